@@ -0,0 +1,87 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"tech-challenge-payment/internal/auth/token"
+	"tech-challenge-payment/internal/bootstrap"
+	"tech-challenge-payment/internal/channels/grpc"
+	"tech-challenge-payment/internal/channels/rest"
+	"tech-challenge-payment/internal/channels/sqs"
+	"tech-challenge-payment/internal/config"
+	"tech-challenge-payment/internal/events"
+	"tech-challenge-payment/internal/health"
+	"tech-challenge-payment/internal/jobs"
+	"tech-challenge-payment/internal/service"
+)
+
+type server interface {
+	Start(ctx context.Context) error
+}
+
+// app is the composition root: one service, one publisher and one hub shared by every channel and job.
+type app struct {
+	rest           server
+	grpc           server
+	consumer       sqs.QueueInterface
+	expiration     jobs.Runner
+	authorization  jobs.Runner
+	reconciliation jobs.Runner
+}
+
+// newApp is the only place the configuration is read from, everything else gets its settings as
+// arguments.
+func newApp(deps bootstrap.Dependencies, cfg config.Config) *app {
+	hub := events.NewHub()
+	paymentSvc := bootstrap.NewPaymentService(deps, hub, cfg)
+	apiKeySvc := service.NewAPIKeyService(deps.APIKeys, deps.Clock, deps.IDs, cfg.APIKey.RotationGrace, cfg.APIKey.LastUsedInterval)
+	consumer := sqs.NewSQS(deps.Session, paymentSvc, cfg.SQS, cfg.Health.HeartbeatTimeout)
+	tokens := token.NewValidator(cfg.Token, deps.Clock)
+
+	checker := health.NewChecker(cfg.Health.Timeout, map[string]health.Check{
+		"mongo":    deps.Database.Ping,
+		"sqs":      consumer.CheckQueues,
+		"consumer": consumer.CheckConsumers,
+	})
+
+	return &app{
+		rest:           rest.New(paymentSvc, apiKeySvc, hub, checker, tokens, deps.Clock, cfg.Server, cfg.SSE.HeartbeatInterval),
+		grpc:           grpc.New(paymentSvc, apiKeySvc, hub, tokens, cfg.GRPC.Port),
+		consumer:       consumer,
+		expiration:     jobs.NewExpiration(paymentSvc, deps.Locks, deps.Clock, deps.IDs, cfg.Expiration.TTL, cfg.Expiration.Interval),
+		authorization:  jobs.NewAuthorization(paymentSvc, deps.Locks, deps.Clock, deps.IDs, cfg.Authorization.CaptureWindow, cfg.Authorization.Interval),
+		reconciliation: jobs.NewReconciliation(paymentSvc, deps.Reports, deps.Locks, deps.Clock, deps.IDs, cfg.Reconciliation.After, cfg.Reconciliation.Interval),
+	}
+}
+
+// run starts every channel and job and blocks until ctx is done or a server fails, in which case
+// the others are stopped too.
+func (a *app) run(ctx context.Context) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	go a.consumer.ReceiveMessage(ctx)
+	go a.expiration.Start(ctx)
+	go a.authorization.Start(ctx)
+	go a.reconciliation.Start(ctx)
+
+	servers := map[string]server{"rest": a.rest, "grpc": a.grpc}
+	stopped := make(chan error, len(servers))
+	for name, srv := range servers {
+		go func(name string, srv server) {
+			if err := srv.Start(ctx); err != nil {
+				stopped <- fmt.Errorf("%s: %w", name, err)
+				return
+			}
+			stopped <- nil
+		}(name, srv)
+	}
+
+	errs := []error{<-stopped}
+	cancel()
+	for i := 1; i < len(servers); i++ {
+		errs = append(errs, <-stopped)
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"strconv"
+	"tech-challenge-payment/internal/bootstrap"
+	"tech-challenge-payment/internal/canonical"
+	"tech-challenge-payment/internal/config"
+	"tech-challenge-payment/internal/integration/aws_session"
+	"tech-challenge-payment/internal/integration/payment_provider"
+	"tech-challenge-payment/internal/repository"
+	"tech-challenge-payment/internal/sqstest"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/notnull-co/cfg"
+	"github.com/stretchr/testify/assert"
+)
+
+type paymentRepoStub struct{ repository.PaymentRepository }
+
+type intentRepoStub struct{ repository.IntentRepository }
+
+type auditRepoStub struct{ repository.AuditRepository }
+
+type apiKeyRepoStub struct{ repository.APIKeyRepository }
+
+type reconciliationRepoStub struct {
+	repository.ReconciliationRepository
+}
+
+type lockRepoStub struct{}
+
+func (lockRepoStub) Acquire(context.Context, string, string, time.Duration) (bool, error) {
+	return false, nil
+}
+
+func (lockRepoStub) Release(context.Context, string, string) error { return nil }
+
+type databaseStub struct{}
+
+func (databaseStub) Ping(context.Context) error { return nil }
+
+func TestRun(t *testing.T) {
+	server := sqstest.NewServer("pending", "payed", "cancelled", "order_cancelled")
+	defer server.Close()
+	loadTestConfig(t, server)
+	deps := newTestDependencies(t, server)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	stopped := make(chan error, 1)
+	go func() { stopped <- newApp(deps, config.Cfg).run(ctx) }()
+
+	base := "http://localhost:" + config.Cfg.Server.Port
+	assert.Eventually(t, func() bool { return status(base+"/livez") == http.StatusOK }, 5*time.Second, 10*time.Millisecond)
+	assert.Eventually(t, func() bool { return status(base+"/readyz") == http.StatusOK }, 5*time.Second, 10*time.Millisecond)
+	assert.Equal(t, http.StatusOK, status(base+"/api/healthz"))
+
+	cancel()
+	select {
+	case err := <-stopped:
+		assert.NoError(t, err)
+	case <-time.After(15 * time.Second):
+		t.Fatal("app did not stop")
+	}
+}
+
+func TestRunStopsWhenAServerFails(t *testing.T) {
+	server := sqstest.NewServer("pending", "payed", "cancelled", "order_cancelled")
+	defer server.Close()
+	loadTestConfig(t, server)
+	deps := newTestDependencies(t, server)
+
+	busy, err := net.Listen("tcp", ":"+config.Cfg.GRPC.Port)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer busy.Close()
+
+	stopped := make(chan error, 1)
+	go func() { stopped <- newApp(deps, config.Cfg).run(context.Background()) }()
+
+	select {
+	case err := <-stopped:
+		assert.ErrorContains(t, err, "grpc")
+	case <-time.After(15 * time.Second):
+		t.Fatal("app did not stop")
+	}
+}
+
+func newTestDependencies(t *testing.T, server *sqstest.Server) bootstrap.Dependencies {
+	return bootstrap.Dependencies{
+		Payments:  paymentRepoStub{},
+		Intents:   intentRepoStub{},
+		Audits:    auditRepoStub{},
+		APIKeys:   apiKeyRepoStub{},
+		Locks:     lockRepoStub{},
+		Reports:   reconciliationRepoStub{},
+		Database:  databaseStub{},
+		Session:   newTestSession(t, server),
+		Providers: payment_provider.NewRouter(nil, payment_provider.NewProvider()),
+		Clock:     canonical.SystemClock(),
+		IDs:       canonical.UUIDGenerator(),
+	}
+}
+
+// loadTestConfig loads the shipped configuration pointed at the fake SQS and free ports.
+func loadTestConfig(t *testing.T, server *sqstest.Server) {
+	previous := config.Cfg
+	t.Cleanup(func() { config.Cfg = previous })
+
+	if err := cfg.Load(&config.Cfg, cfg.Dirs("../../internal/config/")); err != nil {
+		t.Fatal(err)
+	}
+	config.Cfg.Server.Port = freePort(t)
+	config.Cfg.GRPC.Port = freePort(t)
+	config.Cfg.SQS.Endpoint = server.URL
+	config.Cfg.SQS.PaymentPendingQueue = server.QueueURL("pending")
+	config.Cfg.SQS.PaymentPayedQueue = server.QueueURL("payed")
+	config.Cfg.SQS.PaymentCancelledQueue = server.QueueURL("cancelled")
+	config.Cfg.SQS.OrderCancelledQueue = server.QueueURL("order_cancelled")
+}
+
+func newTestSession(t *testing.T, server *sqstest.Server) *session.Session {
+	sess, err := aws_session.New(config.Cfg.SQS.Region, server.URL, false, config.Cfg.SQS.Credentials)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return sess
+}
+
+func freePort(t *testing.T) string {
+	listener, err := net.Listen("tcp", ":0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	return strconv.Itoa(listener.Addr().(*net.TCPAddr).Port)
+}
+
+func status(url string) int {
+	resp, err := http.Get(url)
+	if err != nil {
+		return 0
+	}
+	defer resp.Body.Close()
+	return resp.StatusCode
+}
@@ -0,0 +1,384 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"os/exec"
+	"strings"
+	"tech-challenge-payment/internal/auth/principal"
+	"tech-challenge-payment/internal/bootstrap"
+	"tech-challenge-payment/internal/canonical"
+	"tech-challenge-payment/internal/config"
+	"tech-challenge-payment/internal/integration/payment_provider"
+	"tech-challenge-payment/internal/logging"
+	"tech-challenge-payment/internal/repository"
+	"tech-challenge-payment/internal/repository/memory"
+	"tech-challenge-payment/internal/sqstest"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+)
+
+const (
+	// eventually bounds how long the suite waits for the asynchronous side of a flow
+	eventually = 5 * time.Second
+	tick       = 10 * time.Millisecond
+)
+
+// suite runs the whole service, REST and consumer included, against a fake SQS and either a
+// throwaway mongod, when one is installed, or the in-memory repositories.
+type suite struct {
+	*testing.T
+	sqs  *sqstest.Server
+	base string
+}
+
+func TestIntegrationPaymentPayed(t *testing.T) {
+	s := startSuite(t)
+
+	s.sqs.Send("pending", `"order-payed"`, nil)
+	payment := s.waitPayment("order-payed")
+	assert.Equal(t, canonical.PAYMENT_CREATED, payment.Status)
+	// orders from the pending queue are paid with the default method
+	assert.Equal(t, canonical.METHOD_PIX, payment.Method)
+	if assert.NotNil(t, payment.Details) && assert.NotNil(t, payment.Details.Pix) {
+		assert.NotEmpty(t, payment.Details.Pix.QRCode)
+		assert.Equal(t, payment.CreatedAt.Add(config.Cfg.Expiration.TTL), payment.Details.Pix.ExpiresAt)
+	}
+	s.waitDrained("pending")
+
+	status := s.callback(payment.ID, "OK", "callback-request")
+	assert.Equal(t, http.StatusOK, status)
+
+	events := s.waitEvents("payed", 1)
+	assert.Equal(t, `"order-payed"`, events[0].Body)
+	assert.Equal(t, "callback-request", events[0].Attributes[logging.REQUEST_ID_ATTRIBUTE].StringValue)
+	assert.Equal(t, canonical.PAYMENT_PAYED, s.payment(payment.ID).Status)
+
+	status = s.callback(payment.ID, "NOK", "late-callback")
+	assert.Equal(t, http.StatusConflict, status)
+	assert.Len(t, s.sqs.Messages("payed"), 1)
+	assert.Empty(t, s.sqs.Messages("cancelled"))
+
+	var history []map[string]any
+	assert.Equal(t, http.StatusOK, s.get("/api/payment/"+payment.ID+"/history", &history))
+	if assert.Len(t, history, 2) {
+		assert.Equal(t, "CREATED", history[0]["new_status"])
+		assert.Nil(t, history[0]["previous_status"])
+		assert.Equal(t, "sqs-consumer", history[0]["actor"])
+
+		assert.Equal(t, "CREATED", history[1]["previous_status"])
+		assert.Equal(t, "PAYED", history[1]["new_status"])
+		assert.Equal(t, "provider:log", history[1]["actor"])
+		assert.Equal(t, "callback-request", history[1]["request_id"])
+		assert.Len(t, history[1]["payload_hash"], 64)
+	}
+}
+
+func TestIntegrationPaymentFailed(t *testing.T) {
+	s := startSuite(t)
+
+	s.sqs.Send("pending", `"order-failed"`, nil)
+	payment := s.waitPayment("order-failed")
+
+	assert.Equal(t, http.StatusOK, s.callback(payment.ID, "NOK", "failed-callback"))
+	assert.Equal(t, "OPEN", s.intent("order-failed")["status"])
+
+	// the order is only cancelled once every attempt failed
+	for attempt := 2; attempt <= config.Cfg.Intent.MaxAttempts; attempt++ {
+		assert.Empty(t, s.sqs.Messages("cancelled"))
+		retry, status := s.create("order-failed")
+		if !assert.Equal(t, http.StatusOK, status) {
+			s.FailNow()
+		}
+		assert.Equal(t, attempt, retry.Attempt)
+		assert.Equal(t, http.StatusOK, s.callback(retry.ID, "NOK", "failed-callback"))
+	}
+
+	events := s.waitEvents("cancelled", 1)
+	assert.Equal(t, `"order-failed"`, events[0].Body)
+	assert.Equal(t, string(canonical.REASON_ATTEMPTS_EXHAUSTED), events[0].Attributes["reason"].StringValue)
+	assert.Empty(t, s.sqs.Messages("payed"))
+
+	intent := s.intent("order-failed")
+	assert.Equal(t, "CANCELLED", intent["status"])
+	assert.Equal(t, string(canonical.REASON_ATTEMPTS_EXHAUSTED), intent["reason"])
+	_, status := s.create("order-failed")
+	assert.Equal(t, http.StatusConflict, status)
+}
+
+func TestIntegrationPaymentRetried(t *testing.T) {
+	s := startSuite(t)
+
+	s.sqs.Send("pending", `"order-retried"`, nil)
+	payment := s.waitPayment("order-retried")
+
+	_, status := s.create("order-retried")
+	assert.Equal(t, http.StatusConflict, status)
+
+	assert.Equal(t, http.StatusOK, s.callback(payment.ID, "NOK", "failed-callback"))
+	retry, status := s.create("order-retried")
+	if !assert.Equal(t, http.StatusOK, status) {
+		s.FailNow()
+	}
+	assert.Equal(t, http.StatusOK, s.callback(retry.ID, "OK", "payed-callback"))
+
+	events := s.waitEvents("payed", 1)
+	assert.Equal(t, `"order-retried"`, events[0].Body)
+	assert.Empty(t, s.sqs.Messages("cancelled"))
+	intent := s.intent("order-retried")
+	assert.Equal(t, "SUCCEEDED", intent["status"])
+	assert.EqualValues(t, 2, intent["attempts"])
+}
+
+func TestIntegrationCardCaptured(t *testing.T) {
+	s := startSuite(t)
+
+	var payment canonical.Payment
+	status := s.post("/api/payment/", map[string]any{
+		"order_id": "order-card",
+		"method":   "CREDIT_CARD",
+		"card":     map[string]string{"token": "tok_4242"},
+		"amount":   2500,
+	}, &payment)
+	if !assert.Equal(t, http.StatusOK, status) {
+		s.FailNow()
+	}
+
+	assert.Equal(t, http.StatusOK, s.post("/api/payment/"+payment.ID+"/authorize", nil, &payment))
+	assert.Equal(t, canonical.PAYMENT_AUTHORIZED, payment.Status)
+	// the order is only payed once the kitchen accepts it
+	assert.Empty(t, s.sqs.Messages("payed"))
+
+	assert.Equal(t, http.StatusBadRequest, s.post("/api/payment/"+payment.ID+"/capture", map[string]int64{"amount": 3000}, nil))
+	assert.Equal(t, http.StatusOK, s.post("/api/payment/"+payment.ID+"/capture", map[string]int64{"amount": 1800}, &payment))
+	assert.Equal(t, canonical.PAYMENT_PAYED, payment.Status)
+
+	events := s.waitEvents("payed", 1)
+	assert.Equal(t, `"order-card"`, events[0].Body)
+	stored := s.payment(payment.ID)
+	assert.Equal(t, int64(2500), stored.Amount)
+	assert.Equal(t, int64(1800), stored.CapturedAmount)
+	assert.Equal(t, http.StatusConflict, s.post("/api/payment/"+payment.ID+"/capture", nil, nil))
+}
+
+func TestIntegrationOrderCancelled(t *testing.T) {
+	s := startSuite(t)
+
+	s.sqs.Send("pending", `"order-cancelled"`, nil)
+	payment := s.waitPayment("order-cancelled")
+
+	s.sqs.Send("order_cancelled", `"order-cancelled"`, nil)
+
+	events := s.waitEvents("cancelled", 1)
+	assert.Equal(t, `"order-cancelled"`, events[0].Body)
+	assert.Equal(t, string(canonical.REASON_ORDER_CANCELLED), events[0].Attributes["reason"].StringValue)
+	assert.Equal(t, canonical.PAYMENT_CANCELLED, s.payment(payment.ID).Status)
+	s.waitDrained("order_cancelled")
+}
+
+func startSuite(t *testing.T) *suite {
+	if testing.Short() {
+		t.Skip("integration suite skipped in short mode")
+	}
+
+	server := sqstest.NewServer("pending", "payed", "cancelled", "order_cancelled")
+	t.Cleanup(server.Close)
+	loadTestConfig(t, server)
+	config.Cfg.SQS.PollInterval = tick
+
+	deps := bootstrap.Dependencies{
+		Session:   newTestSession(t, server),
+		Providers: payment_provider.NewRouter(nil, payment_provider.NewProvider()),
+		Clock:     canonical.SystemClock(),
+		IDs:       canonical.UUIDGenerator(),
+	}
+	if mongod, err := exec.LookPath("mongod"); err == nil {
+		useMongo(t, &deps, mongod)
+	} else {
+		t.Log("mongod not found, using the in-memory repositories")
+		deps.Payments = memory.NewPaymentRepo()
+		deps.Intents = memory.NewIntentRepo()
+		deps.Audits = memory.NewAuditRepo()
+		deps.APIKeys = memory.NewAPIKeyRepo()
+		deps.Locks = memory.NewLockRepo(deps.Clock)
+		deps.Reports = memory.NewReconciliationRepo()
+		deps.Database = memory.NewHealthRepo()
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	stopped := make(chan error, 1)
+	go func() { stopped <- newApp(deps, config.Cfg).run(ctx) }()
+	t.Cleanup(func() {
+		cancel()
+		select {
+		case err := <-stopped:
+			assert.NoError(t, err)
+		case <-time.After(15 * time.Second):
+			t.Error("app did not stop")
+		}
+	})
+
+	s := &suite{T: t, sqs: server, base: "http://localhost:" + config.Cfg.Server.Port}
+	if !assert.Eventually(t, func() bool { return status(s.base+"/readyz") == http.StatusOK }, eventually, tick) {
+		t.FailNow()
+	}
+	return s
+}
+
+// useMongo points the repositories at a mongod started on a free port with an empty data directory.
+func useMongo(t *testing.T, deps *bootstrap.Dependencies, mongod string) {
+	port := freePort(t)
+	cmd := exec.Command(mongod, "--dbpath", t.TempDir(), "--port", port, "--bind_ip", "127.0.0.1", "--quiet")
+	if err := cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		_ = cmd.Process.Kill()
+		_ = cmd.Wait()
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	db, err := repository.NewMongo(ctx, "mongodb://127.0.0.1:"+port+"/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = db.Client().Disconnect(context.Background()) })
+
+	deps.Payments = repository.NewPaymentRepo(db)
+	deps.Intents = repository.NewIntentRepo(db)
+	deps.Audits = repository.NewAuditRepo(db)
+	deps.APIKeys = repository.NewAPIKeyRepo(db)
+	deps.Locks = repository.NewLockRepo(db, deps.Clock)
+	deps.Reports = repository.NewReconciliationRepo(db)
+	deps.Database = repository.NewHealthRepo(db)
+
+	if err := deps.Database.Ping(ctx); err != nil {
+		t.Fatal(err)
+	}
+	t.Log("using mongod at " + mongod)
+}
+
+// waitPayment waits for the consumer to create the payment of the order.
+func (s *suite) waitPayment(orderID string) canonical.Payment {
+	var found canonical.Payment
+	ok := assert.Eventually(s, func() bool {
+		var payments []canonical.Payment
+		s.get("/api/payment/", &payments)
+		for _, payment := range payments {
+			if payment.OrderID == orderID {
+				found = payment
+				return true
+			}
+		}
+		return false
+	}, eventually, tick)
+	if !ok {
+		s.FailNow()
+	}
+	return found
+}
+
+// waitEvents waits for count messages published to the queue.
+func (s *suite) waitEvents(queue string, count int) []sqstest.Message {
+	if !assert.Eventually(s, func() bool { return len(s.sqs.Messages(queue)) >= count }, eventually, tick) {
+		s.FailNow()
+	}
+	return s.sqs.Messages(queue)
+}
+
+// waitDrained waits for the consumer to delete every message of the queue.
+func (s *suite) waitDrained(queue string) {
+	assert.Eventually(s, func() bool { return len(s.sqs.Messages(queue)) == 0 }, eventually, tick)
+}
+
+func (s *suite) payment(id string) canonical.Payment {
+	var payment canonical.Payment
+	assert.Equal(s, http.StatusOK, s.get("/api/payment/"+id, &payment))
+	return payment
+}
+
+// get reads as an admin, listing every payment is only allowed to them.
+func (s *suite) get(path string, out any) int {
+	request, err := http.NewRequest(http.MethodGet, s.base+path, nil)
+	if err != nil {
+		s.Fatal(err)
+	}
+	return s.do(request, out, principal.SCOPE_READ, principal.SCOPE_ADMIN)
+}
+
+// create starts a new attempt to pay the order.
+func (s *suite) create(orderID string) (canonical.Payment, int) {
+	var payment canonical.Payment
+	status := s.post("/api/payment/", map[string]string{"order_id": orderID}, &payment)
+	return payment, status
+}
+
+// post writes as the order service does.
+func (s *suite) post(path string, in, out any) int {
+	body, err := json.Marshal(in)
+	if err != nil {
+		s.Fatal(err)
+	}
+	request, err := http.NewRequest(http.MethodPost, s.base+path, bytes.NewReader(body))
+	if err != nil {
+		s.Fatal(err)
+	}
+	request.Header.Set("Content-Type", "application/json")
+
+	return s.do(request, out, principal.SCOPE_WRITE)
+}
+
+func (s *suite) intent(orderID string) map[string]any {
+	var intent map[string]any
+	assert.Equal(s, http.StatusOK, s.get("/api/payment/intents/"+orderID, &intent))
+	return intent
+}
+
+func (s *suite) callback(paymentID, status, requestID string) int {
+	body, err := json.Marshal(map[string]string{"payment_id": paymentID, "status": status})
+	if err != nil {
+		s.Fatal(err)
+	}
+	request, err := http.NewRequest(http.MethodPost, s.base+"/api/payment/callback", bytes.NewReader(body))
+	if err != nil {
+		s.Fatal(err)
+	}
+	request.Header.Set("Content-Type", "application/json")
+	request.Header.Set(logging.REQUEST_ID_HEADER, requestID)
+	return s.do(request, nil, principal.SCOPE_CALLBACK)
+}
+
+func (s *suite) do(request *http.Request, out any, scopes ...string) int {
+	request.Header.Set("Authorization", "Bearer "+s.token(scopes...))
+
+	response, err := http.DefaultClient.Do(request)
+	if err != nil {
+		s.Fatal(err)
+	}
+	defer response.Body.Close()
+
+	if out != nil && response.StatusCode == http.StatusOK {
+		if err := json.NewDecoder(response.Body).Decode(out); err != nil {
+			s.Fatal(err)
+		}
+	}
+	return response.StatusCode
+}
+
+func (s *suite) token(scopes ...string) string {
+	signed, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"sub":   "integration",
+		"scope": strings.Join(scopes, " "),
+		"exp":   time.Now().Add(time.Hour).Unix(),
+	}).SignedString([]byte(config.Cfg.Token.Key))
+	if err != nil {
+		s.Fatal(err)
+	}
+	return signed
+}
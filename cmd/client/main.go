@@ -1,22 +1,87 @@
 package main
 
 import (
-	"tech-challenge-payment/internal/channels/rest"
-	"tech-challenge-payment/internal/channels/sqs"
+	"context"
+	"flag"
+	"os"
+	"os/signal"
+	"syscall"
+	"tech-challenge-payment/internal/bootstrap"
 	"tech-challenge-payment/internal/config"
+	"tech-challenge-payment/internal/repository"
+	"tech-challenge-payment/internal/tracing"
 
 	"github.com/rs/zerolog/log"
 )
 
+var rebuildProjections = flag.Bool("rebuild-projections", false, "Rebuild the payments from their event log and exit")
+
 func main() {
 	config.ParseFromFlags()
 
-	log.Info().Any("config", config.Get()).Msg("configuration file")
-	go func() {
-		sqs.NewSQS().ReceiveMessage()
+	log.Info().Any("config", config.Get().Redacted()).Msg("configuration file")
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	if *rebuildProjections {
+		if err := rebuild(ctx); err != nil {
+			log.Fatal().Err(err).Msg("an error occurred when rebuild the payment projections")
+		}
+		return
+	}
+
+	if err := serve(ctx); err != nil {
+		log.Fatal().Err(err).Msg("an error occurred when running the service")
+	}
+
+	log.Info().Msg("service stopped")
+}
+
+// serve runs the service until ctx is done, flushing traces and closing connections on the way out.
+func serve(ctx context.Context) error {
+	cfg := config.Get()
+
+	shutdown, err := tracing.Init(ctx, cfg.Tracing)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err := shutdown(context.Background()); err != nil {
+			log.Err(err).Msg("an error occurred when flush traces")
+		}
+	}()
+
+	deps, disconnect, err := bootstrap.Connect(ctx, cfg)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err := disconnect(context.Background()); err != nil {
+			log.Err(err).Msg("an error occurred when disconnect from mongo")
+		}
+	}()
+
+	return newApp(deps, cfg).run(ctx)
+}
+
+// rebuild saves every payment again as folded from its event log, without starting the service.
+func rebuild(ctx context.Context) error {
+	db, err := repository.NewMongo(ctx, config.Get().DB.ConnectionString)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err := db.Client().Disconnect(context.Background()); err != nil {
+			log.Err(err).Msg("an error occurred when disconnect from mongo")
+		}
 	}()
 
-	if err := rest.New().Start(); err != nil {
-		log.Fatal().Err(err).Msg("an error occurred in rest channel")
+	saved, err := repository.NewPaymentProjector(db).Rebuild(ctx)
+	if err != nil {
+		return err
 	}
+
+	log.Info().Int("payments", saved).Msg("payment projections rebuilt")
+	return nil
 }
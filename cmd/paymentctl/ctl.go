@@ -0,0 +1,202 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"strings"
+	"tech-challenge-payment/internal/canonical"
+	"tech-challenge-payment/internal/service"
+	"time"
+)
+
+// ErrorUsage is returned when the command line is wrong, after the usage was printed.
+var ErrorUsage = errors.New("invalid usage")
+
+const usage = `usage: paymentctl [-config-dir dir] [-operator name] <command> [flags] [id]
+
+commands:
+  get <id>                               show a payment
+  list [filters]                         list the payments matching every filter, oldest first
+  force -status S -reason R <id>         force the status of a payment, the reason is kept in its audit trail
+  republish <id>                         send the event that settled the order of a payment again
+
+every command takes -output table|json|csv, table by default
+
+changes are sent to the order service queues as usual, but not to the clients
+watching the payment on the servers' event streams (SSE and gRPC), which only
+hear about changes made by their own server
+`
+
+// ctl runs the commands of the operators through the payment service, printing the payments
+// they read or change to out and the usage to errOut.
+type ctl struct {
+	paymentSvc service.PaymentService
+	out        io.Writer
+	errOut     io.Writer
+}
+
+type command func(c *ctl, ctx context.Context, args []string) error
+
+var commands = map[string]command{
+	"get":       (*ctl).get,
+	"list":      (*ctl).list,
+	"force":     (*ctl).force,
+	"republish": (*ctl).republish,
+}
+
+func (c *ctl) run(ctx context.Context, args []string) error {
+	if len(args) == 0 {
+		fmt.Fprint(c.errOut, usage)
+		return ErrorUsage
+	}
+
+	cmd, ok := commands[args[0]]
+	if !ok {
+		fmt.Fprintf(c.errOut, "unknown command %q\n\n%s", args[0], usage)
+		return ErrorUsage
+	}
+
+	return cmd(c, ctx, args[1:])
+}
+
+// flags starts the flag set of a command with the output flag every command takes.
+func (c *ctl) flags(name string) (*flag.FlagSet, *string) {
+	flags := flag.NewFlagSet(name, flag.ContinueOnError)
+	flags.SetOutput(c.errOut)
+	flags.Usage = func() {
+		fmt.Fprintf(c.errOut, "usage of %s:\n", name)
+		flags.PrintDefaults()
+	}
+	output := flags.String("output", OUTPUT_TABLE, "Output format: table, json or csv")
+	return flags, output
+}
+
+// parse checks the command line of a command, want is the number of arguments after the flags.
+func (c *ctl) parse(flags *flag.FlagSet, output *string, args []string, want int) error {
+	if err := flags.Parse(args); err != nil {
+		return ErrorUsage
+	}
+	if flags.NArg() != want {
+		flags.Usage()
+		return ErrorUsage
+	}
+	return validOutput(*output)
+}
+
+func (c *ctl) get(ctx context.Context, args []string) error {
+	flags, output := c.flags("get")
+	if err := c.parse(flags, output, args, 1); err != nil {
+		return err
+	}
+
+	payment, err := c.paymentSvc.GetByID(ctx, flags.Arg(0))
+	if err != nil {
+		return err
+	}
+	if payment == nil {
+		return canonical.ErrorNotFound
+	}
+
+	return write(c.out, *output, []canonical.Payment{*payment})
+}
+
+func (c *ctl) list(ctx context.Context, args []string) error {
+	flags, output := c.flags("list")
+	status := flags.String("status", "", "Status, e.g. CREATED, AUTHORIZED, PAYED, FAILED, CANCELLED, EXPIRED or REFUNDED")
+	orderID := flags.String("order", "", "Order id")
+	customerID := flags.String("customer", "", "Customer id")
+	method := flags.String("method", "", "Method, e.g. PIX or CREDIT_CARD")
+	from := flags.String("from", "", "Created at or after, RFC 3339")
+	to := flags.String("to", "", "Created before, RFC 3339")
+	limit := flags.Int("limit", 100, "Maximum number of payments, 0 lists them all")
+	if err := c.parse(flags, output, args, 0); err != nil {
+		return err
+	}
+
+	filter := canonical.PaymentFilter{OrderID: *orderID, CustomerID: *customerID, Limit: *limit}
+	if len(*status) > 0 {
+		parsed, err := parseStatus(*status)
+		if err != nil {
+			return err
+		}
+		filter.Status = &parsed
+	}
+	if len(*method) > 0 {
+		parsed, ok := canonical.MapPaymentMethod[strings.ToUpper(*method)]
+		if !ok {
+			return fmt.Errorf("unknown method %q", *method)
+		}
+		filter.Method = parsed
+	}
+	var err error
+	if filter.CreatedFrom, err = parseTime("from", *from); err != nil {
+		return err
+	}
+	if filter.CreatedTo, err = parseTime("to", *to); err != nil {
+		return err
+	}
+
+	payments, err := c.paymentSvc.Search(ctx, filter)
+	if err != nil {
+		return err
+	}
+
+	return write(c.out, *output, payments)
+}
+
+func (c *ctl) force(ctx context.Context, args []string) error {
+	flags, output := c.flags("force")
+	status := flags.String("status", "", "Status to force, required")
+	reason := flags.String("reason", "", "Why the status is forced, required and kept in the audit trail")
+	if err := c.parse(flags, output, args, 1); err != nil {
+		return err
+	}
+
+	parsed, err := parseStatus(*status)
+	if err != nil {
+		return err
+	}
+
+	payment, err := c.paymentSvc.ForceStatus(ctx, flags.Arg(0), parsed, *reason)
+	if err != nil {
+		return err
+	}
+
+	return write(c.out, *output, []canonical.Payment{*payment})
+}
+
+func (c *ctl) republish(ctx context.Context, args []string) error {
+	flags, output := c.flags("republish")
+	if err := c.parse(flags, output, args, 1); err != nil {
+		return err
+	}
+
+	payment, err := c.paymentSvc.Republish(ctx, flags.Arg(0))
+	if err != nil {
+		return err
+	}
+
+	return write(c.out, *output, []canonical.Payment{*payment})
+}
+
+func parseStatus(name string) (canonical.PaymentStatus, error) {
+	status, ok := canonical.ParsePaymentStatus(strings.ToUpper(name))
+	if !ok {
+		return status, fmt.Errorf("unknown status %q", name)
+	}
+	return status, nil
+}
+
+func parseTime(name, value string) (time.Time, error) {
+	if len(value) == 0 {
+		return time.Time{}, nil
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return t, fmt.Errorf("-%s must be an RFC 3339 time: %w", name, err)
+	}
+	return t, nil
+}
@@ -0,0 +1,206 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"sync"
+	"tech-challenge-payment/internal/canonical"
+	"tech-challenge-payment/internal/canonical/canonicaltest"
+	"tech-challenge-payment/internal/config"
+	"tech-challenge-payment/internal/events"
+	"tech-challenge-payment/internal/integration/payment_provider"
+	"tech-challenge-payment/internal/repository"
+	"tech-challenge-payment/internal/repository/memory"
+	"tech-challenge-payment/internal/service"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var now = time.Date(2020, 11, 1, 12, 0, 0, 0, time.UTC)
+
+type message struct {
+	body       any
+	queue      string
+	attributes map[string]string
+}
+
+// publisherStub records the messages instead of sending them.
+type publisherStub struct {
+	mu       sync.Mutex
+	messages []message
+}
+
+func (p *publisherStub) SendMessage(ctx context.Context, inputMsg any, queueURL string) error {
+	return p.SendMessageWithAttributes(ctx, inputMsg, queueURL, nil)
+}
+
+func (p *publisherStub) SendMessageWithAttributes(ctx context.Context, inputMsg any, queueURL string, attributes map[string]string) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.messages = append(p.messages, message{body: inputMsg, queue: queueURL, attributes: attributes})
+	return nil
+}
+
+type fixture struct {
+	ctl       *ctl
+	out       *bytes.Buffer
+	payments  repository.PaymentRepository
+	audits    repository.AuditRepository
+	publisher *publisherStub
+}
+
+func newFixture(t *testing.T, payments ...canonical.Payment) *fixture {
+	var cfg config.Config
+	cfg.SQS.PaymentPayedQueue = "payed"
+	cfg.SQS.PaymentCancelledQueue = "cancelled"
+
+	f := &fixture{
+		out:       &bytes.Buffer{},
+		payments:  memory.NewPaymentRepo(),
+		audits:    memory.NewAuditRepo(),
+		publisher: &publisherStub{},
+	}
+	for _, payment := range payments {
+		if _, err := f.payments.Create(context.Background(), payment); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	paymentSvc := service.NewPaymentService(f.payments, memory.NewIntentRepo(), f.audits, f.publisher,
+		payment_provider.NewRouter(nil, payment_provider.NewProvider()), events.NewHub(),
+		canonicaltest.NewClock(now), canonicaltest.NewIDs("audit"), cfg)
+	f.ctl = &ctl{paymentSvc: paymentSvc, out: f.out, errOut: &bytes.Buffer{}}
+	return f
+}
+
+func (f *fixture) run(args ...string) error {
+	f.out.Reset()
+	return f.ctl.run(service.WithActor(context.Background(), service.ACTOR_OPERATOR_PREFIX+"alice"), args)
+}
+
+func (f *fixture) rows(t *testing.T) []row {
+	var rows []row
+	if err := json.Unmarshal(f.out.Bytes(), &rows); err != nil {
+		t.Fatal(err)
+	}
+	return rows
+}
+
+func TestGet(t *testing.T) {
+	f := newFixture(t, canonical.Payment{ID: "1234", OrderID: "order", Method: canonical.METHOD_PIX, CreatedAt: now})
+
+	assert.NoError(t, f.run("get", "-output", "json", "1234"))
+	rows := f.rows(t)
+	assert.Len(t, rows, 1)
+	assert.Equal(t, "1234", rows[0].ID)
+	assert.Equal(t, "CREATED", rows[0].Status)
+	assert.Equal(t, "PIX", rows[0].Method)
+
+	assert.ErrorIs(t, f.run("get", "missing"), canonical.ErrorNotFound)
+}
+
+func TestList(t *testing.T) {
+	f := newFixture(t,
+		canonical.Payment{ID: "1", OrderID: "order-1", CustomerID: "alice", Method: canonical.METHOD_PIX, CreatedAt: now.Add(-2 * time.Hour)},
+		canonical.Payment{ID: "2", OrderID: "order-2", CustomerID: "alice", Method: canonical.METHOD_CASH, CreatedAt: now.Add(-time.Hour)},
+		canonical.Payment{ID: "3", OrderID: "order-3", CustomerID: "bob", Method: canonical.METHOD_PIX, CreatedAt: now},
+	)
+
+	tests := map[string]struct {
+		given    []string
+		expected []string
+	}{
+		"given no filter, must list every payment oldest first": {
+			given:    []string{},
+			expected: []string{"1", "2", "3"},
+		},
+		"given customer and method, must list the payments matching both": {
+			given:    []string{"-customer", "alice", "-method", "pix"},
+			expected: []string{"1"},
+		},
+		"given a creation range, must list the payments created within it": {
+			given:    []string{"-from", now.Add(-time.Hour).Format(time.RFC3339), "-to", now.Format(time.RFC3339)},
+			expected: []string{"2"},
+		},
+		"given a limit, must list only the oldest payments": {
+			given:    []string{"-limit", "2"},
+			expected: []string{"1", "2"},
+		},
+		"given a status no payment has, must list nothing": {
+			given:    []string{"-status", "payed"},
+			expected: []string{},
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			assert.NoError(t, f.run(append([]string{"list", "-output", "json"}, tc.given...)...))
+
+			ids := []string{}
+			for _, r := range f.rows(t) {
+				ids = append(ids, r.ID)
+			}
+			assert.Equal(t, tc.expected, ids)
+		})
+	}
+}
+
+func TestForce(t *testing.T) {
+	f := newFixture(t, canonical.Payment{ID: "1234", OrderID: "order", Method: canonical.METHOD_PIX, CreatedAt: now})
+
+	assert.ErrorIs(t, f.run("force", "-status", "PAYED", "1234"), canonical.ErrorReasonRequired)
+	assert.ErrorContains(t, f.run("force", "-status", "SETTLED", "-reason", "typo", "1234"), "unknown status")
+
+	assert.NoError(t, f.run("force", "-status", "PAYED", "-reason", "provider confirmed by phone", "-output", "json", "1234"))
+	assert.Equal(t, "PAYED", f.rows(t)[0].Status)
+	assert.Equal(t, "FORCED", f.rows(t)[0].Reason)
+
+	entries, err := f.audits.GetByPaymentID(context.Background(), "1234")
+	assert.NoError(t, err)
+	forced := entries[len(entries)-1]
+	assert.Equal(t, "operator:alice", forced.Actor)
+	assert.Equal(t, "provider confirmed by phone", forced.Note)
+	assert.Equal(t, canonical.PAYMENT_PAYED, forced.NewStatus)
+	assert.Len(t, f.publisher.messages, 1)
+	assert.Equal(t, "payed", f.publisher.messages[0].queue)
+}
+
+func TestRepublish(t *testing.T) {
+	f := newFixture(t, canonical.Payment{ID: "1234", OrderID: "order", Method: canonical.METHOD_PIX, CreatedAt: now})
+
+	assert.ErrorIs(t, f.run("republish", "1234"), canonical.ErrorInvalidTransition)
+
+	assert.NoError(t, f.payments.UpdateFromStatus(context.Background(), "1234", canonical.PAYMENT_CREATED, canonical.Payment{
+		Status: canonical.PAYMENT_CANCELLED, Reason: canonical.REASON_ORDER_CANCELLED, UpdatedAt: now,
+	}))
+	assert.NoError(t, f.run("republish", "1234"))
+
+	assert.Equal(t, []message{{
+		body:       "order",
+		queue:      "cancelled",
+		attributes: map[string]string{service.REASON_ATTRIBUTE: string(canonical.REASON_ORDER_CANCELLED)},
+	}}, f.publisher.messages)
+}
+
+func TestUsage(t *testing.T) {
+	f := newFixture(t)
+
+	tests := map[string][]string{
+		"given no command":         {},
+		"given unknown command":    {"delete", "1234"},
+		"given missing id":         {"get"},
+		"given unknown flag":       {"list", "-verbose"},
+		"given too many arguments": {"republish", "1234", "5678"},
+	}
+
+	for name, args := range tests {
+		t.Run(name, func(t *testing.T) {
+			assert.ErrorIs(t, f.run(args...), ErrorUsage)
+		})
+	}
+
+	assert.ErrorContains(t, f.run("list", "-output", "yaml"), "unknown output")
+}
@@ -0,0 +1,69 @@
+// paymentctl lets operators look into and fix payments through the payment service, instead of
+// changing the database by hand. Every change it makes goes through the same rules, audit trail
+// and queues as the service's own.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"os/user"
+	"syscall"
+	"tech-challenge-payment/internal/bootstrap"
+	"tech-challenge-payment/internal/config"
+	"tech-challenge-payment/internal/events"
+	"tech-challenge-payment/internal/service"
+
+	"github.com/rs/zerolog/log"
+)
+
+var operator = flag.String("operator", "", "Name recorded as the actor of the changes in the audit trail, the current user by default")
+
+func main() {
+	config.ParseFromFlags()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	err := run(ctx, flag.Args())
+	if errors.Is(err, ErrorUsage) {
+		os.Exit(2)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "paymentctl:", err)
+		os.Exit(1)
+	}
+}
+
+func run(ctx context.Context, args []string) error {
+	cfg := config.Get()
+	deps, disconnect, err := bootstrap.Connect(ctx, cfg)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err := disconnect(context.Background()); err != nil {
+			log.Err(err).Msg("an error occurred when disconnect from mongo")
+		}
+	}()
+
+	// nobody watches the payments from this process, the hub only keeps the service whole. The
+	// hubs of the servers live in their own processes, so their watchers miss these changes.
+	paymentSvc := bootstrap.NewPaymentService(deps, events.NewHub(), cfg)
+
+	c := &ctl{paymentSvc: paymentSvc, out: os.Stdout, errOut: os.Stderr}
+	return c.run(service.WithActor(ctx, service.ACTOR_OPERATOR_PREFIX+operatorName()), args)
+}
+
+func operatorName() string {
+	if len(*operator) > 0 {
+		return *operator
+	}
+	if current, err := user.Current(); err == nil && len(current.Username) > 0 {
+		return current.Username
+	}
+	return "unknown"
+}
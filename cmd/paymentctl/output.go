@@ -0,0 +1,114 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"tech-challenge-payment/internal/canonical"
+	"text/tabwriter"
+	"time"
+)
+
+const (
+	OUTPUT_TABLE = "table"
+	OUTPUT_JSON  = "json"
+	OUTPUT_CSV   = "csv"
+)
+
+var columns = []string{"id", "order_id", "customer_id", "method", "status", "reason", "attempt", "amount", "captured_amount", "created_at", "updated_at"}
+
+// row is a payment as operators read it, with its enums by name.
+type row struct {
+	ID             string `json:"id"`
+	OrderID        string `json:"order_id"`
+	CustomerID     string `json:"customer_id"`
+	Method         string `json:"method"`
+	Status         string `json:"status"`
+	Reason         string `json:"reason"`
+	Attempt        int    `json:"attempt"`
+	Amount         int64  `json:"amount"`
+	CapturedAmount int64  `json:"captured_amount"`
+	CreatedAt      string `json:"created_at"`
+	UpdatedAt      string `json:"updated_at"`
+}
+
+func toRow(payment canonical.Payment) row {
+	return row{
+		ID:             payment.ID,
+		OrderID:        payment.OrderID,
+		CustomerID:     payment.CustomerID,
+		Method:         payment.Method.String(),
+		Status:         payment.Status.String(),
+		Reason:         string(payment.Reason),
+		Attempt:        payment.Attempt,
+		Amount:         payment.Amount,
+		CapturedAmount: payment.CapturedAmount,
+		CreatedAt:      formatTime(payment.CreatedAt),
+		UpdatedAt:      formatTime(payment.UpdatedAt),
+	}
+}
+
+// values follow the order of columns.
+func (r row) values() []string {
+	return []string{
+		r.ID, r.OrderID, r.CustomerID, r.Method, r.Status, r.Reason,
+		strconv.Itoa(r.Attempt), strconv.FormatInt(r.Amount, 10), strconv.FormatInt(r.CapturedAmount, 10),
+		r.CreatedAt, r.UpdatedAt,
+	}
+}
+
+func formatTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.UTC().Format(time.RFC3339)
+}
+
+func validOutput(format string) error {
+	switch format {
+	case OUTPUT_TABLE, OUTPUT_JSON, OUTPUT_CSV:
+		return nil
+	default:
+		return fmt.Errorf("unknown output %q, must be one of %s, %s, %s", format, OUTPUT_TABLE, OUTPUT_JSON, OUTPUT_CSV)
+	}
+}
+
+// write prints the payments in the format, JSON always prints a list even for a single payment
+// so scripts read every command the same way.
+func write(out io.Writer, format string, payments []canonical.Payment) error {
+	rows := make([]row, 0, len(payments))
+	for _, payment := range payments {
+		rows = append(rows, toRow(payment))
+	}
+
+	switch format {
+	case OUTPUT_JSON:
+		encoder := json.NewEncoder(out)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(rows)
+	case OUTPUT_CSV:
+		writer := csv.NewWriter(out)
+		if err := writer.Write(columns); err != nil {
+			return err
+		}
+		for _, r := range rows {
+			if err := writer.Write(r.values()); err != nil {
+				return err
+			}
+		}
+		writer.Flush()
+		return writer.Error()
+	case OUTPUT_TABLE:
+		writer := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(writer, strings.ToUpper(strings.Join(columns, "\t")))
+		for _, r := range rows {
+			fmt.Fprintln(writer, strings.Join(r.values(), "\t"))
+		}
+		return writer.Flush()
+	default:
+		return validOutput(format)
+	}
+}
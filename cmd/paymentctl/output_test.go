@@ -0,0 +1,62 @@
+package main
+
+import (
+	"bytes"
+	"tech-challenge-payment/internal/canonical"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWrite(t *testing.T) {
+	payments := []canonical.Payment{{
+		ID: "1234", OrderID: "order", CustomerID: "alice", Method: canonical.METHOD_CREDIT_CARD, Status: canonical.PAYMENT_PAYED,
+		Attempt: 1, Amount: 2500, CapturedAmount: 1800, CreatedAt: now,
+	}}
+
+	tests := map[string]struct {
+		given    string
+		expected string
+	}{
+		"given table, must align the columns under their headers": {
+			given: OUTPUT_TABLE,
+			expected: "ID    ORDER_ID  CUSTOMER_ID  METHOD       STATUS  REASON  ATTEMPT  AMOUNT  CAPTURED_AMOUNT  CREATED_AT            UPDATED_AT\n" +
+				"1234  order     alice        CREDIT_CARD  PAYED           1        2500    1800             2020-11-01T12:00:00Z  \n",
+		},
+		"given csv, must write a header and a record per payment": {
+			given: OUTPUT_CSV,
+			expected: "id,order_id,customer_id,method,status,reason,attempt,amount,captured_amount,created_at,updated_at\n" +
+				"1234,order,alice,CREDIT_CARD,PAYED,,1,2500,1800,2020-11-01T12:00:00Z,\n",
+		},
+		"given json, must write a list of payments": {
+			given: OUTPUT_JSON,
+			expected: `[
+  {
+    "id": "1234",
+    "order_id": "order",
+    "customer_id": "alice",
+    "method": "CREDIT_CARD",
+    "status": "PAYED",
+    "reason": "",
+    "attempt": 1,
+    "amount": 2500,
+    "captured_amount": 1800,
+    "created_at": "2020-11-01T12:00:00Z",
+    "updated_at": ""
+  }
+]
+`,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			var out bytes.Buffer
+
+			assert.NoError(t, write(&out, tc.given, payments))
+			assert.Equal(t, tc.expected, out.String())
+		})
+	}
+
+	assert.Error(t, write(&bytes.Buffer{}, "yaml", payments))
+}
@@ -0,0 +1,55 @@
+package apikey
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"strings"
+)
+
+const (
+	// secretSize is the number of random bytes of a key, enough to make a plain hash safe to store.
+	secretSize = 32
+	separator  = "."
+)
+
+var (
+	ErrInvalidKey = errors.New("api key is invalid")
+	ErrKeyExpired = errors.New("api key is expired")
+	ErrKeyRevoked = errors.New("api key was revoked")
+)
+
+// Generate returns a new key for id in the form "<id>.<secret>" and the hash of its secret.
+// Only the hash is stored, the key is shown once to whoever created it.
+func Generate(id string) (key string, hash string, err error) {
+	secret := make([]byte, secretSize)
+	if _, err := rand.Read(secret); err != nil {
+		return "", "", err
+	}
+
+	encoded := base64.RawURLEncoding.EncodeToString(secret)
+
+	return id + separator + encoded, Hash(encoded), nil
+}
+
+// Parse splits a key into the id used to look it up and the secret to verify.
+func Parse(key string) (id string, secret string, err error) {
+	id, secret, found := strings.Cut(key, separator)
+	if !found || len(id) == 0 || len(secret) == 0 {
+		return "", "", ErrInvalidKey
+	}
+
+	return id, secret, nil
+}
+
+func Hash(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+func Verify(hash, secret string) bool {
+	return subtle.ConstantTimeCompare([]byte(hash), []byte(Hash(secret))) == 1
+}
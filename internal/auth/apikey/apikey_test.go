@@ -0,0 +1,42 @@
+package apikey
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGenerate(t *testing.T) {
+	key, hash, err := Generate("1234")
+	assert.NoError(t, err)
+	assert.NotContains(t, hash, key)
+
+	id, secret, err := Parse(key)
+	assert.NoError(t, err)
+	assert.Equal(t, "1234", id)
+	assert.True(t, Verify(hash, secret))
+	assert.False(t, Verify(hash, secret+"x"))
+
+	other, _, err := Generate("1234")
+	assert.NoError(t, err)
+	assert.NotEqual(t, key, other)
+}
+
+func TestParse(t *testing.T) {
+	tests := map[string]struct {
+		given    string
+		expected error
+	}{
+		"given key with id and secret, must parse it": {given: "1234.secret"},
+		"given key without separator, must reject it": {given: "1234secret", expected: ErrInvalidKey},
+		"given key without id, must reject it":        {given: ".secret", expected: ErrInvalidKey},
+		"given key without secret, must reject it":    {given: "1234.", expected: ErrInvalidKey},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			_, _, err := Parse(tc.given)
+			assert.Equal(t, tc.expected, err)
+		})
+	}
+}
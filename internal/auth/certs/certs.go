@@ -0,0 +1,213 @@
+package certs
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"tech-challenge-payment/internal/auth/principal"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	CLIENT_AUTH_NONE     = "none"
+	CLIENT_AUTH_OPTIONAL = "optional"
+	CLIENT_AUTH_REQUIRE  = "require"
+)
+
+var (
+	ErrInvalidClientAuth = errors.New("client auth must be none, optional or require")
+	ErrNoClientCA        = errors.New("client certificate verification needs a client CA bundle")
+)
+
+type stamp struct {
+	modTime time.Time
+	size    int64
+}
+
+// Reloader serves the server certificate and the client CA bundle from disk and picks up new
+// versions of the files without a restart, so certificates can be renewed in place.
+type Reloader struct {
+	certFile   string
+	keyFile    string
+	caFile     string
+	clientAuth tls.ClientAuthType
+
+	mu     sync.RWMutex
+	cert   *tls.Certificate
+	pool   *x509.CertPool
+	stamps map[string]stamp
+}
+
+// NewReloader loads the files once and fails when they can not be used, caFile may be empty when clients are not verified.
+func NewReloader(certFile, keyFile, caFile, clientAuth string) (*Reloader, error) {
+	authType, err := parseClientAuth(clientAuth)
+	if err != nil {
+		return nil, err
+	}
+
+	if authType != tls.NoClientCert && len(caFile) == 0 {
+		return nil, ErrNoClientCA
+	}
+
+	r := &Reloader{
+		certFile:   certFile,
+		keyFile:    keyFile,
+		caFile:     caFile,
+		clientAuth: authType,
+	}
+
+	if _, err := r.Reload(); err != nil {
+		return nil, err
+	}
+
+	return r, nil
+}
+
+func parseClientAuth(clientAuth string) (tls.ClientAuthType, error) {
+	switch clientAuth {
+	case "", CLIENT_AUTH_NONE:
+		return tls.NoClientCert, nil
+	case CLIENT_AUTH_OPTIONAL:
+		return tls.VerifyClientCertIfGiven, nil
+	case CLIENT_AUTH_REQUIRE:
+		return tls.RequireAndVerifyClientCert, nil
+	default:
+		return tls.NoClientCert, ErrInvalidClientAuth
+	}
+}
+
+// Reload reads the files again when any of them changed and reports whether it did. A broken
+// new version is rejected and the previous one keeps being served.
+func (r *Reloader) Reload() (bool, error) {
+	stamps, err := r.stat()
+	if err != nil {
+		return false, err
+	}
+
+	r.mu.RLock()
+	changed := r.changed(stamps)
+	r.mu.RUnlock()
+	if !changed {
+		return false, nil
+	}
+
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return false, fmt.Errorf("loading server certificate: %w", err)
+	}
+
+	var pool *x509.CertPool
+	if len(r.caFile) > 0 {
+		bundle, err := os.ReadFile(r.caFile)
+		if err != nil {
+			return false, fmt.Errorf("reading client CA bundle: %w", err)
+		}
+		pool = x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(bundle) {
+			return false, fmt.Errorf("client CA bundle %s has no certificates", r.caFile)
+		}
+	}
+
+	r.mu.Lock()
+	r.cert = &cert
+	r.pool = pool
+	r.stamps = stamps
+	r.mu.Unlock()
+
+	return true, nil
+}
+
+func (r *Reloader) stat() (map[string]stamp, error) {
+	stamps := map[string]stamp{}
+	for _, file := range []string{r.certFile, r.keyFile, r.caFile} {
+		if len(file) == 0 {
+			continue
+		}
+		info, err := os.Stat(file)
+		if err != nil {
+			return nil, err
+		}
+		stamps[file] = stamp{modTime: info.ModTime(), size: info.Size()}
+	}
+
+	return stamps, nil
+}
+
+func (r *Reloader) changed(stamps map[string]stamp) bool {
+	if len(stamps) != len(r.stamps) {
+		return true
+	}
+	for file, s := range stamps {
+		if r.stamps[file] != s {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Watch checks the files every interval until ctx is done.
+func (r *Reloader) Watch(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			reloaded, err := r.Reload()
+			if err != nil {
+				log.Err(err).Msg("an error occurred when reload tls certificates, keeping the previous ones")
+				continue
+			}
+			if reloaded {
+				log.Info().Str("cert_file", r.certFile).Msg("tls certificates reloaded")
+			}
+		}
+	}
+}
+
+// TLSConfig resolves the certificate and the client CAs on every handshake, so reloads apply to new connections.
+func (r *Reloader) TLSConfig() *tls.Config {
+	return &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		GetConfigForClient: func(*tls.ClientHelloInfo) (*tls.Config, error) {
+			r.mu.RLock()
+			defer r.mu.RUnlock()
+
+			return &tls.Config{
+				MinVersion:   tls.VersionTLS12,
+				Certificates: []tls.Certificate{*r.cert},
+				ClientAuth:   r.clientAuth,
+				ClientCAs:    r.pool,
+			}, nil
+		},
+	}
+}
+
+// Principal maps a verified client certificate into the caller of the request, granting it scopes.
+// Connections without a verified certificate have no principal.
+func Principal(state *tls.ConnectionState, scopes []string) (principal.Principal, bool) {
+	if state == nil || len(state.VerifiedChains) == 0 || len(state.VerifiedChains[0]) == 0 {
+		return principal.Principal{}, false
+	}
+
+	leaf := state.VerifiedChains[0][0]
+	subject := leaf.Subject.CommonName
+	if len(subject) == 0 {
+		subject = leaf.Subject.String()
+	}
+
+	return principal.Principal{
+		Subject:     subject,
+		Scopes:      scopes,
+		Certificate: leaf.Subject.String(),
+	}, true
+}
@@ -0,0 +1,218 @@
+package certs
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type authority struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	pem  []byte
+}
+
+func newAuthority(t *testing.T) authority {
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test-ca"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, _ := x509.ParseCertificate(der)
+
+	return authority{cert: cert, key: key, pem: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})}
+}
+
+// issue returns a PEM certificate and key signed by the authority.
+func (a authority) issue(t *testing.T, serial int64, commonName string, usage x509.ExtKeyUsage) ([]byte, []byte) {
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(serial),
+		Subject:      pkix.Name{CommonName: commonName, Organization: []string{"partner"}},
+		DNSNames:     []string{"localhost"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{usage},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, a.cert, &key.PublicKey, a.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, _ := x509.MarshalECPrivateKey(key)
+
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+}
+
+type files struct {
+	cert, key, ca string
+}
+
+func write(t *testing.T, f files, cert, key, ca []byte) {
+	for path, content := range map[string][]byte{f.cert: cert, f.key: key, f.ca: ca} {
+		if err := os.WriteFile(path, content, 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func newFiles(t *testing.T) files {
+	dir := t.TempDir()
+	return files{
+		cert: filepath.Join(dir, "server.crt"),
+		key:  filepath.Join(dir, "server.key"),
+		ca:   filepath.Join(dir, "ca.crt"),
+	}
+}
+
+func serve(t *testing.T, r *Reloader) *httptest.Server {
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if p, ok := Principal(req.TLS, []string{"payments:callback"}); ok {
+			io.WriteString(w, p.Subject)
+		}
+	}))
+	server.TLS = r.TLSConfig()
+	server.StartTLS()
+	t.Cleanup(server.Close)
+
+	return server
+}
+
+func client(ca authority, cert, key []byte) *http.Client {
+	pool := x509.NewCertPool()
+	pool.AddCert(ca.cert)
+	config := &tls.Config{RootCAs: pool, ServerName: "localhost"}
+	if cert != nil {
+		pair, _ := tls.X509KeyPair(cert, key)
+		config.Certificates = []tls.Certificate{pair}
+	}
+
+	return &http.Client{Transport: &http.Transport{TLSClientConfig: config}}
+}
+
+func TestNewReloader(t *testing.T) {
+	ca := newAuthority(t)
+	f := newFiles(t)
+	cert, key := ca.issue(t, 2, "localhost", x509.ExtKeyUsageServerAuth)
+	write(t, f, cert, key, ca.pem)
+
+	tests := map[string]struct {
+		caFile     string
+		clientAuth string
+		expected   error
+	}{
+		"given client auth without CA bundle, must fail": {
+			clientAuth: CLIENT_AUTH_REQUIRE,
+			expected:   ErrNoClientCA,
+		},
+		"given unknown client auth, must fail": {
+			caFile:     f.ca,
+			clientAuth: "always",
+			expected:   ErrInvalidClientAuth,
+		},
+		"given server only TLS, must not need a CA bundle": {
+			clientAuth: CLIENT_AUTH_NONE,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			_, err := NewReloader(f.cert, f.key, tc.caFile, tc.clientAuth)
+			assert.Equal(t, tc.expected, err)
+		})
+	}
+
+	_, err := NewReloader(f.cert, filepath.Join(t.TempDir(), "missing.key"), "", CLIENT_AUTH_NONE)
+	assert.Error(t, err, "missing files must fail fast")
+}
+
+func TestClientCertificate(t *testing.T) {
+	ca := newAuthority(t)
+	other := newAuthority(t)
+	f := newFiles(t)
+	cert, key := ca.issue(t, 2, "localhost", x509.ExtKeyUsageServerAuth)
+	write(t, f, cert, key, ca.pem)
+
+	r, err := NewReloader(f.cert, f.key, f.ca, CLIENT_AUTH_OPTIONAL)
+	assert.NoError(t, err)
+	server := serve(t, r)
+
+	partnerCert, partnerKey := ca.issue(t, 3, "partner-callbacks", x509.ExtKeyUsageClientAuth)
+	resp, err := client(ca, partnerCert, partnerKey).Get(server.URL)
+	assert.NoError(t, err)
+	body, _ := io.ReadAll(resp.Body)
+	assert.Equal(t, "partner-callbacks", string(body), "verified certificates must become the principal")
+
+	resp, err = client(ca, nil, nil).Get(server.URL)
+	assert.NoError(t, err)
+	body, _ = io.ReadAll(resp.Body)
+	assert.Empty(t, string(body), "connections without certificate have no principal")
+
+	strangerCert, strangerKey := other.issue(t, 4, "stranger", x509.ExtKeyUsageClientAuth)
+	_, err = client(ca, strangerCert, strangerKey).Get(server.URL)
+	assert.Error(t, err, "certificates from other authorities must be rejected")
+}
+
+func TestReload(t *testing.T) {
+	ca := newAuthority(t)
+	f := newFiles(t)
+	cert, key := ca.issue(t, 2, "localhost", x509.ExtKeyUsageServerAuth)
+	write(t, f, cert, key, ca.pem)
+
+	r, err := NewReloader(f.cert, f.key, "", CLIENT_AUTH_NONE)
+	assert.NoError(t, err)
+	server := serve(t, r)
+
+	served := func() int64 {
+		conn, err := tls.Dial("tcp", server.Listener.Addr().String(), &tls.Config{InsecureSkipVerify: true})
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer conn.Close()
+		return conn.ConnectionState().PeerCertificates[0].SerialNumber.Int64()
+	}
+	assert.Equal(t, int64(2), served())
+
+	reloaded, err := r.Reload()
+	assert.NoError(t, err)
+	assert.False(t, reloaded, "unchanged files must not be read again")
+
+	cert, key = ca.issue(t, 5, "localhost", x509.ExtKeyUsageServerAuth)
+	write(t, f, cert, key, ca.pem)
+	later := time.Now().Add(time.Minute)
+	os.Chtimes(f.cert, later, later)
+
+	reloaded, err = r.Reload()
+	assert.NoError(t, err)
+	assert.True(t, reloaded)
+	assert.Equal(t, int64(5), served(), "new connections must get the renewed certificate")
+
+	os.WriteFile(f.key, []byte("broken"), 0o600)
+	_, err = r.Reload()
+	assert.Error(t, err)
+	assert.Equal(t, int64(5), served(), "a broken renewal must keep the previous certificate")
+}
@@ -0,0 +1,78 @@
+package principal
+
+import (
+	"context"
+)
+
+const (
+	SCOPE_READ     = "payments:read"
+	SCOPE_WRITE    = "payments:write"
+	SCOPE_CALLBACK = "payments:callback"
+	SCOPE_ADMIN    = "payments:admin"
+
+	ROLE_CUSTOMER = "customer"
+)
+
+type contextKey struct{}
+
+// Principal is the authenticated caller of a request.
+type Principal struct {
+	Subject string
+	Scopes  []string
+	Roles   []string
+	// KeyID is set when the caller authenticated with an API key instead of a JWT.
+	KeyID string
+	// Certificate is the subject of the client certificate when the caller authenticated with mutual TLS.
+	Certificate string
+}
+
+func NewContext(ctx context.Context, p Principal) context.Context {
+	return context.WithValue(ctx, contextKey{}, p)
+}
+
+// FromContext returns the caller of the request. Internal flows such as the queue consumer
+// and the jobs have no principal.
+func FromContext(ctx context.Context) (Principal, bool) {
+	p, ok := ctx.Value(contextKey{}).(Principal)
+	return p, ok
+}
+
+// HasScopes reports whether the principal was granted every scope. The admin scope grants all of them.
+func (p Principal) HasScopes(scopes ...string) bool {
+	if contains(p.Scopes, SCOPE_ADMIN) {
+		return true
+	}
+
+	for _, scope := range scopes {
+		if !contains(p.Scopes, scope) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// IsCustomer reports whether the principal may only see its own payments.
+func (p Principal) IsCustomer() bool {
+	return contains(p.Roles, ROLE_CUSTOMER) && !contains(p.Scopes, SCOPE_ADMIN)
+}
+
+// Owns reports whether a payment belonging to customerID can be seen by the principal.
+func (p Principal) Owns(customerID string) bool {
+	return !p.IsCustomer() || (len(customerID) > 0 && customerID == p.Subject)
+}
+
+// IsScope reports whether scope is one of the scopes known by the service.
+func IsScope(scope string) bool {
+	return contains([]string{SCOPE_READ, SCOPE_WRITE, SCOPE_CALLBACK, SCOPE_ADMIN}, scope)
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+
+	return false
+}
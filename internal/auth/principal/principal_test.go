@@ -0,0 +1,59 @@
+package principal
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHasScopes(t *testing.T) {
+	tests := map[string]struct {
+		principal Principal
+		scopes    []string
+		expected  bool
+	}{
+		"given all scopes granted, must allow": {
+			principal: Principal{Scopes: []string{SCOPE_READ, SCOPE_WRITE}},
+			scopes:    []string{SCOPE_READ, SCOPE_WRITE},
+			expected:  true,
+		},
+		"given missing scope, must deny": {
+			principal: Principal{Scopes: []string{SCOPE_READ}},
+			scopes:    []string{SCOPE_WRITE},
+			expected:  false,
+		},
+		"given admin scope, must allow anything": {
+			principal: Principal{Scopes: []string{SCOPE_ADMIN}},
+			scopes:    []string{SCOPE_CALLBACK},
+			expected:  true,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			assert.Equal(t, tc.expected, tc.principal.HasScopes(tc.scopes...))
+		})
+	}
+}
+
+func TestOwns(t *testing.T) {
+	customer := Principal{Subject: "customer", Roles: []string{ROLE_CUSTOMER}, Scopes: []string{SCOPE_READ}}
+	service := Principal{Subject: "order-service", Scopes: []string{SCOPE_READ}}
+	admin := Principal{Subject: "ops", Roles: []string{ROLE_CUSTOMER}, Scopes: []string{SCOPE_ADMIN}}
+
+	assert.True(t, customer.Owns("customer"))
+	assert.False(t, customer.Owns("other"))
+	assert.False(t, customer.Owns(""))
+	assert.True(t, service.Owns("other"))
+	assert.True(t, admin.Owns("other"))
+}
+
+func TestContext(t *testing.T) {
+	_, ok := FromContext(context.Background())
+	assert.False(t, ok)
+
+	p, ok := FromContext(NewContext(context.Background(), Principal{Subject: "tester"}))
+	assert.True(t, ok)
+	assert.Equal(t, "tester", p.Subject)
+}
@@ -0,0 +1,221 @@
+package token
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"sync"
+	"time"
+
+	"golang.org/x/sync/singleflight"
+)
+
+const (
+	// minRefreshInterval limits how often an unknown kid can force the key set to be fetched again.
+	minRefreshInterval = 30 * time.Second
+	// failedRefreshBackoff keeps a failing endpoint from being asked again by every request.
+	failedRefreshBackoff = 10 * time.Second
+	fetchTimeout         = 5 * time.Second
+)
+
+var (
+	ErrUnknownKey    = errors.New("signing key not found in key set")
+	ErrKeySetBackoff = errors.New("jwks endpoint failed recently, not fetching it again yet")
+)
+
+type jsonWebKey struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+// keySet caches the public keys published on a JWKS endpoint. Keys are fetched again once
+// the cache is older than refreshInterval, or earlier when a token references a kid that is
+// not cached yet, which is what happens right after the issuer rotates its keys. Concurrent
+// requests share a single fetch, which never holds the lock.
+type keySet struct {
+	url             string
+	refreshInterval time.Duration
+	client          *http.Client
+	fetches         singleflight.Group
+
+	mu        sync.Mutex
+	keys      map[string]crypto.PublicKey
+	fetchedAt time.Time
+	failedAt  time.Time
+}
+
+func newKeySet(url string, refreshInterval time.Duration) *keySet {
+	return &keySet{
+		url:             url,
+		refreshInterval: refreshInterval,
+		client:          &http.Client{Timeout: fetchTimeout},
+		keys:            map[string]crypto.PublicKey{},
+	}
+}
+
+func (ks *keySet) Get(ctx context.Context, kid string) (crypto.PublicKey, error) {
+	key, ok, age, sinceFailure := ks.cached(kid)
+
+	if ok && age < ks.refreshInterval {
+		return key, nil
+	}
+
+	if !ok && age < minRefreshInterval {
+		return nil, ErrUnknownKey
+	}
+
+	// keep serving the keys we have when the endpoint is temporarily unavailable
+	if sinceFailure < failedRefreshBackoff {
+		if ok {
+			return key, nil
+		}
+		return nil, ErrKeySetBackoff
+	}
+
+	if err := ks.refresh(ctx); err != nil {
+		if ok {
+			return key, nil
+		}
+		return nil, err
+	}
+
+	key, ok, _, _ = ks.cached(kid)
+	if !ok {
+		return nil, ErrUnknownKey
+	}
+
+	return key, nil
+}
+
+func (ks *keySet) cached(kid string) (key crypto.PublicKey, ok bool, age, sinceFailure time.Duration) {
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+
+	key, ok = ks.keys[kid]
+	return key, ok, time.Since(ks.fetchedAt), time.Since(ks.failedAt)
+}
+
+// refresh waits for the fetch shared by every caller, or until ctx is done. The fetch itself
+// is not cancelled with ctx since other callers may be waiting on it.
+func (ks *keySet) refresh(ctx context.Context) error {
+	result := ks.fetches.DoChan(ks.url, func() (interface{}, error) {
+		keys, err := ks.fetch(context.WithoutCancel(ctx))
+
+		ks.mu.Lock()
+		defer ks.mu.Unlock()
+		if err != nil {
+			ks.failedAt = time.Now()
+			return nil, err
+		}
+		ks.keys = keys
+		ks.fetchedAt = time.Now()
+		return nil, nil
+	})
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case fetched := <-result:
+		return fetched.Err
+	}
+}
+
+func (ks *keySet) fetch(ctx context.Context) (map[string]crypto.PublicKey, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, ks.url, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := ks.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("fetching jwks: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("fetching jwks: unexpected status %d", resp.StatusCode)
+	}
+
+	var body struct {
+		Keys []jsonWebKey `json:"keys"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return nil, fmt.Errorf("decoding jwks: %w", err)
+	}
+
+	keys := make(map[string]crypto.PublicKey, len(body.Keys))
+	for _, jwk := range body.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+
+		key, err := jwk.publicKey()
+		if err != nil {
+			continue
+		}
+		keys[jwk.Kid] = key
+	}
+
+	return keys, nil
+}
+
+func (jwk jsonWebKey) publicKey() (crypto.PublicKey, error) {
+	switch jwk.Kty {
+	case "RSA":
+		n, err := decodeBigInt(jwk.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decodeBigInt(jwk.E)
+		if err != nil {
+			return nil, err
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch jwk.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported curve %s", jwk.Crv)
+		}
+		x, err := decodeBigInt(jwk.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decodeBigInt(jwk.Y)
+		if err != nil {
+			return nil, err
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+	default:
+		return nil, fmt.Errorf("unsupported key type %s", jwk.Kty)
+	}
+}
+
+func decodeBigInt(value string) (*big.Int, error) {
+	decoded, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return nil, err
+	}
+
+	return new(big.Int).SetBytes(decoded), nil
+}
@@ -1,48 +1,252 @@
 package token
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"net/http"
 	"strings"
+	"tech-challenge-payment/internal/auth/principal"
+	"tech-challenge-payment/internal/canonical"
 	"tech-challenge-payment/internal/config"
+	"time"
 
-	jwt "github.com/dgrijalva/jwt-go"
+	"github.com/golang-jwt/jwt/v5"
 )
 
 var (
-	cfg = &config.Cfg
+	ErrMissingToken     = errors.New("missing bearer token")
+	ErrInvalidScheme    = errors.New("authorization scheme must be Bearer")
+	ErrMalformedToken   = errors.New("token is malformed")
+	ErrInvalidSignature = errors.New("token signature is invalid")
+	ErrMissingClaim     = errors.New("token is missing a required claim")
+	ErrTokenExpired     = errors.New("token is expired")
+	ErrTokenNotValidYet = errors.New("token is not valid yet")
+	ErrInvalidIssuer    = errors.New("token issuer is not accepted")
+	ErrInvalidAudience  = errors.New("token audience is not accepted")
+	ErrInvalidToken     = errors.New("token is invalid")
+	ErrNoKeys           = errors.New("no token verification keys configured")
+
+	hmacMethods       = []string{"HS256", "HS384", "HS512"}
+	asymmetricMethods = []string{"RS256", "RS384", "RS512", "ES256", "ES384", "ES512"}
+
+	// kinds maps the library errors to ours, the first match wins
+	kinds = []struct {
+		cause error
+		kind  error
+	}{
+		{ErrNoKeys, ErrNoKeys},
+		{ErrUnknownKey, ErrUnknownKey},
+		{jwt.ErrTokenMalformed, ErrMalformedToken},
+		{jwt.ErrTokenSignatureInvalid, ErrInvalidSignature},
+		{jwt.ErrTokenExpired, ErrTokenExpired},
+		{jwt.ErrTokenNotValidYet, ErrTokenNotValidYet},
+		{jwt.ErrTokenUsedBeforeIssued, ErrTokenNotValidYet},
+		{jwt.ErrTokenInvalidIssuer, ErrInvalidIssuer},
+		{jwt.ErrTokenInvalidAudience, ErrInvalidAudience},
+		{jwt.ErrTokenRequiredClaimMissing, ErrMissingClaim},
+	}
 )
 
-func ValidateToken(r *http.Request) error {
-	tokenString := getToken(r)
+// Error is returned for every rejected token. Kind is one of the Err values of this package and
+// is safe to show to the caller, Err keeps the underlying cause for logs.
+type Error struct {
+	Kind error
+	Err  error
+}
+
+func (e *Error) Error() string {
+	if e.Err == nil {
+		return e.Kind.Error()
+	}
+
+	return fmt.Sprintf("%s: %s", e.Kind, e.Err)
+}
+
+func (e *Error) Is(target error) bool {
+	return target == e.Kind
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// Validator turns bearer tokens into the principal they were issued to.
+type Validator interface {
+	ValidateToken(r *http.Request) (principal.Principal, error)
+	// ValidateAuthorization stops waiting for the key set once ctx is done.
+	ValidateAuthorization(ctx context.Context, authorization string) (principal.Principal, error)
+}
+
+type validator struct {
+	hmacKey  []byte
+	keys     *keySet
+	issuer   string
+	audience string
+	skew     time.Duration
+	clock    canonical.Clock
+}
+
+// NewValidator accepts tokens signed with the key of cfg or, when its jwks_url is set, with one of
+// the keys published there, which are fetched on first use and shared by every request. Expiry is
+// checked against clock.
+func NewValidator(cfg config.TokenConfig, clock canonical.Clock) Validator {
+	v := validator{
+		hmacKey:  []byte(cfg.Key),
+		issuer:   cfg.Issuer,
+		audience: cfg.Audience,
+		skew:     cfg.ClockSkew,
+		clock:    clock,
+	}
+
+	if len(cfg.JWKSURL) > 0 {
+		v.keys = newKeySet(cfg.JWKSURL, cfg.JWKSRefreshInterval)
+	}
+
+	return v
+}
+
+func (v validator) ValidateToken(r *http.Request) (principal.Principal, error) {
+	return v.validate(r.Context(), r.Header.Get("Authorization"))
+}
+
+func (v validator) ValidateAuthorization(ctx context.Context, authorization string) (principal.Principal, error) {
+	return v.validate(ctx, authorization)
+}
+
+func (v validator) validate(ctx context.Context, authorization string) (principal.Principal, error) {
+	tokenString, err := getToken(authorization)
+	if err != nil {
+		return principal.Principal{}, err
+	}
+
+	// the parser allows every algorithm when the list is empty
+	methods := v.methods()
+	if len(methods) == 0 {
+		return principal.Principal{}, &Error{Kind: ErrNoKeys}
+	}
 
-	token, err := jwt.Parse(tokenString, returnSecretKey)
+	claims := jwt.MapClaims{}
+	_, err = jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		return v.key(ctx, token)
+	}, v.options(methods)...)
 	if err != nil {
-		return err
+		return principal.Principal{}, &Error{Kind: kindOf(err), Err: err}
 	}
 
-	if _, ok := token.Claims.(jwt.MapClaims); ok && token.Valid {
-		return nil
+	if subject, _ := claims["sub"].(string); len(subject) == 0 {
+		return principal.Principal{}, &Error{Kind: ErrMissingClaim, Err: errors.New("sub claim is required")}
 	}
 
-	return errors.New("invalid token")
+	return toPrincipal(claims), nil
 }
 
-func getToken(r *http.Request) string {
-	token := r.Header.Get("Authorization")
+func (v validator) options(methods []string) []jwt.ParserOption {
+	options := []jwt.ParserOption{
+		jwt.WithValidMethods(methods),
+		jwt.WithExpirationRequired(),
+		jwt.WithIssuedAt(),
+		jwt.WithLeeway(v.skew),
+		jwt.WithTimeFunc(v.clock.Now),
+	}
+	if len(v.issuer) > 0 {
+		options = append(options, jwt.WithIssuer(v.issuer))
+	}
+	if len(v.audience) > 0 {
+		options = append(options, jwt.WithAudience(v.audience))
+	}
+
+	return options
+}
 
-	if len(strings.Split(token, " ")) == 2 {
-		return strings.Split(token, " ")[1]
+// methods only accepts the algorithms we have keys for, so a token can never pick how it is verified.
+func (v validator) methods() []string {
+	var methods []string
+	if len(v.hmacKey) > 0 {
+		methods = append(methods, hmacMethods...)
+	}
+	if v.keys != nil {
+		methods = append(methods, asymmetricMethods...)
 	}
 
-	return ""
+	return methods
 }
 
-func returnSecretKey(token *jwt.Token) (interface{}, error) {
-	if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+func (v validator) key(ctx context.Context, token *jwt.Token) (interface{}, error) {
+	switch token.Method.(type) {
+	case *jwt.SigningMethodHMAC:
+		if len(v.hmacKey) == 0 {
+			return nil, ErrNoKeys
+		}
+		return v.hmacKey, nil
+	case *jwt.SigningMethodRSA, *jwt.SigningMethodECDSA:
+		if v.keys == nil {
+			return nil, ErrNoKeys
+		}
+		kid, _ := token.Header["kid"].(string)
+		return v.keys.Get(ctx, kid)
+	default:
 		return nil, fmt.Errorf("unexpected signature method %v", token.Header["alg"])
 	}
+}
+
+func kindOf(err error) error {
+	for _, k := range kinds {
+		if errors.Is(err, k.cause) {
+			return k.kind
+		}
+	}
+
+	return ErrInvalidToken
+}
+
+// toPrincipal reads the OAuth2 "scope" claim (space separated) or the "scp" list, and the "roles" list.
+func toPrincipal(claims jwt.MapClaims) principal.Principal {
+	subject, _ := claims["sub"].(string)
+
+	scopes := stringsClaim(claims["scp"])
+	if scope, ok := claims["scope"].(string); ok {
+		scopes = append(scopes, strings.Fields(scope)...)
+	}
+
+	return principal.Principal{
+		Subject: subject,
+		Scopes:  scopes,
+		Roles:   stringsClaim(claims["roles"]),
+	}
+}
+
+func stringsClaim(claim interface{}) []string {
+	switch value := claim.(type) {
+	case string:
+		return strings.Fields(value)
+	case []interface{}:
+		var values []string
+		for _, item := range value {
+			if s, ok := item.(string); ok {
+				values = append(values, s)
+			}
+		}
+		return values
+	}
+
+	return nil
+}
+
+// getToken only accepts "Bearer <token>", the scheme is case insensitive as in RFC 7235.
+func getToken(authorization string) (string, error) {
+	if len(authorization) == 0 {
+		return "", &Error{Kind: ErrMissingToken}
+	}
+
+	scheme, token, found := strings.Cut(authorization, " ")
+	if !found || !strings.EqualFold(scheme, "Bearer") {
+		return "", &Error{Kind: ErrInvalidScheme}
+	}
+
+	if len(token) == 0 || strings.ContainsAny(token, " \t") {
+		return "", &Error{Kind: ErrMalformedToken}
+	}
 
-	return []byte(cfg.Token.Key), nil
+	return token, nil
 }
@@ -0,0 +1,415 @@
+package token
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"tech-challenge-payment/internal/auth/principal"
+	"tech-challenge-payment/internal/canonical/canonicaltest"
+	"tech-challenge-payment/internal/config"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+)
+
+const (
+	hmacKey  = "hmac-test-key"
+	issuer   = "https://issuer.test"
+	audience = "payment-service"
+)
+
+type jwksServer struct {
+	*httptest.Server
+	keys     atomic.Value
+	requests atomic.Int32
+}
+
+func newJWKSServer(t *testing.T, keys ...jsonWebKey) *jwksServer {
+	s := &jwksServer{}
+	s.keys.Store(keys)
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.requests.Add(1)
+		json.NewEncoder(w).Encode(map[string]any{"keys": s.keys.Load()})
+	}))
+	t.Cleanup(s.Close)
+
+	return s
+}
+
+func rsaJWK(kid string, key *rsa.PrivateKey) jsonWebKey {
+	return jsonWebKey{
+		Kty: "RSA",
+		Kid: kid,
+		Use: "sig",
+		N:   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+		E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+	}
+}
+
+func ecJWK(kid string, key *ecdsa.PrivateKey) jsonWebKey {
+	return jsonWebKey{
+		Kty: "EC",
+		Kid: kid,
+		Crv: "P-256",
+		X:   base64.RawURLEncoding.EncodeToString(key.X.FillBytes(make([]byte, 32))),
+		Y:   base64.RawURLEncoding.EncodeToString(key.Y.FillBytes(make([]byte, 32))),
+	}
+}
+
+func sign(t *testing.T, method jwt.SigningMethod, kid string, key interface{}, claims jwt.MapClaims) string {
+	token := jwt.NewWithClaims(method, claims)
+	if len(kid) > 0 {
+		token.Header["kid"] = kid
+	}
+
+	signed, err := token.SignedString(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return "Bearer " + signed
+}
+
+func validClaims(now time.Time) jwt.MapClaims {
+	return jwt.MapClaims{
+		"sub": "tester",
+		"iss": issuer,
+		"aud": []string{"other", audience},
+		"iat": now.Unix(),
+		"exp": now.Add(time.Hour).Unix(),
+	}
+}
+
+func TestValidate(t *testing.T) {
+	now := time.Date(2020, 11, 1, 12, 0, 0, 0, time.UTC)
+	rsaKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	otherRSAKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	ecKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+
+	server := newJWKSServer(t, rsaJWK("rsa", rsaKey), ecJWK("ec", ecKey))
+
+	with := func(change func(claims jwt.MapClaims)) jwt.MapClaims {
+		claims := validClaims(now)
+		change(claims)
+		return claims
+	}
+
+	type Given struct {
+		authorization string
+	}
+	type Expected struct {
+		err error
+		ok  bool
+	}
+	tests := map[string]struct {
+		given    Given
+		expected Expected
+	}{
+		"given RS256 token signed by a published key, must accept it": {
+			given:    Given{authorization: sign(t, jwt.SigningMethodRS256, "rsa", rsaKey, validClaims(now))},
+			expected: Expected{ok: true},
+		},
+		"given ES256 token signed by a published key, must accept it": {
+			given:    Given{authorization: sign(t, jwt.SigningMethodES256, "ec", ecKey, validClaims(now))},
+			expected: Expected{ok: true},
+		},
+		"given HS256 token signed with the shared key, must accept it": {
+			given:    Given{authorization: sign(t, jwt.SigningMethodHS256, "", []byte(hmacKey), validClaims(now))},
+			expected: Expected{ok: true},
+		},
+		"given token signed by an unknown key, must reject it": {
+			given: Given{authorization: sign(t, jwt.SigningMethodRS256, "rsa", otherRSAKey, validClaims(now))},
+		},
+		"given token with unknown kid, must reject it": {
+			given: Given{authorization: sign(t, jwt.SigningMethodRS256, "unknown", rsaKey, validClaims(now))},
+		},
+		"given token expired within the clock skew, must accept it": {
+			given: Given{authorization: sign(t, jwt.SigningMethodRS256, "rsa", rsaKey, with(func(claims jwt.MapClaims) {
+				claims["exp"] = now.Add(-10 * time.Second).Unix()
+			}))},
+			expected: Expected{ok: true},
+		},
+		"given token expired beyond the clock skew, must reject it": {
+			given: Given{authorization: sign(t, jwt.SigningMethodRS256, "rsa", rsaKey, with(func(claims jwt.MapClaims) {
+				claims["exp"] = now.Add(-time.Minute).Unix()
+			}))},
+			expected: Expected{err: ErrTokenExpired},
+		},
+		"given token without expiration, must reject it": {
+			given: Given{authorization: sign(t, jwt.SigningMethodRS256, "rsa", rsaKey, with(func(claims jwt.MapClaims) {
+				delete(claims, "exp")
+			}))},
+			expected: Expected{err: ErrMissingClaim},
+		},
+		"given token not valid yet, must reject it": {
+			given: Given{authorization: sign(t, jwt.SigningMethodRS256, "rsa", rsaKey, with(func(claims jwt.MapClaims) {
+				claims["nbf"] = now.Add(time.Minute).Unix()
+			}))},
+			expected: Expected{err: ErrTokenNotValidYet},
+		},
+		"given token from another issuer, must reject it": {
+			given: Given{authorization: sign(t, jwt.SigningMethodRS256, "rsa", rsaKey, with(func(claims jwt.MapClaims) {
+				claims["iss"] = "https://other.test"
+			}))},
+			expected: Expected{err: ErrInvalidIssuer},
+		},
+		"given token for another audience, must reject it": {
+			given: Given{authorization: sign(t, jwt.SigningMethodRS256, "rsa", rsaKey, with(func(claims jwt.MapClaims) {
+				claims["aud"] = "other"
+			}))},
+			expected: Expected{err: ErrInvalidAudience},
+		},
+		"given token without subject, must reject it": {
+			given: Given{authorization: sign(t, jwt.SigningMethodRS256, "rsa", rsaKey, with(func(claims jwt.MapClaims) {
+				delete(claims, "sub")
+			}))},
+			expected: Expected{err: ErrMissingClaim},
+		},
+		"given token without the expected issuer claim, must reject it": {
+			given: Given{authorization: sign(t, jwt.SigningMethodRS256, "rsa", rsaKey, with(func(claims jwt.MapClaims) {
+				delete(claims, "iss")
+			}))},
+			expected: Expected{err: ErrMissingClaim},
+		},
+		"given unsigned token, must reject it": {
+			given:    Given{authorization: sign(t, jwt.SigningMethodNone, "", jwt.UnsafeAllowNoneSignatureType, validClaims(now))},
+			expected: Expected{err: ErrInvalidSignature},
+		},
+		"given token with a not allowed algorithm, must reject it": {
+			given:    Given{authorization: sign(t, jwt.SigningMethodPS256, "rsa", rsaKey, validClaims(now))},
+			expected: Expected{err: ErrInvalidSignature},
+		},
+		"given malformed token, must reject it": {
+			given:    Given{authorization: "Bearer invalid"},
+			expected: Expected{err: ErrMalformedToken},
+		},
+		"given missing token, must reject it": {
+			given:    Given{authorization: ""},
+			expected: Expected{err: ErrMissingToken},
+		},
+		"given token with another scheme, must reject it": {
+			given:    Given{authorization: "Basic " + sign(t, jwt.SigningMethodHS256, "", []byte(hmacKey), validClaims(now))[len("Bearer "):]},
+			expected: Expected{err: ErrInvalidScheme},
+		},
+		"given token without scheme, must reject it": {
+			given:    Given{authorization: sign(t, jwt.SigningMethodHS256, "", []byte(hmacKey), validClaims(now))[len("Bearer "):]},
+			expected: Expected{err: ErrInvalidScheme},
+		},
+		"given lowercase bearer scheme, must accept it": {
+			given:    Given{authorization: "bearer " + sign(t, jwt.SigningMethodHS256, "", []byte(hmacKey), validClaims(now))[len("Bearer "):]},
+			expected: Expected{ok: true},
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			v := validator{
+				hmacKey:  []byte(hmacKey),
+				keys:     newKeySet(server.URL, time.Hour),
+				issuer:   issuer,
+				audience: audience,
+				skew:     30 * time.Second,
+				clock:    canonicaltest.NewClock(now),
+			}
+
+			_, err := v.validate(context.Background(), tc.given.authorization)
+
+			if tc.expected.ok {
+				assert.NoError(t, err)
+				return
+			}
+			var tokenErr *Error
+			assert.ErrorAs(t, err, &tokenErr)
+			if tc.expected.err != nil {
+				assert.ErrorIs(t, err, tc.expected.err)
+			}
+		})
+	}
+}
+
+func TestExpiry(t *testing.T) {
+	now := time.Date(2020, 11, 1, 12, 0, 0, 0, time.UTC)
+	clock := canonicaltest.NewClock(now)
+	v := NewValidator(config.TokenConfig{Key: hmacKey, ClockSkew: 30 * time.Second}, clock)
+	authorization := sign(t, jwt.SigningMethodHS256, "", []byte(hmacKey), validClaims(now))
+
+	_, err := v.ValidateAuthorization(context.Background(), authorization)
+	assert.NoError(t, err)
+
+	// the token expires an hour after it was issued, the skew keeps it valid a little longer
+	clock.Advance(time.Hour + 29*time.Second)
+	_, err = v.ValidateAuthorization(context.Background(), authorization)
+	assert.NoError(t, err)
+
+	clock.Advance(time.Second)
+	_, err = v.ValidateAuthorization(context.Background(), authorization)
+	assert.ErrorIs(t, err, ErrTokenExpired)
+}
+
+func TestValidateWithoutKeys(t *testing.T) {
+	now := time.Date(2020, 11, 1, 12, 0, 0, 0, time.UTC)
+	rsaKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+
+	v := validator{
+		clock: canonicaltest.NewClock(now),
+	}
+
+	_, err := v.validate(context.Background(), sign(t, jwt.SigningMethodHS256, "", []byte(""), validClaims(now)))
+	assert.Error(t, err)
+	_, err = v.validate(context.Background(), sign(t, jwt.SigningMethodRS256, "rsa", rsaKey, validClaims(now)))
+	assert.Error(t, err)
+}
+
+func TestPrincipal(t *testing.T) {
+	now := time.Date(2020, 11, 1, 12, 0, 0, 0, time.UTC)
+	v := validator{
+		hmacKey: []byte(hmacKey),
+		clock:   canonicaltest.NewClock(now),
+	}
+
+	type Expected struct {
+		principal principal.Principal
+	}
+	tests := map[string]struct {
+		given    jwt.MapClaims
+		expected Expected
+	}{
+		"given space separated scope claim, must split scopes": {
+			given: jwt.MapClaims{"sub": "customer", "exp": now.Add(time.Hour).Unix(), "scope": "payments:read payments:write", "roles": []string{"customer"}},
+			expected: Expected{principal: principal.Principal{
+				Subject: "customer",
+				Scopes:  []string{"payments:read", "payments:write"},
+				Roles:   []string{"customer"},
+			}},
+		},
+		"given scp list claim, must read scopes": {
+			given: jwt.MapClaims{"sub": "order-service", "exp": now.Add(time.Hour).Unix(), "scp": []string{"payments:admin"}},
+			expected: Expected{principal: principal.Principal{
+				Subject: "order-service",
+				Scopes:  []string{"payments:admin"},
+			}},
+		},
+		"given no scopes, must return principal without scopes": {
+			given:    jwt.MapClaims{"sub": "tester", "exp": now.Add(time.Hour).Unix()},
+			expected: Expected{principal: principal.Principal{Subject: "tester"}},
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			p, err := v.validate(context.Background(), sign(t, jwt.SigningMethodHS256, "", []byte(hmacKey), tc.given))
+
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expected.principal, p)
+		})
+	}
+}
+
+func TestKeyRotation(t *testing.T) {
+	now := time.Date(2020, 11, 1, 12, 0, 0, 0, time.UTC)
+	oldKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	newKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+
+	server := newJWKSServer(t, rsaJWK("old", oldKey))
+	ks := newKeySet(server.URL, time.Hour)
+	v := validator{
+		keys:  ks,
+		clock: canonicaltest.NewClock(now),
+	}
+	validate := func(authorization string) error {
+		_, err := v.validate(context.Background(), authorization)
+		return err
+	}
+
+	assert.NoError(t, validate(sign(t, jwt.SigningMethodRS256, "old", oldKey, validClaims(now))))
+	assert.NoError(t, validate(sign(t, jwt.SigningMethodRS256, "old", oldKey, validClaims(now))))
+	assert.Equal(t, int32(1), server.requests.Load(), "cached keys must not be fetched again")
+
+	server.keys.Store([]jsonWebKey{rsaJWK("old", oldKey), rsaJWK("new", newKey)})
+
+	// unknown kids right after a fetch are not enough to hit the endpoint again
+	assert.ErrorIs(t, validate(sign(t, jwt.SigningMethodRS256, "new", newKey, validClaims(now))), ErrUnknownKey)
+	assert.Equal(t, int32(1), server.requests.Load())
+
+	ks.fetchedAt = ks.fetchedAt.Add(-minRefreshInterval)
+
+	assert.NoError(t, validate(sign(t, jwt.SigningMethodRS256, "new", newKey, validClaims(now))))
+	assert.Equal(t, int32(2), server.requests.Load())
+}
+
+func TestKeySetUnavailable(t *testing.T) {
+	rsaKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	server := newJWKSServer(t, rsaJWK("rsa", rsaKey))
+	ks := newKeySet(server.URL, time.Millisecond)
+
+	_, err := ks.Get(context.Background(), "rsa")
+	assert.NoError(t, err)
+
+	server.Close()
+	time.Sleep(2 * time.Millisecond)
+
+	key, err := ks.Get(context.Background(), "rsa")
+	assert.NoError(t, err, "stale keys must be served while the endpoint is down")
+	assert.NotNil(t, key)
+}
+
+func TestKeySetBackoff(t *testing.T) {
+	rsaKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	server := newJWKSServer(t, rsaJWK("rsa", rsaKey))
+	server.Close()
+	ks := newKeySet(server.URL, time.Hour)
+
+	_, err := ks.Get(context.Background(), "rsa")
+	assert.Error(t, err)
+	assert.NotErrorIs(t, err, ErrKeySetBackoff)
+
+	_, err = ks.Get(context.Background(), "rsa")
+	assert.ErrorIs(t, err, ErrKeySetBackoff, "a failing endpoint must not be asked again right away")
+}
+
+func TestKeySetSharedFetch(t *testing.T) {
+	rsaKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	release := make(chan struct{})
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		<-release
+		json.NewEncoder(w).Encode(map[string]any{"keys": []jsonWebKey{rsaJWK("rsa", rsaKey)}})
+	}))
+	defer server.Close()
+	ks := newKeySet(server.URL, time.Hour)
+
+	errs := make(chan error, 10)
+	for i := 0; i < cap(errs); i++ {
+		go func() {
+			_, err := ks.Get(context.Background(), "rsa")
+			errs <- err
+		}()
+	}
+
+	t.Run("given a cancelled request, must stop waiting for the fetch", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		_, err := ks.Get(ctx, "rsa")
+
+		assert.ErrorIs(t, err, context.Canceled)
+	})
+
+	assert.Eventually(t, func() bool { return requests.Load() == 1 }, time.Second, time.Millisecond)
+	close(release)
+	for i := 0; i < cap(errs); i++ {
+		assert.NoError(t, <-errs)
+	}
+	assert.Equal(t, int32(1), requests.Load(), "concurrent requests must share one fetch")
+}
@@ -0,0 +1,80 @@
+// Package bootstrap opens the connections to the outside world and builds the payment service on
+// top of them, for the service itself and for paymentctl alike.
+package bootstrap
+
+import (
+	"context"
+	"fmt"
+	"tech-challenge-payment/internal/canonical"
+	"tech-challenge-payment/internal/config"
+	"tech-challenge-payment/internal/events"
+	"tech-challenge-payment/internal/integration/aws_session"
+	"tech-challenge-payment/internal/integration/payment_provider"
+	"tech-challenge-payment/internal/integration/sqs_publisher"
+	"tech-challenge-payment/internal/repository"
+	"tech-challenge-payment/internal/service"
+
+	"github.com/aws/aws-sdk-go/aws/session"
+)
+
+// Dependencies are the connections to the outside world, everything else is built on top of
+// them. Tests swap them for fakes.
+type Dependencies struct {
+	Payments  repository.PaymentRepository
+	Intents   repository.IntentRepository
+	Audits    repository.AuditRepository
+	APIKeys   repository.APIKeyRepository
+	Locks     repository.LockRepository
+	Reports   repository.ReconciliationRepository
+	Database  repository.HealthRepository
+	Session   *session.Session
+	Providers payment_provider.Router
+	Clock     canonical.Clock
+	IDs       canonical.IDGenerator
+}
+
+// Connect opens a single Mongo client and AWS session, the returned func disconnects from Mongo.
+func Connect(ctx context.Context, cfg config.Config) (Dependencies, func(context.Context) error, error) {
+	providers, err := payment_provider.NewRouterFromNames(map[canonical.PaymentMethod]string{
+		canonical.METHOD_PIX:         cfg.Provider.Adapters.PIX,
+		canonical.METHOD_CREDIT_CARD: cfg.Provider.Adapters.CreditCard,
+		canonical.METHOD_DEBIT_CARD:  cfg.Provider.Adapters.DebitCard,
+		canonical.METHOD_BOLETO:      cfg.Provider.Adapters.Boleto,
+		canonical.METHOD_CASH:        cfg.Provider.Adapters.Cash,
+	})
+	if err != nil {
+		return Dependencies{}, nil, fmt.Errorf("provider: %w", err)
+	}
+
+	db, err := repository.NewMongo(ctx, cfg.DB.ConnectionString)
+	if err != nil {
+		return Dependencies{}, nil, fmt.Errorf("mongo: %w", err)
+	}
+
+	sess, err := aws_session.New(cfg.SQS.Region, cfg.SQS.Endpoint, cfg.SQS.DisableSSL, cfg.SQS.Credentials)
+	if err != nil {
+		return Dependencies{}, nil, fmt.Errorf("aws: %w", err)
+	}
+
+	clock := canonical.SystemClock()
+	return Dependencies{
+		Payments:  repository.NewPaymentRepo(db),
+		Intents:   repository.NewIntentRepo(db),
+		Audits:    repository.NewAuditRepo(db),
+		APIKeys:   repository.NewAPIKeyRepo(db),
+		Locks:     repository.NewLockRepo(db, clock),
+		Reports:   repository.NewReconciliationRepo(db),
+		Database:  repository.NewHealthRepo(db),
+		Session:   sess,
+		Providers: providers,
+		Clock:     clock,
+		IDs:       canonical.UUIDGenerator(),
+	}, db.Client().Disconnect, nil
+}
+
+// NewPaymentService builds the payment service on top of deps, publishing to the queues of cfg
+// and streaming the changes it makes to hub.
+func NewPaymentService(deps Dependencies, hub events.Hub, cfg config.Config) service.PaymentService {
+	publisher := sqs_publisher.NewSQS(deps.Session)
+	return service.NewPaymentService(deps.Payments, deps.Intents, deps.Audits, publisher, deps.Providers, hub, deps.Clock, deps.IDs, cfg)
+}
@@ -0,0 +1,58 @@
+// Package canonicaltest provides deterministic stand-ins of canonical.Clock and canonical.IDGenerator.
+package canonicaltest
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Clock stays at the time it is set to until moved.
+type Clock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func NewClock(now time.Time) *Clock {
+	return &Clock{now: now}
+}
+
+func (c *Clock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.now
+}
+
+func (c *Clock) Set(now time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.now = now
+}
+
+func (c *Clock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.now = c.now.Add(d)
+}
+
+// IDs issues prefix-1, prefix-2 and so on.
+type IDs struct {
+	mu     sync.Mutex
+	prefix string
+	issued int
+}
+
+func NewIDs(prefix string) *IDs {
+	return &IDs{prefix: prefix}
+}
+
+func (g *IDs) NewID() string {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	g.issued++
+	return fmt.Sprintf("%s-%d", g.prefix, g.issued)
+}
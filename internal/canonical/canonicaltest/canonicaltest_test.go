@@ -0,0 +1,33 @@
+package canonicaltest
+
+import (
+	"tech-challenge-payment/internal/canonical"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var (
+	_ canonical.Clock       = (*Clock)(nil)
+	_ canonical.IDGenerator = (*IDs)(nil)
+)
+
+func TestClock(t *testing.T) {
+	start := time.Date(2020, 11, 1, 0, 0, 0, 0, time.UTC)
+	clock := NewClock(start)
+	assert.Equal(t, start, clock.Now())
+
+	clock.Advance(time.Minute)
+	assert.Equal(t, start.Add(time.Minute), clock.Now())
+
+	clock.Set(start)
+	assert.Equal(t, start, clock.Now())
+}
+
+func TestIDs(t *testing.T) {
+	ids := NewIDs("payment")
+
+	assert.Equal(t, "payment-1", ids.NewID())
+	assert.Equal(t, "payment-2", ids.NewID())
+}
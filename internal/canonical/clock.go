@@ -0,0 +1,36 @@
+package canonical
+
+import "time"
+
+// Clock tells the current time. Code that stamps or compares times takes one instead of calling
+// time.Now, so tests can pin it.
+type Clock interface {
+	Now() time.Time
+}
+
+// IDGenerator issues the ids of new documents.
+type IDGenerator interface {
+	NewID() string
+}
+
+type systemClock struct{}
+
+// SystemClock reads the wall clock.
+func SystemClock() Clock {
+	return systemClock{}
+}
+
+func (systemClock) Now() time.Time {
+	return time.Now()
+}
+
+type uuidGenerator struct{}
+
+// UUIDGenerator issues random UUIDs.
+func UUIDGenerator() IDGenerator {
+	return uuidGenerator{}
+}
+
+func (uuidGenerator) NewID() string {
+	return NewUUID()
+}
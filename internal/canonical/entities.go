@@ -9,16 +9,35 @@ import (
 )
 
 var (
-	ErrorNotFound = fmt.Errorf("entity not found")
+	ErrorNotFound          = fmt.Errorf("entity not found")
+	ErrorInvalidTransition = fmt.Errorf("invalid payment status transition")
+	ErrorForbidden         = fmt.Errorf("operation not allowed for the caller")
+	ErrorAttemptPending    = fmt.Errorf("the previous payment attempt is still pending")
+	ErrorIntentSettled     = fmt.Errorf("the payment intent of the order is already settled")
+	ErrorInvalidAmount     = fmt.Errorf("invalid capture amount")
+	ErrorReasonRequired    = fmt.Errorf("a reason is required to force the status of a payment")
 )
 
 type Payment struct {
-	ID          string        `bson:"_id"`
-	OrderID     string        `bson:"order_id"`
-	PaymentType int           `bson:"payment_type"`
-	CreatedAt   time.Time     `bson:"created_at"`
-	UpdatedAt   time.Time     `bson:"updated_at"`
-	Status      PaymentStatus `bson:"status"`
+	ID         string        `bson:"_id"`
+	OrderID    string        `bson:"order_id"`
+	CustomerID string        `bson:"customer_id,omitempty"`
+	Method     PaymentMethod `bson:"method"`
+	CreatedAt  time.Time     `bson:"created_at"`
+	UpdatedAt  time.Time     `bson:"updated_at"`
+	Status     PaymentStatus `bson:"status"`
+	Reason     StatusReason  `bson:"reason,omitempty"`
+	// Details is missing on payments created before methods existed.
+	Details *MethodDetails `bson:"details,omitempty"`
+	// Amount is in cents, it is what card payments authorize and may be missing on other methods.
+	Amount int64 `bson:"amount,omitempty"`
+	// CapturedAmount is what was collected of an authorized payment, up to its amount.
+	CapturedAmount int64 `bson:"captured_amount,omitempty"`
+	// Attempt numbers the payments of the order's intent from 1, it is 0 on payments created
+	// before intents existed.
+	Attempt int `bson:"attempt,omitempty"`
+	// Version is the sequence of the last event of the payment's log applied to it.
+	Version uint64 `bson:"version"`
 }
 
 type PaymentStatus int
@@ -27,16 +46,176 @@ const (
 	PAYMENT_CREATED PaymentStatus = iota
 	PAYMENT_PAYED
 	PAYMENT_FAILED
+	PAYMENT_CANCELLED
+	PAYMENT_EXPIRED
+	// PAYMENT_AUTHORIZED holds the amount on the customer's card until it is captured or voided.
+	PAYMENT_AUTHORIZED
+	// PAYMENT_REFUNDED gives back the money of a payed payment, the provider reports it.
+	PAYMENT_REFUNDED
 )
 
+func (s PaymentStatus) IsFinal() bool {
+	return s != PAYMENT_CREATED && s != PAYMENT_AUTHORIZED
+}
+
+func (s PaymentStatus) String() string {
+	switch s {
+	case PAYMENT_CREATED:
+		return "CREATED"
+	case PAYMENT_PAYED:
+		return "PAYED"
+	case PAYMENT_FAILED:
+		return "FAILED"
+	case PAYMENT_CANCELLED:
+		return "CANCELLED"
+	case PAYMENT_EXPIRED:
+		return "EXPIRED"
+	case PAYMENT_AUTHORIZED:
+		return "AUTHORIZED"
+	case PAYMENT_REFUNDED:
+		return "REFUNDED"
+	default:
+		return "UNKNOWN"
+	}
+}
+
+// ParsePaymentStatus finds the status by the name String gives it.
+func ParsePaymentStatus(name string) (PaymentStatus, bool) {
+	for status := PAYMENT_CREATED; status <= PAYMENT_REFUNDED; status++ {
+		if status.String() == name {
+			return status, true
+		}
+	}
+	return PAYMENT_CREATED, false
+}
+
+// StatusReason tells consumers of the cancelled queue why a payment did not go through.
+type StatusReason string
+
+const (
+	REASON_REQUESTED        StatusReason = "REQUESTED"
+	REASON_ORDER_CANCELLED  StatusReason = "ORDER_CANCELLED"
+	REASON_PROVIDER_FAILURE StatusReason = "PROVIDER_FAILURE"
+	REASON_EXPIRED          StatusReason = "EXPIRED"
+	// REASON_ATTEMPTS_EXHAUSTED is given when the last attempt allowed to the intent failed.
+	REASON_ATTEMPTS_EXHAUSTED StatusReason = "ATTEMPTS_EXHAUSTED"
+	// REASON_NOT_CAPTURED is given when an authorization is voided for not being captured in time.
+	REASON_NOT_CAPTURED StatusReason = "NOT_CAPTURED"
+	// REASON_FORCED is given when an operator forced the status, the audit trail tells why.
+	REASON_FORCED StatusReason = "FORCED"
+	// REASON_DUPLICATE_ATTEMPT is given to a payment made while another attempt of its order was
+	// counted, it never counted as an attempt.
+	REASON_DUPLICATE_ATTEMPT StatusReason = "DUPLICATE_ATTEMPT"
+)
+
+// PaymentIntent is the will to pay an order, there is one per order. Each payment of the order
+// is an attempt of its intent, and the order service only hears about the intent: it is payed
+// by the first attempt that succeeds and cancelled when it runs out of attempts, expires or is
+// cancelled.
+type PaymentIntent struct {
+	OrderID     string       `bson:"_id"`
+	CustomerID  string       `bson:"customer_id,omitempty"`
+	Status      IntentStatus `bson:"status"`
+	Reason      StatusReason `bson:"reason,omitempty"`
+	Attempts    int          `bson:"attempts"`
+	MaxAttempts int          `bson:"max_attempts"`
+	CreatedAt   time.Time    `bson:"created_at"`
+	UpdatedAt   time.Time    `bson:"updated_at"`
+}
+
+type IntentStatus int
+
+const (
+	INTENT_OPEN IntentStatus = iota
+	INTENT_SUCCEEDED
+	INTENT_CANCELLED
+)
+
+func (s IntentStatus) String() string {
+	switch s {
+	case INTENT_OPEN:
+		return "OPEN"
+	case INTENT_SUCCEEDED:
+		return "SUCCEEDED"
+	case INTENT_CANCELLED:
+		return "CANCELLED"
+	default:
+		return "UNKNOWN"
+	}
+}
+
+// Exhausted tells whether no attempt is left to the intent.
+func (i PaymentIntent) Exhausted() bool {
+	return i.Attempts >= i.MaxAttempts
+}
+
 var MapPaymentStatus = map[string]PaymentStatus{
-	"OK":        PAYMENT_PAYED,
-	"NOK":       PAYMENT_FAILED,
-	"ERROR":     PAYMENT_FAILED,
-	"INIT":      PAYMENT_CREATED,
-	"":          PAYMENT_FAILED,
-	"COMPLETED": PAYMENT_PAYED,
-	"PENDING":   PAYMENT_CREATED,
+	"OK":         PAYMENT_PAYED,
+	"NOK":        PAYMENT_FAILED,
+	"ERROR":      PAYMENT_FAILED,
+	"INIT":       PAYMENT_CREATED,
+	"":           PAYMENT_FAILED,
+	"COMPLETED":  PAYMENT_PAYED,
+	"PENDING":    PAYMENT_CREATED,
+	"AUTHORIZED": PAYMENT_AUTHORIZED,
+	"REFUNDED":   PAYMENT_REFUNDED,
+}
+
+// ReconciliationReport records the payments whose status disagreed with the provider in a
+// reconciliation run and whether each of them could be fixed. Payments whose provider adapter
+// can not report statuses are counted as skipped rather than checked.
+type ReconciliationReport struct {
+	ID            string                  `bson:"_id"`
+	StartedAt     time.Time               `bson:"started_at"`
+	FinishedAt    time.Time               `bson:"finished_at"`
+	Checked       int                     `bson:"checked"`
+	Skipped       int                     `bson:"skipped"`
+	Discrepancies []Discrepancy           `bson:"discrepancies"`
+	Errors        []ReconciliationFailure `bson:"errors"`
+}
+
+type Discrepancy struct {
+	PaymentID      string        `bson:"payment_id"`
+	OrderID        string        `bson:"order_id"`
+	LocalStatus    PaymentStatus `bson:"local_status"`
+	ProviderStatus PaymentStatus `bson:"provider_status"`
+	Fixed          bool          `bson:"fixed"`
+	Error          string        `bson:"error,omitempty"`
+}
+
+type ReconciliationFailure struct {
+	PaymentID string `bson:"payment_id"`
+	Error     string `bson:"error"`
+}
+
+// AuditEntry records who or what changed the status of a payment. Entries are only ever appended.
+type AuditEntry struct {
+	ID        string `bson:"_id"`
+	PaymentID string `bson:"payment_id"`
+	// PreviousStatus is missing on the entry recording the creation of the payment.
+	PreviousStatus *PaymentStatus `bson:"previous_status,omitempty"`
+	NewStatus      PaymentStatus  `bson:"new_status"`
+	Reason         StatusReason   `bson:"reason,omitempty"`
+	Actor          string         `bson:"actor"`
+	// PayloadHash is the SHA-256 of the raw provider callback that caused the change, if any.
+	PayloadHash string `bson:"payload_hash,omitempty"`
+	// Note is why an operator forced the status, it is missing on every other change.
+	Note      string    `bson:"note,omitempty"`
+	RequestID string    `bson:"request_id,omitempty"`
+	At        time.Time `bson:"at"`
+}
+
+// APIKey lets service callers authenticate without a JWT. Only the hash of its secret is stored.
+type APIKey struct {
+	ID         string    `bson:"_id"`
+	Hash       string    `bson:"hash"`
+	Owner      string    `bson:"owner"`
+	Scopes     []string  `bson:"scopes"`
+	CreatedAt  time.Time `bson:"created_at"`
+	ExpiresAt  time.Time `bson:"expires_at,omitempty"`
+	RevokedAt  time.Time `bson:"revoked_at,omitempty"`
+	LastUsedAt time.Time `bson:"last_used_at,omitempty"`
+	RotatedTo  string    `bson:"rotated_to,omitempty"`
 }
 
 func NewUUID() string {
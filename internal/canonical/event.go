@@ -0,0 +1,161 @@
+package canonical
+
+import (
+	"fmt"
+	"time"
+)
+
+// PaymentEventType names what happened to a payment. The payment itself is only ever derived
+// from its events, in the order of their sequence.
+type PaymentEventType string
+
+const (
+	EVENT_PAYMENT_REQUESTED PaymentEventType = "PaymentRequested"
+	// EVENT_CHARGE_CREATED records what the provider gave the customer to pay with, the payment
+	// is still waiting for it.
+	EVENT_CHARGE_CREATED PaymentEventType = "ChargeCreated"
+	EVENT_AUTHORIZED     PaymentEventType = "Authorized"
+	EVENT_CAPTURED       PaymentEventType = "Captured"
+	EVENT_FAILED         PaymentEventType = "Failed"
+	EVENT_CANCELLED      PaymentEventType = "Cancelled"
+	EVENT_EXPIRED        PaymentEventType = "Expired"
+	EVENT_REFUNDED       PaymentEventType = "Refunded"
+)
+
+// statusEvents names the event of every change of status. A payment only becomes CREATED by
+// starting its log, see NewPaymentLog.
+var statusEvents = map[PaymentStatus]PaymentEventType{
+	PAYMENT_AUTHORIZED: EVENT_AUTHORIZED,
+	PAYMENT_PAYED:      EVENT_CAPTURED,
+	PAYMENT_FAILED:     EVENT_FAILED,
+	PAYMENT_CANCELLED:  EVENT_CANCELLED,
+	PAYMENT_EXPIRED:    EVENT_EXPIRED,
+	PAYMENT_REFUNDED:   EVENT_REFUNDED,
+}
+
+var eventStatuses = map[PaymentEventType]PaymentStatus{
+	EVENT_PAYMENT_REQUESTED: PAYMENT_CREATED,
+	EVENT_CHARGE_CREATED:    PAYMENT_CREATED,
+	EVENT_AUTHORIZED:        PAYMENT_AUTHORIZED,
+	EVENT_CAPTURED:          PAYMENT_PAYED,
+	EVENT_FAILED:            PAYMENT_FAILED,
+	EVENT_CANCELLED:         PAYMENT_CANCELLED,
+	EVENT_EXPIRED:           PAYMENT_EXPIRED,
+	EVENT_REFUNDED:          PAYMENT_REFUNDED,
+}
+
+// PaymentEvent is an immutable entry of the log of a payment. Sequence numbers start at 1 and
+// have no gaps within a payment, so two writers can not append the same change twice.
+type PaymentEvent struct {
+	ID        string           `bson:"_id"`
+	PaymentID string           `bson:"payment_id"`
+	Sequence  uint64           `bson:"sequence"`
+	Type      PaymentEventType `bson:"type"`
+	Reason    StatusReason     `bson:"reason,omitempty"`
+	At        time.Time        `bson:"at"`
+
+	// the fields below are only set on the PaymentRequested event
+	OrderID    string        `bson:"order_id,omitempty"`
+	CustomerID string        `bson:"customer_id,omitempty"`
+	Method     PaymentMethod `bson:"method,omitempty"`
+	Attempt    int           `bson:"attempt,omitempty"`
+	Amount     int64         `bson:"amount,omitempty"`
+
+	// Details is set on the ChargeCreated event. Logs started before that event existed have it
+	// on their PaymentRequested event.
+	Details *MethodDetails `bson:"details,omitempty"`
+
+	// CapturedAmount is only set on the Captured event of an authorized payment.
+	CapturedAmount int64 `bson:"captured_amount,omitempty"`
+}
+
+// EventID is unique per payment and sequence.
+func EventID(paymentID string, sequence uint64) string {
+	return fmt.Sprintf("%s:%d", paymentID, sequence)
+}
+
+// NewPaymentLog starts the log of a new pending payment: its PaymentRequested event, followed
+// by its ChargeCreated event when the provider already charged it.
+func NewPaymentLog(payment Payment) []PaymentEvent {
+	events := []PaymentEvent{{
+		ID:         EventID(payment.ID, 1),
+		PaymentID:  payment.ID,
+		Sequence:   1,
+		Type:       EVENT_PAYMENT_REQUESTED,
+		At:         payment.CreatedAt,
+		OrderID:    payment.OrderID,
+		CustomerID: payment.CustomerID,
+		Method:     payment.Method,
+		Attempt:    payment.Attempt,
+		Amount:     payment.Amount,
+	}}
+	if payment.Details != nil {
+		events = append(events, PaymentEvent{
+			ID:        EventID(payment.ID, 2),
+			PaymentID: payment.ID,
+			Sequence:  2,
+			Type:      EVENT_CHARGE_CREATED,
+			At:        payment.CreatedAt,
+			Details:   payment.Details,
+		})
+	}
+	return events
+}
+
+// NewPaymentEvent records the change that led the payment to its current status as the
+// sequence-th event of its log. Payments can not change back to CREATED, their log is started
+// by NewPaymentLog instead.
+func NewPaymentEvent(payment Payment, sequence uint64) PaymentEvent {
+	event := PaymentEvent{
+		ID:        EventID(payment.ID, sequence),
+		PaymentID: payment.ID,
+		Sequence:  sequence,
+		Type:      statusEvents[payment.Status],
+		Reason:    payment.Reason,
+		At:        payment.UpdatedAt,
+	}
+	if event.Type == EVENT_CAPTURED {
+		event.CapturedAmount = payment.CapturedAmount
+	}
+	return event
+}
+
+// Apply moves the payment forward by one event of its log.
+func (p *Payment) Apply(event PaymentEvent) {
+	if event.Type == EVENT_PAYMENT_REQUESTED {
+		*p = Payment{
+			ID:         event.PaymentID,
+			OrderID:    event.OrderID,
+			CustomerID: event.CustomerID,
+			Method:     event.Method,
+			Attempt:    event.Attempt,
+			Amount:     event.Amount,
+			CreatedAt:  event.At,
+		}
+	} else if event.Type != EVENT_CHARGE_CREATED {
+		p.UpdatedAt = event.At
+	}
+	if event.Details != nil {
+		p.Details = event.Details
+	}
+	if event.Type == EVENT_CAPTURED {
+		p.CapturedAmount = event.CapturedAmount
+	}
+	p.Status = eventStatuses[event.Type]
+	p.Reason = event.Reason
+	p.Version = event.Sequence
+}
+
+// Replay folds the log of a payment, ordered by sequence, into the payment. It returns nil when
+// there are no events.
+func Replay(events []PaymentEvent) *Payment {
+	if len(events) == 0 {
+		return nil
+	}
+
+	var payment Payment
+	for _, event := range events {
+		payment.Apply(event)
+	}
+	return &payment
+}
@@ -0,0 +1,115 @@
+package canonical
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReplay(t *testing.T) {
+	now := time.Date(2020, 11, 1, 12, 0, 0, 0, time.UTC)
+	requested := Payment{ID: "1234", OrderID: "order", CustomerID: "customer", Method: METHOD_PIX, CreatedAt: now, Status: PAYMENT_CREATED}
+	details := &MethodDetails{Pix: &PixDetails{QRCode: "qr-code"}}
+
+	type Given struct {
+		requested *Payment
+		// started replaces the log started from requested
+		started []PaymentEvent
+		changes []Payment
+	}
+	type Expected struct {
+		payment *Payment
+	}
+	tests := map[string]struct {
+		given    Given
+		expected Expected
+	}{
+		"given no events, must return no payment": {
+			expected: Expected{payment: nil},
+		},
+		"given only the request, must return the created payment": {
+			given: Given{requested: &requested},
+			expected: Expected{payment: &Payment{
+				ID: "1234", OrderID: "order", CustomerID: "customer", Method: METHOD_PIX, CreatedAt: now, Status: PAYMENT_CREATED, Version: 1,
+			}},
+		},
+		"given the request and its charge, must return the created payment with its details": {
+			given: Given{requested: &Payment{ID: "1234", OrderID: "order", Method: METHOD_PIX, Details: details, CreatedAt: now}},
+			expected: Expected{payment: &Payment{
+				ID: "1234", OrderID: "order", Method: METHOD_PIX, Details: details, CreatedAt: now, Status: PAYMENT_CREATED, Version: 2,
+			}},
+		},
+		"given a cancellation, must return the cancelled payment with its reason": {
+			given: Given{requested: &requested, changes: []Payment{{ID: "1234", Status: PAYMENT_CANCELLED, Reason: REASON_ORDER_CANCELLED, UpdatedAt: now.Add(time.Minute)}}},
+			expected: Expected{payment: &Payment{
+				ID: "1234", OrderID: "order", CustomerID: "customer", Method: METHOD_PIX, CreatedAt: now, UpdatedAt: now.Add(time.Minute),
+				Status: PAYMENT_CANCELLED, Reason: REASON_ORDER_CANCELLED, Version: 2,
+			}},
+		},
+		"given a partial capture of an authorization, must return the payed payment with both amounts": {
+			given: Given{
+				requested: &Payment{ID: "1234", OrderID: "order", Method: METHOD_CREDIT_CARD, Amount: 2500, CreatedAt: now, Status: PAYMENT_CREATED},
+				changes: []Payment{
+					{ID: "1234", Status: PAYMENT_AUTHORIZED, UpdatedAt: now.Add(time.Minute)},
+					{ID: "1234", Status: PAYMENT_PAYED, CapturedAmount: 1800, UpdatedAt: now.Add(time.Hour)},
+				},
+			},
+			expected: Expected{payment: &Payment{
+				ID: "1234", OrderID: "order", Method: METHOD_CREDIT_CARD, Amount: 2500, CapturedAmount: 1800, CreatedAt: now,
+				UpdatedAt: now.Add(time.Hour), Status: PAYMENT_PAYED, Version: 3,
+			}},
+		},
+		"given a refund, must return the refunded payment": {
+			given: Given{requested: &requested, changes: []Payment{
+				{ID: "1234", Status: PAYMENT_PAYED, UpdatedAt: now.Add(time.Minute)},
+				{ID: "1234", Status: PAYMENT_REFUNDED, UpdatedAt: now.Add(time.Hour)},
+			}},
+			expected: Expected{payment: &Payment{
+				ID: "1234", OrderID: "order", CustomerID: "customer", Method: METHOD_PIX, CreatedAt: now, UpdatedAt: now.Add(time.Hour),
+				Status: PAYMENT_REFUNDED, Version: 3,
+			}},
+		},
+		"given a log started before the charge event, must keep the details of the request": {
+			given: Given{started: []PaymentEvent{{
+				ID: "1234:1", PaymentID: "1234", Sequence: 1, Type: EVENT_PAYMENT_REQUESTED, At: now,
+				OrderID: "order", Method: METHOD_PIX, Details: details,
+			}}},
+			expected: Expected{payment: &Payment{
+				ID: "1234", OrderID: "order", Method: METHOD_PIX, Details: details, CreatedAt: now, Status: PAYMENT_CREATED, Version: 1,
+			}},
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			events := tc.given.started
+			if tc.given.requested != nil {
+				events = NewPaymentLog(*tc.given.requested)
+			}
+			for _, change := range tc.given.changes {
+				events = append(events, NewPaymentEvent(change, uint64(len(events)+1)))
+			}
+
+			assert.Equal(t, tc.expected.payment, Replay(events))
+		})
+	}
+}
+
+func TestNewPaymentLog(t *testing.T) {
+	now := time.Date(2020, 11, 1, 12, 0, 0, 0, time.UTC)
+	details := &MethodDetails{Pix: &PixDetails{QRCode: "qr-code"}}
+
+	events := NewPaymentLog(Payment{ID: "1234", OrderID: "order", Method: METHOD_PIX, Details: details, CreatedAt: now})
+
+	assert.Equal(t, []PaymentEvent{
+		{ID: "1234:1", PaymentID: "1234", Sequence: 1, Type: EVENT_PAYMENT_REQUESTED, At: now, OrderID: "order", Method: METHOD_PIX},
+		{ID: "1234:2", PaymentID: "1234", Sequence: 2, Type: EVENT_CHARGE_CREATED, At: now, Details: details},
+	}, events)
+}
+
+func TestNewPaymentEvent(t *testing.T) {
+	event := NewPaymentEvent(Payment{ID: "1234", Status: PAYMENT_PAYED}, 2)
+
+	assert.Equal(t, PaymentEvent{ID: "1234:2", PaymentID: "1234", Sequence: 2, Type: EVENT_CAPTURED}, event)
+}
@@ -0,0 +1,36 @@
+package canonical
+
+import "time"
+
+// PaymentFilter narrows a search of payments down to the ones matching every field set, zero
+// fields match every payment.
+type PaymentFilter struct {
+	Status     *PaymentStatus
+	OrderID    string
+	CustomerID string
+	Method     PaymentMethod
+	// CreatedFrom is inclusive and CreatedTo exclusive.
+	CreatedFrom time.Time
+	CreatedTo   time.Time
+	// Limit caps the number of payments found, the oldest ones first.
+	Limit int
+}
+
+// Match tells whether the payment is one the filter searches for.
+func (f PaymentFilter) Match(payment Payment) bool {
+	switch {
+	case f.Status != nil && payment.Status != *f.Status:
+		return false
+	case len(f.OrderID) > 0 && payment.OrderID != f.OrderID:
+		return false
+	case len(f.CustomerID) > 0 && payment.CustomerID != f.CustomerID:
+		return false
+	case f.Method != METHOD_UNSPECIFIED && payment.Method != f.Method:
+		return false
+	case !f.CreatedFrom.IsZero() && payment.CreatedAt.Before(f.CreatedFrom):
+		return false
+	case !f.CreatedTo.IsZero() && !payment.CreatedAt.Before(f.CreatedTo):
+		return false
+	}
+	return true
+}
@@ -0,0 +1,55 @@
+package canonical
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPaymentFilterMatch(t *testing.T) {
+	now := time.Date(2020, 11, 1, 12, 0, 0, 0, time.UTC)
+	payed := PAYMENT_PAYED
+	payment := Payment{ID: "1234", OrderID: "order", CustomerID: "customer", Method: METHOD_PIX, Status: PAYMENT_PAYED, CreatedAt: now}
+
+	tests := map[string]struct {
+		given    PaymentFilter
+		expected bool
+	}{
+		"given no filter, must match": {
+			given:    PaymentFilter{},
+			expected: true,
+		},
+		"given every field matching, must match": {
+			given:    PaymentFilter{Status: &payed, OrderID: "order", CustomerID: "customer", Method: METHOD_PIX, CreatedFrom: now, CreatedTo: now.Add(time.Second)},
+			expected: true,
+		},
+		"given another status, must not match": {
+			given: PaymentFilter{Status: new(PaymentStatus)},
+		},
+		"given another method, must not match": {
+			given: PaymentFilter{Method: METHOD_CASH},
+		},
+		"given created after the range, must not match": {
+			given: PaymentFilter{CreatedTo: now},
+		},
+		"given created before the range, must not match": {
+			given: PaymentFilter{CreatedFrom: now.Add(time.Second)},
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			assert.Equal(t, tc.expected, tc.given.Match(payment))
+		})
+	}
+}
+
+func TestParsePaymentStatus(t *testing.T) {
+	status, ok := ParsePaymentStatus("AUTHORIZED")
+	assert.True(t, ok)
+	assert.Equal(t, PAYMENT_AUTHORIZED, status)
+
+	_, ok = ParsePaymentStatus("UNKNOWN")
+	assert.False(t, ok)
+}
@@ -0,0 +1,125 @@
+package canonical
+
+import (
+	"fmt"
+	"time"
+)
+
+var (
+	ErrorInvalidPayment = fmt.Errorf("invalid payment method data")
+)
+
+// PaymentMethod is how the customer pays. It is saved as the method of the payment, apart from
+// the payment_type of payments created before methods existed, whose values meant nothing.
+type PaymentMethod int
+
+const (
+	// METHOD_UNSPECIFIED is the method of payments created before methods existed. New payments
+	// that do not name a method get the configured default one instead.
+	METHOD_UNSPECIFIED PaymentMethod = iota
+	METHOD_PIX
+	METHOD_CREDIT_CARD
+	METHOD_DEBIT_CARD
+	METHOD_BOLETO
+	METHOD_CASH
+)
+
+func (m PaymentMethod) String() string {
+	switch m {
+	case METHOD_UNSPECIFIED:
+		return "UNSPECIFIED"
+	case METHOD_PIX:
+		return "PIX"
+	case METHOD_CREDIT_CARD:
+		return "CREDIT_CARD"
+	case METHOD_DEBIT_CARD:
+		return "DEBIT_CARD"
+	case METHOD_BOLETO:
+		return "BOLETO"
+	case METHOD_CASH:
+		return "CASH"
+	default:
+		return "UNKNOWN"
+	}
+}
+
+// IsCard tells whether the method charges a card the customer tokenized beforehand.
+func (m PaymentMethod) IsCard() bool {
+	return m == METHOD_CREDIT_CARD || m == METHOD_DEBIT_CARD
+}
+
+var MapPaymentMethod = map[string]PaymentMethod{
+	"PIX":         METHOD_PIX,
+	"CREDIT_CARD": METHOD_CREDIT_CARD,
+	"DEBIT_CARD":  METHOD_DEBIT_CARD,
+	"BOLETO":      METHOD_BOLETO,
+	"CASH":        METHOD_CASH,
+}
+
+// MethodDetails holds what is specific to the method of a payment, only the part of its method
+// is set. The customer gives the card token, the provider fills in everything else.
+type MethodDetails struct {
+	Pix    *PixDetails    `bson:"pix,omitempty"`
+	Card   *CardDetails   `bson:"card,omitempty"`
+	Boleto *BoletoDetails `bson:"boleto,omitempty"`
+	Cash   *CashDetails   `bson:"cash,omitempty"`
+}
+
+type PixDetails struct {
+	QRCode    string    `bson:"qr_code"`
+	ExpiresAt time.Time `bson:"expires_at"`
+}
+
+type CardDetails struct {
+	// Token stands for the card at the provider. It is only handed to the provider, never saved.
+	Token string `bson:"-" json:"-"`
+	Last4 string `bson:"last4"`
+	Brand string `bson:"brand"`
+}
+
+type BoletoDetails struct {
+	Barcode string    `bson:"barcode"`
+	DueDate time.Time `bson:"due_date"`
+}
+
+// CashDetails lets the customer pay at the counter by telling the reference.
+type CashDetails struct {
+	Reference string    `bson:"reference"`
+	ExpiresAt time.Time `bson:"expires_at"`
+}
+
+// WithDeadline sets when the customer must have paid by on the details the provider left
+// without one.
+func (d MethodDetails) WithDeadline(deadline time.Time) MethodDetails {
+	if d.Pix != nil && d.Pix.ExpiresAt.IsZero() {
+		pix := *d.Pix
+		pix.ExpiresAt = deadline
+		d.Pix = &pix
+	}
+	if d.Boleto != nil && d.Boleto.DueDate.IsZero() {
+		boleto := *d.Boleto
+		boleto.DueDate = deadline
+		d.Boleto = &boleto
+	}
+	if d.Cash != nil && d.Cash.ExpiresAt.IsZero() {
+		cash := *d.Cash
+		cash.ExpiresAt = deadline
+		d.Cash = &cash
+	}
+	return d
+}
+
+// ValidateMethod checks the payment names a known method and carries what the method needs
+// from the customer.
+func (p Payment) ValidateMethod() error {
+	if p.Method <= METHOD_UNSPECIFIED || p.Method > METHOD_CASH {
+		return fmt.Errorf("%w: unknown method %d", ErrorInvalidPayment, p.Method)
+	}
+	if p.Method.IsCard() && (p.Details == nil || p.Details.Card == nil || len(p.Details.Card.Token) == 0) {
+		return fmt.Errorf("%w: %s requires a card token", ErrorInvalidPayment, p.Method)
+	}
+	if p.Method.IsCard() && p.Amount <= 0 {
+		return fmt.Errorf("%w: %s requires the amount to authorize", ErrorInvalidPayment, p.Method)
+	}
+	return nil
+}
@@ -0,0 +1,62 @@
+package canonical
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateMethod(t *testing.T) {
+	tests := map[string]struct {
+		given    Payment
+		expected error
+	}{
+		"given pix, must accept it": {
+			given: Payment{Method: METHOD_PIX},
+		},
+		"given card with token, must accept it": {
+			given: Payment{Method: METHOD_CREDIT_CARD, Amount: 2500, Details: &MethodDetails{Card: &CardDetails{Token: "tok"}}},
+		},
+		"given card without amount, must refuse it": {
+			given:    Payment{Method: METHOD_CREDIT_CARD, Details: &MethodDetails{Card: &CardDetails{Token: "tok"}}},
+			expected: ErrorInvalidPayment,
+		},
+		"given card without token, must refuse it": {
+			given:    Payment{Method: METHOD_DEBIT_CARD, Details: &MethodDetails{Card: &CardDetails{}}},
+			expected: ErrorInvalidPayment,
+		},
+		"given no method, must refuse it": {
+			given:    Payment{},
+			expected: ErrorInvalidPayment,
+		},
+		"given unknown method, must refuse it": {
+			given:    Payment{Method: METHOD_CASH + 1},
+			expected: ErrorInvalidPayment,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			err := tc.given.ValidateMethod()
+
+			if tc.expected == nil {
+				assert.NoError(t, err)
+			} else {
+				assert.ErrorIs(t, err, tc.expected)
+			}
+		})
+	}
+}
+
+func TestWithDeadline(t *testing.T) {
+	now := time.Date(2020, 11, 01, 00, 00, 00, 0, time.UTC)
+	deadline := now.Add(30 * time.Minute)
+	pix := &PixDetails{QRCode: "qr"}
+
+	details := MethodDetails{Pix: pix, Boleto: &BoletoDetails{DueDate: now.Add(72 * time.Hour)}}.WithDeadline(deadline)
+
+	assert.Equal(t, deadline, details.Pix.ExpiresAt)
+	assert.Equal(t, now.Add(72*time.Hour), details.Boleto.DueDate)
+	assert.True(t, pix.ExpiresAt.IsZero(), "the provider's details are left untouched")
+}
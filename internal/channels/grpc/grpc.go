@@ -0,0 +1,82 @@
+package grpc
+
+import (
+	"context"
+	"net"
+	"tech-challenge-payment/internal/auth/token"
+	"tech-challenge-payment/internal/channels/grpc/pb"
+	"tech-challenge-payment/internal/events"
+	"tech-challenge-payment/internal/middlewares"
+	"tech-challenge-payment/internal/service"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/health"
+	"google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/reflection"
+)
+
+const (
+	shutdownTimeout = 10 * time.Second
+)
+
+type server struct {
+	payment pb.PaymentServiceServer
+	tokens  token.Validator
+	apiKeys middlewares.APIKeyAuthenticator
+	port    string
+}
+
+func New(paymentSvc service.PaymentService, apiKeySvc service.APIKeyService, hub events.Hub, tokens token.Validator, port string) server {
+	return server{
+		payment: NewPaymentChannel(paymentSvc, hub),
+		tokens:  tokens,
+		apiKeys: apiKeySvc,
+		port:    port,
+	}
+}
+
+// Start serves until ctx is done, then waits for the calls in flight to finish.
+func (s server) Start(ctx context.Context) error {
+	listener, err := net.Listen("tcp", ":"+s.port)
+	if err != nil {
+		return err
+	}
+
+	srv := s.newServer()
+	go func() {
+		<-ctx.Done()
+
+		stopped := make(chan struct{})
+		go func() {
+			srv.GracefulStop()
+			close(stopped)
+		}()
+
+		// watchers only leave when they want to, they are cut off once the timeout elapses
+		select {
+		case <-stopped:
+		case <-time.After(shutdownTimeout):
+			srv.Stop()
+		}
+	}()
+
+	return srv.Serve(listener)
+}
+
+func (s server) newServer() *grpc.Server {
+	srv := grpc.NewServer(
+		grpc.ChainUnaryInterceptor(middlewares.UnaryLogger, middlewares.UnaryAuthorization(s.tokens, s.apiKeys)),
+		grpc.ChainStreamInterceptor(middlewares.StreamLogger, middlewares.StreamAuthorization(s.tokens, s.apiKeys)),
+	)
+
+	pb.RegisterPaymentServiceServer(srv, s.payment)
+
+	healthSrv := health.NewServer()
+	healthSrv.SetServingStatus(pb.PaymentService_ServiceDesc.ServiceName, grpc_health_v1.HealthCheckResponse_SERVING)
+	grpc_health_v1.RegisterHealthServer(srv, healthSrv)
+
+	reflection.Register(srv)
+
+	return srv
+}
@@ -0,0 +1,73 @@
+package grpc
+
+import (
+	"tech-challenge-payment/internal/canonical"
+	"tech-challenge-payment/internal/channels/grpc/pb"
+
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+var (
+	statusToProto = map[canonical.PaymentStatus]pb.PaymentStatus{
+		canonical.PAYMENT_CREATED:    pb.PaymentStatus_PAYMENT_STATUS_CREATED,
+		canonical.PAYMENT_PAYED:      pb.PaymentStatus_PAYMENT_STATUS_PAYED,
+		canonical.PAYMENT_FAILED:     pb.PaymentStatus_PAYMENT_STATUS_FAILED,
+		canonical.PAYMENT_CANCELLED:  pb.PaymentStatus_PAYMENT_STATUS_CANCELLED,
+		canonical.PAYMENT_EXPIRED:    pb.PaymentStatus_PAYMENT_STATUS_EXPIRED,
+		canonical.PAYMENT_AUTHORIZED: pb.PaymentStatus_PAYMENT_STATUS_AUTHORIZED,
+		canonical.PAYMENT_REFUNDED:   pb.PaymentStatus_PAYMENT_STATUS_REFUNDED,
+	}
+)
+
+func toProto(payment canonical.Payment) *pb.Payment {
+	return &pb.Payment{
+		Id:             payment.ID,
+		OrderId:        payment.OrderID,
+		PaymentType:    int32(payment.Method),
+		Method:         pb.PaymentMethod(payment.Method),
+		Status:         statusToProto[payment.Status],
+		CreatedAt:      timestamppb.New(payment.CreatedAt),
+		UpdatedAt:      timestamppb.New(payment.UpdatedAt),
+		Instructions:   toInstructions(payment.Details),
+		Amount:         payment.Amount,
+		CapturedAmount: payment.CapturedAmount,
+	}
+}
+
+func toInstructions(details *canonical.MethodDetails) *pb.Instructions {
+	if details == nil {
+		return nil
+	}
+
+	instructions := &pb.Instructions{}
+	switch {
+	case details.Pix != nil:
+		instructions.QrCode = details.Pix.QRCode
+		instructions.ExpiresAt = timestamppb.New(details.Pix.ExpiresAt)
+	case details.Card != nil:
+		instructions.CardLast4 = details.Card.Last4
+		instructions.CardBrand = details.Card.Brand
+	case details.Boleto != nil:
+		instructions.Barcode = details.Boleto.Barcode
+		instructions.ExpiresAt = timestamppb.New(details.Boleto.DueDate)
+	case details.Cash != nil:
+		instructions.Reference = details.Cash.Reference
+		instructions.ExpiresAt = timestamppb.New(details.Cash.ExpiresAt)
+	}
+	return instructions
+}
+
+func toCanonical(request *pb.CreatePaymentRequest) canonical.Payment {
+	payment := canonical.Payment{
+		OrderID: request.GetOrderId(),
+		Method:  canonical.PaymentMethod(request.GetPaymentType()),
+		Amount:  request.GetAmount(),
+	}
+	if request.GetMethod() != pb.PaymentMethod_PAYMENT_METHOD_UNSPECIFIED {
+		payment.Method = canonical.PaymentMethod(request.GetMethod())
+	}
+	if len(request.GetCardToken()) > 0 {
+		payment.Details = &canonical.MethodDetails{Card: &canonical.CardDetails{Token: request.GetCardToken()}}
+	}
+	return payment
+}
@@ -0,0 +1,139 @@
+package grpc
+
+import (
+	"context"
+	"errors"
+	"tech-challenge-payment/internal/canonical"
+	"tech-challenge-payment/internal/channels/grpc/pb"
+	"tech-challenge-payment/internal/events"
+	"tech-challenge-payment/internal/service"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+type payment struct {
+	pb.UnimplementedPaymentServiceServer
+	paymentSvc service.PaymentService
+	hub        events.Hub
+}
+
+func NewPaymentChannel(paymentSvc service.PaymentService, hub events.Hub) pb.PaymentServiceServer {
+	return &payment{
+		paymentSvc: paymentSvc,
+		hub:        hub,
+	}
+}
+
+func (p *payment) CreatePayment(ctx context.Context, request *pb.CreatePaymentRequest) (*pb.Payment, error) {
+	if len(request.GetOrderId()) == 0 {
+		return nil, status.Error(codes.InvalidArgument, "missing order id")
+	}
+
+	payment, err := p.paymentSvc.Create(ctx, toCanonical(request))
+	if err != nil {
+		return nil, toStatusError(err, "error creating payment")
+	}
+
+	return toProto(*payment), nil
+}
+
+func (p *payment) GetPayment(ctx context.Context, request *pb.GetPaymentRequest) (*pb.Payment, error) {
+	if len(request.GetId()) == 0 {
+		return nil, status.Error(codes.InvalidArgument, "missing id")
+	}
+
+	payment, err := p.paymentSvc.GetByID(ctx, request.GetId())
+	if err != nil || payment == nil {
+		return nil, status.Error(codes.NotFound, "error searching payment")
+	}
+
+	return toProto(*payment), nil
+}
+
+func (p *payment) ListPayments(ctx context.Context, _ *pb.ListPaymentsRequest) (*pb.ListPaymentsResponse, error) {
+	payments, err := p.paymentSvc.GetAll(ctx)
+	if err != nil {
+		return nil, toStatusError(err, "error searching payments")
+	}
+
+	response := &pb.ListPaymentsResponse{
+		Payments: make([]*pb.Payment, 0, len(payments)),
+	}
+	for _, payment := range payments {
+		response.Payments = append(response.Payments, toProto(payment))
+	}
+
+	return response, nil
+}
+
+func (p *payment) CancelPayment(ctx context.Context, request *pb.CancelPaymentRequest) (*pb.Payment, error) {
+	if len(request.GetId()) == 0 {
+		return nil, status.Error(codes.InvalidArgument, "missing id")
+	}
+
+	payment, err := p.paymentSvc.Cancel(ctx, request.GetId(), canonical.REASON_REQUESTED)
+	if err != nil {
+		return nil, toStatusError(err, "error cancelling payment")
+	}
+
+	return toProto(*payment), nil
+}
+
+func (p *payment) WatchPayment(request *pb.WatchPaymentRequest, stream pb.PaymentService_WatchPaymentServer) error {
+	if len(request.GetId()) == 0 {
+		return status.Error(codes.InvalidArgument, "missing id")
+	}
+
+	ctx := stream.Context()
+
+	eventsCh, unsubscribe := p.hub.Subscribe(request.GetId(), 0)
+	defer unsubscribe()
+
+	payment, err := p.paymentSvc.GetByID(ctx, request.GetId())
+	if err != nil || payment == nil {
+		return status.Error(codes.NotFound, "error searching payment")
+	}
+
+	if err := stream.Send(toProto(*payment)); err != nil {
+		return err
+	}
+	lastStatus := payment.Status
+
+	for !lastStatus.IsFinal() {
+		select {
+		case <-ctx.Done():
+			return status.FromContextError(ctx.Err()).Err()
+		case event, ok := <-eventsCh:
+			if !ok {
+				return status.Error(codes.Unavailable, "watch stream fell behind, watch again")
+			}
+			if event.Payment.Status == lastStatus {
+				continue
+			}
+			if err := stream.Send(toProto(event.Payment)); err != nil {
+				return err
+			}
+			lastStatus = event.Payment.Status
+		}
+	}
+
+	return nil
+}
+
+func toStatusError(err error, message string) error {
+	switch {
+	case errors.Is(err, canonical.ErrorNotFound):
+		return status.Error(codes.NotFound, message)
+	case errors.Is(err, canonical.ErrorForbidden):
+		return status.Error(codes.PermissionDenied, message)
+	case errors.Is(err, canonical.ErrorInvalidTransition),
+		errors.Is(err, canonical.ErrorAttemptPending),
+		errors.Is(err, canonical.ErrorIntentSettled):
+		return status.Error(codes.FailedPrecondition, message)
+	case errors.Is(err, canonical.ErrorInvalidPayment):
+		return status.Error(codes.InvalidArgument, err.Error())
+	default:
+		return status.Error(codes.Internal, message)
+	}
+}
@@ -0,0 +1,396 @@
+package grpc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"tech-challenge-payment/internal/auth/token"
+	"tech-challenge-payment/internal/canonical"
+	"tech-challenge-payment/internal/channels/grpc/pb"
+	"tech-challenge-payment/internal/config"
+	"tech-challenge-payment/internal/events"
+	"tech-challenge-payment/internal/service"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+const (
+	tokenKey = "grpc-test-key"
+)
+
+func TestCreatePayment(t *testing.T) {
+	type Given struct {
+		request        *pb.CreatePaymentRequest
+		paymentService service.PaymentService
+	}
+	type Expected struct {
+		code codes.Code
+	}
+	tests := map[string]struct {
+		given    Given
+		expected Expected
+	}{
+		"given valid request must create payment": {
+			given: Given{
+				request:        &pb.CreatePaymentRequest{OrderId: "1234", PaymentType: 1},
+				paymentService: mockPaymentServiceForCreate(nil),
+			},
+			expected: Expected{
+				code: codes.OK,
+			},
+		},
+		"given missing order id must return invalid argument": {
+			given: Given{
+				request:        &pb.CreatePaymentRequest{},
+				paymentService: &PaymentServiceMock{},
+			},
+			expected: Expected{
+				code: codes.InvalidArgument,
+			},
+		},
+		"given card payment without token must return invalid argument": {
+			given: Given{
+				request:        &pb.CreatePaymentRequest{OrderId: "1234", PaymentType: 1},
+				paymentService: mockPaymentServiceForCreate(fmt.Errorf("%w: CREDIT_CARD requires a card token", canonical.ErrorInvalidPayment)),
+			},
+			expected: Expected{
+				code: codes.InvalidArgument,
+			},
+		},
+		"given application error must return internal": {
+			given: Given{
+				request:        &pb.CreatePaymentRequest{OrderId: "1234", PaymentType: 1},
+				paymentService: mockPaymentServiceForCreate(errors.New("")),
+			},
+			expected: Expected{
+				code: codes.Internal,
+			},
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			client := newTestClient(t, tc.given.paymentService)
+
+			payment, err := client.CreatePayment(authorizedContext(t), tc.given.request)
+
+			assert.Equal(t, tc.expected.code, status.Code(err))
+			if tc.expected.code == codes.OK {
+				assert.Equal(t, "1234", payment.GetOrderId())
+				assert.Equal(t, pb.PaymentStatus_PAYMENT_STATUS_CREATED, payment.GetStatus())
+			}
+		})
+	}
+}
+
+func TestCreateCardPayment(t *testing.T) {
+	paymentSvc := new(PaymentServiceMock)
+	paymentSvc.On("Create", mock.Anything, canonical.Payment{
+		OrderID: "1234",
+		Method:  canonical.METHOD_CREDIT_CARD,
+		Amount:  2500,
+		Details: &canonical.MethodDetails{Card: &canonical.CardDetails{Token: "tok_4242"}},
+	}).Return(&canonical.Payment{
+		ID:      "payment_valid",
+		OrderID: "1234",
+		Method:  canonical.METHOD_CREDIT_CARD,
+		Status:  canonical.PAYMENT_CREATED,
+		Amount:  2500,
+		Details: &canonical.MethodDetails{Card: &canonical.CardDetails{Last4: "4242", Brand: "VISA"}},
+	}, nil)
+	client := newTestClient(t, paymentSvc)
+
+	payment, err := client.CreatePayment(authorizedContext(t), &pb.CreatePaymentRequest{
+		OrderId:     "1234",
+		PaymentType: 1,
+		Method:      pb.PaymentMethod_PAYMENT_METHOD_CREDIT_CARD,
+		CardToken:   "tok_4242",
+		Amount:      2500,
+	})
+
+	assert.NoError(t, err)
+	assert.Equal(t, pb.PaymentMethod_PAYMENT_METHOD_CREDIT_CARD, payment.GetMethod())
+	assert.Equal(t, "4242", payment.GetInstructions().GetCardLast4())
+	assert.Equal(t, "VISA", payment.GetInstructions().GetCardBrand())
+	assert.Equal(t, int64(2500), payment.GetAmount())
+}
+
+func TestGetPayment(t *testing.T) {
+	type Given struct {
+		id             string
+		paymentService service.PaymentService
+	}
+	type Expected struct {
+		code codes.Code
+	}
+	tests := map[string]struct {
+		given    Given
+		expected Expected
+	}{
+		"given valid id must return payment": {
+			given: Given{
+				id:             "1234",
+				paymentService: mockPaymentServiceForGetByID("1234", &canonical.Payment{ID: "1234"}, nil),
+			},
+			expected: Expected{
+				code: codes.OK,
+			},
+		},
+		"given empty id must return invalid argument": {
+			given: Given{
+				id:             "",
+				paymentService: &PaymentServiceMock{},
+			},
+			expected: Expected{
+				code: codes.InvalidArgument,
+			},
+		},
+		"given unknown id must return not found": {
+			given: Given{
+				id:             "1234",
+				paymentService: mockPaymentServiceForGetByID("1234", nil, canonical.ErrorNotFound),
+			},
+			expected: Expected{
+				code: codes.NotFound,
+			},
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			client := newTestClient(t, tc.given.paymentService)
+
+			payment, err := client.GetPayment(authorizedContext(t), &pb.GetPaymentRequest{Id: tc.given.id})
+
+			assert.Equal(t, tc.expected.code, status.Code(err))
+			if tc.expected.code == codes.OK {
+				assert.Equal(t, tc.given.id, payment.GetId())
+			}
+		})
+	}
+}
+
+func TestListPayments(t *testing.T) {
+	paymentSvc := new(PaymentServiceMock)
+	paymentSvc.On("GetAll", mock.Anything).Return([]canonical.Payment{{ID: "1234"}, {ID: "1235"}}, nil)
+
+	client := newTestClient(t, paymentSvc)
+
+	response, err := client.ListPayments(authorizedContext(t), &pb.ListPaymentsRequest{})
+
+	assert.NoError(t, err)
+	assert.Len(t, response.GetPayments(), 2)
+}
+
+func TestListPaymentsForbidden(t *testing.T) {
+	paymentSvc := new(PaymentServiceMock)
+	paymentSvc.On("GetAll", mock.Anything).Return(nil, canonical.ErrorForbidden)
+
+	client := newTestClient(t, paymentSvc)
+
+	_, err := client.ListPayments(authorizedContext(t), &pb.ListPaymentsRequest{})
+
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+}
+
+func TestCancelPayment(t *testing.T) {
+	type Given struct {
+		paymentService service.PaymentService
+	}
+	type Expected struct {
+		code codes.Code
+	}
+	tests := map[string]struct {
+		given    Given
+		expected Expected
+	}{
+		"given created payment must cancel it": {
+			given: Given{
+				paymentService: mockPaymentServiceForCancel(&canonical.Payment{ID: "1234", Status: canonical.PAYMENT_CANCELLED}, nil),
+			},
+			expected: Expected{
+				code: codes.OK,
+			},
+		},
+		"given payment already finished must return failed precondition": {
+			given: Given{
+				paymentService: mockPaymentServiceForCancel(nil, canonical.ErrorInvalidTransition),
+			},
+			expected: Expected{
+				code: codes.FailedPrecondition,
+			},
+		},
+		"given unknown payment must return not found": {
+			given: Given{
+				paymentService: mockPaymentServiceForCancel(nil, canonical.ErrorNotFound),
+			},
+			expected: Expected{
+				code: codes.NotFound,
+			},
+		},
+		"given application error must return internal": {
+			given: Given{
+				paymentService: mockPaymentServiceForCancel(nil, errors.New("")),
+			},
+			expected: Expected{
+				code: codes.Internal,
+			},
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			client := newTestClient(t, tc.given.paymentService)
+
+			payment, err := client.CancelPayment(authorizedContext(t), &pb.CancelPaymentRequest{Id: "1234"})
+
+			assert.Equal(t, tc.expected.code, status.Code(err))
+			if tc.expected.code == codes.OK {
+				assert.Equal(t, pb.PaymentStatus_PAYMENT_STATUS_CANCELLED, payment.GetStatus())
+			}
+		})
+	}
+}
+
+func TestWatchPayment(t *testing.T) {
+	paymentSvc := new(PaymentServiceMock)
+	paymentSvc.On("GetByID", mock.Anything, "watch_1234").Return(&canonical.Payment{ID: "watch_1234", Status: canonical.PAYMENT_CREATED}, nil)
+
+	hub := events.NewHub()
+	client := pb.NewPaymentServiceClient(newTestConn(t, paymentSvc, hub))
+
+	stream, err := client.WatchPayment(authorizedContext(t), &pb.WatchPaymentRequest{Id: "watch_1234"})
+	assert.NoError(t, err)
+
+	var received []pb.PaymentStatus
+	for {
+		payment, err := stream.Recv()
+		if err != nil {
+			break
+		}
+		received = append(received, payment.GetStatus())
+
+		if payment.GetStatus() == pb.PaymentStatus_PAYMENT_STATUS_CREATED {
+			hub.Publish(canonical.Payment{ID: "watch_1234", Status: canonical.PAYMENT_CREATED})
+			hub.Publish(canonical.Payment{ID: "watch_1234", Status: canonical.PAYMENT_PAYED})
+		}
+	}
+
+	assert.Equal(t, []pb.PaymentStatus{
+		pb.PaymentStatus_PAYMENT_STATUS_CREATED,
+		pb.PaymentStatus_PAYMENT_STATUS_PAYED,
+	}, received)
+}
+
+func TestAuthorization(t *testing.T) {
+	client := newTestClient(t, &PaymentServiceMock{})
+
+	_, err := client.GetPayment(context.Background(), &pb.GetPaymentRequest{Id: "1234"})
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+
+	ctx := metadata.AppendToOutgoingContext(context.Background(), "authorization", "Bearer invalid")
+	stream, err := client.WatchPayment(ctx, &pb.WatchPaymentRequest{Id: "1234"})
+	assert.NoError(t, err)
+	_, err = stream.Recv()
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+
+	signed, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"sub":   "tester",
+		"scope": "payments:read",
+		"exp":   time.Now().Add(time.Hour).Unix(),
+	}).SignedString([]byte(tokenKey))
+	assert.NoError(t, err)
+	ctx = metadata.AppendToOutgoingContext(context.Background(), "authorization", "Bearer "+signed)
+	_, err = client.CancelPayment(ctx, &pb.CancelPaymentRequest{Id: "1234"})
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+}
+
+func TestHealthCheck(t *testing.T) {
+	conn := newTestConn(t, &PaymentServiceMock{}, events.NewHub())
+
+	response, err := grpc_health_v1.NewHealthClient(conn).Check(context.Background(), &grpc_health_v1.HealthCheckRequest{})
+
+	assert.NoError(t, err)
+	assert.Equal(t, grpc_health_v1.HealthCheckResponse_SERVING, response.GetStatus())
+}
+
+func newTestConn(t *testing.T, paymentSvc service.PaymentService, hub events.Hub) *grpc.ClientConn {
+	listener := bufconn.Listen(1024 * 1024)
+	srv := server{
+		payment: &payment{
+			paymentSvc: paymentSvc,
+			hub:        hub,
+		},
+		tokens: token.NewValidator(config.TokenConfig{Key: tokenKey}, canonical.SystemClock()),
+	}.newServer()
+	go srv.Serve(listener)
+	t.Cleanup(srv.Stop)
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return listener.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	return conn
+}
+
+func newTestClient(t *testing.T, paymentSvc service.PaymentService) pb.PaymentServiceClient {
+	return pb.NewPaymentServiceClient(newTestConn(t, paymentSvc, events.NewHub()))
+}
+
+func authorizedContext(t *testing.T) context.Context {
+	signed, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"sub":   "tester",
+		"scope": "payments:read payments:write",
+		"exp":   time.Now().Add(time.Hour).Unix(),
+	}).SignedString([]byte(tokenKey))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return metadata.AppendToOutgoingContext(context.Background(), "authorization", "Bearer "+signed)
+}
+
+func mockPaymentServiceForCreate(err error) *PaymentServiceMock {
+	mockPaymentSvc := new(PaymentServiceMock)
+	mockPaymentSvc.On("Create", mock.Anything, canonical.Payment{
+		OrderID: "1234",
+		Method:  canonical.METHOD_PIX,
+	}).Return(&canonical.Payment{
+		ID:      "payment_valid",
+		OrderID: "1234",
+		Method:  canonical.METHOD_PIX,
+		Status:  canonical.PAYMENT_CREATED,
+	}, err)
+	return mockPaymentSvc
+}
+
+func mockPaymentServiceForGetByID(paymentID string, paymentReturned *canonical.Payment, err error) *PaymentServiceMock {
+	mockPaymentSvc := new(PaymentServiceMock)
+	mockPaymentSvc.On("GetByID", mock.Anything, paymentID).Return(paymentReturned, err)
+	return mockPaymentSvc
+}
+
+func mockPaymentServiceForCancel(paymentReturned *canonical.Payment, err error) *PaymentServiceMock {
+	mockPaymentSvc := new(PaymentServiceMock)
+	mockPaymentSvc.On("Cancel", mock.Anything, "1234", canonical.REASON_REQUESTED).Return(paymentReturned, err)
+	return mockPaymentSvc
+}
@@ -0,0 +1,124 @@
+package rest
+
+import (
+	"errors"
+	"net/http"
+	"tech-challenge-payment/internal/auth/principal"
+	"tech-challenge-payment/internal/canonical"
+	"tech-challenge-payment/internal/service"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+type APIKey interface {
+	RegisterGroup(g *echo.Group)
+	Create(c echo.Context) error
+	GetAll(c echo.Context) error
+	Revoke(c echo.Context) error
+	Rotate(c echo.Context) error
+}
+
+type apiKey struct {
+	apiKeySvc service.APIKeyService
+	clock     canonical.Clock
+}
+
+func NewAPIKeyChannel(apiKeySvc service.APIKeyService, clock canonical.Clock) APIKey {
+	return &apiKey{
+		apiKeySvc: apiKeySvc,
+		clock:     clock,
+	}
+}
+
+func (a *apiKey) RegisterGroup(g *echo.Group) {
+	g.POST("", a.Create)
+	g.GET("", a.GetAll)
+	g.DELETE("/:id", a.Revoke)
+	g.POST("/:id/rotate", a.Rotate)
+}
+
+func (a *apiKey) Create(c echo.Context) error {
+	var request APIKeyRequest
+	if err := c.Bind(&request); err != nil {
+		return c.JSON(http.StatusBadRequest, Response{
+			Message: "Invalid request body",
+		})
+	}
+
+	if message := request.validate(a.clock.Now()); len(message) > 0 {
+		return c.JSON(http.StatusBadRequest, Response{
+			Message: message,
+		})
+	}
+
+	stored, key, err := a.apiKeySvc.Create(c.Request().Context(), request.Owner, request.Scopes, request.ExpiresAt)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, "error creating api key")
+	}
+
+	return c.JSON(http.StatusCreated, toAPIKeyResponse(stored, key))
+}
+
+func (a *apiKey) GetAll(c echo.Context) error {
+	keys, err := a.apiKeySvc.GetAll(c.Request().Context())
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, "error searching api keys")
+	}
+
+	response := make([]APIKeyResponse, 0, len(keys))
+	for _, key := range keys {
+		response = append(response, toAPIKeyResponse(key, ""))
+	}
+
+	return c.JSON(http.StatusOK, response)
+}
+
+func (a *apiKey) Revoke(c echo.Context) error {
+	if err := a.apiKeySvc.Revoke(c.Request().Context(), c.Param("id")); err != nil {
+		if errors.Is(err, canonical.ErrorNotFound) {
+			return c.JSON(http.StatusNotFound, Response{
+				Message: "api key not found or already revoked",
+			})
+		}
+		return c.JSON(http.StatusInternalServerError, "error revoking api key")
+	}
+
+	return c.NoContent(http.StatusNoContent)
+}
+
+func (a *apiKey) Rotate(c echo.Context) error {
+	stored, key, err := a.apiKeySvc.Rotate(c.Request().Context(), c.Param("id"))
+	if err != nil {
+		if errors.Is(err, canonical.ErrorNotFound) {
+			return c.JSON(http.StatusNotFound, Response{
+				Message: "api key not found, revoked or already rotated",
+			})
+		}
+		return c.JSON(http.StatusInternalServerError, "error rotating api key")
+	}
+
+	return c.JSON(http.StatusCreated, toAPIKeyResponse(stored, key))
+}
+
+func (r APIKeyRequest) validate(now time.Time) string {
+	if len(r.Owner) == 0 {
+		return "owner is required"
+	}
+
+	if len(r.Scopes) == 0 {
+		return "at least one scope is required"
+	}
+
+	for _, scope := range r.Scopes {
+		if !principal.IsScope(scope) {
+			return "unknown scope " + scope
+		}
+	}
+
+	if !r.ExpiresAt.IsZero() && !r.ExpiresAt.After(now) {
+		return "expires_at must be in the future"
+	}
+
+	return ""
+}
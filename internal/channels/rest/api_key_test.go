@@ -0,0 +1,168 @@
+package rest
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"tech-challenge-payment/internal/canonical"
+	"tech-challenge-payment/internal/canonical/canonicaltest"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+var apiKeyNow = time.Date(2024, 7, 1, 12, 0, 0, 0, time.UTC)
+
+func TestCreateAPIKey(t *testing.T) {
+	endpoint := "/admin/api-keys"
+
+	type Given struct {
+		request *http.Request
+		err     error
+	}
+	type Expected struct {
+		statusCode int
+	}
+	tests := map[string]struct {
+		given    Given
+		expected Expected
+	}{
+		"given valid request, must return the key once with status 201": {
+			given: Given{
+				request: createJsonRequest(http.MethodPost, endpoint, APIKeyRequest{Owner: "batch", Scopes: []string{"payments:read"}}),
+			},
+			expected: Expected{statusCode: http.StatusCreated},
+		},
+		"given request without owner, must return 400": {
+			given: Given{
+				request: createJsonRequest(http.MethodPost, endpoint, APIKeyRequest{Scopes: []string{"payments:read"}}),
+			},
+			expected: Expected{statusCode: http.StatusBadRequest},
+		},
+		"given request with unknown scope, must return 400": {
+			given: Given{
+				request: createJsonRequest(http.MethodPost, endpoint, APIKeyRequest{Owner: "batch", Scopes: []string{"orders:read"}}),
+			},
+			expected: Expected{statusCode: http.StatusBadRequest},
+		},
+		"given request expiring in the past, must return 400": {
+			given: Given{
+				request: createJsonRequest(http.MethodPost, endpoint, APIKeyRequest{Owner: "batch", Scopes: []string{"payments:read"}, ExpiresAt: apiKeyNow.Add(-time.Second)}),
+			},
+			expected: Expected{statusCode: http.StatusBadRequest},
+		},
+		"given request expiring right now, must return 400": {
+			given: Given{
+				request: createJsonRequest(http.MethodPost, endpoint, APIKeyRequest{Owner: "batch", Scopes: []string{"payments:read"}, ExpiresAt: apiKeyNow}),
+			},
+			expected: Expected{statusCode: http.StatusBadRequest},
+		},
+		"given request expiring in the future, must return the key with status 201": {
+			given: Given{
+				request: createJsonRequest(http.MethodPost, endpoint, APIKeyRequest{Owner: "batch", Scopes: []string{"payments:read"}, ExpiresAt: apiKeyNow.Add(time.Second)}),
+			},
+			expected: Expected{statusCode: http.StatusCreated},
+		},
+		"given error creating, must return 500": {
+			given: Given{
+				request: createJsonRequest(http.MethodPost, endpoint, APIKeyRequest{Owner: "batch", Scopes: []string{"payments:read"}}),
+				err:     errors.New("db error"),
+			},
+			expected: Expected{statusCode: http.StatusInternalServerError},
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			apiKeySvc := &APIKeyServiceMock{}
+			apiKeySvc.On("Create", mock.Anything, "batch", []string{"payments:read"}, mock.Anything).
+				Return(canonical.APIKey{ID: "key_valid", Hash: "hash", Owner: "batch"}, "key_valid.secret", tc.given.err)
+			a := apiKey{apiKeySvc: apiKeySvc, clock: canonicaltest.NewClock(apiKeyNow)}
+			rec := httptest.NewRecorder()
+
+			err := a.Create(echo.New().NewContext(tc.given.request, rec))
+
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expected.statusCode, rec.Code)
+			if tc.expected.statusCode == http.StatusCreated {
+				var response map[string]any
+				assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &response))
+				assert.Equal(t, "key_valid.secret", response["key"])
+				assert.NotContains(t, response, "hash")
+			}
+		})
+	}
+}
+
+func TestGetAllAPIKeys(t *testing.T) {
+	apiKeySvc := &APIKeyServiceMock{}
+	apiKeySvc.On("GetAll", mock.Anything).Return([]canonical.APIKey{{ID: "key_valid", Hash: "hash", LastUsedAt: time.Now()}}, nil)
+	a := apiKey{apiKeySvc: apiKeySvc}
+	rec := httptest.NewRecorder()
+
+	err := a.GetAll(echo.New().NewContext(createRequest(http.MethodGet, "/admin/api-keys"), rec))
+
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	var response []map[string]any
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &response))
+	assert.Len(t, response, 1)
+	assert.NotContains(t, response[0], "key")
+	assert.NotContains(t, response[0], "hash")
+	assert.Contains(t, response[0], "last_used_at")
+}
+
+func TestRevokeAPIKey(t *testing.T) {
+	tests := map[string]struct {
+		err        error
+		statusCode int
+	}{
+		"given active key, must return 204":     {statusCode: http.StatusNoContent},
+		"given unknown key, must return 404":    {err: canonical.ErrorNotFound, statusCode: http.StatusNotFound},
+		"given error revoking, must return 500": {err: errors.New("db error"), statusCode: http.StatusInternalServerError},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			apiKeySvc := &APIKeyServiceMock{}
+			apiKeySvc.On("Revoke", mock.Anything, "key_valid").Return(tc.err)
+			a := apiKey{apiKeySvc: apiKeySvc}
+			rec := httptest.NewRecorder()
+			c := echo.New().NewContext(createRequest(http.MethodDelete, "/admin/api-keys/key_valid"), rec)
+			c.SetParamNames("id")
+			c.SetParamValues("key_valid")
+
+			assert.NoError(t, a.Revoke(c))
+			assert.Equal(t, tc.statusCode, rec.Code)
+		})
+	}
+}
+
+func TestRotateAPIKey(t *testing.T) {
+	tests := map[string]struct {
+		err        error
+		statusCode int
+	}{
+		"given active key, must return the new key with status 201": {statusCode: http.StatusCreated},
+		"given rotated key, must return 404":                        {err: canonical.ErrorNotFound, statusCode: http.StatusNotFound},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			apiKeySvc := &APIKeyServiceMock{}
+			apiKeySvc.On("Rotate", mock.Anything, "key_valid").Return(canonical.APIKey{ID: "key_new"}, "key_new.secret", tc.err)
+			a := apiKey{apiKeySvc: apiKeySvc}
+			rec := httptest.NewRecorder()
+			c := echo.New().NewContext(createRequest(http.MethodPost, "/admin/api-keys/key_valid/rotate"), rec)
+			c.SetParamNames("id")
+			c.SetParamValues("key_valid")
+
+			assert.NoError(t, a.Rotate(c))
+			assert.Equal(t, tc.statusCode, rec.Code)
+		})
+	}
+}
@@ -1,6 +1,7 @@
 package rest
 
 import (
+	"tech-challenge-payment/internal/canonical"
 	"time"
 )
 
@@ -9,14 +10,87 @@ type Response struct {
 }
 
 type PaymentRequest struct {
-	PaymentType int       `json:"payment_type"`
-	CreatedAt   time.Time `json:"created_at"`
-	UpdatedAt   time.Time `json:"updated_at"`
-	Status      int       `json:"status"`
-	OrderID     string    `json:"order_id"`
+	// PaymentType is the method by its number, Method wins when both are given.
+	PaymentType int          `json:"payment_type"`
+	Method      string       `json:"method"`
+	Card        *CardRequest `json:"card"`
+	// Amount is in cents, card payments authorize it.
+	Amount    int64     `json:"amount"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+	Status    int       `json:"status"`
+	OrderID   string    `json:"order_id"`
+}
+
+// CardRequest carries the card as tokenized by the provider on the customer's device.
+type CardRequest struct {
+	Token string `json:"token"`
+}
+
+// CaptureRequest takes part of the authorized amount, in cents, no amount captures all of it.
+type CaptureRequest struct {
+	Amount int64 `json:"amount"`
+}
+
+// CreatePaymentResponse is the payment created along with what the customer must do to pay it.
+type CreatePaymentResponse struct {
+	canonical.Payment
+	Instructions InstructionsResponse `json:"instructions"`
+}
+
+type InstructionsResponse struct {
+	Method    string     `json:"method"`
+	Message   string     `json:"message,omitempty"`
+	QRCode    string     `json:"qr_code,omitempty"`
+	Barcode   string     `json:"barcode,omitempty"`
+	Reference string     `json:"reference,omitempty"`
+	CardLast4 string     `json:"card_last4,omitempty"`
+	CardBrand string     `json:"card_brand,omitempty"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
 }
 
 type PaymentCallback struct {
 	PaymentID string `json:"payment_id"`
 	Status    string `json:"status"`
 }
+
+type AuditEntryResponse struct {
+	ID             string    `json:"id"`
+	PaymentID      string    `json:"payment_id"`
+	PreviousStatus *string   `json:"previous_status"`
+	NewStatus      string    `json:"new_status"`
+	Reason         string    `json:"reason,omitempty"`
+	Actor          string    `json:"actor"`
+	PayloadHash    string    `json:"payload_hash,omitempty"`
+	Note           string    `json:"note,omitempty"`
+	RequestID      string    `json:"request_id,omitempty"`
+	At             time.Time `json:"at"`
+}
+
+type IntentResponse struct {
+	OrderID     string    `json:"order_id"`
+	Status      string    `json:"status"`
+	Reason      string    `json:"reason,omitempty"`
+	Attempts    int       `json:"attempts"`
+	MaxAttempts int       `json:"max_attempts"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+type APIKeyRequest struct {
+	Owner     string    `json:"owner"`
+	Scopes    []string  `json:"scopes"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+type APIKeyResponse struct {
+	ID         string     `json:"id"`
+	Key        string     `json:"key,omitempty"`
+	Owner      string     `json:"owner"`
+	Scopes     []string   `json:"scopes"`
+	CreatedAt  time.Time  `json:"created_at"`
+	ExpiresAt  *time.Time `json:"expires_at,omitempty"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+	RotatedTo  string     `json:"rotated_to,omitempty"`
+}
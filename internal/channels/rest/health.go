@@ -0,0 +1,38 @@
+package rest
+
+import (
+	"net/http"
+	"tech-challenge-payment/internal/health"
+
+	"github.com/labstack/echo/v4"
+)
+
+type Health interface {
+	Live(c echo.Context) error
+	Ready(c echo.Context) error
+}
+
+type probe struct {
+	checker health.Checker
+}
+
+func NewHealthChannel(checker health.Checker) Health {
+	return &probe{
+		checker: checker,
+	}
+}
+
+func (p *probe) Live(c echo.Context) error {
+	return report(c, p.checker.Live(c.Request().Context()))
+}
+
+func (p *probe) Ready(c echo.Context) error {
+	return report(c, p.checker.Ready(c.Request().Context()))
+}
+
+func report(c echo.Context, report health.Report) error {
+	if !report.OK() {
+		return c.JSON(http.StatusServiceUnavailable, report)
+	}
+	return c.JSON(http.StatusOK, report)
+}
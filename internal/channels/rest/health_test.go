@@ -0,0 +1,82 @@
+package rest
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"tech-challenge-payment/internal/health"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReady(t *testing.T) {
+	type Expected struct {
+		code   int
+		status string
+		checks map[string]string
+	}
+	tests := map[string]struct {
+		given    map[string]health.Check
+		expected Expected
+	}{
+		"given reachable dependencies, must be ready": {
+			given: map[string]health.Check{
+				"mongo":    func(context.Context) error { return nil },
+				"consumer": func(context.Context) error { return nil },
+			},
+			expected: Expected{
+				code:   http.StatusOK,
+				status: health.STATUS_OK,
+				checks: map[string]string{"mongo": health.STATUS_OK, "consumer": health.STATUS_OK},
+			},
+		},
+		"given dead consumer, must not be ready": {
+			given: map[string]health.Check{
+				"mongo":    func(context.Context) error { return nil },
+				"consumer": func(context.Context) error { return health.ErrStalled },
+			},
+			expected: Expected{
+				code:   http.StatusServiceUnavailable,
+				status: health.STATUS_UNAVAILABLE,
+				checks: map[string]string{"mongo": health.STATUS_OK, "consumer": health.STATUS_UNAVAILABLE},
+			},
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			p := &probe{checker: health.NewChecker(time.Second, tc.given)}
+
+			rec := httptest.NewRecorder()
+			c := echo.New().NewContext(httptest.NewRequest(http.MethodGet, "/readyz", nil), rec)
+
+			assert.NoError(t, p.Ready(c))
+			assert.Equal(t, tc.expected.code, rec.Code)
+
+			var report health.Report
+			assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &report))
+			assert.Equal(t, tc.expected.status, report.Status)
+			for name, status := range tc.expected.checks {
+				assert.Equal(t, status, report.Checks[name].Status, name)
+			}
+		})
+	}
+}
+
+func TestLive(t *testing.T) {
+	p := &probe{checker: health.NewChecker(time.Second, map[string]health.Check{
+		"mongo": func(context.Context) error { return errors.New("connection refused") },
+	})}
+
+	rec := httptest.NewRecorder()
+	c := echo.New().NewContext(httptest.NewRequest(http.MethodGet, "/livez", nil), rec)
+
+	assert.NoError(t, p.Live(c))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.JSONEq(t, `{"status":"ok"}`, rec.Body.String())
+}
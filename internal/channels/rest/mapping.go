@@ -1,13 +1,116 @@
 package rest
 
-import "tech-challenge-payment/internal/canonical"
+import (
+	"fmt"
+	"strings"
+	"tech-challenge-payment/internal/canonical"
+	"time"
+)
 
-func (pr *PaymentRequest) toCanonical() canonical.Payment {
-	return canonical.Payment{
-		PaymentType: pr.PaymentType,
-		CreatedAt:   pr.CreatedAt,
-		UpdatedAt:   pr.UpdatedAt,
-		Status:      canonical.PaymentStatus(pr.Status),
-		OrderID:     pr.OrderID,
+func (pr *PaymentRequest) toCanonical() (canonical.Payment, error) {
+	method := canonical.PaymentMethod(pr.PaymentType)
+	if len(pr.Method) > 0 {
+		named, ok := canonical.MapPaymentMethod[strings.ToUpper(pr.Method)]
+		if !ok {
+			return canonical.Payment{}, fmt.Errorf("%w: unknown method %q", canonical.ErrorInvalidPayment, pr.Method)
+		}
+		method = named
 	}
+
+	payment := canonical.Payment{
+		Method:    method,
+		CreatedAt: pr.CreatedAt,
+		UpdatedAt: pr.UpdatedAt,
+		Status:    canonical.PaymentStatus(pr.Status),
+		OrderID:   pr.OrderID,
+		Amount:    pr.Amount,
+	}
+	if pr.Card != nil {
+		payment.Details = &canonical.MethodDetails{Card: &canonical.CardDetails{Token: pr.Card.Token}}
+	}
+	return payment, nil
+}
+
+// toCreatePaymentResponse tells the customer how to pay with the method of the payment.
+func toCreatePaymentResponse(payment canonical.Payment) CreatePaymentResponse {
+	instructions := InstructionsResponse{Method: payment.Method.String()}
+	if details := payment.Details; details != nil {
+		switch {
+		case details.Pix != nil:
+			instructions.Message = "scan the QR code or paste it in the bank app before it expires"
+			instructions.QRCode = details.Pix.QRCode
+			instructions.ExpiresAt = optionalTime(details.Pix.ExpiresAt)
+		case details.Card != nil:
+			instructions.Message = "the amount is held on the card and charged once the order is accepted"
+			instructions.CardLast4 = details.Card.Last4
+			instructions.CardBrand = details.Card.Brand
+		case details.Boleto != nil:
+			instructions.Message = "pay the boleto by its barcode until the due date"
+			instructions.Barcode = details.Boleto.Barcode
+			instructions.ExpiresAt = optionalTime(details.Boleto.DueDate)
+		case details.Cash != nil:
+			instructions.Message = "tell the reference at the counter and pay before it expires"
+			instructions.Reference = details.Cash.Reference
+			instructions.ExpiresAt = optionalTime(details.Cash.ExpiresAt)
+		}
+	}
+
+	return CreatePaymentResponse{
+		Payment:      payment,
+		Instructions: instructions,
+	}
+}
+
+// toAPIKeyResponse never exposes the hash, key is only filled right after the key is issued.
+func toAPIKeyResponse(apiKey canonical.APIKey, key string) APIKeyResponse {
+	return APIKeyResponse{
+		ID:         apiKey.ID,
+		Key:        key,
+		Owner:      apiKey.Owner,
+		Scopes:     apiKey.Scopes,
+		CreatedAt:  apiKey.CreatedAt,
+		ExpiresAt:  optionalTime(apiKey.ExpiresAt),
+		RevokedAt:  optionalTime(apiKey.RevokedAt),
+		LastUsedAt: optionalTime(apiKey.LastUsedAt),
+		RotatedTo:  apiKey.RotatedTo,
+	}
+}
+
+// toAuditEntryResponse names the statuses, previous_status is null for the entry of the creation.
+func toAuditEntryResponse(entry canonical.AuditEntry) AuditEntryResponse {
+	response := AuditEntryResponse{
+		ID:          entry.ID,
+		PaymentID:   entry.PaymentID,
+		NewStatus:   entry.NewStatus.String(),
+		Reason:      string(entry.Reason),
+		Actor:       entry.Actor,
+		PayloadHash: entry.PayloadHash,
+		Note:        entry.Note,
+		RequestID:   entry.RequestID,
+		At:          entry.At,
+	}
+	if entry.PreviousStatus != nil {
+		previous := entry.PreviousStatus.String()
+		response.PreviousStatus = &previous
+	}
+	return response
+}
+
+func toIntentResponse(intent canonical.PaymentIntent) IntentResponse {
+	return IntentResponse{
+		OrderID:     intent.OrderID,
+		Status:      intent.Status.String(),
+		Reason:      string(intent.Reason),
+		Attempts:    intent.Attempts,
+		MaxAttempts: intent.MaxAttempts,
+		CreatedAt:   intent.CreatedAt,
+		UpdatedAt:   intent.UpdatedAt,
+	}
+}
+
+func optionalTime(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+	return &t
 }
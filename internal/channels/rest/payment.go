@@ -1,9 +1,17 @@
 package rest
 
 import (
+	"bytes"
+	"errors"
 	"fmt"
+	"io"
+	"strconv"
+	"tech-challenge-payment/internal/auth/principal"
 	"tech-challenge-payment/internal/canonical"
+	"tech-challenge-payment/internal/events"
+	"tech-challenge-payment/internal/middlewares"
 	"tech-challenge-payment/internal/service"
+	"time"
 
 	"net/http"
 
@@ -14,26 +22,45 @@ type Payment interface {
 	RegisterGroup(g *echo.Group)
 	Callback(c echo.Context) error
 	GetByID(c echo.Context) error
+	History(c echo.Context) error
+	Intent(c echo.Context) error
 	Create(c echo.Context) error
 	GetAll(c echo.Context) error
+	Events(c echo.Context) error
+	Cancel(c echo.Context) error
+	Authorize(c echo.Context) error
+	Capture(c echo.Context) error
 	HealthCheck(c echo.Context) error
 }
 
 type payment struct {
-	paymentSvc service.PaymentService
+	paymentSvc        service.PaymentService
+	hub               events.Hub
+	heartbeatInterval time.Duration
 }
 
-func NewPaymentChannel() Payment {
+func NewPaymentChannel(paymentSvc service.PaymentService, hub events.Hub, heartbeatInterval time.Duration) Payment {
 	return &payment{
-		paymentSvc: service.NewPaymentService(),
+		paymentSvc:        paymentSvc,
+		hub:               hub,
+		heartbeatInterval: heartbeatInterval,
 	}
 }
 
 func (p *payment) RegisterGroup(g *echo.Group) {
-	g.GET("/:id", p.GetByID)
-	g.GET("/", p.GetAll)
-	g.POST("/callback", p.Callback)
-	g.POST("/", p.Create)
+	read := middlewares.RequireScopes(principal.SCOPE_READ)
+	write := middlewares.RequireScopes(principal.SCOPE_WRITE)
+
+	g.GET("/:id", p.GetByID, read)
+	g.GET("/:id/events", p.Events, read)
+	g.GET("/:id/history", p.History, read)
+	g.GET("/intents/:order_id", p.Intent, read)
+	g.GET("/", p.GetAll, read)
+	g.POST("/callback", p.Callback, middlewares.RequireScopes(principal.SCOPE_CALLBACK))
+	g.POST("/:id/cancel", p.Cancel, write)
+	g.POST("/:id/authorize", p.Authorize, write)
+	g.POST("/:id/capture", p.Capture, write)
+	g.POST("/", p.Create, write)
 }
 
 func (r *payment) HealthCheck(c echo.Context) error {
@@ -47,12 +74,36 @@ func (p *payment) Create(c echo.Context) error {
 			Message: "Invalid request body",
 		})
 	}
-	payment, err := p.paymentSvc.Create(c.Request().Context(), paymentRequest.toCanonical())
+	request, err := paymentRequest.toCanonical()
 	if err != nil {
-		return c.JSON(http.StatusInternalServerError, "error creating payment")
+		return c.JSON(http.StatusBadRequest, Response{
+			Message: err.Error(),
+		})
 	}
 
-	return c.JSON(http.StatusOK, payment)
+	payment, err := p.paymentSvc.Create(c.Request().Context(), request)
+	if err != nil {
+		switch {
+		case errors.Is(err, canonical.ErrorInvalidPayment):
+			return c.JSON(http.StatusBadRequest, Response{
+				Message: err.Error(),
+			})
+		case errors.Is(err, canonical.ErrorNotFound):
+			return c.JSON(http.StatusNotFound, "error searching payment intent")
+		case errors.Is(err, canonical.ErrorAttemptPending):
+			return c.JSON(http.StatusConflict, Response{
+				Message: "the previous payment attempt of the order is still pending",
+			})
+		case errors.Is(err, canonical.ErrorIntentSettled):
+			return c.JSON(http.StatusConflict, Response{
+				Message: "the order can no longer be paid",
+			})
+		default:
+			return c.JSON(http.StatusInternalServerError, "error creating payment")
+		}
+	}
+
+	return c.JSON(http.StatusOK, toCreatePaymentResponse(*payment))
 }
 
 func (p *payment) GetByID(c echo.Context) error {
@@ -71,16 +122,240 @@ func (p *payment) GetByID(c echo.Context) error {
 	return c.JSON(http.StatusOK, payment)
 }
 
+func (p *payment) History(c echo.Context) error {
+	id := c.Param("id")
+	if len(id) == 0 {
+		return c.JSON(http.StatusBadRequest, Response{
+			Message: "missing id query param",
+		})
+	}
+
+	entries, err := p.paymentSvc.History(c.Request().Context(), id)
+	if err != nil {
+		if errors.Is(err, canonical.ErrorNotFound) {
+			return c.JSON(http.StatusNotFound, "error searching payment")
+		}
+		return c.JSON(http.StatusInternalServerError, "error searching payment history")
+	}
+
+	history := make([]AuditEntryResponse, 0, len(entries))
+	for _, entry := range entries {
+		history = append(history, toAuditEntryResponse(entry))
+	}
+	return c.JSON(http.StatusOK, history)
+}
+
+func (p *payment) Intent(c echo.Context) error {
+	orderId := c.Param("order_id")
+	if len(orderId) == 0 {
+		return c.JSON(http.StatusBadRequest, Response{
+			Message: "missing order_id query param",
+		})
+	}
+
+	intent, err := p.paymentSvc.Intent(c.Request().Context(), orderId)
+	if err != nil {
+		if errors.Is(err, canonical.ErrorNotFound) {
+			return c.JSON(http.StatusNotFound, "error searching payment intent")
+		}
+		return c.JSON(http.StatusInternalServerError, "error searching payment intent")
+	}
+
+	return c.JSON(http.StatusOK, toIntentResponse(*intent))
+}
+
 func (p *payment) GetAll(c echo.Context) error {
 	payments, err := p.paymentSvc.GetAll(c.Request().Context())
 	if err != nil {
+		if errors.Is(err, canonical.ErrorForbidden) {
+			return c.JSON(http.StatusForbidden, Response{
+				Message: "listing every payment requires the admin scope",
+			})
+		}
 		return c.JSON(http.StatusNotFound, "error searching payment")
 	}
 
 	return c.JSON(http.StatusOK, payments)
 }
 
+func (p *payment) Cancel(c echo.Context) error {
+	id := c.Param("id")
+	if len(id) == 0 {
+		return c.JSON(http.StatusBadRequest, Response{
+			Message: "missing id query param",
+		})
+	}
+
+	payment, err := p.paymentSvc.Cancel(c.Request().Context(), id, canonical.REASON_REQUESTED)
+	if err != nil {
+		switch {
+		case errors.Is(err, canonical.ErrorNotFound):
+			return c.JSON(http.StatusNotFound, "error searching payment")
+		case errors.Is(err, canonical.ErrorInvalidTransition):
+			return c.JSON(http.StatusConflict, Response{
+				Message: "payment can no longer be cancelled",
+			})
+		default:
+			return c.JSON(http.StatusInternalServerError, "error cancelling payment")
+		}
+	}
+
+	return c.JSON(http.StatusOK, payment)
+}
+
+func (p *payment) Authorize(c echo.Context) error {
+	id := c.Param("id")
+	if len(id) == 0 {
+		return c.JSON(http.StatusBadRequest, Response{
+			Message: "missing id query param",
+		})
+	}
+
+	payment, err := p.paymentSvc.Authorize(c.Request().Context(), id)
+	if err != nil {
+		switch {
+		case errors.Is(err, canonical.ErrorInvalidPayment):
+			return c.JSON(http.StatusBadRequest, Response{
+				Message: err.Error(),
+			})
+		case errors.Is(err, canonical.ErrorNotFound):
+			return c.JSON(http.StatusNotFound, "error searching payment")
+		case errors.Is(err, canonical.ErrorInvalidTransition):
+			return c.JSON(http.StatusConflict, Response{
+				Message: "payment can no longer be authorized",
+			})
+		default:
+			return c.JSON(http.StatusInternalServerError, "error authorizing payment")
+		}
+	}
+
+	return c.JSON(http.StatusOK, payment)
+}
+
+func (p *payment) Capture(c echo.Context) error {
+	id := c.Param("id")
+	if len(id) == 0 {
+		return c.JSON(http.StatusBadRequest, Response{
+			Message: "missing id query param",
+		})
+	}
+
+	var captureRequest CaptureRequest
+	if err := c.Bind(&captureRequest); err != nil {
+		return c.JSON(http.StatusBadRequest, Response{
+			Message: "Invalid request body",
+		})
+	}
+
+	payment, err := p.paymentSvc.Capture(c.Request().Context(), id, captureRequest.Amount)
+	if err != nil {
+		switch {
+		case errors.Is(err, canonical.ErrorInvalidAmount):
+			return c.JSON(http.StatusBadRequest, Response{
+				Message: err.Error(),
+			})
+		case errors.Is(err, canonical.ErrorNotFound):
+			return c.JSON(http.StatusNotFound, "error searching payment")
+		case errors.Is(err, canonical.ErrorInvalidTransition):
+			return c.JSON(http.StatusConflict, Response{
+				Message: "only authorized payments can be captured",
+			})
+		default:
+			return c.JSON(http.StatusInternalServerError, "error capturing payment")
+		}
+	}
+
+	return c.JSON(http.StatusOK, payment)
+}
+
+func (p *payment) Events(c echo.Context) error {
+	id := c.Param("id")
+	if len(id) == 0 {
+		return c.JSON(http.StatusBadRequest, Response{
+			Message: "missing id query param",
+		})
+	}
+
+	var lastEventID uint64
+	if header := c.Request().Header.Get("Last-Event-ID"); len(header) > 0 {
+		parsed, err := strconv.ParseUint(header, 10, 64)
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, Response{
+				Message: "invalid Last-Event-ID header",
+			})
+		}
+		lastEventID = parsed
+	}
+
+	ctx := c.Request().Context()
+
+	// subscribing before reading the payment guarantees no change is lost between both calls
+	eventsCh, unsubscribe := p.hub.Subscribe(id, lastEventID)
+	defer unsubscribe()
+
+	payment, err := p.paymentSvc.GetByID(ctx, id)
+	if err != nil || payment == nil {
+		return c.JSON(http.StatusNotFound, "error searching payment")
+	}
+
+	// event ids are versions of the payment, a client already at the stored one has missed nothing
+	upToDate := lastEventID > 0 && lastEventID == payment.Version
+
+	// a resumed stream for a finished payment has nothing left to deliver, 204 tells EventSource to stop reconnecting
+	if upToDate && payment.Status.IsFinal() {
+		return c.NoContent(http.StatusNoContent)
+	}
+
+	stream := newEventStream(c.Response())
+	if !upToDate {
+		// the changes the client missed may have been published by another replica, the snapshot covers them
+		if err := stream.send(payment.Version, *payment); err != nil {
+			return nil
+		}
+		if payment.Status.IsFinal() {
+			return nil
+		}
+		lastEventID = payment.Version
+	}
+
+	heartbeat := time.NewTicker(p.heartbeatInterval)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-heartbeat.C:
+			if err := stream.heartbeat(); err != nil {
+				return nil
+			}
+		case event, ok := <-eventsCh:
+			if !ok {
+				return nil
+			}
+			// already sent with the snapshot
+			if event.ID > 0 && event.ID <= lastEventID {
+				continue
+			}
+			if err := stream.send(event.ID, event.Payment); err != nil {
+				return nil
+			}
+			if event.Payment.Status.IsFinal() {
+				return nil
+			}
+		}
+	}
+}
+
 func (p *payment) Callback(c echo.Context) error {
+	// the raw payload is hashed into the audit trail, so it is read before binding
+	payload, err := io.ReadAll(c.Request().Body)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, Response{
+			Message: fmt.Errorf("invalid data").Error(),
+		})
+	}
+	c.Request().Body = io.NopCloser(bytes.NewReader(payload))
 
 	var callback PaymentCallback
 	if err := c.Bind(&callback); err != nil {
@@ -95,9 +370,18 @@ func (p *payment) Callback(c echo.Context) error {
 		})
 	}
 
-	err := p.paymentSvc.Callback(c.Request().Context(), callback.PaymentID, canonical.MapPaymentStatus[callback.Status])
+	err = p.paymentSvc.Callback(c.Request().Context(), callback.PaymentID, canonical.MapPaymentStatus[callback.Status], payload)
 	if err != nil {
-		return c.JSON(http.StatusInternalServerError, "error processing callback")
+		switch {
+		case errors.Is(err, canonical.ErrorNotFound):
+			return c.JSON(http.StatusNotFound, "error searching payment")
+		case errors.Is(err, canonical.ErrorInvalidTransition):
+			return c.JSON(http.StatusConflict, Response{
+				Message: "payment already finished with another status",
+			})
+		default:
+			return c.JSON(http.StatusInternalServerError, "error processing callback")
+		}
 	}
 
 	return c.JSON(http.StatusOK, nil)
@@ -4,11 +4,15 @@ import (
 	"bytes"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"tech-challenge-payment/internal/canonical"
+	"tech-challenge-payment/internal/events"
 	"tech-challenge-payment/internal/service"
 	"testing"
+	"time"
 
 	"github.com/labstack/echo/v4"
 	"github.com/stretchr/testify/assert"
@@ -17,6 +21,8 @@ import (
 
 var (
 	errorProcessingID = "PAYMENT_ERROR_PROCESSING"
+	finishedPaymentID = "PAYMENT_FINISHED"
+	unknownPaymentID  = "PAYMENT_UNKNOWN"
 )
 
 func TestRegisterGroup(t *testing.T) {
@@ -116,6 +122,56 @@ func TestCreate(t *testing.T) {
 				statusCode: http.StatusInternalServerError,
 			},
 		},
+		"given previous attempt pending, must return status 409": {
+			given: Given{
+				request:        createJsonRequest(http.MethodPost, endpoint, PaymentRequest{OrderID: "order"}),
+				paymenyService: mockPaymentServiceForCreateErr(canonical.ErrorAttemptPending),
+			},
+			expected: Expected{
+				err:        assert.NoError,
+				statusCode: http.StatusConflict,
+			},
+		},
+		"given intent settled, must return status 409": {
+			given: Given{
+				request:        createJsonRequest(http.MethodPost, endpoint, PaymentRequest{OrderID: "order"}),
+				paymenyService: mockPaymentServiceForCreateErr(canonical.ErrorIntentSettled),
+			},
+			expected: Expected{
+				err:        assert.NoError,
+				statusCode: http.StatusConflict,
+			},
+		},
+		"given unknown method, must return status 400": {
+			given: Given{
+				request:        createJsonRequest(http.MethodPost, endpoint, PaymentRequest{OrderID: "order", Method: "CHEQUE"}),
+				paymenyService: &PaymentServiceMock{},
+			},
+			expected: Expected{
+				err:        assert.NoError,
+				statusCode: http.StatusBadRequest,
+			},
+		},
+		"given card without token, must return status 400": {
+			given: Given{
+				request:        createJsonRequest(http.MethodPost, endpoint, PaymentRequest{OrderID: "order", Method: "CREDIT_CARD"}),
+				paymenyService: mockPaymentServiceForCreateErr(fmt.Errorf("%w: CREDIT_CARD requires a card token", canonical.ErrorInvalidPayment)),
+			},
+			expected: Expected{
+				err:        assert.NoError,
+				statusCode: http.StatusBadRequest,
+			},
+		},
+		"given another customer's order, must return status 404": {
+			given: Given{
+				request:        createJsonRequest(http.MethodPost, endpoint, PaymentRequest{OrderID: "order"}),
+				paymenyService: mockPaymentServiceForCreateErr(canonical.ErrorNotFound),
+			},
+			expected: Expected{
+				err:        assert.NoError,
+				statusCode: http.StatusNotFound,
+			},
+		},
 	}
 
 	for _, tc := range tests {
@@ -133,6 +189,83 @@ func TestCreate(t *testing.T) {
 	}
 }
 
+func TestCreateInstructions(t *testing.T) {
+	endpoint := "/payment"
+	expiresAt := time.Date(2020, 11, 1, 12, 30, 0, 0, time.UTC)
+
+	type Given struct {
+		request  PaymentRequest
+		received canonical.Payment
+		created  canonical.Payment
+	}
+	type Expected struct {
+		instructions string
+	}
+	tests := map[string]struct {
+		given    Given
+		expected Expected
+	}{
+		"given pix payment, must return the qr code": {
+			given: Given{
+				request:  PaymentRequest{OrderID: "order", Method: "pix"},
+				received: canonical.Payment{OrderID: "order", Method: canonical.METHOD_PIX},
+				created: canonical.Payment{ID: "1234", OrderID: "order", Method: canonical.METHOD_PIX, Details: &canonical.MethodDetails{
+					Pix: &canonical.PixDetails{QRCode: "qr", ExpiresAt: expiresAt},
+				}},
+			},
+			expected: Expected{
+				instructions: `{"method":"PIX","message":"scan the QR code or paste it in the bank app before it expires","qr_code":"qr","expires_at":"2020-11-01T12:30:00Z"}`,
+			},
+		},
+		"given card payment, must hand the token over and never return it": {
+			given: Given{
+				request:  PaymentRequest{OrderID: "order", Method: "CREDIT_CARD", Card: &CardRequest{Token: "tok_4242"}},
+				received: canonical.Payment{OrderID: "order", Method: canonical.METHOD_CREDIT_CARD, Details: &canonical.MethodDetails{Card: &canonical.CardDetails{Token: "tok_4242"}}},
+				created: canonical.Payment{ID: "1234", OrderID: "order", Method: canonical.METHOD_CREDIT_CARD, Details: &canonical.MethodDetails{
+					Card: &canonical.CardDetails{Token: "tok_4242", Last4: "4242", Brand: "VISA"},
+				}},
+			},
+			expected: Expected{
+				instructions: `{"method":"CREDIT_CARD","message":"the amount is held on the card and charged once the order is accepted","card_last4":"4242","card_brand":"VISA"}`,
+			},
+		},
+		"given boleto by its number, must return the barcode": {
+			given: Given{
+				request:  PaymentRequest{OrderID: "order", PaymentType: int(canonical.METHOD_BOLETO)},
+				received: canonical.Payment{OrderID: "order", Method: canonical.METHOD_BOLETO},
+				created: canonical.Payment{ID: "1234", OrderID: "order", Method: canonical.METHOD_BOLETO, Details: &canonical.MethodDetails{
+					Boleto: &canonical.BoletoDetails{Barcode: "0123", DueDate: expiresAt},
+				}},
+			},
+			expected: Expected{
+				instructions: `{"method":"BOLETO","message":"pay the boleto by its barcode until the due date","barcode":"0123","expires_at":"2020-11-01T12:30:00Z"}`,
+			},
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			p := payment{
+				paymentSvc: mockPaymentServiceForCreate(tc.given.received, tc.given.created),
+			}
+
+			err := p.Create(echo.New().NewContext(createJsonRequest(http.MethodPost, endpoint, tc.given.request), rec))
+
+			assert.NoError(t, err)
+			assert.Equal(t, http.StatusOK, rec.Result().StatusCode)
+			assert.NotContains(t, rec.Body.String(), "tok_4242")
+			var body struct {
+				ID           string          `json:"ID"`
+				Instructions json.RawMessage `json:"instructions"`
+			}
+			assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &body))
+			assert.Equal(t, "1234", body.ID)
+			assert.JSONEq(t, tc.expected.instructions, string(body.Instructions))
+		})
+	}
+}
+
 func TestCallback(t *testing.T) {
 	endpoint := "/payment/callback"
 
@@ -213,6 +346,32 @@ func TestCallback(t *testing.T) {
 				statusCode: http.StatusInternalServerError,
 			},
 		},
+		"given payment already finished, must return statuscode 409": {
+			given: Given{
+				request: createJsonRequest(http.MethodPost, endpoint, PaymentCallback{
+					PaymentID: finishedPaymentID,
+					Status:    "OK",
+				}),
+				paymenyService: mockPaymentServiceForCallback("", canonical.PAYMENT_FAILED),
+			},
+			expected: Expected{
+				err:        assert.NoError,
+				statusCode: http.StatusConflict,
+			},
+		},
+		"given unknown payment, must return statuscode 404": {
+			given: Given{
+				request: createJsonRequest(http.MethodPost, endpoint, PaymentCallback{
+					PaymentID: unknownPaymentID,
+					Status:    "OK",
+				}),
+				paymenyService: mockPaymentServiceForCallback("", canonical.PAYMENT_FAILED),
+			},
+			expected: Expected{
+				err:        assert.NoError,
+				statusCode: http.StatusNotFound,
+			},
+		},
 		"given invalid data, must return bad request": {
 			given: Given{
 				request:        createJsonRequest(http.MethodPost, endpoint, PaymentRequest{}),
@@ -311,6 +470,177 @@ func TestGetByID(t *testing.T) {
 	}
 }
 
+func TestHistory(t *testing.T) {
+	endpoint := "/payment/1234/history"
+	created := canonical.PAYMENT_CREATED
+	payed := canonical.PAYMENT_PAYED
+	at := time.Date(2020, 11, 1, 12, 0, 0, 0, time.UTC)
+
+	type Given struct {
+		pathParamID    string
+		paymenyService service.PaymentService
+	}
+	type Expected struct {
+		statusCode int
+		body       string
+	}
+	tests := map[string]struct {
+		given    Given
+		expected Expected
+	}{
+		"given payment with history, must return its entries with named statuses": {
+			given: Given{
+				pathParamID: "1234",
+				paymenyService: mockPaymentServiceForHistory([]canonical.AuditEntry{
+					{ID: "1", PaymentID: "1234", NewStatus: canonical.PAYMENT_CREATED, Actor: "sqs-consumer", At: at},
+					{ID: "2", PaymentID: "1234", PreviousStatus: &created, NewStatus: canonical.PAYMENT_PAYED, Actor: "provider:log", PayloadHash: "hash", RequestID: "request", At: at},
+					{ID: "3", PaymentID: "1234", PreviousStatus: &payed, NewStatus: canonical.PAYMENT_CANCELLED, Reason: canonical.REASON_FORCED, Actor: "operator:alice", Note: "refunded by phone", At: at},
+				}, nil),
+			},
+			expected: Expected{
+				statusCode: http.StatusOK,
+				body: `[{"id":"1","payment_id":"1234","previous_status":null,"new_status":"CREATED","actor":"sqs-consumer","at":"2020-11-01T12:00:00Z"},` +
+					`{"id":"2","payment_id":"1234","previous_status":"CREATED","new_status":"PAYED","actor":"provider:log","payload_hash":"hash","request_id":"request","at":"2020-11-01T12:00:00Z"},` +
+					`{"id":"3","payment_id":"1234","previous_status":"PAYED","new_status":"CANCELLED","reason":"FORCED","actor":"operator:alice","note":"refunded by phone","at":"2020-11-01T12:00:00Z"}]`,
+			},
+		},
+		"given empty id, must return status 400": {
+			given: Given{
+				pathParamID:    "",
+				paymenyService: &PaymentServiceMock{},
+			},
+			expected: Expected{
+				statusCode: http.StatusBadRequest,
+			},
+		},
+		"given unknown payment, must return status 404": {
+			given: Given{
+				pathParamID:    "1234",
+				paymenyService: mockPaymentServiceForHistory(nil, canonical.ErrorNotFound),
+			},
+			expected: Expected{
+				statusCode: http.StatusNotFound,
+			},
+		},
+		"given application error, must return status 500": {
+			given: Given{
+				pathParamID:    "1234",
+				paymenyService: mockPaymentServiceForHistory(nil, errors.New("")),
+			},
+			expected: Expected{
+				statusCode: http.StatusInternalServerError,
+			},
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			e := echo.New().NewContext(createRequest(http.MethodGet, endpoint), rec)
+			e.SetPath("/:id/history")
+			e.SetParamNames("id")
+			e.SetParamValues(tc.given.pathParamID)
+			p := payment{
+				paymentSvc: tc.given.paymenyService,
+			}
+
+			err := p.History(e)
+
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expected.statusCode, rec.Result().StatusCode)
+			if len(tc.expected.body) > 0 {
+				assert.JSONEq(t, tc.expected.body, rec.Body.String())
+			}
+		})
+	}
+}
+
+func TestIntent(t *testing.T) {
+	endpoint := "/payment/intents/order"
+	at := time.Date(2020, 11, 1, 12, 0, 0, 0, time.UTC)
+
+	type Given struct {
+		pathParamID    string
+		paymenyService service.PaymentService
+	}
+	type Expected struct {
+		statusCode int
+		body       string
+	}
+	tests := map[string]struct {
+		given    Given
+		expected Expected
+	}{
+		"given intent, must return it with named status": {
+			given: Given{
+				pathParamID: "order",
+				paymenyService: mockPaymentServiceForIntent(&canonical.PaymentIntent{
+					OrderID:     "order",
+					Status:      canonical.INTENT_CANCELLED,
+					Reason:      canonical.REASON_ATTEMPTS_EXHAUSTED,
+					Attempts:    3,
+					MaxAttempts: 3,
+					CreatedAt:   at,
+					UpdatedAt:   at,
+				}, nil),
+			},
+			expected: Expected{
+				statusCode: http.StatusOK,
+				body: `{"order_id":"order","status":"CANCELLED","reason":"ATTEMPTS_EXHAUSTED","attempts":3,"max_attempts":3,` +
+					`"created_at":"2020-11-01T12:00:00Z","updated_at":"2020-11-01T12:00:00Z"}`,
+			},
+		},
+		"given empty order id, must return status 400": {
+			given: Given{
+				pathParamID:    "",
+				paymenyService: &PaymentServiceMock{},
+			},
+			expected: Expected{
+				statusCode: http.StatusBadRequest,
+			},
+		},
+		"given unknown order, must return status 404": {
+			given: Given{
+				pathParamID:    "order",
+				paymenyService: mockPaymentServiceForIntent(nil, canonical.ErrorNotFound),
+			},
+			expected: Expected{
+				statusCode: http.StatusNotFound,
+			},
+		},
+		"given application error, must return status 500": {
+			given: Given{
+				pathParamID:    "order",
+				paymenyService: mockPaymentServiceForIntent(nil, errors.New("")),
+			},
+			expected: Expected{
+				statusCode: http.StatusInternalServerError,
+			},
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			e := echo.New().NewContext(createRequest(http.MethodGet, endpoint), rec)
+			e.SetPath("/intents/:order_id")
+			e.SetParamNames("order_id")
+			e.SetParamValues(tc.given.pathParamID)
+			p := payment{
+				paymentSvc: tc.given.paymenyService,
+			}
+
+			err := p.Intent(e)
+
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expected.statusCode, rec.Result().StatusCode)
+			if len(tc.expected.body) > 0 {
+				assert.JSONEq(t, tc.expected.body, rec.Body.String())
+			}
+		})
+	}
+}
+
 func TestGetAll(t *testing.T) {
 	endpoint := "/payment/"
 
@@ -346,6 +676,16 @@ func TestGetAll(t *testing.T) {
 				statusCode: http.StatusNotFound,
 			},
 		},
+		"given caller without admin scope returns status 403": {
+			given: Given{
+				request:        createRequest(http.MethodGet, endpoint),
+				paymenyService: mockPaymentServiceForGetAllForbidden(),
+			},
+			expected: Expected{
+				err:        assert.NoError,
+				statusCode: http.StatusForbidden,
+			},
+		},
 	}
 
 	for _, tc := range tests {
@@ -385,15 +725,30 @@ func mockPaymentServiceForCreate(paymentReceived, paymentReturned canonical.Paym
 	return mockPaymentSvc
 }
 
+func mockPaymentServiceForCreateErr(err error) *PaymentServiceMock {
+	mockPaymentSvc := new(PaymentServiceMock)
+	mockPaymentSvc.On("Create", mock.Anything, mock.Anything).Return((*canonical.Payment)(nil), err)
+	return mockPaymentSvc
+}
+
 func mockPaymentServiceForCallback(paymentID string, paymentStatus canonical.PaymentStatus) *PaymentServiceMock {
 	mockPaymentSvc := new(PaymentServiceMock)
 
 	mockPaymentSvc.
-		On("Callback", mock.Anything, paymentID, paymentStatus).
+		On("Callback", mock.Anything, paymentID, paymentStatus, mock.MatchedBy(func(payload []byte) bool {
+			// the raw body reaches the service to be hashed into the audit trail
+			return json.Valid(payload)
+		})).
 		Return(nil)
 	mockPaymentSvc.
-		On("Callback", mock.Anything, errorProcessingID, mock.Anything).
+		On("Callback", mock.Anything, errorProcessingID, mock.Anything, mock.Anything).
 		Return(errors.New(""))
+	mockPaymentSvc.
+		On("Callback", mock.Anything, finishedPaymentID, mock.Anything, mock.Anything).
+		Return(canonical.ErrorInvalidTransition)
+	mockPaymentSvc.
+		On("Callback", mock.Anything, unknownPaymentID, mock.Anything, mock.Anything).
+		Return(canonical.ErrorNotFound)
 
 	return mockPaymentSvc
 }
@@ -411,6 +766,22 @@ func mockPaymentServiceForGetByID(paymentID string, paymentReturned *canonical.P
 	return mockPaymentSvc
 }
 
+func mockPaymentServiceForHistory(entries []canonical.AuditEntry, err error) *PaymentServiceMock {
+	mockPaymentSvc := new(PaymentServiceMock)
+	mockPaymentSvc.
+		On("History", mock.Anything, "1234").
+		Return(entries, err)
+	return mockPaymentSvc
+}
+
+func mockPaymentServiceForIntent(intent *canonical.PaymentIntent, err error) *PaymentServiceMock {
+	mockPaymentSvc := new(PaymentServiceMock)
+	mockPaymentSvc.
+		On("Intent", mock.Anything, "order").
+		Return(intent, err)
+	return mockPaymentSvc
+}
+
 func mockPaymentServiceForGetAll() *PaymentServiceMock {
 	mockPaymentSvc := new(PaymentServiceMock)
 	payments := []canonical.Payment{
@@ -434,3 +805,436 @@ func mockPaymentServiceForGetAllErr() *PaymentServiceMock {
 		Return(nil, errors.New(""))
 	return mockPaymentSvc
 }
+
+func mockPaymentServiceForGetAllForbidden() *PaymentServiceMock {
+	mockPaymentSvc := new(PaymentServiceMock)
+	mockPaymentSvc.
+		On("GetAll", mock.Anything).
+		Return(nil, canonical.ErrorForbidden)
+	return mockPaymentSvc
+}
+
+func TestEvents(t *testing.T) {
+	endpoint := "/payment/1234/events"
+
+	type Given struct {
+		paymentID      string
+		lastEventID    string
+		paymenyService service.PaymentService
+		publish        []canonical.Payment
+	}
+	type Expected struct {
+		statusCode int
+		body       []string
+		// count of events sent, when checked
+		count int
+	}
+	tests := map[string]struct {
+		given    Given
+		expected Expected
+	}{
+		"given finished payment, must send snapshot and close": {
+			given: Given{
+				paymentID:      "sse_payed",
+				paymenyService: mockPaymentServiceForGetByID("sse_payed", &canonical.Payment{ID: "sse_payed", Status: canonical.PAYMENT_PAYED}),
+			},
+			expected: Expected{
+				statusCode: http.StatusOK,
+				body:       []string{"event: payment\ndata: {\"ID\":\"sse_payed\""},
+			},
+		},
+		"given pending payment, must stream changes until it finishes": {
+			given: Given{
+				paymentID:      "sse_pending",
+				paymenyService: mockPaymentServiceForGetByID("sse_pending", &canonical.Payment{ID: "sse_pending", Status: canonical.PAYMENT_CREATED}),
+				publish: []canonical.Payment{
+					{ID: "sse_pending", Status: canonical.PAYMENT_PAYED},
+				},
+			},
+			expected: Expected{
+				statusCode: http.StatusOK,
+				body:       []string{"\"Status\":0", "event: payment\n", "\"Status\":1"},
+			},
+		},
+		"given pending payment, must not send again the changes the snapshot covers": {
+			given: Given{
+				paymentID:      "sse_covered",
+				paymenyService: mockPaymentServiceForGetByID("sse_covered", &canonical.Payment{ID: "sse_covered", Status: canonical.PAYMENT_AUTHORIZED, Version: 2}),
+				publish: []canonical.Payment{
+					{ID: "sse_covered", Status: canonical.PAYMENT_AUTHORIZED, Version: 2},
+					{ID: "sse_covered", Status: canonical.PAYMENT_PAYED, Version: 3},
+				},
+			},
+			expected: Expected{
+				statusCode: http.StatusOK,
+				body:       []string{"id: 2\nevent: payment\n", "id: 3\nevent: payment\n"},
+				count:      2,
+			},
+		},
+		"given resumed stream of finished payment at its version, must return no content": {
+			given: Given{
+				paymentID:      "sse_resumed",
+				lastEventID:    "3",
+				paymenyService: mockPaymentServiceForGetByID("sse_resumed", &canonical.Payment{ID: "sse_resumed", Status: canonical.PAYMENT_FAILED, Version: 3}),
+			},
+			expected: Expected{
+				statusCode: http.StatusNoContent,
+			},
+		},
+		"given resumed stream behind the stored version, must send the snapshot": {
+			given: Given{
+				paymentID:      "sse_behind",
+				lastEventID:    "1",
+				paymenyService: mockPaymentServiceForGetByID("sse_behind", &canonical.Payment{ID: "sse_behind", Status: canonical.PAYMENT_PAYED, Version: 2}),
+			},
+			expected: Expected{
+				statusCode: http.StatusOK,
+				body:       []string{"id: 2\nevent: payment\ndata: {\"ID\":\"sse_behind\""},
+			},
+		},
+		"given resumed stream with an id of another replica, must send the snapshot": {
+			given: Given{
+				paymentID:      "sse_foreign",
+				lastEventID:    "999999",
+				paymenyService: mockPaymentServiceForGetByID("sse_foreign", &canonical.Payment{ID: "sse_foreign", Status: canonical.PAYMENT_FAILED, Version: 2}),
+			},
+			expected: Expected{
+				statusCode: http.StatusOK,
+				body:       []string{"id: 2\nevent: payment\n"},
+			},
+		},
+		"given invalid last event id, must return bad request": {
+			given: Given{
+				paymentID:      "sse_invalid",
+				lastEventID:    "abc",
+				paymenyService: &PaymentServiceMock{},
+			},
+			expected: Expected{
+				statusCode: http.StatusBadRequest,
+			},
+		},
+		"given unknown payment, must return not found": {
+			given: Given{
+				paymentID:      errorProcessingID,
+				paymenyService: mockPaymentServiceForGetByID("1234", nil),
+			},
+			expected: Expected{
+				statusCode: http.StatusNotFound,
+			},
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			hub := events.NewHub()
+			rec := httptest.NewRecorder()
+			req := createRequest(http.MethodGet, endpoint)
+			if len(tc.given.lastEventID) > 0 {
+				req.Header.Set("Last-Event-ID", tc.given.lastEventID)
+			}
+			e := echo.New().NewContext(req, rec)
+			e.SetPath("/:id/events")
+			e.SetParamNames("id")
+			e.SetParamValues(tc.given.paymentID)
+
+			p := payment{
+				paymentSvc:        tc.given.paymenyService,
+				hub:               hub,
+				heartbeatInterval: time.Millisecond,
+			}
+
+			done := make(chan error)
+			go func() {
+				done <- p.Events(e)
+			}()
+			time.Sleep(10 * time.Millisecond)
+			for _, published := range tc.given.publish {
+				hub.Publish(published)
+			}
+
+			select {
+			case err := <-done:
+				assert.NoError(t, err)
+			case <-time.After(time.Second):
+				t.Fatal("event stream did not finish")
+			}
+
+			assert.Equal(t, tc.expected.statusCode, rec.Result().StatusCode)
+			for _, expected := range tc.expected.body {
+				assert.Contains(t, rec.Body.String(), expected)
+			}
+			if tc.expected.count > 0 {
+				assert.Equal(t, tc.expected.count, strings.Count(rec.Body.String(), "event: payment\n"))
+			}
+		})
+	}
+}
+
+func TestCancel(t *testing.T) {
+	endpoint := "/payment/1234/cancel"
+
+	type Given struct {
+		pathParamID    string
+		paymenyService service.PaymentService
+	}
+	type Expected struct {
+		err        assert.ErrorAssertionFunc
+		statusCode int
+	}
+	tests := map[string]struct {
+		given    Given
+		expected Expected
+	}{
+		"given created payment returns cancelled payment and status 200": {
+			given: Given{
+				pathParamID:    "1234",
+				paymenyService: mockPaymentServiceForCancel(&canonical.Payment{ID: "1234", Status: canonical.PAYMENT_CANCELLED}, nil),
+			},
+			expected: Expected{
+				err:        assert.NoError,
+				statusCode: http.StatusOK,
+			},
+		},
+		"given empty id returns status 400": {
+			given: Given{
+				pathParamID:    "",
+				paymenyService: &PaymentServiceMock{},
+			},
+			expected: Expected{
+				err:        assert.NoError,
+				statusCode: http.StatusBadRequest,
+			},
+		},
+		"given unknown payment returns status 404": {
+			given: Given{
+				pathParamID:    "1234",
+				paymenyService: mockPaymentServiceForCancel(nil, canonical.ErrorNotFound),
+			},
+			expected: Expected{
+				err:        assert.NoError,
+				statusCode: http.StatusNotFound,
+			},
+		},
+		"given finished payment returns status 409": {
+			given: Given{
+				pathParamID:    "1234",
+				paymenyService: mockPaymentServiceForCancel(nil, canonical.ErrorInvalidTransition),
+			},
+			expected: Expected{
+				err:        assert.NoError,
+				statusCode: http.StatusConflict,
+			},
+		},
+		"given application error returns status 500": {
+			given: Given{
+				pathParamID:    "1234",
+				paymenyService: mockPaymentServiceForCancel(nil, errors.New("")),
+			},
+			expected: Expected{
+				err:        assert.NoError,
+				statusCode: http.StatusInternalServerError,
+			},
+		},
+	}
+
+	for _, tc := range tests {
+		rec := httptest.NewRecorder()
+		e := echo.New().NewContext(createRequest(http.MethodPost, endpoint), rec)
+		e.SetPath("/:id/cancel")
+		e.SetParamNames("id")
+		e.SetParamValues(tc.given.pathParamID)
+		p := payment{
+			paymentSvc: tc.given.paymenyService,
+		}
+		err := p.Cancel(e)
+		statusCode := rec.Result().StatusCode
+
+		assert.Equal(t, tc.expected.statusCode, statusCode)
+
+		tc.expected.err(t, err)
+	}
+}
+
+func mockPaymentServiceForCancel(paymentReturned *canonical.Payment, err error) *PaymentServiceMock {
+	mockPaymentSvc := new(PaymentServiceMock)
+	mockPaymentSvc.
+		On("Cancel", mock.Anything, "1234", canonical.REASON_REQUESTED).
+		Return(paymentReturned, err)
+	return mockPaymentSvc
+}
+
+func TestAuthorize(t *testing.T) {
+	endpoint := "/payment/1234/authorize"
+
+	type Given struct {
+		pathParamID    string
+		paymenyService service.PaymentService
+	}
+	type Expected struct {
+		statusCode int
+	}
+	tests := map[string]struct {
+		given    Given
+		expected Expected
+	}{
+		"given pending card payment returns authorized payment and status 200": {
+			given: Given{
+				pathParamID:    "1234",
+				paymenyService: mockPaymentServiceForAuthorize(&canonical.Payment{ID: "1234", Status: canonical.PAYMENT_AUTHORIZED}, nil),
+			},
+			expected: Expected{statusCode: http.StatusOK},
+		},
+		"given empty id returns status 400": {
+			given: Given{
+				pathParamID:    "",
+				paymenyService: &PaymentServiceMock{},
+			},
+			expected: Expected{statusCode: http.StatusBadRequest},
+		},
+		"given payment not paid by card returns status 400": {
+			given: Given{
+				pathParamID:    "1234",
+				paymenyService: mockPaymentServiceForAuthorize(nil, canonical.ErrorInvalidPayment),
+			},
+			expected: Expected{statusCode: http.StatusBadRequest},
+		},
+		"given unknown payment returns status 404": {
+			given: Given{
+				pathParamID:    "1234",
+				paymenyService: mockPaymentServiceForAuthorize(nil, canonical.ErrorNotFound),
+			},
+			expected: Expected{statusCode: http.StatusNotFound},
+		},
+		"given finished payment returns status 409": {
+			given: Given{
+				pathParamID:    "1234",
+				paymenyService: mockPaymentServiceForAuthorize(nil, canonical.ErrorInvalidTransition),
+			},
+			expected: Expected{statusCode: http.StatusConflict},
+		},
+		"given application error returns status 500": {
+			given: Given{
+				pathParamID:    "1234",
+				paymenyService: mockPaymentServiceForAuthorize(nil, errors.New("")),
+			},
+			expected: Expected{statusCode: http.StatusInternalServerError},
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			e := echo.New().NewContext(createRequest(http.MethodPost, endpoint), rec)
+			e.SetPath("/:id/authorize")
+			e.SetParamNames("id")
+			e.SetParamValues(tc.given.pathParamID)
+			p := payment{
+				paymentSvc: tc.given.paymenyService,
+			}
+
+			assert.NoError(t, p.Authorize(e))
+			assert.Equal(t, tc.expected.statusCode, rec.Result().StatusCode)
+		})
+	}
+}
+
+func TestCapture(t *testing.T) {
+	endpoint := "/payment/1234/capture"
+
+	type Given struct {
+		request        interface{}
+		paymenyService service.PaymentService
+	}
+	type Expected struct {
+		statusCode int
+	}
+	tests := map[string]struct {
+		given    Given
+		expected Expected
+	}{
+		"given partial amount returns payed payment and status 200": {
+			given: Given{
+				request:        CaptureRequest{Amount: 1800},
+				paymenyService: mockPaymentServiceForCapture(1800, &canonical.Payment{ID: "1234", Status: canonical.PAYMENT_PAYED, Amount: 2500, CapturedAmount: 1800}, nil),
+			},
+			expected: Expected{statusCode: http.StatusOK},
+		},
+		"given no body captures the whole amount and returns status 200": {
+			given: Given{
+				paymenyService: mockPaymentServiceForCapture(0, &canonical.Payment{ID: "1234", Status: canonical.PAYMENT_PAYED, Amount: 2500, CapturedAmount: 2500}, nil),
+			},
+			expected: Expected{statusCode: http.StatusOK},
+		},
+		"given malformed body returns status 400": {
+			given: Given{
+				request:        map[string]string{"amount": "all"},
+				paymenyService: &PaymentServiceMock{},
+			},
+			expected: Expected{statusCode: http.StatusBadRequest},
+		},
+		"given amount over the authorized one returns status 400": {
+			given: Given{
+				request:        CaptureRequest{Amount: 9999},
+				paymenyService: mockPaymentServiceForCapture(9999, nil, canonical.ErrorInvalidAmount),
+			},
+			expected: Expected{statusCode: http.StatusBadRequest},
+		},
+		"given unknown payment returns status 404": {
+			given: Given{
+				request:        CaptureRequest{Amount: 1800},
+				paymenyService: mockPaymentServiceForCapture(1800, nil, canonical.ErrorNotFound),
+			},
+			expected: Expected{statusCode: http.StatusNotFound},
+		},
+		"given payment not authorized returns status 409": {
+			given: Given{
+				request:        CaptureRequest{Amount: 1800},
+				paymenyService: mockPaymentServiceForCapture(1800, nil, canonical.ErrorInvalidTransition),
+			},
+			expected: Expected{statusCode: http.StatusConflict},
+		},
+		"given application error returns status 500": {
+			given: Given{
+				request:        CaptureRequest{Amount: 1800},
+				paymenyService: mockPaymentServiceForCapture(1800, nil, errors.New("")),
+			},
+			expected: Expected{statusCode: http.StatusInternalServerError},
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, endpoint, nil)
+			if tc.given.request != nil {
+				req = createJsonRequest(http.MethodPost, endpoint, tc.given.request)
+			}
+			rec := httptest.NewRecorder()
+			e := echo.New().NewContext(req, rec)
+			e.SetPath("/:id/capture")
+			e.SetParamNames("id")
+			e.SetParamValues("1234")
+			p := payment{
+				paymentSvc: tc.given.paymenyService,
+			}
+
+			assert.NoError(t, p.Capture(e))
+			assert.Equal(t, tc.expected.statusCode, rec.Result().StatusCode)
+		})
+	}
+}
+
+func mockPaymentServiceForAuthorize(paymentReturned *canonical.Payment, err error) *PaymentServiceMock {
+	mockPaymentSvc := new(PaymentServiceMock)
+	mockPaymentSvc.
+		On("Authorize", mock.Anything, "1234").
+		Return(paymentReturned, err)
+	return mockPaymentSvc
+}
+
+func mockPaymentServiceForCapture(amount int64, paymentReturned *canonical.Payment, err error) *PaymentServiceMock {
+	mockPaymentSvc := new(PaymentServiceMock)
+	mockPaymentSvc.
+		On("Capture", mock.Anything, "1234", amount).
+		Return(paymentReturned, err)
+	return mockPaymentSvc
+}
@@ -1,36 +1,96 @@
 package rest
 
 import (
+	"context"
+	"errors"
+	"net/http"
+	"tech-challenge-payment/internal/auth/certs"
+	"tech-challenge-payment/internal/auth/principal"
+	"tech-challenge-payment/internal/auth/token"
+	"tech-challenge-payment/internal/canonical"
 	"tech-challenge-payment/internal/config"
+	"tech-challenge-payment/internal/events"
+	"tech-challenge-payment/internal/health"
+	"tech-challenge-payment/internal/metrics"
 	"tech-challenge-payment/internal/middlewares"
+	"tech-challenge-payment/internal/service"
+	"time"
 
 	"github.com/labstack/echo/v4"
 )
 
-var (
-	cfg = &config.Cfg
+const (
+	shutdownTimeout = 10 * time.Second
 )
 
 type rest struct {
 	payment Payment
+	apiKey  APIKey
+	health  Health
+	tokens  token.Validator
+	apiKeys middlewares.APIKeyAuthenticator
+	server  config.ServerConfig
 }
 
-func New() rest {
+// New serves on the port and with the TLS settings of server, SSE streams send a heartbeat every sseHeartbeatInterval.
+func New(paymentSvc service.PaymentService, apiKeySvc service.APIKeyService, hub events.Hub, checker health.Checker, tokens token.Validator, clock canonical.Clock, server config.ServerConfig, sseHeartbeatInterval time.Duration) rest {
 	return rest{
-		payment: NewPaymentChannel(),
+		payment: NewPaymentChannel(paymentSvc, hub, sseHeartbeatInterval),
+		apiKey:  NewAPIKeyChannel(apiKeySvc, clock),
+		health:  NewHealthChannel(checker),
+		tokens:  tokens,
+		apiKeys: apiKeySvc,
+		server:  server,
 	}
 }
 
-func (r rest) Start() error {
+// Start serves the API until ctx is done, then waits for the requests in flight to be answered.
+func (r rest) Start(ctx context.Context) error {
 	router := echo.New()
 
+	router.Use(middlewares.Tracing)
 	router.Use(middlewares.Logger)
+	router.Use(middlewares.Metrics)
+
+	router.GET("/metrics", echo.WrapHandler(metrics.Handler()))
+	router.GET("/livez", r.health.Live)
+	router.GET("/readyz", r.health.Ready)
 
 	mainGroup := router.Group("/api")
 	mainGroup.GET("/healthz", r.payment.HealthCheck)
+	authorization := middlewares.NewAuthorization(r.tokens, r.apiKeys, r.server.TLS.ClientScopes)
+
 	paymentGroup := mainGroup.Group("/payment")
-	paymentGroup.Use(middlewares.Authorization)
+	paymentGroup.Use(authorization)
 	r.payment.RegisterGroup(paymentGroup)
 
-	return router.Start(":" + cfg.Server.Port)
+	apiKeyGroup := mainGroup.Group("/admin/api-keys")
+	apiKeyGroup.Use(authorization, middlewares.RequireScopes(principal.SCOPE_ADMIN))
+	r.apiKey.RegisterGroup(apiKeyGroup)
+
+	server := &http.Server{
+		Addr: ":" + r.server.Port,
+	}
+
+	if tls := r.server.TLS; tls.Enabled {
+		reloader, err := certs.NewReloader(tls.CertFile, tls.KeyFile, tls.ClientCAFile, tls.ClientAuth)
+		if err != nil {
+			return err
+		}
+		go reloader.Watch(ctx, tls.ReloadInterval)
+		server.TLSConfig = reloader.TLSConfig()
+	}
+
+	stopped := make(chan error, 1)
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		defer cancel()
+		stopped <- server.Shutdown(shutdownCtx)
+	}()
+
+	if err := router.StartServer(server); !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return <-stopped
 }
@@ -0,0 +1,63 @@
+package rest
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"tech-challenge-payment/internal/canonical"
+
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	paymentEvent = "payment"
+)
+
+type eventStream struct {
+	response *echo.Response
+}
+
+func newEventStream(response *echo.Response) eventStream {
+	response.Header().Set(echo.HeaderContentType, "text/event-stream")
+	response.Header().Set(echo.HeaderCacheControl, "no-cache")
+	response.Header().Set(echo.HeaderConnection, "keep-alive")
+	response.Header().Set("X-Accel-Buffering", "no")
+	response.WriteHeader(http.StatusOK)
+	response.Flush()
+
+	return eventStream{
+		response: response,
+	}
+}
+
+// send writes the payment as an SSE event with its version as id. Payments
+// saved before they had an event log have no version and are sent without id,
+// so they do not move the client's Last-Event-ID.
+func (s eventStream) send(id uint64, payment canonical.Payment) error {
+	data, err := json.Marshal(payment)
+	if err != nil {
+		return err
+	}
+
+	if id > 0 {
+		if _, err := fmt.Fprintf(s.response, "id: %d\n", id); err != nil {
+			return err
+		}
+	}
+
+	if _, err := fmt.Fprintf(s.response, "event: %s\ndata: %s\n\n", paymentEvent, data); err != nil {
+		return err
+	}
+	s.response.Flush()
+
+	return nil
+}
+
+func (s eventStream) heartbeat() error {
+	if _, err := fmt.Fprint(s.response, ": heartbeat\n\n"); err != nil {
+		return err
+	}
+	s.response.Flush()
+
+	return nil
+}
@@ -0,0 +1,128 @@
+package sqs
+
+import (
+	"context"
+	"tech-challenge-payment/internal/canonical"
+	"time"
+
+	"github.com/stretchr/testify/mock"
+)
+
+type PaymentServiceMock struct {
+	mock.Mock
+}
+
+func (m *PaymentServiceMock) Create(ctx context.Context, payment canonical.Payment) (*canonical.Payment, error) {
+	args := m.Called(ctx, payment)
+	return args.Get(0).(*canonical.Payment), args.Error(1)
+}
+
+func (m *PaymentServiceMock) Callback(ctx context.Context, paymentId string, status canonical.PaymentStatus, payload []byte) error {
+	args := m.Called(ctx, paymentId, status, payload)
+	return args.Error(0)
+}
+
+func (m *PaymentServiceMock) History(ctx context.Context, paymentId string) ([]canonical.AuditEntry, error) {
+	args := m.Called(ctx, paymentId)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]canonical.AuditEntry), args.Error(1)
+}
+
+func (m *PaymentServiceMock) GetByID(ctx context.Context, paymentId string) (*canonical.Payment, error) {
+	args := m.Called(ctx, paymentId)
+	return args.Get(0).(*canonical.Payment), args.Error(1)
+}
+func (m *PaymentServiceMock) Cancel(ctx context.Context, paymentId string, reason canonical.StatusReason) (*canonical.Payment, error) {
+	args := m.Called(ctx, paymentId, reason)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*canonical.Payment), args.Error(1)
+}
+
+func (m *PaymentServiceMock) CancelByOrderID(ctx context.Context, orderId string, reason canonical.StatusReason) (*canonical.Payment, error) {
+	args := m.Called(ctx, orderId, reason)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*canonical.Payment), args.Error(1)
+}
+
+func (m *PaymentServiceMock) Expire(ctx context.Context, createdBefore time.Time) ([]canonical.Payment, error) {
+	args := m.Called(ctx, createdBefore)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]canonical.Payment), args.Error(1)
+}
+
+func (m *PaymentServiceMock) Reconcile(ctx context.Context, createdBefore time.Time) (canonical.ReconciliationReport, error) {
+	args := m.Called(ctx, createdBefore)
+	return args.Get(0).(canonical.ReconciliationReport), args.Error(1)
+}
+
+func (m *PaymentServiceMock) GetAll(ctx context.Context) ([]canonical.Payment, error) {
+	args := m.Called(ctx)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]canonical.Payment), args.Error(1)
+}
+
+func (m *PaymentServiceMock) Intent(ctx context.Context, orderId string) (*canonical.PaymentIntent, error) {
+	args := m.Called(ctx, orderId)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*canonical.PaymentIntent), args.Error(1)
+}
+
+func (m *PaymentServiceMock) Authorize(ctx context.Context, paymentId string) (*canonical.Payment, error) {
+	args := m.Called(ctx, paymentId)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*canonical.Payment), args.Error(1)
+}
+
+func (m *PaymentServiceMock) Capture(ctx context.Context, paymentId string, amount int64) (*canonical.Payment, error) {
+	args := m.Called(ctx, paymentId, amount)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*canonical.Payment), args.Error(1)
+}
+
+func (m *PaymentServiceMock) Search(ctx context.Context, filter canonical.PaymentFilter) ([]canonical.Payment, error) {
+	args := m.Called(ctx, filter)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]canonical.Payment), args.Error(1)
+}
+
+func (m *PaymentServiceMock) ForceStatus(ctx context.Context, paymentId string, status canonical.PaymentStatus, note string) (*canonical.Payment, error) {
+	args := m.Called(ctx, paymentId, status, note)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*canonical.Payment), args.Error(1)
+}
+
+func (m *PaymentServiceMock) Republish(ctx context.Context, paymentId string) (*canonical.Payment, error) {
+	args := m.Called(ctx, paymentId)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*canonical.Payment), args.Error(1)
+}
+
+func (m *PaymentServiceMock) VoidAuthorizations(ctx context.Context, authorizedBefore time.Time) ([]canonical.Payment, error) {
+	args := m.Called(ctx, authorizedBefore)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]canonical.Payment), args.Error(1)
+}
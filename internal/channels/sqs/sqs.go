@@ -3,22 +3,26 @@ package sqs
 import (
 	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
 	"sync"
 	"tech-challenge-payment/internal/canonical"
 	"tech-challenge-payment/internal/config"
+	"tech-challenge-payment/internal/health"
+	"tech-challenge-payment/internal/logging"
+	"tech-challenge-payment/internal/metrics"
 	"tech-challenge-payment/internal/service"
+	"tech-challenge-payment/internal/tracing"
 	"time"
 
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/sqs"
+	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
-	"github.com/sirupsen/logrus"
-)
-
-var (
-	once     sync.Once
-	instance QueueInterface
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
 )
 
 const (
@@ -27,87 +31,230 @@ const (
 )
 
 type QueueInterface interface {
-	ReceiveMessage()
+	// ReceiveMessage consumes the queues until ctx is done.
+	ReceiveMessage(ctx context.Context)
+	// CheckQueues fails when any queue the service consumes or publishes to can not be reached.
+	CheckQueues(ctx context.Context) error
+	// CheckConsumers fails when the loop of any consumed queue stopped, or never started, polling.
+	CheckConsumers(ctx context.Context) error
 }
 
 type queueSQS struct {
-	sqsService    *sqs.SQS
-	service       service.PaymentService
-	queuesAddress string
+	sqsService          *sqs.SQS
+	service             service.PaymentService
+	queuesAddress       string
+	orderCancelledQueue string
+	// queues are every queue the service consumes or publishes to
+	queues           []string
+	heartbeats       map[string]*health.Heartbeat
+	heartbeatTimeout time.Duration
+	pollInterval     time.Duration
 }
 
-func NewSQS() QueueInterface {
-	once.Do(func() {
-		sess := session.Must(session.NewSessionWithOptions(session.Options{
-			Config: aws.Config{
-				Region:     aws.String(config.Get().SQS.Region),
-				DisableSSL: aws.Bool(true),
-			},
-		}))
-
-		sqs := &queueSQS{
-			sqsService:    sqs.New(sess),
-			service:       service.NewPaymentService(),
-			queuesAddress: config.Get().SQS.PaymentPendingQueue,
-		}
+func NewSQS(sess *session.Session, paymentSvc service.PaymentService, queues config.SQSConfig, heartbeatTimeout time.Duration) QueueInterface {
+	return &queueSQS{
+		sqsService:          sqs.New(sess),
+		service:             paymentSvc,
+		queuesAddress:       queues.PaymentPendingQueue,
+		orderCancelledQueue: queues.OrderCancelledQueue,
+		queues:              []string{queues.PaymentPendingQueue, queues.OrderCancelledQueue, queues.PaymentPayedQueue, queues.PaymentCancelledQueue},
+		heartbeats: map[string]*health.Heartbeat{
+			queues.PaymentPendingQueue: {},
+			queues.OrderCancelledQueue: {},
+		},
+		heartbeatTimeout: heartbeatTimeout,
+		pollInterval:     queues.PollInterval,
+	}
+}
 
-		instance = sqs
-	})
+func (q *queueSQS) ReceiveMessage(ctx context.Context) {
+	handlers := map[string]func(context.Context, []byte) error{
+		q.queuesAddress:       q.processPaymentMessage,
+		q.orderCancelledQueue: q.processOrderCancelledMessage,
+	}
 
-	return instance
+	var wg sync.WaitGroup
+	for queueURL, handler := range handlers {
+		wg.Add(1)
+		go func(queueURL string, handler func(context.Context, []byte) error) {
+			defer wg.Done()
+			q.consume(ctx, queueURL, handler)
+		}(queueURL, handler)
+	}
+	wg.Wait()
 }
 
-func (q *queueSQS) ReceiveMessage() {
-	for {
+func (q *queueSQS) consume(ctx context.Context, queueURL string, handler func(context.Context, []byte) error) {
+	heartbeat := q.heartbeats[queueURL]
+	for ctx.Err() == nil {
+		heartbeat.Beat()
+
 		paramsOrder := &sqs.ReceiveMessageInput{
-			QueueUrl:            &q.queuesAddress,
+			QueueUrl:            &queueURL,
 			MaxNumberOfMessages: aws.Int64(1),
+			// the trace context of the publisher travels in the attributes
+			MessageAttributeNames: aws.StringSlice([]string{sqs.QueueAttributeNameAll}),
 		}
 
-		resp, err := q.sqsService.ReceiveMessage(paramsOrder)
+		resp, err := q.sqsService.ReceiveMessageWithContext(ctx, paramsOrder)
 		if err != nil {
-			log.Err(err).Msg("an error occurred when receive message from the queue")
+			if ctx.Err() != nil {
+				return
+			}
+			log.Err(err).Str(logging.QUEUE_FIELD, metrics.QueueName(queueURL)).Msg("an error occurred when receive message from the queue")
+			q.wait(ctx)
 			continue
 		}
 
 		if len(resp.Messages) > 0 {
 			for _, msg := range resp.Messages {
-				log.Info().Any("msg_id", msg.MessageId).Msg("msg received from payment queue")
-
-				err := q.processPaymentMessage([]byte(*msg.Body))
-				if err != nil {
-					continue
-				}
-
-				_, err = q.sqsService.DeleteMessage(&sqs.DeleteMessageInput{
-					QueueUrl:      &q.queuesAddress,
-					ReceiptHandle: msg.ReceiptHandle,
-				})
-				if err != nil {
-					continue
-				}
+				q.process(queueURL, msg, handler)
 			}
 		} else {
-			logrus.Info("there aren't new messages")
-			time.Sleep(time.Second * 10)
+			log.Debug().Str(logging.QUEUE_FIELD, metrics.QueueName(queueURL)).Msg("there aren't new messages")
+			q.wait(ctx)
 		}
 	}
 }
 
-func (q *queueSQS) processPaymentMessage(msg []byte) error {
+func (q *queueSQS) wait(ctx context.Context) {
+	timer := time.NewTimer(q.pollInterval)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+	case <-timer.C:
+	}
+}
+
+func (q *queueSQS) CheckQueues(ctx context.Context) error {
+	checked := map[string]bool{}
+
+	var errs []error
+	for _, queueURL := range q.queues {
+		if checked[queueURL] {
+			continue
+		}
+		checked[queueURL] = true
+
+		_, err := q.sqsService.GetQueueAttributesWithContext(ctx, &sqs.GetQueueAttributesInput{
+			QueueUrl:       aws.String(queueURL),
+			AttributeNames: aws.StringSlice([]string{sqs.QueueAttributeNameQueueArn}),
+		})
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", metrics.QueueName(queueURL), err))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+func (q *queueSQS) CheckConsumers(ctx context.Context) error {
+	queues := make([]string, 0, len(q.heartbeats))
+	for queueURL := range q.heartbeats {
+		queues = append(queues, queueURL)
+	}
+	sort.Strings(queues)
+
+	var errs []error
+	for _, queueURL := range queues {
+		if err := q.heartbeats[queueURL].Check(q.heartbeatTimeout)(ctx); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", metrics.QueueName(queueURL), err))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// process handles a message within a span that continues the trace of its publisher and
+// deletes it once handled, failed messages are left for SQS to deliver again.
+func (q *queueSQS) process(queueURL string, msg *sqs.Message, handler func(context.Context, []byte) error) {
+	start := time.Now()
+	metrics.ObserveMessage(queueURL, metrics.SQS_RECEIVED)
+
+	ctx, span := tracing.Start(tracing.Extract(context.Background(), msg.MessageAttributes), metrics.QueueName(queueURL)+" process",
+		trace.WithSpanKind(trace.SpanKindConsumer),
+		trace.WithAttributes(
+			semconv.MessagingSystemAWSSqs,
+			semconv.MessagingDestinationName(metrics.QueueName(queueURL)),
+			semconv.MessagingMessageID(aws.StringValue(msg.MessageId)),
+		),
+	)
+	if requestID, ok := msg.MessageAttributes[logging.REQUEST_ID_ATTRIBUTE]; ok {
+		ctx = logging.WithRequestID(ctx, aws.StringValue(requestID.StringValue))
+	}
+	ctx = logging.NewContext(ctx, func(with zerolog.Context) zerolog.Context {
+		return with.Str(logging.MESSAGE_ID_FIELD, aws.StringValue(msg.MessageId)).Str(logging.QUEUE_FIELD, metrics.QueueName(queueURL))
+	})
+	ctx = service.WithActor(ctx, service.ACTOR_SQS_CONSUMER)
+	logging.Ctx(ctx).Info().Msg("msg received from queue")
+
+	err := handler(ctx, []byte(aws.StringValue(msg.Body)))
+	if err != nil {
+		metrics.ObserveMessage(queueURL, metrics.SQS_FAILED)
+		tracing.End(span, err)
+		logging.Ctx(ctx).Warn().Dur("latency_ms", time.Since(start)).Msg("msg not processed, it will be delivered again")
+		return
+	}
+	metrics.ObserveMessage(queueURL, metrics.SQS_PROCESSED)
+
+	_, err = q.sqsService.DeleteMessageWithContext(ctx, &sqs.DeleteMessageInput{
+		QueueUrl:      &queueURL,
+		ReceiptHandle: msg.ReceiptHandle,
+	})
+	tracing.End(span, err)
+	if err != nil {
+		logging.Ctx(ctx).Err(err).Msg("an error occurred when delete message from the queue")
+		return
+	}
+	metrics.ObserveMessage(queueURL, metrics.SQS_DELETED)
+	logging.Ctx(ctx).Info().Dur("latency_ms", time.Since(start)).Msg("msg processed")
+}
+
+func (q *queueSQS) processPaymentMessage(ctx context.Context, msg []byte) error {
 	var orderId string
 
 	err := json.Unmarshal(msg, &orderId)
 	if err != nil {
-		log.Err(err).Msg("an error occurred when unmarshal order")
+		logging.Ctx(ctx).Err(err).Msg("an error occurred when unmarshal order")
 		return err
 	}
 
-	_, err = q.service.Create(context.Background(), canonical.Payment{
+	_, err = q.service.Create(ctx, canonical.Payment{
 		OrderID: orderId,
 	})
 	if err != nil {
-		log.Err(err).Any("order_id", orderId).Msg("an error occurred when create payment")
+		// the message was delivered again, the order is already being paid
+		if errors.Is(err, canonical.ErrorAttemptPending) || errors.Is(err, canonical.ErrorIntentSettled) {
+			logging.Ctx(ctx).Warn().Err(err).Str("order_id", orderId).Msg("payment of pending order already requested")
+			return nil
+		}
+
+		logging.Ctx(ctx).Err(err).Str("order_id", orderId).Msg("an error occurred when create payment")
+		return err
+	}
+
+	return nil
+}
+
+func (q *queueSQS) processOrderCancelledMessage(ctx context.Context, msg []byte) error {
+	var orderId string
+
+	err := json.Unmarshal(msg, &orderId)
+	if err != nil {
+		logging.Ctx(ctx).Err(err).Msg("an error occurred when unmarshal order")
+		return err
+	}
+
+	_, err = q.service.CancelByOrderID(ctx, orderId, canonical.REASON_ORDER_CANCELLED)
+	if err != nil {
+		// there is nothing to cancel, retrying the message would not change that
+		if errors.Is(err, canonical.ErrorNotFound) || errors.Is(err, canonical.ErrorInvalidTransition) {
+			logging.Ctx(ctx).Warn().Err(err).Str("order_id", orderId).Msg("payment of cancelled order can not be cancelled")
+			return nil
+		}
+
+		logging.Ctx(ctx).Err(err).Str("order_id", orderId).Msg("an error occurred when cancel payment")
 		return err
 	}
 
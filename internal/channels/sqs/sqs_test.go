@@ -0,0 +1,300 @@
+package sqs
+
+import (
+	"context"
+	"errors"
+	"tech-challenge-payment/internal/canonical"
+	"tech-challenge-payment/internal/config"
+	"tech-challenge-payment/internal/health"
+	"tech-challenge-payment/internal/integration/aws_session"
+	"tech-challenge-payment/internal/logging"
+	"tech-challenge-payment/internal/service"
+	"tech-challenge-payment/internal/sqstest"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/sqs"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestProcessPaymentMessage(t *testing.T) {
+	type Given struct {
+		msg            []byte
+		paymentService func() service.PaymentService
+	}
+	type Expected struct {
+		err assert.ErrorAssertionFunc
+	}
+	tests := map[string]struct {
+		given    Given
+		expected Expected
+	}{
+		"given valid order id, must create payment": {
+			given: Given{
+				msg: []byte(`"order_valid"`),
+				paymentService: func() service.PaymentService {
+					svcMock := new(PaymentServiceMock)
+					svcMock.On("Create", mock.Anything, canonical.Payment{OrderID: "order_valid"}).Return(&canonical.Payment{}, nil)
+					return svcMock
+				},
+			},
+			expected: Expected{
+				err: assert.NoError,
+			},
+		},
+		"given invalid message, must return error": {
+			given: Given{
+				msg: []byte(`{`),
+				paymentService: func() service.PaymentService {
+					return new(PaymentServiceMock)
+				},
+			},
+			expected: Expected{
+				err: assert.Error,
+			},
+		},
+		"given error creating payment, must return error": {
+			given: Given{
+				msg: []byte(`"order_valid"`),
+				paymentService: func() service.PaymentService {
+					svcMock := new(PaymentServiceMock)
+					svcMock.On("Create", mock.Anything, mock.Anything).Return(&canonical.Payment{}, errors.New("db error"))
+					return svcMock
+				},
+			},
+			expected: Expected{
+				err: assert.Error,
+			},
+		},
+		"given order already being paid, must acknowledge the message": {
+			given: Given{
+				msg: []byte(`"order_valid"`),
+				paymentService: func() service.PaymentService {
+					svcMock := new(PaymentServiceMock)
+					svcMock.On("Create", mock.Anything, mock.Anything).Return(&canonical.Payment{}, canonical.ErrorAttemptPending)
+					return svcMock
+				},
+			},
+			expected: Expected{
+				err: assert.NoError,
+			},
+		},
+		"given order no longer payable, must acknowledge the message": {
+			given: Given{
+				msg: []byte(`"order_valid"`),
+				paymentService: func() service.PaymentService {
+					svcMock := new(PaymentServiceMock)
+					svcMock.On("Create", mock.Anything, mock.Anything).Return(&canonical.Payment{}, canonical.ErrorIntentSettled)
+					return svcMock
+				},
+			},
+			expected: Expected{
+				err: assert.NoError,
+			},
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			q := queueSQS{
+				service: tc.given.paymentService(),
+			}
+
+			tc.expected.err(t, q.processPaymentMessage(context.Background(), tc.given.msg))
+		})
+	}
+}
+
+func TestProcessOrderCancelledMessage(t *testing.T) {
+	type Given struct {
+		msg       []byte
+		cancelErr error
+	}
+	type Expected struct {
+		err assert.ErrorAssertionFunc
+	}
+	tests := map[string]struct {
+		given    Given
+		expected Expected
+	}{
+		"given cancelled order, must cancel its payment": {
+			given: Given{
+				msg: []byte(`"order_valid"`),
+			},
+			expected: Expected{
+				err: assert.NoError,
+			},
+		},
+		"given order without payment, must acknowledge message": {
+			given: Given{
+				msg:       []byte(`"order_valid"`),
+				cancelErr: canonical.ErrorNotFound,
+			},
+			expected: Expected{
+				err: assert.NoError,
+			},
+		},
+		"given order already payed, must acknowledge message": {
+			given: Given{
+				msg:       []byte(`"order_valid"`),
+				cancelErr: canonical.ErrorInvalidTransition,
+			},
+			expected: Expected{
+				err: assert.NoError,
+			},
+		},
+		"given unexpected error, must return error to retry": {
+			given: Given{
+				msg:       []byte(`"order_valid"`),
+				cancelErr: errors.New("db error"),
+			},
+			expected: Expected{
+				err: assert.Error,
+			},
+		},
+		"given invalid message, must return error": {
+			given: Given{
+				msg: []byte(`{`),
+			},
+			expected: Expected{
+				err: assert.Error,
+			},
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			svcMock := new(PaymentServiceMock)
+			svcMock.On("CancelByOrderID", mock.Anything, "order_valid", canonical.REASON_ORDER_CANCELLED).Return(nil, tc.given.cancelErr)
+
+			q := queueSQS{
+				service: svcMock,
+			}
+
+			tc.expected.err(t, q.processOrderCancelledMessage(context.Background(), tc.given.msg))
+		})
+	}
+}
+
+func TestProcessContinuesTrace(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+
+	var handled trace.SpanContext
+	q := queueSQS{}
+	// a failing handler keeps the message in the queue, so there is nothing to delete
+	q.process("http://localhost:4566/000000000000/paymentpendingqueue", &sqs.Message{
+		MessageId: aws.String("message-1"),
+		Body:      aws.String(`"order_valid"`),
+		MessageAttributes: map[string]*sqs.MessageAttributeValue{
+			"traceparent": {
+				DataType:    aws.String("String"),
+				StringValue: aws.String("00-4bf92f3577b34da6a1c7d1a2f7b5c6d1-00f067aa0ba902b7-01"),
+			},
+		},
+	}, func(ctx context.Context, msg []byte) error {
+		handled = trace.SpanContextFromContext(ctx)
+		return errors.New("db error")
+	})
+
+	spans := recorder.Ended()
+	assert.Len(t, spans, 1)
+	assert.Equal(t, "paymentpendingqueue process", spans[0].Name())
+	assert.Equal(t, trace.SpanKindConsumer, spans[0].SpanKind())
+	assert.Equal(t, "4bf92f3577b34da6a1c7d1a2f7b5c6d1", spans[0].SpanContext().TraceID().String())
+	assert.Equal(t, "00f067aa0ba902b7", spans[0].Parent().SpanID().String())
+	assert.Contains(t, spans[0].Attributes(), semconv.MessagingMessageID("message-1"))
+	assert.Equal(t, codes.Error, spans[0].Status().Code)
+	assert.Equal(t, spans[0].SpanContext().SpanID(), handled.SpanID())
+}
+
+func newFakeSQS(t *testing.T, server *sqstest.Server) *sqs.SQS {
+	sess, err := aws_session.New("sa-east-1", server.URL, false, config.AWSCredentials{
+		Source:          aws_session.CREDENTIALS_STATIC,
+		AccessKeyID:     "test",
+		SecretAccessKey: "test",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return sqs.New(sess)
+}
+
+func TestCheckQueues(t *testing.T) {
+	server := sqstest.NewServer("pending", "cancelled", "payed")
+	defer server.Close()
+	q := queueSQS{
+		sqsService: newFakeSQS(t, server),
+		queues:     []string{server.QueueURL("pending"), server.QueueURL("cancelled"), server.QueueURL("payed"), server.QueueURL("cancelled")},
+	}
+	assert.NoError(t, q.CheckQueues(context.Background()))
+
+	q.queues[2] = server.QueueURL("missing")
+	err := q.CheckQueues(context.Background())
+	assert.ErrorContains(t, err, "missing")
+	assert.NotContains(t, err.Error(), "pending")
+}
+
+func TestProcess(t *testing.T) {
+	server := sqstest.NewServer("pending")
+	defer server.Close()
+	q := queueSQS{sqsService: newFakeSQS(t, server)}
+	queueURL := server.QueueURL("pending")
+
+	server.Send("pending", `"order_valid"`, map[string]string{logging.REQUEST_ID_ATTRIBUTE: "request-1"})
+	server.Send("pending", `"order_broken"`, nil)
+
+	resp, err := q.sqsService.ReceiveMessage(&sqs.ReceiveMessageInput{
+		QueueUrl:              aws.String(queueURL),
+		MaxNumberOfMessages:   aws.Int64(2),
+		MessageAttributeNames: aws.StringSlice([]string{sqs.QueueAttributeNameAll}),
+	})
+	assert.NoError(t, err)
+	assert.Len(t, resp.Messages, 2)
+
+	requestIDs := map[string]string{}
+	for _, msg := range resp.Messages {
+		q.process(queueURL, msg, func(ctx context.Context, body []byte) error {
+			requestIDs[string(body)] = logging.RequestID(ctx)
+			if string(body) == `"order_broken"` {
+				return errors.New("db error")
+			}
+			return nil
+		})
+	}
+
+	assert.Equal(t, "request-1", requestIDs[`"order_valid"`])
+	// only the processed message is deleted, the failed one is left for SQS to deliver again
+	messages := server.Messages("pending")
+	assert.Len(t, messages, 1)
+	assert.Equal(t, `"order_broken"`, messages[0].Body)
+}
+
+func TestCheckConsumers(t *testing.T) {
+	pending, cancelled := &health.Heartbeat{}, &health.Heartbeat{}
+	q := queueSQS{
+		heartbeats: map[string]*health.Heartbeat{
+			"http://localhost:4566/000000000000/pending":   pending,
+			"http://localhost:4566/000000000000/cancelled": cancelled,
+		},
+		heartbeatTimeout: time.Minute,
+	}
+
+	pending.Beat()
+	err := q.CheckConsumers(context.Background())
+	assert.ErrorIs(t, err, health.ErrNotStarted)
+	assert.ErrorContains(t, err, "cancelled")
+
+	cancelled.Beat()
+	assert.NoError(t, q.CheckConsumers(context.Background()))
+}
@@ -3,6 +3,7 @@ package config
 import (
 	"flag"
 	"log"
+	"time"
 
 	"github.com/notnull-co/cfg"
 )
@@ -12,21 +13,109 @@ var (
 )
 
 type Config struct {
-	Token struct {
-		Key string `cfg:"key"`
-	} `cfg:"token"`
-	Server struct {
+	Token  TokenConfig `cfg:"token"`
+	APIKey struct {
+		RotationGrace    time.Duration `cfg:"rotation_grace" default:"1h"`
+		LastUsedInterval time.Duration `cfg:"last_used_interval" default:"1m"`
+	} `cfg:"api_key"`
+	Server ServerConfig `cfg:"server"`
+	GRPC   struct {
 		Port string `cfg:"port"`
-	} `cfg:"server"`
-	DB struct {
+	} `cfg:"grpc"`
+	Health struct {
+		Timeout          time.Duration `cfg:"timeout" default:"2s"`
+		HeartbeatTimeout time.Duration `cfg:"heartbeat_timeout" default:"1m"`
+	} `cfg:"health"`
+	SSE struct {
+		HeartbeatInterval time.Duration `cfg:"heartbeat_interval" default:"15s"`
+	} `cfg:"sse"`
+	Expiration struct {
+		TTL      time.Duration `cfg:"ttl" default:"30m"`
+		Interval time.Duration `cfg:"interval" default:"1m"`
+	} `cfg:"expiration"`
+	Intent struct {
+		MaxAttempts int `cfg:"max_attempts" default:"3"`
+	} `cfg:"intent"`
+	Provider struct {
+		DefaultMethod string `cfg:"default_method" default:"PIX"`
+		// Adapters names the provider integration each payment method goes through.
+		Adapters struct {
+			PIX        string `cfg:"pix" default:"log"`
+			CreditCard string `cfg:"credit_card" default:"log"`
+			DebitCard  string `cfg:"debit_card" default:"log"`
+			Boleto     string `cfg:"boleto" default:"log"`
+			Cash       string `cfg:"cash" default:"log"`
+		} `cfg:"adapters"`
+	} `cfg:"provider"`
+	Authorization struct {
+		// CaptureWindow is how long an authorization waits to be captured before it is voided.
+		CaptureWindow time.Duration `cfg:"capture_window" default:"24h"`
+		Interval      time.Duration `cfg:"interval" default:"5m"`
+	} `cfg:"authorization"`
+	Reconciliation struct {
+		Interval time.Duration `cfg:"interval" default:"5m"`
+		After    time.Duration `cfg:"after" default:"10m"`
+	} `cfg:"reconciliation"`
+	Tracing TracingConfig `cfg:"tracing"`
+	DB      struct {
 		ConnectionString string `cfg:"connection_string"`
 	} `cfg:"db"`
-	SQS struct {
-		PaymentPendingQueue   string `cfg:"payment_pending_queue"`
-		PaymentPayedQueue     string `cfg:"payment_payed_queue"`
-		PaymentCancelledQueue string `cfg:"payment_cancelled_queue"`
-		Region                string `cfg:"region"`
-	} `cfg:"sqs"`
+	SQS SQSConfig `cfg:"sqs"`
+}
+
+// TokenConfig holds the keys bearer tokens are verified with and the claims they must carry.
+type TokenConfig struct {
+	Key                 string        `cfg:"key"`
+	JWKSURL             string        `cfg:"jwks_url"`
+	JWKSRefreshInterval time.Duration `cfg:"jwks_refresh_interval" default:"10m"`
+	Issuer              string        `cfg:"issuer"`
+	Audience            string        `cfg:"audience"`
+	ClockSkew           time.Duration `cfg:"clock_skew" default:"30s"`
+}
+
+// ServerConfig is where and how the REST API is served.
+type ServerConfig struct {
+	Port string `cfg:"port"`
+	TLS  struct {
+		Enabled        bool          `cfg:"enabled"`
+		CertFile       string        `cfg:"cert_file"`
+		KeyFile        string        `cfg:"key_file"`
+		ClientCAFile   string        `cfg:"client_ca_file"`
+		ClientAuth     string        `cfg:"client_auth" default:"none"`
+		ClientScopes   []string      `cfg:"client_scopes" default:"[payments:callback]"`
+		ReloadInterval time.Duration `cfg:"reload_interval" default:"10s"`
+	} `cfg:"tls"`
+}
+
+// TracingConfig is where spans are exported to and how many of them.
+type TracingConfig struct {
+	Exporter    string  `cfg:"exporter" default:"none"`
+	Endpoint    string  `cfg:"endpoint"`
+	ServiceName string  `cfg:"service_name" default:"tech-challenge-payment"`
+	SampleRatio float64 `cfg:"sample_ratio" default:"1"`
+}
+
+// SQSConfig holds the queues the service consumes and publishes to, and how to reach them.
+type SQSConfig struct {
+	PaymentPendingQueue   string         `cfg:"payment_pending_queue"`
+	PaymentPayedQueue     string         `cfg:"payment_payed_queue"`
+	PaymentCancelledQueue string         `cfg:"payment_cancelled_queue"`
+	OrderCancelledQueue   string         `cfg:"order_cancelled_queue"`
+	Region                string         `cfg:"region"`
+	Endpoint              string         `cfg:"endpoint"`
+	DisableSSL            bool           `cfg:"disable_ssl"`
+	Credentials           AWSCredentials `cfg:"credentials"`
+	PollInterval          time.Duration  `cfg:"poll_interval" default:"10s"`
+}
+
+// AWSCredentials picks where the AWS clients get their credentials from: the default chain of
+// the SDK, the static keys below, the environment or a profile of the shared credentials file.
+type AWSCredentials struct {
+	Source          string `cfg:"source" default:"default"`
+	AccessKeyID     string `cfg:"access_key_id"`
+	SecretAccessKey string `cfg:"secret_access_key"`
+	SessionToken    string `cfg:"session_token"`
+	Profile         string `cfg:"profile"`
 }
 
 func ParseFromFlags() {
@@ -45,6 +134,10 @@ func parse(dirs ...string) {
 	); err != nil {
 		log.Panic(err)
 	}
+
+	if err := Validate(Cfg); err != nil {
+		log.Fatal(err)
+	}
 }
 func Get() Config {
 	return Cfg
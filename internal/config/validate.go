@@ -0,0 +1,204 @@
+package config
+
+import (
+	"fmt"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	REDACTED = "[REDACTED]"
+)
+
+// ValidationError lists every problem found in the configuration, so they can all be fixed at once.
+type ValidationError struct {
+	Problems []string
+}
+
+func (e *ValidationError) Error() string {
+	return "invalid configuration:\n  - " + strings.Join(e.Problems, "\n  - ")
+}
+
+type validator struct {
+	problems []string
+}
+
+func (v *validator) fail(key, format string, args ...any) {
+	v.problems = append(v.problems, key+": "+fmt.Sprintf(format, args...))
+}
+
+func (v *validator) required(key, value string) bool {
+	if len(strings.TrimSpace(value)) == 0 {
+		v.fail(key, "is required")
+		return false
+	}
+	return true
+}
+
+func (v *validator) port(key, value string) {
+	if !v.required(key, value) {
+		return
+	}
+	if port, err := strconv.Atoi(value); err != nil || port < 1 || port > 65535 {
+		v.fail(key, "must be a port between 1 and 65535, got %q", value)
+	}
+}
+
+// url accepts absolute URLs with one of the schemes, empty values are left to required.
+func (v *validator) url(key, value string, schemes ...string) {
+	if len(value) == 0 {
+		return
+	}
+
+	parsed, err := url.Parse(value)
+	if err != nil || len(parsed.Host) == 0 {
+		v.fail(key, "must be an absolute URL")
+		return
+	}
+
+	for _, scheme := range schemes {
+		if parsed.Scheme == scheme {
+			return
+		}
+	}
+	v.fail(key, "must use one of the schemes %s, got %q", strings.Join(schemes, ", "), parsed.Scheme)
+}
+
+func (v *validator) positive(key string, value time.Duration) {
+	if value <= 0 {
+		v.fail(key, "must be a positive duration, got %s", value)
+	}
+}
+
+func (v *validator) notNegative(key string, value time.Duration) {
+	if value < 0 {
+		v.fail(key, "must not be a negative duration, got %s", value)
+	}
+}
+
+func (v *validator) oneOf(key, value string, allowed ...string) {
+	for _, candidate := range allowed {
+		if value == candidate {
+			return
+		}
+	}
+	v.fail(key, "must be one of %s, got %q", strings.Join(allowed, ", "), value)
+}
+
+// Validate checks the configuration the service can not run without, returning a *ValidationError
+// listing every problem found.
+func Validate(c Config) error {
+	v := &validator{}
+
+	v.port("server.port", c.Server.Port)
+	v.port("grpc.port", c.GRPC.Port)
+
+	if len(c.Token.Key) == 0 && len(c.Token.JWKSURL) == 0 {
+		v.fail("token", "either key or jwks_url is required")
+	}
+	v.url("token.jwks_url", c.Token.JWKSURL, "https", "http")
+	v.positive("token.jwks_refresh_interval", c.Token.JWKSRefreshInterval)
+	v.notNegative("token.clock_skew", c.Token.ClockSkew)
+
+	v.notNegative("api_key.rotation_grace", c.APIKey.RotationGrace)
+	v.notNegative("api_key.last_used_interval", c.APIKey.LastUsedInterval)
+
+	if tls := c.Server.TLS; tls.Enabled {
+		v.required("server.tls.cert_file", tls.CertFile)
+		v.required("server.tls.key_file", tls.KeyFile)
+		v.oneOf("server.tls.client_auth", tls.ClientAuth, "none", "optional", "require")
+		if tls.ClientAuth != "none" {
+			v.required("server.tls.client_ca_file", tls.ClientCAFile)
+		}
+		v.positive("server.tls.reload_interval", tls.ReloadInterval)
+	}
+
+	v.positive("health.timeout", c.Health.Timeout)
+	v.positive("health.heartbeat_timeout", c.Health.HeartbeatTimeout)
+	v.positive("sse.heartbeat_interval", c.SSE.HeartbeatInterval)
+	v.positive("expiration.ttl", c.Expiration.TTL)
+	v.positive("expiration.interval", c.Expiration.Interval)
+	if c.Intent.MaxAttempts < 1 {
+		v.fail("intent.max_attempts", "must be at least 1, got %d", c.Intent.MaxAttempts)
+	}
+	// payments created from the pending queue get the default method, and the order service
+	// sends no card token
+	v.oneOf("provider.default_method", c.Provider.DefaultMethod, "PIX", "BOLETO", "CASH")
+	for key, adapter := range map[string]string{
+		"provider.adapters.pix":         c.Provider.Adapters.PIX,
+		"provider.adapters.credit_card": c.Provider.Adapters.CreditCard,
+		"provider.adapters.debit_card":  c.Provider.Adapters.DebitCard,
+		"provider.adapters.boleto":      c.Provider.Adapters.Boleto,
+		"provider.adapters.cash":        c.Provider.Adapters.Cash,
+	} {
+		v.required(key, adapter)
+	}
+	v.positive("authorization.capture_window", c.Authorization.CaptureWindow)
+	v.positive("authorization.interval", c.Authorization.Interval)
+	v.positive("reconciliation.interval", c.Reconciliation.Interval)
+	v.positive("reconciliation.after", c.Reconciliation.After)
+
+	v.oneOf("tracing.exporter", c.Tracing.Exporter, "none", "stdout", "otlp")
+	v.url("tracing.endpoint", c.Tracing.Endpoint, "https", "http")
+	if c.Tracing.SampleRatio < 0 || c.Tracing.SampleRatio > 1 {
+		v.fail("tracing.sample_ratio", "must be between 0 and 1, got %v", c.Tracing.SampleRatio)
+	}
+
+	if v.required("db.connection_string", c.DB.ConnectionString) {
+		v.url("db.connection_string", c.DB.ConnectionString, "mongodb", "mongodb+srv")
+	}
+
+	v.url("sqs.endpoint", c.SQS.Endpoint, "https", "http")
+	v.oneOf("sqs.credentials.source", c.SQS.Credentials.Source, "default", "static", "env", "shared")
+	if c.SQS.Credentials.Source == "static" {
+		v.required("sqs.credentials.access_key_id", c.SQS.Credentials.AccessKeyID)
+		v.required("sqs.credentials.secret_access_key", c.SQS.Credentials.SecretAccessKey)
+	}
+	v.required("sqs.region", c.SQS.Region)
+	v.positive("sqs.poll_interval", c.SQS.PollInterval)
+	for key, queue := range map[string]string{
+		"sqs.payment_pending_queue":   c.SQS.PaymentPendingQueue,
+		"sqs.payment_payed_queue":     c.SQS.PaymentPayedQueue,
+		"sqs.payment_cancelled_queue": c.SQS.PaymentCancelledQueue,
+		"sqs.order_cancelled_queue":   c.SQS.OrderCancelledQueue,
+	} {
+		if v.required(key, queue) {
+			v.url(key, queue, "https", "http")
+		}
+	}
+
+	if len(v.problems) > 0 {
+		sort.Strings(v.problems)
+		return &ValidationError{Problems: v.problems}
+	}
+	return nil
+}
+
+// Redacted is a copy of the configuration safe to be logged, secrets are replaced and so are the
+// passwords in connection strings.
+func (c Config) Redacted() Config {
+	if len(c.Token.Key) > 0 {
+		c.Token.Key = REDACTED
+	}
+	if len(c.SQS.Credentials.SecretAccessKey) > 0 {
+		c.SQS.Credentials.SecretAccessKey = REDACTED
+	}
+	if len(c.SQS.Credentials.SessionToken) > 0 {
+		c.SQS.Credentials.SessionToken = REDACTED
+	}
+	c.DB.ConnectionString = redactURL(c.DB.ConnectionString)
+	c.Tracing.Endpoint = redactURL(c.Tracing.Endpoint)
+	return c
+}
+
+func redactURL(value string) string {
+	parsed, err := url.Parse(value)
+	if err != nil {
+		// an unparseable value may still hold a secret
+		return REDACTED
+	}
+	return parsed.Redacted()
+}
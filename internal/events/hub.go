@@ -0,0 +1,157 @@
+package events
+
+import (
+	"sync"
+	"tech-challenge-payment/internal/canonical"
+	"time"
+)
+
+const (
+	historySize      = 32
+	subscriberBuffer = 16
+	retention        = 5 * time.Minute
+)
+
+// Event is a change of a payment, its ID is the version of the payment, that is
+// the sequence of the event of its log, so it means the same on every replica
+// and across restarts.
+type Event struct {
+	ID      uint64
+	Payment canonical.Payment
+}
+
+// Hub fans out payment status changes to everyone watching a payment. It keeps
+// a short history per payment so subscribers can resume from the last event
+// they have seen. The history only holds what this replica published lately,
+// clients resuming from elsewhere or after a long pause need a snapshot of the
+// payment.
+type Hub interface {
+	Publish(payment canonical.Payment)
+	// Subscribe returns a channel with every event newer than lastEventID and a
+	// function that must be called to release the subscription. The channel is
+	// closed when the subscription is released or when the subscriber falls too
+	// far behind, in which case it should subscribe again.
+	Subscribe(paymentID string, lastEventID uint64) (<-chan Event, func())
+}
+
+type topic struct {
+	history     []Event
+	subscribers map[uint64]chan Event
+	expiration  *time.Timer
+}
+
+type hub struct {
+	mu        sync.Mutex
+	nextSubID uint64
+	topics    map[string]*topic
+	retention time.Duration
+}
+
+func NewHub() Hub {
+	return newHub(retention)
+}
+
+func newHub(retention time.Duration) *hub {
+	return &hub{
+		topics:    map[string]*topic{},
+		retention: retention,
+	}
+}
+
+func (h *hub) Publish(payment canonical.Payment) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	event := Event{
+		ID:      payment.Version,
+		Payment: payment,
+	}
+
+	t := h.topic(payment.ID)
+	t.history = append(t.history, event)
+	if len(t.history) > historySize {
+		t.history = t.history[len(t.history)-historySize:]
+	}
+
+	for id, ch := range t.subscribers {
+		select {
+		case ch <- event:
+		default:
+			close(ch)
+			delete(t.subscribers, id)
+		}
+	}
+
+	h.scheduleExpiration(payment.ID, t)
+}
+
+func (h *hub) Subscribe(paymentID string, lastEventID uint64) (<-chan Event, func()) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	t := h.topic(paymentID)
+	ch := make(chan Event, subscriberBuffer+historySize)
+	for _, event := range t.history {
+		if event.ID > lastEventID {
+			ch <- event
+		}
+	}
+
+	h.nextSubID++
+	subID := h.nextSubID
+	t.subscribers[subID] = ch
+
+	var unsubscribe sync.Once
+	return ch, func() {
+		unsubscribe.Do(func() {
+			h.mu.Lock()
+			defer h.mu.Unlock()
+
+			if current, ok := t.subscribers[subID]; ok {
+				close(current)
+				delete(t.subscribers, subID)
+			}
+
+			if len(t.subscribers) > 0 {
+				return
+			}
+
+			if len(t.history) > 0 {
+				h.scheduleExpiration(paymentID, t)
+			} else if h.topics[paymentID] == t {
+				delete(h.topics, paymentID)
+			}
+		})
+	}
+}
+
+func (h *hub) topic(paymentID string) *topic {
+	t, ok := h.topics[paymentID]
+	if !ok {
+		t = &topic{
+			subscribers: map[uint64]chan Event{},
+		}
+		h.topics[paymentID] = t
+	}
+
+	return t
+}
+
+// scheduleExpiration drops the history of a payment once it was neither changed
+// nor watched for the retention, whether it finished or not, so payments that
+// never finish here, e.g. because another replica finishes them, do not pile
+// up.
+func (h *hub) scheduleExpiration(paymentID string, t *topic) {
+	if t.expiration != nil {
+		t.expiration.Stop()
+	}
+
+	t.expiration = time.AfterFunc(h.retention, func() {
+		h.mu.Lock()
+		defer h.mu.Unlock()
+
+		if h.topics[paymentID] == t && len(t.subscribers) == 0 {
+			delete(h.topics, paymentID)
+		}
+	})
+}
@@ -0,0 +1,162 @@
+package events
+
+import (
+	"tech-challenge-payment/internal/canonical"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPublish(t *testing.T) {
+	type Given struct {
+		published   []canonical.Payment
+		lastEventID uint64
+	}
+	type Expected struct {
+		ids []uint64
+	}
+	tests := map[string]struct {
+		given    Given
+		expected Expected
+	}{
+		"given events already published, must replay all of them": {
+			given: Given{
+				published: []canonical.Payment{
+					{ID: "1234", Status: canonical.PAYMENT_CREATED, Version: 1},
+					{ID: "1234", Status: canonical.PAYMENT_PAYED, Version: 2},
+				},
+			},
+			expected: Expected{
+				ids: []uint64{1, 2},
+			},
+		},
+		"given last event id, must replay only newer events": {
+			given: Given{
+				published: []canonical.Payment{
+					{ID: "1234", Status: canonical.PAYMENT_CREATED, Version: 1},
+					{ID: "1234", Status: canonical.PAYMENT_PAYED, Version: 2},
+				},
+				lastEventID: 1,
+			},
+			expected: Expected{
+				ids: []uint64{2},
+			},
+		},
+		"given events from other payments, must ignore them": {
+			given: Given{
+				published: []canonical.Payment{
+					{ID: "4321", Status: canonical.PAYMENT_CREATED, Version: 1},
+					{ID: "1234", Status: canonical.PAYMENT_CREATED, Version: 1},
+				},
+			},
+			expected: Expected{
+				ids: []uint64{1},
+			},
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			h := newHub(time.Minute)
+			for _, payment := range tc.given.published {
+				h.Publish(payment)
+			}
+
+			ch, unsubscribe := h.Subscribe("1234", tc.given.lastEventID)
+			unsubscribe()
+
+			var ids []uint64
+			for event := range ch {
+				ids = append(ids, event.ID)
+			}
+
+			assert.Equal(t, tc.expected.ids, ids)
+		})
+	}
+}
+
+func TestSubscribe(t *testing.T) {
+	h := newHub(time.Minute)
+
+	ch, unsubscribe := h.Subscribe("1234", 0)
+	h.Publish(canonical.Payment{ID: "1234", Status: canonical.PAYMENT_PAYED})
+
+	event := <-ch
+	assert.Equal(t, canonical.PAYMENT_PAYED, event.Payment.Status)
+
+	unsubscribe()
+	unsubscribe()
+	_, ok := <-ch
+	assert.False(t, ok)
+}
+
+func TestSlowSubscriber(t *testing.T) {
+	h := newHub(time.Minute)
+
+	ch, unsubscribe := h.Subscribe("1234", 0)
+	defer unsubscribe()
+
+	for i := 0; i < historySize+subscriberBuffer+1; i++ {
+		h.Publish(canonical.Payment{ID: "1234", Status: canonical.PAYMENT_CREATED})
+	}
+
+	received := 0
+	for range ch {
+		received++
+	}
+
+	assert.Equal(t, historySize+subscriberBuffer, received)
+}
+
+func TestExpiration(t *testing.T) {
+	h := newHub(time.Millisecond)
+
+	h.Publish(canonical.Payment{ID: "1234", Status: canonical.PAYMENT_PAYED})
+
+	assert.Eventually(t, func() bool {
+		h.mu.Lock()
+		defer h.mu.Unlock()
+		return len(h.topics) == 0
+	}, time.Second, time.Millisecond)
+
+	_, unsubscribe := h.Subscribe("4321", 0)
+	unsubscribe()
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	assert.Empty(t, h.topics)
+}
+
+func TestExpirationOfPendingPayment(t *testing.T) {
+	h := newHub(time.Millisecond)
+
+	// a payment finished by another replica is only ever seen pending here
+	h.Publish(canonical.Payment{ID: "1234", Status: canonical.PAYMENT_CREATED, Version: 1})
+
+	assert.Eventually(t, func() bool {
+		h.mu.Lock()
+		defer h.mu.Unlock()
+		return len(h.topics) == 0
+	}, time.Second, time.Millisecond)
+}
+
+func TestExpirationWaitsForSubscribers(t *testing.T) {
+	h := newHub(time.Millisecond)
+
+	ch, unsubscribe := h.Subscribe("1234", 0)
+	h.Publish(canonical.Payment{ID: "1234", Status: canonical.PAYMENT_CREATED, Version: 1})
+	<-ch
+	time.Sleep(10 * time.Millisecond)
+
+	h.mu.Lock()
+	assert.Len(t, h.topics, 1)
+	h.mu.Unlock()
+
+	unsubscribe()
+	assert.Eventually(t, func() bool {
+		h.mu.Lock()
+		defer h.mu.Unlock()
+		return len(h.topics) == 0
+	}, time.Second, time.Millisecond)
+}
@@ -0,0 +1,142 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	STATUS_OK          = "ok"
+	STATUS_UNAVAILABLE = "unavailable"
+)
+
+var (
+	ErrNotStarted = errors.New("not started")
+	ErrStalled    = errors.New("stalled")
+)
+
+// Check reports whether a dependency can be used, it must give up once ctx is done.
+type Check func(ctx context.Context) error
+
+type Result struct {
+	Status  string  `json:"status"`
+	Error   string  `json:"error,omitempty"`
+	Latency float64 `json:"latency_ms"`
+}
+
+type Report struct {
+	Status string            `json:"status"`
+	Checks map[string]Result `json:"checks,omitempty"`
+}
+
+func (r Report) OK() bool {
+	return r.Status == STATUS_OK
+}
+
+type Checker interface {
+	// Live only tells the process is able to answer, dependencies are left out so an outage
+	// of one of them does not get every replica restarted.
+	Live(ctx context.Context) Report
+	// Ready runs every check, the service is ready only when all of them pass.
+	Ready(ctx context.Context) Report
+}
+
+type checker struct {
+	checks  map[string]Check
+	timeout time.Duration
+}
+
+func NewChecker(timeout time.Duration, checks map[string]Check) Checker {
+	return &checker{
+		checks:  checks,
+		timeout: timeout,
+	}
+}
+
+func (c *checker) Live(context.Context) Report {
+	return Report{Status: STATUS_OK}
+}
+
+func (c *checker) Ready(ctx context.Context) Report {
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+
+	report := Report{
+		Status: STATUS_OK,
+		Checks: make(map[string]Result, len(c.checks)),
+	}
+
+	var (
+		mu sync.Mutex
+		wg sync.WaitGroup
+	)
+	for name, check := range c.checks {
+		wg.Add(1)
+		go func(name string, check Check) {
+			defer wg.Done()
+
+			result := run(ctx, check)
+
+			mu.Lock()
+			defer mu.Unlock()
+			report.Checks[name] = result
+			if result.Status != STATUS_OK {
+				report.Status = STATUS_UNAVAILABLE
+			}
+		}(name, check)
+	}
+	wg.Wait()
+
+	return report
+}
+
+func run(ctx context.Context, check Check) Result {
+	start := time.Now()
+	err := check(ctx)
+
+	result := Result{
+		Status:  STATUS_OK,
+		Latency: float64(time.Since(start).Microseconds()) / 1000,
+	}
+	if err != nil {
+		result.Status = STATUS_UNAVAILABLE
+		result.Error = err.Error()
+	}
+	return result
+}
+
+// Heartbeat is beaten by a loop on every iteration, so a loop that died or got stuck can be told
+// from one that is only idle.
+type Heartbeat struct {
+	last atomic.Int64
+}
+
+func (h *Heartbeat) Beat() {
+	h.last.Store(time.Now().UnixNano())
+}
+
+func (h *Heartbeat) Last() time.Time {
+	last := h.last.Load()
+	if last == 0 {
+		return time.Time{}
+	}
+	return time.Unix(0, last)
+}
+
+// Check fails when the loop did not beat in the last maxAge.
+func (h *Heartbeat) Check(maxAge time.Duration) Check {
+	return func(context.Context) error {
+		last := h.Last()
+		if last.IsZero() {
+			return ErrNotStarted
+		}
+		if since := time.Since(last); since > maxAge {
+			return fmt.Errorf("%w: last beat %s ago", ErrStalled, since.Truncate(time.Second))
+		}
+		return nil
+	}
+}
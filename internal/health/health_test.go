@@ -0,0 +1,95 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReady(t *testing.T) {
+	type Expected struct {
+		status string
+		checks map[string]string
+		errors map[string]string
+	}
+	tests := map[string]struct {
+		given    map[string]Check
+		expected Expected
+	}{
+		"given passing checks, must be ready": {
+			given: map[string]Check{
+				"mongo": func(context.Context) error { return nil },
+				"sqs":   func(context.Context) error { return nil },
+			},
+			expected: Expected{
+				status: STATUS_OK,
+				checks: map[string]string{"mongo": STATUS_OK, "sqs": STATUS_OK},
+				errors: map[string]string{},
+			},
+		},
+		"given a failing check, must not be ready": {
+			given: map[string]Check{
+				"mongo": func(context.Context) error { return errors.New("connection refused") },
+				"sqs":   func(context.Context) error { return nil },
+			},
+			expected: Expected{
+				status: STATUS_UNAVAILABLE,
+				checks: map[string]string{"mongo": STATUS_UNAVAILABLE, "sqs": STATUS_OK},
+				errors: map[string]string{"mongo": "connection refused"},
+			},
+		},
+		"given a hanging check, must give up on timeout": {
+			given: map[string]Check{
+				"mongo": func(ctx context.Context) error {
+					<-ctx.Done()
+					return ctx.Err()
+				},
+			},
+			expected: Expected{
+				status: STATUS_UNAVAILABLE,
+				checks: map[string]string{"mongo": STATUS_UNAVAILABLE},
+				errors: map[string]string{"mongo": context.DeadlineExceeded.Error()},
+			},
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			report := NewChecker(50*time.Millisecond, tc.given).Ready(context.Background())
+
+			assert.Equal(t, tc.expected.status, report.Status)
+			assert.Len(t, report.Checks, len(tc.expected.checks))
+			for name, status := range tc.expected.checks {
+				assert.Equal(t, status, report.Checks[name].Status, name)
+				assert.Equal(t, tc.expected.errors[name], report.Checks[name].Error, name)
+			}
+		})
+	}
+}
+
+func TestLive(t *testing.T) {
+	checker := NewChecker(time.Second, map[string]Check{
+		"mongo": func(context.Context) error { return errors.New("connection refused") },
+	})
+
+	report := checker.Live(context.Background())
+
+	assert.True(t, report.OK())
+	assert.Empty(t, report.Checks)
+}
+
+func TestHeartbeat(t *testing.T) {
+	var heartbeat Heartbeat
+
+	assert.ErrorIs(t, heartbeat.Check(time.Minute)(context.Background()), ErrNotStarted)
+
+	heartbeat.Beat()
+	assert.NoError(t, heartbeat.Check(time.Minute)(context.Background()))
+	assert.WithinDuration(t, time.Now(), heartbeat.Last(), time.Second)
+
+	heartbeat.last.Store(time.Now().Add(-2 * time.Minute).UnixNano())
+	assert.ErrorIs(t, heartbeat.Check(time.Minute)(context.Background()), ErrStalled)
+}
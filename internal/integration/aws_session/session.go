@@ -0,0 +1,61 @@
+package aws_session
+
+import (
+	"errors"
+	"fmt"
+	"tech-challenge-payment/internal/config"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+)
+
+const (
+	CREDENTIALS_DEFAULT = "default"
+	CREDENTIALS_STATIC  = "static"
+	CREDENTIALS_ENV     = "env"
+	CREDENTIALS_SHARED  = "shared"
+)
+
+var (
+	ErrInvalidCredentialsSource = errors.New("invalid credentials source")
+)
+
+// New builds the session shared by every AWS client of the service, talking to endpoint when
+// set, e.g. LocalStack, instead of the AWS endpoint of the region.
+func New(region, endpoint string, disableSSL bool, creds config.AWSCredentials) (*session.Session, error) {
+	provider, err := newCredentials(creds)
+	if err != nil {
+		return nil, err
+	}
+
+	cfg := aws.Config{
+		Region:      aws.String(region),
+		DisableSSL:  aws.Bool(disableSSL),
+		Credentials: provider,
+	}
+	if len(endpoint) > 0 {
+		cfg.Endpoint = aws.String(endpoint)
+	}
+
+	return session.NewSessionWithOptions(session.Options{
+		Config: cfg,
+	})
+}
+
+// newCredentials leaves the default chain of the SDK (environment, shared file, instance role)
+// in charge unless another source is configured.
+func newCredentials(creds config.AWSCredentials) (*credentials.Credentials, error) {
+	switch creds.Source {
+	case "", CREDENTIALS_DEFAULT:
+		return nil, nil
+	case CREDENTIALS_STATIC:
+		return credentials.NewStaticCredentials(creds.AccessKeyID, creds.SecretAccessKey, creds.SessionToken), nil
+	case CREDENTIALS_ENV:
+		return credentials.NewEnvCredentials(), nil
+	case CREDENTIALS_SHARED:
+		return credentials.NewSharedCredentials("", creds.Profile), nil
+	default:
+		return nil, fmt.Errorf("%w: %q", ErrInvalidCredentialsSource, creds.Source)
+	}
+}
@@ -0,0 +1,91 @@
+package aws_session
+
+import (
+	"strings"
+	"tech-challenge-payment/internal/config"
+	"tech-challenge-payment/internal/sqstest"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/sqs"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNew(t *testing.T) {
+	type Given struct {
+		credentials config.AWSCredentials
+		env         map[string]string
+	}
+	type Expected struct {
+		accessKeyID string
+		err         error
+	}
+	tests := map[string]struct {
+		given    Given
+		expected Expected
+	}{
+		"given static credentials, must sign with them": {
+			given: Given{
+				credentials: config.AWSCredentials{Source: CREDENTIALS_STATIC, AccessKeyID: "static-key", SecretAccessKey: "static-secret"},
+			},
+			expected: Expected{accessKeyID: "static-key"},
+		},
+		"given env credentials, must sign with the environment keys": {
+			given: Given{
+				credentials: config.AWSCredentials{Source: CREDENTIALS_ENV},
+				env:         map[string]string{"AWS_ACCESS_KEY_ID": "env-key", "AWS_SECRET_ACCESS_KEY": "env-secret"},
+			},
+			expected: Expected{accessKeyID: "env-key"},
+		},
+		"given default credentials, must follow the sdk chain": {
+			given: Given{
+				credentials: config.AWSCredentials{Source: CREDENTIALS_DEFAULT},
+				env:         map[string]string{"AWS_ACCESS_KEY_ID": "chain-key", "AWS_SECRET_ACCESS_KEY": "chain-secret"},
+			},
+			expected: Expected{accessKeyID: "chain-key"},
+		},
+		"given unknown credentials source, must return error": {
+			given: Given{
+				credentials: config.AWSCredentials{Source: "vault"},
+			},
+			expected: Expected{err: ErrInvalidCredentialsSource},
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			for key, value := range tc.given.env {
+				t.Setenv(key, value)
+			}
+			server := sqstest.NewServer("queue")
+			defer server.Close()
+
+			sess, err := New("sa-east-1", server.URL, false, tc.given.credentials)
+			assert.ErrorIs(t, err, tc.expected.err)
+			if err != nil {
+				return
+			}
+
+			_, err = sqs.New(sess).SendMessage(&sqs.SendMessageInput{
+				QueueUrl:    aws.String(server.QueueURL("queue")),
+				MessageBody: aws.String(`"order"`),
+			})
+			assert.NoError(t, err)
+
+			// requests reach the configured endpoint instead of the AWS one
+			requests := server.Requests()
+			assert.Len(t, requests, 1)
+			assert.True(t, strings.Contains(requests[0].Authorization, "Credential="+tc.expected.accessKeyID+"/"), requests[0].Authorization)
+			assert.Len(t, server.Messages("queue"), 1)
+		})
+	}
+}
+
+func TestNewDisableSSL(t *testing.T) {
+	sess, err := New("sa-east-1", "", true, config.AWSCredentials{})
+	assert.NoError(t, err)
+	assert.True(t, aws.BoolValue(sess.Config.DisableSSL))
+
+	// without an endpoint the region decides where requests go
+	assert.Equal(t, "http://sqs.sa-east-1.amazonaws.com", sqs.New(sess).Endpoint)
+}
@@ -0,0 +1,95 @@
+package payment_provider
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"strings"
+	"tech-challenge-payment/internal/canonical"
+	"tech-challenge-payment/internal/logging"
+)
+
+var (
+	// ErrorUnsupported is returned by adapters that can not do what was asked of them.
+	ErrorUnsupported = errors.New("not supported by the provider adapter")
+)
+
+type Provider interface {
+	// Name identifies the provider in the audit trail of the statuses it reports.
+	Name() string
+	// Charge asks the provider to collect the payment and returns what the customer needs to
+	// pay with its method. Card payments are authorized instead.
+	Charge(ctx context.Context, payment canonical.Payment) (canonical.MethodDetails, error)
+	// Authorize holds the amount of a card payment on the card until it is captured or voided,
+	// and returns what the provider tells about the card.
+	Authorize(ctx context.Context, payment canonical.Payment) (canonical.MethodDetails, error)
+	// Capture collects the amount, up to the authorized one, of an authorized card payment.
+	Capture(ctx context.Context, payment canonical.Payment, amount int64) error
+	Void(ctx context.Context, payment canonical.Payment) error
+	// GetStatus asks the provider for the status of the payment, adapters that can not ask
+	// return ErrorUnsupported.
+	GetStatus(ctx context.Context, payment canonical.Payment) (canonical.PaymentStatus, error)
+}
+
+// logProvider stands in for the payment provider integration, which is not
+// implemented yet. It only records the operations that would be sent.
+type logProvider struct{}
+
+func NewProvider() Provider {
+	return &logProvider{}
+}
+
+func (p *logProvider) Name() string {
+	return "log"
+}
+
+// Charge makes up details shaped like the provider's, derived from the payment id.
+func (p *logProvider) Charge(ctx context.Context, payment canonical.Payment) (canonical.MethodDetails, error) {
+	logging.Ctx(ctx).Info().Str("payment_id", payment.ID).Str("order_id", payment.OrderID).Stringer("method", payment.Method).Msg("payment charged at provider")
+
+	var details canonical.MethodDetails
+	switch payment.Method {
+	case canonical.METHOD_PIX:
+		details.Pix = &canonical.PixDetails{QRCode: "00020126580014br.gov.bcb.pix0136" + payment.ID + "5204000053039865802BR6304"}
+	case canonical.METHOD_BOLETO:
+		details.Boleto = &canonical.BoletoDetails{Barcode: fmt.Sprintf("%047d", hash(payment.ID))}
+	case canonical.METHOD_CASH:
+		details.Cash = &canonical.CashDetails{Reference: strings.ToUpper(fmt.Sprintf("%08x", uint32(hash(payment.ID))))}
+	}
+	return details, nil
+}
+
+// Authorize makes up the card details from the last digits of the token.
+func (p *logProvider) Authorize(ctx context.Context, payment canonical.Payment) (canonical.MethodDetails, error) {
+	logging.Ctx(ctx).Info().Str("payment_id", payment.ID).Str("order_id", payment.OrderID).Int64("amount", payment.Amount).Msg("payment authorized at provider")
+
+	var details canonical.MethodDetails
+	if payment.Details != nil && payment.Details.Card != nil {
+		token := payment.Details.Card.Token
+		details.Card = &canonical.CardDetails{Last4: token[max(len(token)-4, 0):], Brand: "UNKNOWN"}
+	}
+	return details, nil
+}
+
+func (p *logProvider) Capture(ctx context.Context, payment canonical.Payment, amount int64) error {
+	logging.Ctx(ctx).Info().Str("payment_id", payment.ID).Str("order_id", payment.OrderID).Int64("amount", amount).Msg("payment captured at provider")
+	return nil
+}
+
+// GetStatus has no provider to ask. Answering with the status we already have would make
+// every reconciliation look clean, so it refuses instead.
+func (p *logProvider) GetStatus(ctx context.Context, payment canonical.Payment) (canonical.PaymentStatus, error) {
+	return payment.Status, fmt.Errorf("%w: the log adapter can not tell the status of payments", ErrorUnsupported)
+}
+
+func (p *logProvider) Void(ctx context.Context, payment canonical.Payment) error {
+	logging.Ctx(ctx).Info().Str("payment_id", payment.ID).Str("order_id", payment.OrderID).Msg("payment voided at provider")
+	return nil
+}
+
+func hash(value string) uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(value))
+	return h.Sum64()
+}
@@ -0,0 +1,55 @@
+package payment_provider
+
+import (
+	"fmt"
+	"tech-challenge-payment/internal/canonical"
+)
+
+// adapters lists the provider integrations a method can be configured to go through.
+var adapters = map[string]func() Provider{
+	"log": NewProvider,
+}
+
+// Router picks the provider adapter each payment goes through, by its method.
+type Router interface {
+	Route(method canonical.PaymentMethod) Provider
+}
+
+type router struct {
+	providers map[canonical.PaymentMethod]Provider
+	fallback  Provider
+}
+
+// NewRouter routes the methods missing from providers, payments created before methods existed
+// included, to fallback.
+func NewRouter(providers map[canonical.PaymentMethod]Provider, fallback Provider) Router {
+	return &router{
+		providers: providers,
+		fallback:  fallback,
+	}
+}
+
+// NewRouterFromNames builds the adapter named for each method, the methods sharing an adapter
+// share its instance. Methods left out go through the log adapter.
+func NewRouterFromNames(names map[canonical.PaymentMethod]string) (Router, error) {
+	built := map[string]Provider{}
+	providers := map[canonical.PaymentMethod]Provider{}
+	for method, name := range names {
+		if _, ok := built[name]; !ok {
+			newProvider, ok := adapters[name]
+			if !ok {
+				return nil, fmt.Errorf("unknown provider adapter %q for %s", name, method)
+			}
+			built[name] = newProvider()
+		}
+		providers[method] = built[name]
+	}
+	return NewRouter(providers, NewProvider()), nil
+}
+
+func (r *router) Route(method canonical.PaymentMethod) Provider {
+	if provider, ok := r.providers[method]; ok {
+		return provider
+	}
+	return r.fallback
+}
@@ -0,0 +1,84 @@
+package payment_provider
+
+import (
+	"context"
+	"tech-challenge-payment/internal/canonical"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewRouterFromNames(t *testing.T) {
+	t.Run("given known adapters, must route each method and the rest to the fallback", func(t *testing.T) {
+		router, err := NewRouterFromNames(map[canonical.PaymentMethod]string{
+			canonical.METHOD_PIX:    "log",
+			canonical.METHOD_BOLETO: "log",
+		})
+
+		assert.NoError(t, err)
+		assert.Same(t, router.Route(canonical.METHOD_PIX), router.Route(canonical.METHOD_BOLETO))
+		assert.Equal(t, "log", router.Route(canonical.METHOD_UNSPECIFIED).Name())
+	})
+
+	t.Run("given unknown adapter, must return error", func(t *testing.T) {
+		_, err := NewRouterFromNames(map[canonical.PaymentMethod]string{canonical.METHOD_CASH: "acme"})
+
+		assert.EqualError(t, err, `unknown provider adapter "acme" for CASH`)
+	})
+}
+
+func TestCharge(t *testing.T) {
+	type Expected struct {
+		details func(t *testing.T, details canonical.MethodDetails)
+	}
+	tests := map[string]struct {
+		given    canonical.Payment
+		expected Expected
+	}{
+		"given pix payment, must return a qr code": {
+			given: canonical.Payment{ID: "1234", Method: canonical.METHOD_PIX},
+			expected: Expected{details: func(t *testing.T, details canonical.MethodDetails) {
+				assert.Contains(t, details.Pix.QRCode, "1234")
+			}},
+		},
+		"given boleto payment, must return a barcode": {
+			given: canonical.Payment{ID: "1234", Method: canonical.METHOD_BOLETO},
+			expected: Expected{details: func(t *testing.T, details canonical.MethodDetails) {
+				assert.Len(t, details.Boleto.Barcode, 47)
+			}},
+		},
+		"given cash payment, must return a reference": {
+			given: canonical.Payment{ID: "1234", Method: canonical.METHOD_CASH},
+			expected: Expected{details: func(t *testing.T, details canonical.MethodDetails) {
+				assert.Len(t, details.Cash.Reference, 8)
+			}},
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			details, err := NewProvider().Charge(context.Background(), tc.given)
+
+			assert.NoError(t, err)
+			tc.expected.details(t, details)
+		})
+	}
+}
+
+func TestAuthorize(t *testing.T) {
+	payment := canonical.Payment{ID: "1234", Method: canonical.METHOD_DEBIT_CARD, Amount: 2500, Details: &canonical.MethodDetails{
+		Card: &canonical.CardDetails{Token: "tok_4242"},
+	}}
+
+	details, err := NewProvider().Authorize(context.Background(), payment)
+
+	assert.NoError(t, err)
+	assert.Equal(t, "4242", details.Card.Last4)
+	assert.Empty(t, details.Card.Token)
+}
+
+func TestGetStatus(t *testing.T) {
+	_, err := NewProvider().GetStatus(context.Background(), canonical.Payment{ID: "1234", Status: canonical.PAYMENT_CREATED})
+
+	assert.ErrorIs(t, err, ErrorUnsupported)
+}
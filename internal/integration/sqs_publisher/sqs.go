@@ -1,12 +1,17 @@
 package sqs_publisher
 
 import (
+	"context"
 	"encoding/json"
-	"tech-challenge-payment/internal/config"
+	"tech-challenge-payment/internal/logging"
+	"tech-challenge-payment/internal/metrics"
+	"tech-challenge-payment/internal/tracing"
 
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/sqs"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
 )
 
 type queueSQS struct {
@@ -14,37 +19,65 @@ type queueSQS struct {
 }
 
 type Publisher interface {
-	SendMessage(inputMsg any, queueURL string) error
+	SendMessage(ctx context.Context, inputMsg any, queueURL string) error
+	SendMessageWithAttributes(ctx context.Context, inputMsg any, queueURL string, attributes map[string]string) error
 }
 
-func NewSQS() Publisher {
-	sess := session.Must(session.NewSessionWithOptions(session.Options{
-		Config: aws.Config{
-			Region:     aws.String(config.Get().SQS.Region),
-			DisableSSL: aws.Bool(true),
-		},
-	}))
-
+func NewSQS(sess *session.Session) Publisher {
 	return &queueSQS{
 		queueSvc: sqs.New(sess),
 	}
 }
 
-func (q *queueSQS) SendMessage(inputMsg any, queueURL string) error {
+func (q *queueSQS) SendMessage(ctx context.Context, inputMsg any, queueURL string) error {
+	return q.SendMessageWithAttributes(ctx, inputMsg, queueURL, nil)
+}
+
+func (q *queueSQS) SendMessageWithAttributes(ctx context.Context, inputMsg any, queueURL string, attributes map[string]string) (err error) {
+	ctx, span := tracing.Start(ctx, metrics.QueueName(queueURL)+" publish",
+		trace.WithSpanKind(trace.SpanKindProducer),
+		trace.WithAttributes(
+			semconv.MessagingSystemAWSSqs,
+			semconv.MessagingDestinationName(metrics.QueueName(queueURL)),
+		),
+	)
+	defer func() { tracing.End(span, err) }()
+
 	msg, err := json.Marshal(inputMsg)
 	if err != nil {
 		return err
 	}
 
 	params := &sqs.SendMessageInput{
-		QueueUrl:    &queueURL,
-		MessageBody: aws.String(string(msg)),
+		QueueUrl:          &queueURL,
+		MessageBody:       aws.String(string(msg)),
+		MessageAttributes: make(map[string]*sqs.MessageAttributeValue, len(attributes)+1),
+	}
+
+	for key, value := range attributes {
+		params.MessageAttributes[key] = &sqs.MessageAttributeValue{
+			DataType:    aws.String("String"),
+			StringValue: aws.String(value),
+		}
+	}
+	if requestID := logging.RequestID(ctx); len(requestID) > 0 {
+		params.MessageAttributes[logging.REQUEST_ID_ATTRIBUTE] = &sqs.MessageAttributeValue{
+			DataType:    aws.String("String"),
+			StringValue: aws.String(requestID),
+		}
+	}
+	tracing.Inject(ctx, params.MessageAttributes)
+	// there is nothing to propagate when the context carries neither a request nor a span
+	if len(params.MessageAttributes) == 0 {
+		params.MessageAttributes = nil
 	}
 
-	_, err = q.queueSvc.SendMessage(params)
+	output, err := q.queueSvc.SendMessageWithContext(ctx, params)
+	metrics.ObservePublish(queueURL, err)
 	if err != nil {
 		return err
 	}
+	span.SetAttributes(semconv.MessagingMessageID(aws.StringValue(output.MessageId)))
 
 	return nil
 }
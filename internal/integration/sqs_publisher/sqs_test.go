@@ -0,0 +1,66 @@
+package sqs_publisher
+
+import (
+	"context"
+	"tech-challenge-payment/internal/config"
+	"tech-challenge-payment/internal/integration/aws_session"
+	"tech-challenge-payment/internal/logging"
+	"tech-challenge-payment/internal/sqstest"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/service/sqs"
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+func newPublisher(t *testing.T, server *sqstest.Server) Publisher {
+	sess, err := aws_session.New("sa-east-1", server.URL, false, config.AWSCredentials{
+		Source:          aws_session.CREDENTIALS_STATIC,
+		AccessKeyID:     "test",
+		SecretAccessKey: "test",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &queueSQS{queueSvc: sqs.New(sess)}
+}
+
+func TestSendMessageWithAttributes(t *testing.T) {
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	server := sqstest.NewServer("paymentcancelledqueue")
+	defer server.Close()
+	publisher := newPublisher(t, server)
+
+	ctx, span := sdktrace.NewTracerProvider().Tracer("test").Start(context.Background(), "request")
+	defer span.End()
+	ctx = logging.WithRequestID(ctx, "request-1")
+
+	err := publisher.SendMessageWithAttributes(ctx, "order-1", server.QueueURL("paymentcancelledqueue"), map[string]string{
+		"reason": "EXPIRED",
+	})
+	assert.NoError(t, err)
+
+	messages := server.Messages("paymentcancelledqueue")
+	assert.Len(t, messages, 1)
+	assert.Equal(t, `"order-1"`, messages[0].Body)
+	assert.Equal(t, "EXPIRED", messages[0].Attributes["reason"].StringValue)
+	assert.Equal(t, "request-1", messages[0].Attributes[logging.REQUEST_ID_ATTRIBUTE].StringValue)
+	assert.Contains(t, messages[0].Attributes["traceparent"].StringValue, span.SpanContext().TraceID().String())
+}
+
+func TestSendMessage(t *testing.T) {
+	server := sqstest.NewServer("paymentpayedqueue")
+	defer server.Close()
+	publisher := newPublisher(t, server)
+
+	assert.NoError(t, publisher.SendMessage(context.Background(), "order-1", server.QueueURL("paymentpayedqueue")))
+
+	messages := server.Messages("paymentpayedqueue")
+	assert.Len(t, messages, 1)
+	assert.Equal(t, `"order-1"`, messages[0].Body)
+	assert.Empty(t, messages[0].Attributes)
+
+	assert.Error(t, publisher.SendMessage(context.Background(), "order-1", server.QueueURL("missingqueue")))
+}
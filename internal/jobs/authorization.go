@@ -0,0 +1,43 @@
+package jobs
+
+import (
+	"context"
+	"tech-challenge-payment/internal/canonical"
+	"tech-challenge-payment/internal/logging"
+	"tech-challenge-payment/internal/repository"
+	"tech-challenge-payment/internal/service"
+	"time"
+)
+
+const (
+	authorizationJobName = "authorization-void"
+)
+
+// authorization voids the card authorizations the kitchen never got to capture, so the amount
+// is not held on the customer's card any longer than the capture window.
+type authorization struct {
+	paymentSvc    service.PaymentService
+	clock         canonical.Clock
+	captureWindow time.Duration
+}
+
+func NewAuthorization(paymentSvc service.PaymentService, locks repository.LockRepository, clock canonical.Clock, ids canonical.IDGenerator, captureWindow, interval time.Duration) Runner {
+	return NewRunner(&authorization{
+		paymentSvc:    paymentSvc,
+		clock:         clock,
+		captureWindow: captureWindow,
+	}, interval, locks, ids)
+}
+
+func (a *authorization) Name() string {
+	return authorizationJobName
+}
+
+func (a *authorization) Run(ctx context.Context) error {
+	voided, err := a.paymentSvc.VoidAuthorizations(ctx, a.clock.Now().Add(-a.captureWindow))
+	for _, payment := range voided {
+		logging.Ctx(ctx).Info().Str("payment_id", payment.ID).Str("order_id", payment.OrderID).Msg("uncaptured authorization voided")
+	}
+
+	return err
+}
@@ -0,0 +1,61 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"tech-challenge-payment/internal/canonical"
+	"tech-challenge-payment/internal/canonical/canonicaltest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestAuthorizationRun(t *testing.T) {
+	type Given struct {
+		voided []canonical.Payment
+		err    error
+	}
+	type Expected struct {
+		err assert.ErrorAssertionFunc
+	}
+	tests := map[string]struct {
+		given    Given
+		expected Expected
+	}{
+		"given authorizations not captured in time, must void them": {
+			given: Given{
+				voided: []canonical.Payment{{ID: "1234", Status: canonical.PAYMENT_EXPIRED, Reason: canonical.REASON_NOT_CAPTURED}},
+			},
+			expected: Expected{
+				err: assert.NoError,
+			},
+		},
+		"given error voiding authorizations, must return error": {
+			given: Given{
+				err: errors.New("db error"),
+			},
+			expected: Expected{
+				err: assert.Error,
+			},
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			now := time.Date(2020, 11, 1, 12, 0, 0, 0, time.UTC)
+			svcMock := new(PaymentServiceMock)
+			svcMock.On("VoidAuthorizations", mock.Anything, now.Add(-24*time.Hour)).Return(tc.given.voided, tc.given.err)
+
+			a := authorization{
+				paymentSvc:    svcMock,
+				clock:         canonicaltest.NewClock(now),
+				captureWindow: 24 * time.Hour,
+			}
+
+			tc.expected.err(t, a.Run(context.Background()))
+			svcMock.AssertExpectations(t)
+		})
+	}
+}
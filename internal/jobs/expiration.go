@@ -0,0 +1,41 @@
+package jobs
+
+import (
+	"context"
+	"tech-challenge-payment/internal/canonical"
+	"tech-challenge-payment/internal/logging"
+	"tech-challenge-payment/internal/repository"
+	"tech-challenge-payment/internal/service"
+	"time"
+)
+
+const (
+	expirationJobName = "payment-expiration"
+)
+
+type expiration struct {
+	paymentSvc service.PaymentService
+	clock      canonical.Clock
+	ttl        time.Duration
+}
+
+func NewExpiration(paymentSvc service.PaymentService, locks repository.LockRepository, clock canonical.Clock, ids canonical.IDGenerator, ttl, interval time.Duration) Runner {
+	return NewRunner(&expiration{
+		paymentSvc: paymentSvc,
+		clock:      clock,
+		ttl:        ttl,
+	}, interval, locks, ids)
+}
+
+func (e *expiration) Name() string {
+	return expirationJobName
+}
+
+func (e *expiration) Run(ctx context.Context) error {
+	expired, err := e.paymentSvc.Expire(ctx, e.clock.Now().Add(-e.ttl))
+	for _, payment := range expired {
+		logging.Ctx(ctx).Info().Str("payment_id", payment.ID).Str("order_id", payment.OrderID).Msg("pending payment expired")
+	}
+
+	return err
+}
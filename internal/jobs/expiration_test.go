@@ -0,0 +1,61 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"tech-challenge-payment/internal/canonical"
+	"tech-challenge-payment/internal/canonical/canonicaltest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestExpirationRun(t *testing.T) {
+	type Given struct {
+		expired []canonical.Payment
+		err     error
+	}
+	type Expected struct {
+		err assert.ErrorAssertionFunc
+	}
+	tests := map[string]struct {
+		given    Given
+		expected Expected
+	}{
+		"given stale payments, must expire them": {
+			given: Given{
+				expired: []canonical.Payment{{ID: "1234", Status: canonical.PAYMENT_EXPIRED}},
+			},
+			expected: Expected{
+				err: assert.NoError,
+			},
+		},
+		"given error expiring payments, must return error": {
+			given: Given{
+				err: errors.New("db error"),
+			},
+			expected: Expected{
+				err: assert.Error,
+			},
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			now := time.Date(2020, 11, 1, 12, 0, 0, 0, time.UTC)
+			svcMock := new(PaymentServiceMock)
+			svcMock.On("Expire", mock.Anything, now.Add(-30*time.Minute)).Return(tc.given.expired, tc.given.err)
+
+			e := expiration{
+				paymentSvc: svcMock,
+				clock:      canonicaltest.NewClock(now),
+				ttl:        30 * time.Minute,
+			}
+
+			tc.expected.err(t, e.Run(context.Background()))
+			svcMock.AssertExpectations(t)
+		})
+	}
+}
@@ -0,0 +1,68 @@
+package jobs
+
+import (
+	"context"
+	"tech-challenge-payment/internal/canonical"
+	"tech-challenge-payment/internal/logging"
+	"tech-challenge-payment/internal/repository"
+	"tech-challenge-payment/internal/service"
+	"time"
+)
+
+const (
+	reconciliationJobName = "payment-reconciliation"
+)
+
+type reconciliation struct {
+	paymentSvc service.PaymentService
+	reports    repository.ReconciliationRepository
+	clock      canonical.Clock
+	after      time.Duration
+}
+
+func NewReconciliation(paymentSvc service.PaymentService, reports repository.ReconciliationRepository, locks repository.LockRepository, clock canonical.Clock, ids canonical.IDGenerator, after, interval time.Duration) Runner {
+	return NewRunner(&reconciliation{
+		paymentSvc: paymentSvc,
+		reports:    reports,
+		clock:      clock,
+		after:      after,
+	}, interval, locks, ids)
+}
+
+func (r *reconciliation) Name() string {
+	return reconciliationJobName
+}
+
+func (r *reconciliation) Run(ctx context.Context) error {
+	report, runErr := r.paymentSvc.Reconcile(ctx, r.clock.Now().Add(-r.after))
+
+	for _, discrepancy := range report.Discrepancies {
+		logging.Ctx(ctx).Warn().
+			Str("payment_id", discrepancy.PaymentID).
+			Int("local_status", int(discrepancy.LocalStatus)).
+			Int("provider_status", int(discrepancy.ProviderStatus)).
+			Bool("fixed", discrepancy.Fixed).
+			Str("error", discrepancy.Error).
+			Msg("payment status disagrees with provider")
+	}
+
+	if report.Skipped > 0 {
+		logging.Ctx(ctx).Warn().
+			Int("skipped", report.Skipped).
+			Msg("payments skipped, their provider adapter can not report statuses")
+	}
+
+	if err := r.reports.Create(ctx, report); err != nil {
+		logging.Ctx(ctx).Err(err).Str("report_id", report.ID).Msg("an error occurred when save reconciliation report")
+	}
+
+	logging.Ctx(ctx).Info().
+		Str("report_id", report.ID).
+		Int("checked", report.Checked).
+		Int("skipped", report.Skipped).
+		Int("discrepancies", len(report.Discrepancies)).
+		Int("errors", len(report.Errors)).
+		Msg("reconciliation finished")
+
+	return runErr
+}
@@ -0,0 +1,79 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"tech-challenge-payment/internal/canonical"
+	"tech-challenge-payment/internal/canonical/canonicaltest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestReconciliationRun(t *testing.T) {
+	report := canonical.ReconciliationReport{
+		ID:      "report",
+		Checked: 1,
+		Skipped: 1,
+		Discrepancies: []canonical.Discrepancy{
+			{PaymentID: "1234", LocalStatus: canonical.PAYMENT_CREATED, ProviderStatus: canonical.PAYMENT_PAYED, Fixed: true},
+		},
+	}
+
+	type Given struct {
+		reconcileErr error
+		saveErr      error
+	}
+	type Expected struct {
+		err assert.ErrorAssertionFunc
+	}
+	tests := map[string]struct {
+		given    Given
+		expected Expected
+	}{
+		"given discrepancies fixed, must save the report": {
+			expected: Expected{
+				err: assert.NoError,
+			},
+		},
+		"given error saving the report, must not fail the run": {
+			given: Given{
+				saveErr: errors.New("db error"),
+			},
+			expected: Expected{
+				err: assert.NoError,
+			},
+		},
+		"given error reconciling, must save the partial report and return error": {
+			given: Given{
+				reconcileErr: errors.New("db error"),
+			},
+			expected: Expected{
+				err: assert.Error,
+			},
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			now := time.Date(2020, 11, 1, 12, 0, 0, 0, time.UTC)
+			svcMock := new(PaymentServiceMock)
+			svcMock.On("Reconcile", mock.Anything, now.Add(-10*time.Minute)).Return(report, tc.given.reconcileErr)
+
+			reportsMock := new(ReconciliationRepositoryMock)
+			reportsMock.On("Create", mock.Anything, report).Return(tc.given.saveErr)
+
+			r := reconciliation{
+				paymentSvc: svcMock,
+				reports:    reportsMock,
+				clock:      canonicaltest.NewClock(now),
+				after:      10 * time.Minute,
+			}
+
+			tc.expected.err(t, r.Run(context.Background()))
+			reportsMock.AssertExpectations(t)
+		})
+	}
+}
@@ -0,0 +1,91 @@
+package jobs
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"tech-challenge-payment/internal/canonical"
+	"tech-challenge-payment/internal/logging"
+	"tech-challenge-payment/internal/repository"
+	"tech-challenge-payment/internal/service"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+type Job interface {
+	Name() string
+	Run(ctx context.Context) error
+}
+
+type Runner interface {
+	Start(ctx context.Context)
+}
+
+// runner executes a job every interval on a single replica. The replica that runs the job keeps
+// the lease for the whole interval, so the others only take over when it stops renewing it.
+type runner struct {
+	job      Job
+	locks    repository.LockRepository
+	ids      canonical.IDGenerator
+	owner    string
+	interval time.Duration
+}
+
+// NewRunner takes the lease owner and the id of every run from ids.
+func NewRunner(job Job, interval time.Duration, locks repository.LockRepository, ids canonical.IDGenerator) Runner {
+	return &runner{
+		job:      job,
+		locks:    locks,
+		ids:      ids,
+		owner:    newOwner(ids),
+		interval: interval,
+	}
+}
+
+func (r *runner) Start(ctx context.Context) {
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+
+	for {
+		r.runOnce(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (r *runner) runOnce(ctx context.Context) {
+	// every run gets its own id, so the lines it logs can be told from the previous runs'
+	ctx = logging.NewContext(logging.WithRequestID(ctx, r.ids.NewID()), func(with zerolog.Context) zerolog.Context {
+		return with.Str("job", r.job.Name())
+	})
+	ctx = service.WithActor(ctx, service.ACTOR_JOB_PREFIX+r.job.Name())
+
+	acquired, err := r.locks.Acquire(ctx, r.job.Name(), r.owner, r.interval)
+	if err != nil {
+		logging.Ctx(ctx).Err(err).Msg("an error occurred when acquire job lease")
+		return
+	}
+
+	if !acquired {
+		logging.Ctx(ctx).Debug().Msg("job lease held by another replica")
+		return
+	}
+
+	if err := r.job.Run(ctx); err != nil {
+		logging.Ctx(ctx).Err(err).Msg("an error occurred when run job")
+	}
+}
+
+func newOwner(ids canonical.IDGenerator) string {
+	hostname, err := os.Hostname()
+	if err != nil {
+		hostname = "unknown"
+	}
+
+	return fmt.Sprintf("%s-%s", hostname, ids.NewID())
+}
@@ -0,0 +1,121 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"os"
+	"tech-challenge-payment/internal/canonical/canonicaltest"
+	"tech-challenge-payment/internal/logging"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestRunOnce(t *testing.T) {
+	type Given struct {
+		acquired bool
+		lockErr  error
+	}
+	type Expected struct {
+		runs int
+	}
+	tests := map[string]struct {
+		given    Given
+		expected Expected
+	}{
+		"given lease acquired, must run the job": {
+			given: Given{
+				acquired: true,
+			},
+			expected: Expected{
+				runs: 1,
+			},
+		},
+		"given lease held by another replica, must skip the job": {
+			given: Given{
+				acquired: false,
+			},
+			expected: Expected{
+				runs: 0,
+			},
+		},
+		"given error acquiring lease, must skip the job": {
+			given: Given{
+				lockErr: errors.New("db error"),
+			},
+			expected: Expected{
+				runs: 0,
+			},
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			lockMock := new(LockRepositoryMock)
+			lockMock.On("Acquire", mock.Anything, "job", "owner", time.Minute).Return(tc.given.acquired, tc.given.lockErr)
+
+			jobMock := new(JobMock)
+			jobMock.On("Run", mock.Anything).Return(nil)
+
+			r := runner{
+				job:      jobMock,
+				locks:    lockMock,
+				ids:      canonicaltest.NewIDs("run"),
+				owner:    "owner",
+				interval: time.Minute,
+			}
+			r.runOnce(context.Background())
+
+			jobMock.AssertNumberOfCalls(t, "Run", tc.expected.runs)
+		})
+	}
+}
+
+func TestStart(t *testing.T) {
+	lockMock := new(LockRepositoryMock)
+	lockMock.On("Acquire", mock.Anything, "job", "owner", time.Millisecond).Return(true, nil)
+
+	jobMock := new(JobMock)
+	jobMock.On("Run", mock.Anything).Return(nil)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	r := runner{
+		job:      jobMock,
+		locks:    lockMock,
+		ids:      canonicaltest.NewIDs("run"),
+		owner:    "owner",
+		interval: time.Millisecond,
+	}
+	r.Start(ctx)
+
+	if len(jobMock.Calls) < 2 {
+		t.Fatalf("expected job to run on every interval, ran %d times", len(jobMock.Calls))
+	}
+}
+
+func TestLease(t *testing.T) {
+	hostname, err := os.Hostname()
+	if err != nil {
+		hostname = "unknown"
+	}
+
+	lockMock := new(LockRepositoryMock)
+	lockMock.On("Acquire", mock.Anything, "job", hostname+"-id-1", time.Minute).Return(true, nil)
+
+	var runs []string
+	jobMock := new(JobMock)
+	jobMock.On("Run", mock.Anything).Run(func(args mock.Arguments) {
+		runs = append(runs, logging.RequestID(args.Get(0).(context.Context)))
+	}).Return(nil)
+
+	r := NewRunner(jobMock, time.Minute, lockMock, canonicaltest.NewIDs("id")).(*runner)
+	r.runOnce(context.Background())
+	r.runOnce(context.Background())
+
+	lockMock.AssertExpectations(t)
+	assert.Equal(t, []string{"id-2", "id-3"}, runs)
+}
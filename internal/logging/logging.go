@@ -0,0 +1,97 @@
+package logging
+
+import (
+	"context"
+	"net/http"
+	"tech-challenge-payment/internal/canonical"
+
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	REQUEST_ID_HEADER = "X-Request-ID"
+	REQUEST_ID_FIELD  = "request_id"
+	TRACE_ID_FIELD    = "trace_id"
+	MESSAGE_ID_FIELD  = "msg_id"
+	QUEUE_FIELD       = "queue"
+
+	// REQUEST_ID_ATTRIBUTE carries the request id in SQS messages, so the consumers log it too
+	REQUEST_ID_ATTRIBUTE = "request_id"
+
+	REDACTED = "[REDACTED]"
+
+	// ids sent by callers longer than this are replaced, they would only bloat every log line
+	maxRequestIDLength = 128
+)
+
+var (
+	// sensitiveHeaders are never written to the logs, keys are in canonical form
+	sensitiveHeaders = map[string]bool{
+		"Authorization":       true,
+		"Proxy-Authorization": true,
+		"X-Api-Key":           true,
+		"Cookie":              true,
+		"Set-Cookie":          true,
+	}
+)
+
+type requestIDKey struct{}
+
+// Ctx returns the logger carried by ctx, code running outside of a request or a message gets the global one.
+func Ctx(ctx context.Context) *zerolog.Logger {
+	// zerolog hands out a disabled logger when ctx carries none
+	if logger := zerolog.Ctx(ctx); logger.GetLevel() != zerolog.Disabled {
+		return logger
+	}
+	return &log.Logger
+}
+
+// NewContext returns ctx carrying a child of its logger tagged with the request and trace ids found
+// in ctx, plus the fields added by with, which may be nil. Entry points call it once per request or message.
+func NewContext(ctx context.Context, with func(zerolog.Context) zerolog.Context) context.Context {
+	fields := Ctx(ctx).With()
+	if requestID := RequestID(ctx); len(requestID) > 0 {
+		fields = fields.Str(REQUEST_ID_FIELD, requestID)
+	}
+	if span := trace.SpanContextFromContext(ctx); span.IsValid() {
+		fields = fields.Str(TRACE_ID_FIELD, span.TraceID().String())
+	}
+	if with != nil {
+		fields = with(fields)
+	}
+
+	return fields.Logger().WithContext(ctx)
+}
+
+// RequestID returns the id of the request that started the work done under ctx.
+func RequestID(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, id)
+}
+
+// ValidRequestID keeps the id sent by the caller, or generates a new one when it is missing or too long.
+func ValidRequestID(id string) string {
+	if len(id) == 0 || len(id) > maxRequestIDLength {
+		return canonical.NewUUID()
+	}
+	return id
+}
+
+// Headers logs the headers with the values of the sensitive ones replaced.
+func Headers(header http.Header) *zerolog.Event {
+	dict := zerolog.Dict()
+	for key, values := range header {
+		if sensitiveHeaders[http.CanonicalHeaderKey(key)] {
+			dict = dict.Str(key, REDACTED)
+			continue
+		}
+		dict = dict.Strs(key, values)
+	}
+	return dict
+}
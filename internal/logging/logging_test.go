@@ -0,0 +1,102 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+	"github.com/stretchr/testify/assert"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+func TestHeaders(t *testing.T) {
+	header := http.Header{}
+	header.Set("Authorization", "Bearer secret")
+	header.Set("X-API-Key", "key.secret")
+	header.Set("Cookie", "session=secret")
+	header.Set("Content-Type", "application/json")
+
+	var buf bytes.Buffer
+	logger := zerolog.New(&buf)
+	logger.Info().Dict("headers", Headers(header)).Msg("")
+
+	assert.NotContains(t, buf.String(), "secret")
+
+	var line struct {
+		Headers map[string]any `json:"headers"`
+	}
+	assert.NoError(t, json.Unmarshal(buf.Bytes(), &line))
+	assert.Equal(t, REDACTED, line.Headers["Authorization"])
+	assert.Equal(t, REDACTED, line.Headers["X-Api-Key"])
+	assert.Equal(t, REDACTED, line.Headers["Cookie"])
+	assert.Equal(t, []any{"application/json"}, line.Headers["Content-Type"])
+}
+
+func TestValidRequestID(t *testing.T) {
+	tests := map[string]struct {
+		given    string
+		expected func(t *testing.T, id string)
+	}{
+		"given request id, must keep it": {
+			given: "request-1",
+			expected: func(t *testing.T, id string) {
+				assert.Equal(t, "request-1", id)
+			},
+		},
+		"given no request id, must generate one": {
+			given: "",
+			expected: func(t *testing.T, id string) {
+				assert.NotEmpty(t, id)
+			},
+		},
+		"given too long request id, must replace it": {
+			given: strings.Repeat("a", maxRequestIDLength+1),
+			expected: func(t *testing.T, id string) {
+				assert.NotEmpty(t, id)
+				assert.LessOrEqual(t, len(id), maxRequestIDLength)
+			},
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			tc.expected(t, ValidRequestID(tc.given))
+		})
+	}
+}
+
+func TestNewContext(t *testing.T) {
+	var buf bytes.Buffer
+	global := log.Logger
+	log.Logger = zerolog.New(&buf)
+	defer func() { log.Logger = global }()
+
+	ctx, span := sdktrace.NewTracerProvider().Tracer("test").Start(context.Background(), "request")
+	defer span.End()
+
+	ctx = NewContext(WithRequestID(ctx, "request-1"), func(with zerolog.Context) zerolog.Context {
+		return with.Str(MESSAGE_ID_FIELD, "message-1")
+	})
+	Ctx(ctx).Info().Msg("correlated")
+	Ctx(context.Background()).Info().Msg("uncorrelated")
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	assert.Len(t, lines, 2)
+
+	var correlated, uncorrelated map[string]any
+	assert.NoError(t, json.Unmarshal([]byte(lines[0]), &correlated))
+	assert.NoError(t, json.Unmarshal([]byte(lines[1]), &uncorrelated))
+
+	assert.Equal(t, "request-1", correlated[REQUEST_ID_FIELD])
+	assert.Equal(t, "message-1", correlated[MESSAGE_ID_FIELD])
+	assert.Equal(t, span.SpanContext().TraceID().String(), correlated[TRACE_ID_FIELD])
+	assert.Equal(t, "request-1", RequestID(ctx))
+
+	assert.NotContains(t, uncorrelated, REQUEST_ID_FIELD)
+	assert.NotContains(t, uncorrelated, TRACE_ID_FIELD)
+}
@@ -0,0 +1,98 @@
+package metrics
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const (
+	namespace = "payment"
+
+	SQS_RECEIVED  = "received"
+	SQS_PROCESSED = "processed"
+	SQS_FAILED    = "failed"
+	SQS_DELETED   = "deleted"
+
+	RESULT_SUCCESS = "success"
+	RESULT_FAILURE = "failure"
+)
+
+var (
+	HTTPRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "http_requests_total",
+		Help:      "HTTP requests handled, by route and status.",
+	}, []string{"method", "route", "status"})
+
+	HTTPDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "http_request_duration_seconds",
+		Help:      "Latency of HTTP requests, by route and status.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method", "route", "status"})
+
+	SQSMessages = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "sqs_messages_total",
+		Help:      "SQS messages consumed, by queue and outcome (received, processed, failed, deleted).",
+	}, []string{"queue", "outcome"})
+
+	SQSPublished = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "sqs_published_total",
+		Help:      "SQS messages published, by queue and result.",
+	}, []string{"queue", "result"})
+
+	MongoDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "mongo_operation_duration_seconds",
+		Help:      "Latency of Mongo commands, by collection, command and result.",
+		Buckets:   []float64{.001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5},
+	}, []string{"collection", "command", "result"})
+
+	PaymentTransitions = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "payment_status_transitions_total",
+		Help:      "Payments moved between statuses, from is empty for created payments.",
+	}, []string{"from", "to"})
+)
+
+func Handler() http.Handler {
+	return promhttp.Handler()
+}
+
+// QueueName keeps the last segment of a queue URL, the account and host would only add noise to the labels.
+func QueueName(queueURL string) string {
+	return queueURL[strings.LastIndex(queueURL, "/")+1:]
+}
+
+func Result(err error) string {
+	if err != nil {
+		return RESULT_FAILURE
+	}
+	return RESULT_SUCCESS
+}
+
+func ObservePublish(queueURL string, err error) {
+	SQSPublished.WithLabelValues(QueueName(queueURL), Result(err)).Inc()
+}
+
+func ObserveMessage(queueURL, outcome string) {
+	SQSMessages.WithLabelValues(QueueName(queueURL), outcome).Inc()
+}
+
+func ObserveTransition(from, to string) {
+	PaymentTransitions.WithLabelValues(from, to).Inc()
+}
+
+func ObserveHTTP(method, route string, status int, elapsed time.Duration) {
+	labels := []string{method, route, strconv.Itoa(status)}
+	HTTPRequests.WithLabelValues(labels...).Inc()
+	HTTPDuration.WithLabelValues(labels...).Observe(elapsed.Seconds())
+}
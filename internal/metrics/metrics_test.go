@@ -0,0 +1,25 @@
+package metrics
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestQueueName(t *testing.T) {
+	assert.Equal(t, "paymentpendingqueue", QueueName("http://sqs.sa-east-1.localhost.localstack.cloud:4566/000000000000/paymentpendingqueue"))
+	assert.Equal(t, "paymentpendingqueue", QueueName("paymentpendingqueue"))
+}
+
+func TestObservePublish(t *testing.T) {
+	queueURL := "http://localhost:4566/000000000000/paymentpayedqueue"
+
+	ObservePublish(queueURL, nil)
+	ObservePublish(queueURL, errors.New("unavailable"))
+	ObservePublish(queueURL, errors.New("unavailable"))
+
+	assert.Equal(t, float64(1), testutil.ToFloat64(SQSPublished.WithLabelValues("paymentpayedqueue", RESULT_SUCCESS)))
+	assert.Equal(t, float64(2), testutil.ToFloat64(SQSPublished.WithLabelValues("paymentpayedqueue", RESULT_FAILURE)))
+}
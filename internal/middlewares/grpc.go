@@ -0,0 +1,145 @@
+package middlewares
+
+import (
+	"context"
+	"strings"
+	"tech-challenge-payment/internal/auth/principal"
+	"tech-challenge-payment/internal/auth/token"
+	"tech-challenge-payment/internal/logging"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+var (
+	publicServices = []string{
+		"/grpc.health.v1.Health/",
+		"/grpc.reflection.v1.ServerReflection/",
+		"/grpc.reflection.v1alpha.ServerReflection/",
+	}
+
+	// methodScopes lists the scope required by each method, methods missing here are denied
+	methodScopes = map[string]string{
+		"/payment.v1.PaymentService/CreatePayment": principal.SCOPE_WRITE,
+		"/payment.v1.PaymentService/GetPayment":    principal.SCOPE_READ,
+		"/payment.v1.PaymentService/ListPayments":  principal.SCOPE_READ,
+		"/payment.v1.PaymentService/CancelPayment": principal.SCOPE_WRITE,
+		"/payment.v1.PaymentService/WatchPayment":  principal.SCOPE_READ,
+	}
+)
+
+// contextStream hands the handler a context other than the stream's own.
+type contextStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s contextStream) Context() context.Context {
+	return s.ctx
+}
+
+// UnaryAuthorization accepts a JWT checked by tokens in the "authorization" metadata or, when keys is set, an API key in "x-api-key".
+func UnaryAuthorization(tokens token.Validator, keys APIKeyAuthenticator) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		ctx, err := authorize(ctx, tokens, keys, info.FullMethod)
+		if err != nil {
+			return nil, err
+		}
+
+		return handler(ctx, req)
+	}
+}
+
+func StreamAuthorization(tokens token.Validator, keys APIKeyAuthenticator) grpc.StreamServerInterceptor {
+	return func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		ctx, err := authorize(ss.Context(), tokens, keys, info.FullMethod)
+		if err != nil {
+			return err
+		}
+
+		return handler(srv, contextStream{ServerStream: ss, ctx: ctx})
+	}
+}
+
+func authorize(ctx context.Context, tokens token.Validator, keys APIKeyAuthenticator, method string) (context.Context, error) {
+	for _, prefix := range publicServices {
+		if strings.HasPrefix(method, prefix) {
+			return ctx, nil
+		}
+	}
+
+	var authorization, key string
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if values := md.Get("authorization"); len(values) > 0 {
+			authorization = values[0]
+		}
+		if values := md.Get("x-api-key"); len(values) > 0 {
+			key = values[0]
+		}
+	}
+
+	p, err := authenticate(ctx, tokens, keys, authorization, key, nil, nil)
+	if err != nil {
+		if !isUnauthorized(err) {
+			return nil, status.Error(codes.Internal, "error authenticating request")
+		}
+		return nil, status.Error(codes.Unauthenticated, unauthorizedMessage(err))
+	}
+
+	scope, ok := methodScopes[method]
+	if !ok || !p.HasScopes(scope) {
+		return nil, status.Error(codes.PermissionDenied, "insufficient scope")
+	}
+
+	return principal.NewContext(ctx, p), nil
+}
+
+// UnaryLogger is the gRPC counterpart of Logger, the request id travels in the "x-request-id" metadata.
+func UnaryLogger(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	start := time.Now()
+	ctx = requestContext(ctx)
+
+	resp, err := handler(ctx, req)
+
+	logCall(ctx, info.FullMethod, err, start)
+	return resp, err
+}
+
+func StreamLogger(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	start := time.Now()
+	ctx := requestContext(ss.Context())
+
+	err := handler(srv, contextStream{ServerStream: ss, ctx: ctx})
+
+	logCall(ctx, info.FullMethod, err, start)
+	return err
+}
+
+func requestContext(ctx context.Context) context.Context {
+	var requestID string
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if values := md.Get(logging.REQUEST_ID_HEADER); len(values) > 0 {
+			requestID = values[0]
+		}
+	}
+	requestID = logging.ValidRequestID(requestID)
+	_ = grpc.SetHeader(ctx, metadata.Pairs(logging.REQUEST_ID_HEADER, requestID))
+
+	return logging.NewContext(logging.WithRequestID(ctx, requestID), nil)
+}
+
+func logCall(ctx context.Context, method string, err error, start time.Time) {
+	code := status.Code(err)
+	event := logging.Ctx(ctx).Info()
+	if code == codes.Internal || code == codes.Unknown || code == codes.Unavailable {
+		event = logging.Ctx(ctx).Error().Err(err)
+	}
+	event.
+		Str("method", method).
+		Str("code", code.String()).
+		Dur("latency_ms", time.Since(start)).
+		Msg("grpc call handled")
+}
@@ -0,0 +1,44 @@
+package middlewares
+
+import (
+	"errors"
+	"net/http"
+	"tech-challenge-payment/internal/metrics"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+// Metrics records every request by route template, so ids in the path do not blow up the number of series.
+func Metrics(fx echo.HandlerFunc) echo.HandlerFunc {
+	return func(ctx echo.Context) error {
+		start := time.Now()
+
+		err := fx(ctx)
+
+		metrics.ObserveHTTP(ctx.Request().Method, route(ctx), responseStatus(ctx, err), time.Since(start))
+
+		return err
+	}
+}
+
+// responseStatus is the status the client gets, the error handler writes the response after the
+// middlewares return when the handler failed.
+func responseStatus(ctx echo.Context, err error) int {
+	status := ctx.Response().Status
+	if err != nil && !ctx.Response().Committed {
+		status = http.StatusInternalServerError
+		var httpErr *echo.HTTPError
+		if errors.As(err, &httpErr) {
+			status = httpErr.Code
+		}
+	}
+	return status
+}
+
+func route(ctx echo.Context) string {
+	if len(ctx.Path()) == 0 {
+		return "unmatched"
+	}
+	return ctx.Path()
+}
@@ -0,0 +1,35 @@
+package middlewares
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"tech-challenge-payment/internal/metrics"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMetrics(t *testing.T) {
+	router := echo.New()
+	router.Use(Metrics)
+	router.GET("/payment/:id", func(c echo.Context) error {
+		if c.Param("id") == "missing" {
+			return c.JSON(http.StatusNotFound, "error searching payment")
+		}
+		return c.NoContent(http.StatusOK)
+	})
+	router.GET("/broken", func(c echo.Context) error {
+		return echo.NewHTTPError(http.StatusServiceUnavailable)
+	})
+
+	for _, path := range []string{"/payment/1", "/payment/2", "/payment/missing", "/broken", "/unknown"} {
+		router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, path, nil))
+	}
+
+	assert.Equal(t, float64(2), testutil.ToFloat64(metrics.HTTPRequests.WithLabelValues(http.MethodGet, "/payment/:id", "200")))
+	assert.Equal(t, float64(1), testutil.ToFloat64(metrics.HTTPRequests.WithLabelValues(http.MethodGet, "/payment/:id", "404")))
+	assert.Equal(t, float64(1), testutil.ToFloat64(metrics.HTTPRequests.WithLabelValues(http.MethodGet, "/broken", "503")))
+	assert.Equal(t, float64(1), testutil.ToFloat64(metrics.HTTPRequests.WithLabelValues(http.MethodGet, "unmatched", "404")))
+}
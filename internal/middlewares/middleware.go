@@ -2,35 +2,150 @@ package middlewares
 
 import (
 	"context"
+	"crypto/tls"
+	"errors"
 	"net/http"
+	"tech-challenge-payment/internal/auth/apikey"
+	"tech-challenge-payment/internal/auth/certs"
+	"tech-challenge-payment/internal/auth/principal"
 	"tech-challenge-payment/internal/auth/token"
 
+	"tech-challenge-payment/internal/logging"
+	"time"
+
 	"github.com/labstack/echo/v4"
-	"github.com/sirupsen/logrus"
 )
 
+const (
+	APIKeyHeader = "X-API-Key"
+)
+
+// APIKeyAuthenticator resolves the principal owning an API key.
+type APIKeyAuthenticator interface {
+	Authenticate(ctx context.Context, key string) (principal.Principal, error)
+}
+
+// Logger tags the request with the X-Request-ID sent by the caller, or a new one, echoes it back and
+// puts a logger carrying it in the request context. Every request is logged once it is answered.
 func Logger(fx echo.HandlerFunc) echo.HandlerFunc {
 	return func(ctx echo.Context) error {
-		log := logrus.WithContext(context.Background())
+		start := time.Now()
 		request := ctx.Request()
-		log.WithFields(logrus.Fields{
-			"Host":   request.Host,
-			"URI":    request.RequestURI,
-			"Method": request.Method,
-		}).Info()
 
-		return fx(ctx)
+		requestID := logging.ValidRequestID(request.Header.Get(logging.REQUEST_ID_HEADER))
+		ctx.Response().Header().Set(logging.REQUEST_ID_HEADER, requestID)
+		requestCtx := logging.NewContext(logging.WithRequestID(request.Context(), requestID), nil)
+		ctx.SetRequest(request.WithContext(requestCtx))
+
+		err := fx(ctx)
+
+		status := responseStatus(ctx, err)
+		event := logging.Ctx(requestCtx).Info()
+		if status >= http.StatusInternalServerError {
+			event = logging.Ctx(requestCtx).Error().Err(err)
+		}
+		event.
+			Str("method", request.Method).
+			Str("route", route(ctx)).
+			Str("uri", request.RequestURI).
+			Str("host", request.Host).
+			Str("remote_ip", ctx.RealIP()).
+			Int("status", status).
+			Dur("latency_ms", time.Since(start)).
+			Dict("headers", logging.Headers(request.Header)).
+			Msg("request handled")
+
+		return err
 	}
 }
 
-func Authorization(fx echo.HandlerFunc) echo.HandlerFunc {
-	return func(ctx echo.Context) error {
-		if err := token.ValidateToken(ctx.Request()); err != nil {
-			ctx.Response().Header().Set("Content-Type", "application/json")
-			ctx.Response().WriteHeader(http.StatusUnauthorized)
-			return err
+// NewAuthorization accepts a JWT checked by tokens in the Authorization header or, when keys is set, an API key in the X-API-Key header.
+// Requests with neither are accepted when the connection presented a verified client certificate, which is granted clientScopes.
+func NewAuthorization(tokens token.Validator, keys APIKeyAuthenticator, clientScopes []string) echo.MiddlewareFunc {
+	return func(fx echo.HandlerFunc) echo.HandlerFunc {
+		return func(ctx echo.Context) error {
+			request := ctx.Request()
+			p, err := authenticate(request.Context(), tokens, keys, request.Header.Get("Authorization"), request.Header.Get(APIKeyHeader), request.TLS, clientScopes)
+			if err != nil {
+				if !isUnauthorized(err) {
+					return ctx.JSON(http.StatusInternalServerError, echo.Map{
+						"message": "error authenticating request",
+					})
+				}
+
+				if errors.Is(err, token.ErrMissingToken) {
+					ctx.Response().Header().Set(echo.HeaderWWWAuthenticate, "Bearer")
+				} else if isTokenError(err) {
+					ctx.Response().Header().Set(echo.HeaderWWWAuthenticate, `Bearer error="invalid_token"`)
+				}
+				return ctx.JSON(http.StatusUnauthorized, echo.Map{
+					"message": unauthorizedMessage(err),
+				})
+			}
+
+			ctx.SetRequest(request.WithContext(principal.NewContext(request.Context(), p)))
+
+			return fx(ctx)
 		}
+	}
+}
+
+func authenticate(ctx context.Context, tokens token.Validator, keys APIKeyAuthenticator, authorization, key string, state *tls.ConnectionState, clientScopes []string) (principal.Principal, error) {
+	if len(key) > 0 {
+		if keys == nil {
+			return principal.Principal{}, apikey.ErrInvalidKey
+		}
+		return keys.Authenticate(ctx, key)
+	}
 
-		return fx(ctx)
+	if len(authorization) == 0 {
+		if p, ok := certs.Principal(state, clientScopes); ok {
+			return p, nil
+		}
+	}
+
+	return tokens.ValidateAuthorization(ctx, authorization)
+}
+
+func isTokenError(err error) bool {
+	var tokenErr *token.Error
+	return errors.As(err, &tokenErr)
+}
+
+// isUnauthorized tells rejected credentials apart from failures to check them.
+func isUnauthorized(err error) bool {
+	return isTokenError(err) ||
+		errors.Is(err, apikey.ErrInvalidKey) ||
+		errors.Is(err, apikey.ErrKeyExpired) ||
+		errors.Is(err, apikey.ErrKeyRevoked)
+}
+
+// unauthorizedMessage only exposes why credentials were rejected, never the underlying cause.
+func unauthorizedMessage(err error) string {
+	var tokenErr *token.Error
+	if errors.As(err, &tokenErr) {
+		return tokenErr.Kind.Error()
+	}
+
+	if isUnauthorized(err) {
+		return err.Error()
+	}
+
+	return token.ErrInvalidToken.Error()
+}
+
+// RequireScopes rejects requests whose principal was not granted every scope. It must run after Authorization.
+func RequireScopes(scopes ...string) echo.MiddlewareFunc {
+	return func(fx echo.HandlerFunc) echo.HandlerFunc {
+		return func(ctx echo.Context) error {
+			p, ok := principal.FromContext(ctx.Request().Context())
+			if !ok || !p.HasScopes(scopes...) {
+				return ctx.JSON(http.StatusForbidden, echo.Map{
+					"message": "insufficient scope",
+				})
+			}
+
+			return fx(ctx)
+		}
 	}
 }
@@ -0,0 +1,313 @@
+package middlewares
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"tech-challenge-payment/internal/auth/apikey"
+	"tech-challenge-payment/internal/auth/principal"
+	"tech-challenge-payment/internal/auth/token"
+	"tech-challenge-payment/internal/canonical"
+	"tech-challenge-payment/internal/config"
+	"tech-challenge-payment/internal/logging"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/labstack/echo/v4"
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+	"github.com/stretchr/testify/assert"
+)
+
+const tokenKey = "middleware-test-key"
+
+var tokens = token.NewValidator(config.TokenConfig{Key: tokenKey}, canonical.SystemClock())
+
+func bearer(t *testing.T, claims jwt.MapClaims) string {
+	claims["exp"] = time.Now().Add(time.Hour).Unix()
+	signed, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(tokenKey))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return "Bearer " + signed
+}
+
+func expired(t *testing.T) string {
+	signed, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"sub": "order-service",
+		"exp": time.Now().Add(-time.Hour).Unix(),
+	}).SignedString([]byte(tokenKey))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return "Bearer " + signed
+}
+
+func TestAuthorization(t *testing.T) {
+	router := echo.New()
+	router.GET("/payment", func(c echo.Context) error {
+		p, _ := principal.FromContext(c.Request().Context())
+		return c.String(http.StatusOK, p.Subject)
+	}, NewAuthorization(tokens, nil, nil), RequireScopes(principal.SCOPE_READ))
+
+	type Given struct {
+		authorization string
+	}
+	type Expected struct {
+		statusCode int
+		body       string
+		challenge  string
+	}
+	tests := map[string]struct {
+		given    Given
+		expected Expected
+	}{
+		"given token with required scope, must expose the principal to the handler": {
+			given:    Given{authorization: bearer(t, jwt.MapClaims{"sub": "order-service", "scope": principal.SCOPE_READ})},
+			expected: Expected{statusCode: http.StatusOK, body: "order-service"},
+		},
+		"given token with admin scope, must allow any route": {
+			given:    Given{authorization: bearer(t, jwt.MapClaims{"sub": "ops", "scope": principal.SCOPE_ADMIN})},
+			expected: Expected{statusCode: http.StatusOK, body: "ops"},
+		},
+		"given token without required scope, must return 403": {
+			given:    Given{authorization: bearer(t, jwt.MapClaims{"sub": "order-service", "scope": principal.SCOPE_WRITE})},
+			expected: Expected{statusCode: http.StatusForbidden},
+		},
+		"given invalid token, must return 401": {
+			given: Given{authorization: "Bearer invalid"},
+			expected: Expected{
+				statusCode: http.StatusUnauthorized,
+				body:       `{"message":"token is malformed"}` + "\n",
+				challenge:  `Bearer error="invalid_token"`,
+			},
+		},
+		"given token with another scheme, must return 401": {
+			given: Given{authorization: "Basic dXNlcjpwYXNz"},
+			expected: Expected{
+				statusCode: http.StatusUnauthorized,
+				body:       `{"message":"authorization scheme must be Bearer"}` + "\n",
+				challenge:  `Bearer error="invalid_token"`,
+			},
+		},
+		"given missing token, must return 401": {
+			expected: Expected{
+				statusCode: http.StatusUnauthorized,
+				body:       `{"message":"missing bearer token"}` + "\n",
+				challenge:  "Bearer",
+			},
+		},
+		"given expired token, must return 401": {
+			given: Given{authorization: expired(t)},
+			expected: Expected{
+				statusCode: http.StatusUnauthorized,
+				body:       `{"message":"token is expired"}` + "\n",
+				challenge:  `Bearer error="invalid_token"`,
+			},
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			req := httptest.NewRequest(http.MethodGet, "/payment", nil)
+			req.Header.Set("Authorization", tc.given.authorization)
+
+			router.ServeHTTP(rec, req)
+
+			assert.Equal(t, tc.expected.statusCode, rec.Code)
+			if len(tc.expected.body) > 0 {
+				assert.Equal(t, tc.expected.body, rec.Body.String())
+			}
+			assert.Equal(t, tc.expected.challenge, rec.Header().Get(echo.HeaderWWWAuthenticate))
+		})
+	}
+}
+
+type apiKeysFake map[string]error
+
+func (f apiKeysFake) Authenticate(ctx context.Context, key string) (principal.Principal, error) {
+	if err, ok := f[key]; ok {
+		return principal.Principal{}, err
+	}
+	return principal.Principal{Subject: "batch", Scopes: []string{principal.SCOPE_READ}, KeyID: key}, nil
+}
+
+func TestAPIKeyAuthorization(t *testing.T) {
+	keys := apiKeysFake{
+		"revoked": apikey.ErrKeyRevoked,
+		"broken":  errors.New("db error"),
+	}
+
+	router := echo.New()
+	router.GET("/payment", func(c echo.Context) error {
+		p, _ := principal.FromContext(c.Request().Context())
+		return c.String(http.StatusOK, p.Subject)
+	}, NewAuthorization(tokens, keys, nil), RequireScopes(principal.SCOPE_READ))
+
+	tests := map[string]struct {
+		key        string
+		statusCode int
+		body       string
+	}{
+		"given valid key, must expose its owner to the handler": {
+			key:        "valid",
+			statusCode: http.StatusOK,
+			body:       "batch",
+		},
+		"given revoked key, must return 401": {
+			key:        "revoked",
+			statusCode: http.StatusUnauthorized,
+			body:       `{"message":"api key was revoked"}` + "\n",
+		},
+		"given failure checking the key, must return 500": {
+			key:        "broken",
+			statusCode: http.StatusInternalServerError,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			req := httptest.NewRequest(http.MethodGet, "/payment", nil)
+			req.Header.Set(APIKeyHeader, tc.key)
+
+			router.ServeHTTP(rec, req)
+
+			assert.Equal(t, tc.statusCode, rec.Code)
+			if len(tc.body) > 0 {
+				assert.Equal(t, tc.body, rec.Body.String())
+			}
+		})
+	}
+
+	t.Run("given API key without authenticator, must return 401", func(t *testing.T) {
+		router := echo.New()
+		router.GET("/payment", func(c echo.Context) error { return c.NoContent(http.StatusOK) }, NewAuthorization(tokens, nil, nil))
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, "/payment", nil)
+		req.Header.Set(APIKeyHeader, "valid")
+
+		router.ServeHTTP(rec, req)
+
+		assert.Equal(t, http.StatusUnauthorized, rec.Code)
+	})
+}
+
+func TestCertificateAuthorization(t *testing.T) {
+	router := echo.New()
+	router.POST("/payment/callback", func(c echo.Context) error {
+		p, _ := principal.FromContext(c.Request().Context())
+		return c.String(http.StatusOK, p.Subject)
+	}, NewAuthorization(tokens, nil, []string{principal.SCOPE_CALLBACK}), RequireScopes(principal.SCOPE_CALLBACK))
+
+	verified := &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{
+		{Subject: pkix.Name{CommonName: "partner-callbacks"}},
+	}}}
+
+	tests := map[string]struct {
+		state         *tls.ConnectionState
+		authorization string
+		statusCode    int
+		body          string
+	}{
+		"given verified client certificate, must authenticate its subject": {
+			state:      verified,
+			statusCode: http.StatusOK,
+			body:       "partner-callbacks",
+		},
+		"given verified client certificate and a token, must prefer the token": {
+			state:         verified,
+			authorization: bearer(t, jwt.MapClaims{"sub": "order-service", "scope": principal.SCOPE_ADMIN}),
+			statusCode:    http.StatusOK,
+			body:          "order-service",
+		},
+		"given connection without certificate, must return 401": {
+			state:      &tls.ConnectionState{},
+			statusCode: http.StatusUnauthorized,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			req := httptest.NewRequest(http.MethodPost, "/payment/callback", nil)
+			req.TLS = tc.state
+			if len(tc.authorization) > 0 {
+				req.Header.Set("Authorization", tc.authorization)
+			}
+
+			router.ServeHTTP(rec, req)
+
+			assert.Equal(t, tc.statusCode, rec.Code)
+			if len(tc.body) > 0 {
+				assert.Equal(t, tc.body, rec.Body.String())
+			}
+		})
+	}
+}
+
+func TestLogger(t *testing.T) {
+	var buf bytes.Buffer
+	global := log.Logger
+	log.Logger = zerolog.New(&buf)
+	defer func() { log.Logger = global }()
+
+	var handled string
+	router := echo.New()
+	router.Use(Logger)
+	router.GET("/payment/:id", func(c echo.Context) error {
+		handled = logging.RequestID(c.Request().Context())
+		if c.Param("id") == "broken" {
+			return errors.New("db error")
+		}
+		return c.NoContent(http.StatusOK)
+	})
+
+	request := httptest.NewRequest(http.MethodGet, "/payment/1", nil)
+	request.Header.Set(logging.REQUEST_ID_HEADER, "request-1")
+	request.Header.Set("Authorization", "Bearer secret")
+	response := httptest.NewRecorder()
+	router.ServeHTTP(response, request)
+
+	assert.Equal(t, "request-1", response.Header().Get(logging.REQUEST_ID_HEADER))
+	assert.Equal(t, "request-1", handled)
+
+	response = httptest.NewRecorder()
+	router.ServeHTTP(response, httptest.NewRequest(http.MethodGet, "/payment/broken", nil))
+
+	generated := response.Header().Get(logging.REQUEST_ID_HEADER)
+	assert.NotEmpty(t, generated)
+	assert.Equal(t, generated, handled)
+
+	assert.NotContains(t, buf.String(), "secret")
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	assert.Len(t, lines, 2)
+
+	var ok, failed map[string]any
+	assert.NoError(t, json.Unmarshal([]byte(lines[0]), &ok))
+	assert.NoError(t, json.Unmarshal([]byte(lines[1]), &failed))
+
+	assert.Equal(t, "info", ok["level"])
+	assert.Equal(t, "request-1", ok[logging.REQUEST_ID_FIELD])
+	assert.Equal(t, "/payment/:id", ok["route"])
+	assert.Equal(t, float64(http.StatusOK), ok["status"])
+	assert.Contains(t, ok, "latency_ms")
+	assert.Equal(t, logging.REDACTED, ok["headers"].(map[string]any)["Authorization"])
+
+	assert.Equal(t, "error", failed["level"])
+	assert.Equal(t, generated, failed[logging.REQUEST_ID_FIELD])
+	assert.Equal(t, float64(http.StatusInternalServerError), failed["status"])
+	assert.Equal(t, "db error", failed["error"])
+}
@@ -0,0 +1,47 @@
+package middlewares
+
+import (
+	"net/http"
+	"tech-challenge-payment/internal/tracing"
+
+	"github.com/labstack/echo/v4"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Tracing opens a server span for every request, continuing the trace of the caller when it sent a traceparent header.
+func Tracing(fx echo.HandlerFunc) echo.HandlerFunc {
+	return func(ctx echo.Context) error {
+		request := ctx.Request()
+		parent := otel.GetTextMapPropagator().Extract(request.Context(), propagation.HeaderCarrier(request.Header))
+
+		spanCtx, span := tracing.Start(parent, request.Method+" "+route(ctx),
+			trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(
+				semconv.HTTPRequestMethodKey.String(request.Method),
+				semconv.HTTPRoute(route(ctx)),
+				semconv.URLPath(request.URL.Path),
+			),
+		)
+		defer span.End()
+
+		ctx.SetRequest(request.WithContext(spanCtx))
+
+		err := fx(ctx)
+
+		status := responseStatus(ctx, err)
+		span.SetAttributes(semconv.HTTPResponseStatusCode(status))
+		// client errors are the caller's fault, the span only fails for server errors
+		if status >= http.StatusInternalServerError {
+			if err != nil {
+				span.RecordError(err)
+			}
+			span.SetStatus(codes.Error, http.StatusText(status))
+		}
+
+		return err
+	}
+}
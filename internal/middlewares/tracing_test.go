@@ -0,0 +1,66 @@
+package middlewares
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestTracing(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+
+	var handled trace.SpanContext
+	router := echo.New()
+	router.Use(Tracing)
+	router.GET("/payment/:id", func(c echo.Context) error {
+		handled = trace.SpanContextFromContext(c.Request().Context())
+		if c.Param("id") == "missing" {
+			return c.JSON(http.StatusNotFound, "error searching payment")
+		}
+		return c.NoContent(http.StatusOK)
+	})
+	router.GET("/broken", func(c echo.Context) error {
+		return echo.NewHTTPError(http.StatusServiceUnavailable)
+	})
+
+	request := httptest.NewRequest(http.MethodGet, "/payment/1", nil)
+	request.Header.Set("traceparent", "00-4bf92f3577b34da6a1c7d1a2f7b5c6d1-00f067aa0ba902b7-01")
+	router.ServeHTTP(httptest.NewRecorder(), request)
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/payment/missing", nil))
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/broken", nil))
+
+	spans := recorder.Ended()
+	assert.Len(t, spans, 3)
+
+	continued := spans[0]
+	assert.Equal(t, "GET /payment/:id", continued.Name())
+	assert.Equal(t, trace.SpanKindServer, continued.SpanKind())
+	assert.Equal(t, "4bf92f3577b34da6a1c7d1a2f7b5c6d1", continued.SpanContext().TraceID().String())
+	assert.Equal(t, "00f067aa0ba902b7", continued.Parent().SpanID().String())
+	assert.Contains(t, continued.Attributes(), semconv.HTTPResponseStatusCode(http.StatusOK))
+	assert.Contains(t, continued.Attributes(), semconv.URLPath("/payment/1"))
+	assert.Equal(t, codes.Unset, continued.Status().Code)
+
+	notFound := spans[1]
+	assert.False(t, notFound.Parent().IsValid())
+	assert.Contains(t, notFound.Attributes(), semconv.HTTPResponseStatusCode(http.StatusNotFound))
+	assert.Equal(t, codes.Unset, notFound.Status().Code)
+	// the handler sees the span of the request
+	assert.Equal(t, notFound.SpanContext().SpanID(), handled.SpanID())
+
+	broken := spans[2]
+	assert.Contains(t, broken.Attributes(), semconv.HTTPResponseStatusCode(http.StatusServiceUnavailable))
+	assert.Equal(t, codes.Error, broken.Status().Code)
+}
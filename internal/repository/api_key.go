@@ -0,0 +1,114 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"tech-challenge-payment/internal/canonical"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+const (
+	apiKeyCollection = "api_key"
+)
+
+type APIKeyRepository interface {
+	Create(ctx context.Context, key canonical.APIKey) error
+	GetByID(ctx context.Context, id string) (*canonical.APIKey, error)
+	GetAll(ctx context.Context) ([]canonical.APIKey, error)
+	// Revoke fails with canonical.ErrorNotFound when the key does not exist or was already revoked.
+	Revoke(ctx context.Context, id string, at time.Time) error
+	// Rotate records the key replacing id and shortens its life to expiresAt.
+	Rotate(ctx context.Context, id, replacedBy string, expiresAt time.Time) error
+	UpdateLastUsed(ctx context.Context, id string, at time.Time) error
+}
+
+type apiKeyRepository struct {
+	collection *mongo.Collection
+}
+
+func NewAPIKeyRepo(db *mongo.Database) APIKeyRepository {
+	return &apiKeyRepository{
+		collection: db.Collection(apiKeyCollection),
+	}
+}
+
+func (r *apiKeyRepository) Create(ctx context.Context, key canonical.APIKey) error {
+	_, err := r.collection.InsertOne(ctx, key)
+	return err
+}
+
+func (r *apiKeyRepository) GetByID(ctx context.Context, id string) (*canonical.APIKey, error) {
+	var key canonical.APIKey
+
+	err := r.collection.FindOne(ctx, bson.M{"_id": id}).Decode(&key)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, canonical.ErrorNotFound
+		}
+		return nil, err
+	}
+
+	return &key, nil
+}
+
+func (r *apiKeyRepository) GetAll(ctx context.Context) ([]canonical.APIKey, error) {
+	cursor, err := r.collection.Find(ctx, bson.D{})
+	if err != nil {
+		return nil, err
+	}
+
+	var results []canonical.APIKey
+	if err = cursor.All(ctx, &results); err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
+func (r *apiKeyRepository) Revoke(ctx context.Context, id string, at time.Time) error {
+	filter := bson.M{
+		"_id":        id,
+		"revoked_at": bson.M{"$exists": false},
+	}
+
+	result, err := r.collection.UpdateOne(ctx, filter, bson.M{"$set": bson.M{"revoked_at": at}})
+	if err != nil {
+		return err
+	}
+
+	if result.MatchedCount == 0 {
+		return canonical.ErrorNotFound
+	}
+
+	return nil
+}
+
+func (r *apiKeyRepository) Rotate(ctx context.Context, id, replacedBy string, expiresAt time.Time) error {
+	filter := bson.M{
+		"_id":        id,
+		"revoked_at": bson.M{"$exists": false},
+		"rotated_to": bson.M{"$exists": false},
+	}
+	fields := bson.M{"$set": bson.M{
+		"rotated_to": replacedBy,
+		"expires_at": expiresAt,
+	}}
+
+	result, err := r.collection.UpdateOne(ctx, filter, fields)
+	if err != nil {
+		return err
+	}
+
+	if result.MatchedCount == 0 {
+		return canonical.ErrorNotFound
+	}
+
+	return nil
+}
+
+func (r *apiKeyRepository) UpdateLastUsed(ctx context.Context, id string, at time.Time) error {
+	_, err := r.collection.UpdateOne(ctx, bson.M{"_id": id}, bson.M{"$set": bson.M{"last_used_at": at}})
+	return err
+}
@@ -0,0 +1,116 @@
+package repository
+
+import (
+	"context"
+	"tech-challenge-payment/internal/canonical"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+func TestAPIKeyGetByID(t *testing.T) {
+	type Given struct {
+		mtestFunc func(mt *mtest.T)
+	}
+	tests := map[string]struct {
+		given Given
+	}{
+		"given stored key, must return it": {
+			given: Given{
+				mtestFunc: func(mt *mtest.T) {
+					repo := apiKeyRepository{
+						collection: mt.DB.Collection("fake-collection"),
+					}
+					mt.AddMockResponses(mtest.CreateCursorResponse(1, "payment.api_key", mtest.FirstBatch, bson.D{
+						{Key: "_id", Value: "key_valid"},
+						{Key: "hash", Value: "hash"},
+						{Key: "owner", Value: "batch"},
+						{Key: "scopes", Value: bson.A{"payments:read"}},
+					}))
+
+					key, err := repo.GetByID(context.Background(), "key_valid")
+
+					assert.Nil(t, err)
+					assert.Equal(t, "batch", key.Owner)
+					assert.Equal(t, []string{"payments:read"}, key.Scopes)
+				},
+			},
+		},
+		"given unknown key, must return not found": {
+			given: Given{
+				mtestFunc: func(mt *mtest.T) {
+					repo := apiKeyRepository{
+						collection: mt.DB.Collection("fake-collection"),
+					}
+					mt.AddMockResponses(mtest.CreateCursorResponse(0, "payment.api_key", mtest.FirstBatch))
+
+					key, err := repo.GetByID(context.Background(), "unknown")
+
+					assert.ErrorIs(t, err, canonical.ErrorNotFound)
+					assert.Nil(t, key)
+				},
+			},
+		},
+	}
+
+	for _, tc := range tests {
+		db := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+		db.Run("", tc.given.mtestFunc)
+	}
+}
+
+func TestAPIKeyRevoke(t *testing.T) {
+	type Given struct {
+		mtestFunc func(mt *mtest.T)
+	}
+	tests := map[string]struct {
+		given Given
+	}{
+		"given active key, must revoke it": {
+			given: Given{
+				mtestFunc: func(mt *mtest.T) {
+					repo := apiKeyRepository{
+						collection: mt.DB.Collection("fake-collection"),
+					}
+					mt.AddMockResponses(bson.D{{Key: "ok", Value: 1}, {Key: "n", Value: 1}, {Key: "nModified", Value: 1}})
+
+					assert.Nil(t, repo.Revoke(context.Background(), "key_valid", time.Now()))
+				},
+			},
+		},
+		"given unknown or revoked key, must return not found": {
+			given: Given{
+				mtestFunc: func(mt *mtest.T) {
+					repo := apiKeyRepository{
+						collection: mt.DB.Collection("fake-collection"),
+					}
+					mt.AddMockResponses(bson.D{{Key: "ok", Value: 1}, {Key: "n", Value: 0}, {Key: "nModified", Value: 0}})
+
+					assert.ErrorIs(t, repo.Revoke(context.Background(), "key_valid", time.Now()), canonical.ErrorNotFound)
+				},
+			},
+		},
+	}
+
+	for _, tc := range tests {
+		db := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+		db.Run("", tc.given.mtestFunc)
+	}
+}
+
+func TestAPIKeyRotate(t *testing.T) {
+	db := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	db.Run("", func(mt *mtest.T) {
+		repo := apiKeyRepository{
+			collection: mt.DB.Collection("fake-collection"),
+		}
+		mt.AddMockResponses(bson.D{{Key: "ok", Value: 1}, {Key: "n", Value: 0}, {Key: "nModified", Value: 0}})
+
+		err := repo.Rotate(context.Background(), "key_valid", "key_new", time.Now())
+
+		assert.ErrorIs(t, err, canonical.ErrorNotFound, "keys already rotated must not be rotated again")
+	})
+}
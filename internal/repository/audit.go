@@ -0,0 +1,50 @@
+package repository
+
+import (
+	"context"
+	"tech-challenge-payment/internal/canonical"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	auditCollection = "payment_audit"
+)
+
+// AuditRepository is append only, entries are never updated nor deleted.
+type AuditRepository interface {
+	Create(ctx context.Context, entry canonical.AuditEntry) error
+	// GetByPaymentID lists the entries of the payment from the oldest to the newest.
+	GetByPaymentID(ctx context.Context, paymentID string) ([]canonical.AuditEntry, error)
+}
+
+type auditRepository struct {
+	collection *mongo.Collection
+}
+
+func NewAuditRepo(db *mongo.Database) AuditRepository {
+	return &auditRepository{
+		collection: db.Collection(auditCollection),
+	}
+}
+
+func (r *auditRepository) Create(ctx context.Context, entry canonical.AuditEntry) error {
+	_, err := r.collection.InsertOne(ctx, entry)
+	return err
+}
+
+func (r *auditRepository) GetByPaymentID(ctx context.Context, paymentID string) ([]canonical.AuditEntry, error) {
+	opts := options.Find().SetSort(bson.D{{Key: "at", Value: 1}})
+	cursor, err := r.collection.Find(ctx, bson.M{"payment_id": paymentID}, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	results := []canonical.AuditEntry{}
+	if err = cursor.All(ctx, &results); err != nil {
+		return nil, err
+	}
+	return results, nil
+}
@@ -0,0 +1,103 @@
+package repository
+
+import (
+	"context"
+	"tech-challenge-payment/internal/canonical"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+func TestCreateAuditEntry(t *testing.T) {
+	type Given struct {
+		mtestFunc func(mt *mtest.T)
+	}
+	tests := map[string]struct {
+		given Given
+	}{
+		"given no error saving must return no error": {
+			given: Given{
+				mtestFunc: func(mt *mtest.T) {
+					repo := auditRepository{
+						collection: mt.DB.Collection("fake-collection"),
+					}
+					mt.AddMockResponses(mtest.CreateSuccessResponse())
+
+					err := repo.Create(context.Background(), canonical.AuditEntry{ID: "entry", PaymentID: "1234"})
+
+					assert.Nil(t, err)
+				},
+			},
+		},
+		"given error saving must return error": {
+			given: Given{
+				mtestFunc: func(mt *mtest.T) {
+					repo := auditRepository{
+						collection: mt.DB.Collection("fake-collection"),
+					}
+					mt.AddMockResponses(bson.D{{Key: "ok", Value: -1}})
+
+					err := repo.Create(context.Background(), canonical.AuditEntry{ID: "entry", PaymentID: "1234"})
+
+					assert.NotNil(t, err)
+				},
+			},
+		},
+	}
+
+	for _, tc := range tests {
+		db := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+		db.Run("", tc.given.mtestFunc)
+	}
+}
+
+func TestGetAuditByPaymentID(t *testing.T) {
+	now := time.Date(2020, 11, 01, 00, 00, 00, 0, time.UTC)
+
+	db := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	db.Run("", func(mt *mtest.T) {
+		repo := auditRepository{
+			collection: mt.DB.Collection("fake-collection"),
+		}
+		mt.AddMockResponses(mtest.CreateCursorResponse(0, "payment.payment_audit", mtest.FirstBatch,
+			bson.D{
+				{Key: "_id", Value: "created"},
+				{Key: "payment_id", Value: "1234"},
+				{Key: "new_status", Value: 0},
+				{Key: "actor", Value: "sqs-consumer"},
+				{Key: "at", Value: now},
+			},
+			bson.D{
+				{Key: "_id", Value: "payed"},
+				{Key: "payment_id", Value: "1234"},
+				{Key: "previous_status", Value: 0},
+				{Key: "new_status", Value: 1},
+				{Key: "actor", Value: "provider:log"},
+				{Key: "payload_hash", Value: "hash"},
+				{Key: "at", Value: now.Add(time.Minute)},
+			},
+		))
+
+		entries, err := repo.GetByPaymentID(context.Background(), "1234")
+
+		assert.Nil(t, err)
+		assert.Len(t, entries, 2)
+		assert.Nil(t, entries[0].PreviousStatus)
+		assert.Equal(t, canonical.PAYMENT_CREATED, *entries[1].PreviousStatus)
+		assert.Equal(t, canonical.PAYMENT_PAYED, entries[1].NewStatus)
+		assert.Equal(t, "hash", entries[1].PayloadHash)
+		assert.Equal(t, now.Add(time.Minute), entries[1].At.UTC())
+		assert.Equal(t, bson.D{{Key: "at", Value: int32(1)}}, sortOf(mt))
+	})
+}
+
+func sortOf(mt *mtest.T) bson.D {
+	var sort bson.D
+	if err := bson.Unmarshal(mt.GetStartedEvent().Command.Lookup("sort").Document(), &sort); err != nil {
+		mt.Fatal(err)
+	}
+	return sort
+}
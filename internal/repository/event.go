@@ -0,0 +1,82 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"tech-challenge-payment/internal/canonical"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	eventCollection = "payment_event"
+)
+
+var (
+	ErrorSequenceConflict = errors.New("event sequence already taken")
+)
+
+// EventStore keeps the log the payments are derived from. Events are only ever appended.
+type EventStore interface {
+	// Append fails with ErrorSequenceConflict when another event already took the sequence.
+	Append(ctx context.Context, event canonical.PaymentEvent) error
+	// Load lists the events of a payment ordered by sequence.
+	Load(ctx context.Context, paymentID string) ([]canonical.PaymentEvent, error)
+	// Replay hands every event to apply, the events of each payment together and ordered by sequence.
+	Replay(ctx context.Context, apply func(canonical.PaymentEvent) error) error
+}
+
+type eventStore struct {
+	collection *mongo.Collection
+}
+
+func NewEventStore(db *mongo.Database) EventStore {
+	return &eventStore{
+		collection: db.Collection(eventCollection),
+	}
+}
+
+func (s *eventStore) Append(ctx context.Context, event canonical.PaymentEvent) error {
+	// the id is made of the payment and the sequence, the unique index on it settles races
+	_, err := s.collection.InsertOne(ctx, event)
+	if mongo.IsDuplicateKeyError(err) {
+		return ErrorSequenceConflict
+	}
+	return err
+}
+
+func (s *eventStore) Load(ctx context.Context, paymentID string) ([]canonical.PaymentEvent, error) {
+	opts := options.Find().SetSort(bson.D{{Key: "sequence", Value: 1}})
+	cursor, err := s.collection.Find(ctx, bson.M{"payment_id": paymentID}, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	var events []canonical.PaymentEvent
+	if err = cursor.All(ctx, &events); err != nil {
+		return nil, err
+	}
+	return events, nil
+}
+
+func (s *eventStore) Replay(ctx context.Context, apply func(canonical.PaymentEvent) error) error {
+	opts := options.Find().SetSort(bson.D{{Key: "payment_id", Value: 1}, {Key: "sequence", Value: 1}})
+	cursor, err := s.collection.Find(ctx, bson.D{}, opts)
+	if err != nil {
+		return err
+	}
+	defer cursor.Close(ctx)
+
+	for cursor.Next(ctx) {
+		var event canonical.PaymentEvent
+		if err := cursor.Decode(&event); err != nil {
+			return err
+		}
+		if err := apply(event); err != nil {
+			return err
+		}
+	}
+	return cursor.Err()
+}
@@ -0,0 +1,91 @@
+package repository
+
+import (
+	"context"
+	"tech-challenge-payment/internal/canonical"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+func TestAppendEvent(t *testing.T) {
+	type Given struct {
+		response bson.D
+	}
+	type Expected struct {
+		err assert.ErrorAssertionFunc
+	}
+	tests := map[string]struct {
+		given    Given
+		expected Expected
+	}{
+		"given free sequence, must append the event": {
+			given:    Given{response: mtest.CreateSuccessResponse()},
+			expected: Expected{err: assert.NoError},
+		},
+		"given sequence already taken, must return sequence conflict": {
+			given: Given{response: mtest.CreateWriteErrorsResponse(mtest.WriteError{Code: 11000, Message: "duplicate key"})},
+			expected: Expected{err: func(t assert.TestingT, err error, _ ...interface{}) bool {
+				return assert.ErrorIs(t, err, ErrorSequenceConflict)
+			}},
+		},
+		"given error saving, must return error": {
+			given:    Given{response: bson.D{{Key: "ok", Value: -1}}},
+			expected: Expected{err: assert.Error},
+		},
+	}
+
+	for name, tc := range tests {
+		db := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+		db.Run(name, func(mt *mtest.T) {
+			store := eventStore{collection: mt.DB.Collection("fake-collection")}
+			mt.AddMockResponses(tc.given.response)
+
+			err := store.Append(context.Background(), canonical.PaymentEvent{ID: "1234:1", PaymentID: "1234", Sequence: 1})
+
+			tc.expected.err(t, err)
+		})
+	}
+}
+
+func TestLoadEvents(t *testing.T) {
+	db := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	db.Run("", func(mt *mtest.T) {
+		store := eventStore{collection: mt.DB.Collection("fake-collection")}
+		mt.AddMockResponses(mtest.CreateCursorResponse(0, "payment.payment_event", mtest.FirstBatch,
+			eventDocument(1, canonical.EVENT_PAYMENT_REQUESTED),
+			eventDocument(2, canonical.EVENT_CAPTURED),
+		))
+
+		events, err := store.Load(context.Background(), "payment_valid")
+
+		assert.Nil(t, err)
+		assert.Len(t, events, 2)
+		assert.Equal(t, canonical.EVENT_CAPTURED, events[1].Type)
+		assert.Equal(t, uint64(2), events[1].Sequence)
+		assert.Equal(t, bson.D{{Key: "sequence", Value: int32(1)}}, sortOf(mt))
+	})
+}
+
+func TestReplayEvents(t *testing.T) {
+	db := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	db.Run("", func(mt *mtest.T) {
+		store := eventStore{collection: mt.DB.Collection("fake-collection")}
+		mt.AddMockResponses(mtest.CreateCursorResponse(0, "payment.payment_event", mtest.FirstBatch,
+			eventDocument(1, canonical.EVENT_PAYMENT_REQUESTED),
+			eventDocument(2, canonical.EVENT_FAILED),
+		))
+
+		var replayed []canonical.PaymentEventType
+		err := store.Replay(context.Background(), func(event canonical.PaymentEvent) error {
+			replayed = append(replayed, event.Type)
+			return nil
+		})
+
+		assert.Nil(t, err)
+		assert.Equal(t, []canonical.PaymentEventType{canonical.EVENT_PAYMENT_REQUESTED, canonical.EVENT_FAILED}, replayed)
+		assert.Equal(t, bson.D{{Key: "payment_id", Value: int32(1)}, {Key: "sequence", Value: int32(1)}}, sortOf(mt))
+	})
+}
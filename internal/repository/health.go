@@ -0,0 +1,27 @@
+package repository
+
+import (
+	"context"
+
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/readpref"
+)
+
+// HealthRepository tells whether Mongo can be reached.
+type HealthRepository interface {
+	Ping(ctx context.Context) error
+}
+
+type healthRepository struct {
+	database *mongo.Database
+}
+
+func NewHealthRepo(db *mongo.Database) HealthRepository {
+	return &healthRepository{
+		database: db,
+	}
+}
+
+func (r *healthRepository) Ping(ctx context.Context) error {
+	return r.database.Client().Ping(ctx, readpref.Primary())
+}
@@ -0,0 +1,26 @@
+package repository
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+func TestPing(t *testing.T) {
+	db := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	db.Run("reachable", func(mt *mtest.T) {
+		repo := healthRepository{database: mt.DB}
+		mt.AddMockResponses(mtest.CreateSuccessResponse())
+
+		assert.Nil(t, repo.Ping(context.Background()))
+	})
+	db.Run("failing", func(mt *mtest.T) {
+		repo := healthRepository{database: mt.DB}
+		mt.AddMockResponses(bson.D{{Key: "ok", Value: 0}, {Key: "errmsg", Value: "not primary"}})
+
+		assert.NotNil(t, repo.Ping(context.Background()))
+	})
+}
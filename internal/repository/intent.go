@@ -0,0 +1,114 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"tech-challenge-payment/internal/canonical"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+const (
+	intentCollection = "payment_intent"
+)
+
+// IntentRepository keeps the payment intent of each order. Changes are only applied while the
+// intent is as the caller last saw it, so concurrent attempts can not both be counted.
+type IntentRepository interface {
+	// Create fails when the order already has an intent.
+	Create(ctx context.Context, intent canonical.PaymentIntent) error
+	GetByOrderID(ctx context.Context, orderID string) (*canonical.PaymentIntent, error)
+	// AddAttempt counts one more attempt while the intent is open with attempts attempts, and
+	// fails with canonical.ErrorInvalidTransition otherwise.
+	AddAttempt(ctx context.Context, orderID string, attempts int, at time.Time) error
+	// Settle moves an open intent to its final status, and fails with
+	// canonical.ErrorInvalidTransition when it was already settled.
+	Settle(ctx context.Context, orderID string, status canonical.IntentStatus, reason canonical.StatusReason, at time.Time) error
+	// Resettle moves an intent already settled to another final status, for operators forcing
+	// the outcome of its order. It fails with canonical.ErrorInvalidTransition while it is open.
+	Resettle(ctx context.Context, orderID string, status canonical.IntentStatus, reason canonical.StatusReason, at time.Time) error
+	// GetOpenUpdatedBefore lists the open intents whose last attempt was made before the given
+	// time, or that were opened before it without one.
+	GetOpenUpdatedBefore(ctx context.Context, before time.Time) ([]canonical.PaymentIntent, error)
+}
+
+type intentRepository struct {
+	collection *mongo.Collection
+}
+
+func NewIntentRepo(db *mongo.Database) IntentRepository {
+	return &intentRepository{
+		collection: db.Collection(intentCollection),
+	}
+}
+
+func (r *intentRepository) Create(ctx context.Context, intent canonical.PaymentIntent) error {
+	_, err := r.collection.InsertOne(ctx, intent)
+	return err
+}
+
+func (r *intentRepository) GetByOrderID(ctx context.Context, orderID string) (*canonical.PaymentIntent, error) {
+	var intent canonical.PaymentIntent
+
+	err := r.collection.FindOne(ctx, bson.M{"_id": orderID}).Decode(&intent)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, canonical.ErrorNotFound
+		}
+		return nil, err
+	}
+
+	return &intent, nil
+}
+
+func (r *intentRepository) AddAttempt(ctx context.Context, orderID string, attempts int, at time.Time) error {
+	filter := bson.M{"_id": orderID, "status": canonical.INTENT_OPEN, "attempts": attempts}
+	fields := bson.M{"$set": bson.M{"attempts": attempts + 1, "updated_at": at}}
+
+	return r.update(ctx, filter, fields)
+}
+
+func (r *intentRepository) Settle(ctx context.Context, orderID string, status canonical.IntentStatus, reason canonical.StatusReason, at time.Time) error {
+	filter := bson.M{"_id": orderID, "status": canonical.INTENT_OPEN}
+	fields := bson.M{"$set": bson.M{"status": status, "reason": reason, "updated_at": at}}
+
+	return r.update(ctx, filter, fields)
+}
+
+func (r *intentRepository) Resettle(ctx context.Context, orderID string, status canonical.IntentStatus, reason canonical.StatusReason, at time.Time) error {
+	filter := bson.M{"_id": orderID, "status": bson.M{"$ne": canonical.INTENT_OPEN}}
+	fields := bson.M{"$set": bson.M{"status": status, "reason": reason, "updated_at": at}}
+
+	return r.update(ctx, filter, fields)
+}
+
+func (r *intentRepository) update(ctx context.Context, filter, fields bson.M) error {
+	result, err := r.collection.UpdateOne(ctx, filter, fields)
+	if err != nil {
+		return err
+	}
+
+	if result.MatchedCount == 0 {
+		return canonical.ErrorInvalidTransition
+	}
+	return nil
+}
+
+func (r *intentRepository) GetOpenUpdatedBefore(ctx context.Context, before time.Time) ([]canonical.PaymentIntent, error) {
+	filter := bson.M{
+		"status":     canonical.INTENT_OPEN,
+		"updated_at": bson.M{"$lt": before},
+	}
+
+	cursor, err := r.collection.Find(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+	var results []canonical.PaymentIntent
+	if err = cursor.All(ctx, &results); err != nil {
+		return nil, err
+	}
+	return results, nil
+}
@@ -0,0 +1,130 @@
+package repository
+
+import (
+	"context"
+	"tech-challenge-payment/internal/canonical"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+func TestGetIntentByOrderID(t *testing.T) {
+	type Given struct {
+		mtestFunc func(mt *mtest.T)
+	}
+	tests := map[string]struct {
+		given Given
+	}{
+		"given intent found, must return it": {
+			given: Given{
+				mtestFunc: func(mt *mtest.T) {
+					repo := intentRepository{
+						collection: mt.DB.Collection("fake-collection"),
+					}
+					mt.AddMockResponses(mtest.CreateCursorResponse(1, "db.fake-collection", mtest.FirstBatch, bson.D{
+						{Key: "_id", Value: "order"},
+						{Key: "status", Value: canonical.INTENT_OPEN},
+						{Key: "attempts", Value: 2},
+						{Key: "max_attempts", Value: 3},
+					}))
+
+					intent, err := repo.GetByOrderID(context.Background(), "order")
+
+					assert.Nil(t, err)
+					assert.Equal(t, &canonical.PaymentIntent{OrderID: "order", Attempts: 2, MaxAttempts: 3}, intent)
+				},
+			},
+		},
+		"given no intent, must return not found": {
+			given: Given{
+				mtestFunc: func(mt *mtest.T) {
+					repo := intentRepository{
+						collection: mt.DB.Collection("fake-collection"),
+					}
+					mt.AddMockResponses(mtest.CreateCursorResponse(0, "db.fake-collection", mtest.FirstBatch))
+
+					_, err := repo.GetByOrderID(context.Background(), "order")
+
+					assert.ErrorIs(t, err, canonical.ErrorNotFound)
+				},
+			},
+		},
+	}
+
+	for _, tc := range tests {
+		db := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+		db.Run("", tc.given.mtestFunc)
+	}
+}
+
+func TestAddAttempt(t *testing.T) {
+	now := time.Date(2020, 11, 01, 00, 00, 00, 0, time.UTC)
+
+	type Given struct {
+		response bson.D
+	}
+	type Expected struct {
+		err error
+	}
+	tests := map[string]struct {
+		given    Given
+		expected Expected
+	}{
+		"given intent as last seen, must count the attempt": {
+			given: Given{
+				response: mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 1}, bson.E{Key: "nModified", Value: 1}),
+			},
+		},
+		"given intent changed meanwhile, must return invalid transition": {
+			given: Given{
+				response: mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 0}, bson.E{Key: "nModified", Value: 0}),
+			},
+			expected: Expected{
+				err: canonical.ErrorInvalidTransition,
+			},
+		},
+	}
+
+	for name, tc := range tests {
+		db := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+		db.Run(name, func(mt *mtest.T) {
+			repo := intentRepository{
+				collection: mt.DB.Collection("fake-collection"),
+			}
+			mt.AddMockResponses(tc.given.response)
+
+			err := repo.AddAttempt(context.Background(), "order", 1, now)
+
+			assert.Equal(t, tc.expected.err, err)
+		})
+	}
+}
+
+func TestSettle(t *testing.T) {
+	now := time.Date(2020, 11, 01, 00, 00, 00, 0, time.UTC)
+
+	db := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	db.Run("given intent already settled, must return invalid transition", func(mt *mtest.T) {
+		repo := intentRepository{
+			collection: mt.DB.Collection("fake-collection"),
+		}
+		mt.AddMockResponses(mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 0}, bson.E{Key: "nModified", Value: 0}))
+
+		err := repo.Settle(context.Background(), "order", canonical.INTENT_SUCCEEDED, "", now)
+
+		assert.ErrorIs(t, err, canonical.ErrorInvalidTransition)
+	})
+	db.Run("given error updating, must return it", func(mt *mtest.T) {
+		repo := intentRepository{
+			collection: mt.DB.Collection("fake-collection"),
+		}
+		mt.AddMockResponses(bson.D{{Key: "ok", Value: -1}})
+
+		err := repo.Settle(context.Background(), "order", canonical.INTENT_SUCCEEDED, "", now)
+
+		assert.Error(t, err)
+	})
+}
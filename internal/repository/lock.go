@@ -0,0 +1,66 @@
+package repository
+
+import (
+	"context"
+	"tech-challenge-payment/internal/canonical"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	lockCollection = "lock"
+)
+
+// LockRepository hands out named leases so that only one replica at a time runs a job.
+type LockRepository interface {
+	// Acquire takes the lease when it is free, expired or already held by the owner,
+	// extending it for ttl. It reports whether the owner holds the lease.
+	Acquire(ctx context.Context, name, owner string, ttl time.Duration) (bool, error)
+	Release(ctx context.Context, name, owner string) error
+}
+
+type lockRepository struct {
+	collection *mongo.Collection
+	clock      canonical.Clock
+}
+
+func NewLockRepo(db *mongo.Database, clock canonical.Clock) LockRepository {
+	return &lockRepository{
+		collection: db.Collection(lockCollection),
+		clock:      clock,
+	}
+}
+
+func (r *lockRepository) Acquire(ctx context.Context, name, owner string, ttl time.Duration) (bool, error) {
+	now := r.clock.Now()
+	filter := bson.M{
+		"_id": name,
+		"$or": bson.A{
+			bson.M{"owner": owner},
+			bson.M{"expires_at": bson.M{"$lte": now}},
+		},
+	}
+	fields := bson.M{"$set": bson.M{
+		"owner":      owner,
+		"expires_at": now.Add(ttl),
+	}}
+
+	_, err := r.collection.UpdateOne(ctx, filter, fields, options.Update().SetUpsert(true))
+	if err != nil {
+		// the upsert collides with the lease of another owner that is still valid
+		if mongo.IsDuplicateKeyError(err) {
+			return false, nil
+		}
+		return false, err
+	}
+
+	return true, nil
+}
+
+func (r *lockRepository) Release(ctx context.Context, name, owner string) error {
+	_, err := r.collection.DeleteOne(ctx, bson.M{"_id": name, "owner": owner})
+	return err
+}
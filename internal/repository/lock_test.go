@@ -0,0 +1,95 @@
+package repository
+
+import (
+	"context"
+	"tech-challenge-payment/internal/canonical/canonicaltest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+func TestAcquire(t *testing.T) {
+	now := time.Date(2020, 11, 1, 0, 0, 0, 0, time.UTC)
+	type Given struct {
+		mtestFunc func(mt *mtest.T)
+	}
+	tests := map[string]struct {
+		given Given
+	}{
+		"given free lease, must acquire it": {
+			given: Given{
+				mtestFunc: func(mt *mtest.T) {
+					repo := lockRepository{
+						collection: mt.DB.Collection("fake-collection"),
+						clock:      canonicaltest.NewClock(now),
+					}
+					mt.AddMockResponses(bson.D{{Key: "ok", Value: 1}, {Key: "n", Value: 1}, {Key: "nModified", Value: 1}})
+
+					acquired, err := repo.Acquire(context.Background(), "job", "owner", time.Minute)
+
+					assert.Nil(t, err)
+					assert.True(t, acquired)
+					update := mt.GetStartedEvent().Command.Lookup("updates").Array().Index(0).Value().Document()
+					assert.Equal(t, now, update.Lookup("q", "$or").Array().Index(1).Value().Document().Lookup("expires_at", "$lte").Time().UTC())
+					assert.Equal(t, now.Add(time.Minute), update.Lookup("u", "$set", "expires_at").Time().UTC())
+				},
+			},
+		},
+		"given lease held by another owner, must not acquire it": {
+			given: Given{
+				mtestFunc: func(mt *mtest.T) {
+					repo := lockRepository{
+						collection: mt.DB.Collection("fake-collection"),
+						clock:      canonicaltest.NewClock(now),
+					}
+					mt.AddMockResponses(mtest.CreateWriteErrorsResponse(mtest.WriteError{
+						Index:   0,
+						Code:    11000,
+						Message: "duplicate key error",
+					}))
+
+					acquired, err := repo.Acquire(context.Background(), "job", "owner", time.Minute)
+
+					assert.Nil(t, err)
+					assert.False(t, acquired)
+				},
+			},
+		},
+		"given unexpected error, must return error": {
+			given: Given{
+				mtestFunc: func(mt *mtest.T) {
+					repo := lockRepository{
+						collection: mt.DB.Collection("fake-collection"),
+						clock:      canonicaltest.NewClock(now),
+					}
+					mt.AddMockResponses(bson.D{{Key: "ok", Value: -1}})
+
+					acquired, err := repo.Acquire(context.Background(), "job", "owner", time.Minute)
+
+					assert.NotNil(t, err)
+					assert.False(t, acquired)
+				},
+			},
+		},
+	}
+
+	for _, tc := range tests {
+		db := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+		db.Run("", tc.given.mtestFunc)
+	}
+}
+
+func TestRelease(t *testing.T) {
+	db := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	db.Run("", func(mt *mtest.T) {
+		repo := lockRepository{
+			collection: mt.DB.Collection("fake-collection"),
+		}
+		mt.AddMockResponses(bson.D{{Key: "ok", Value: 1}, {Key: "n", Value: 1}})
+
+		assert.Nil(t, repo.Release(context.Background(), "job", "owner"))
+	})
+}
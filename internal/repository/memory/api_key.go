@@ -0,0 +1,98 @@
+package memory
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"tech-challenge-payment/internal/canonical"
+	"tech-challenge-payment/internal/repository"
+	"time"
+)
+
+type apiKeyRepository struct {
+	mu   sync.RWMutex
+	keys map[string]canonical.APIKey
+}
+
+func NewAPIKeyRepo() repository.APIKeyRepository {
+	return &apiKeyRepository{
+		keys: map[string]canonical.APIKey{},
+	}
+}
+
+func (r *apiKeyRepository) Create(ctx context.Context, key canonical.APIKey) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.keys[key.ID]; ok {
+		return ErrDuplicateKey
+	}
+	r.keys[key.ID] = key
+	return nil
+}
+
+func (r *apiKeyRepository) GetByID(ctx context.Context, id string) (*canonical.APIKey, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	key, ok := r.keys[id]
+	if !ok {
+		return nil, canonical.ErrorNotFound
+	}
+	return &key, nil
+}
+
+func (r *apiKeyRepository) GetAll(ctx context.Context) ([]canonical.APIKey, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var results []canonical.APIKey
+	for _, key := range r.keys {
+		results = append(results, key)
+	}
+	sort.Slice(results, func(i, j int) bool { return results[i].CreatedAt.Before(results[j].CreatedAt) })
+	return results, nil
+}
+
+func (r *apiKeyRepository) Revoke(ctx context.Context, id string, at time.Time) error {
+	return r.update(id, func(key *canonical.APIKey) bool {
+		if !key.RevokedAt.IsZero() {
+			return false
+		}
+		key.RevokedAt = at
+		return true
+	})
+}
+
+func (r *apiKeyRepository) Rotate(ctx context.Context, id, replacedBy string, expiresAt time.Time) error {
+	return r.update(id, func(key *canonical.APIKey) bool {
+		if !key.RevokedAt.IsZero() || len(key.RotatedTo) > 0 {
+			return false
+		}
+		key.RotatedTo = replacedBy
+		key.ExpiresAt = expiresAt
+		return true
+	})
+}
+
+func (r *apiKeyRepository) UpdateLastUsed(ctx context.Context, id string, at time.Time) error {
+	_ = r.update(id, func(key *canonical.APIKey) bool {
+		key.LastUsedAt = at
+		return true
+	})
+	return nil
+}
+
+// update applies change to the key, it fails with canonical.ErrorNotFound when the key does not
+// exist or change does not match it.
+func (r *apiKeyRepository) update(id string, change func(*canonical.APIKey) bool) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	key, ok := r.keys[id]
+	if !ok || !change(&key) {
+		return canonical.ErrorNotFound
+	}
+	r.keys[id] = key
+	return nil
+}
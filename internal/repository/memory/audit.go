@@ -0,0 +1,45 @@
+package memory
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"tech-challenge-payment/internal/canonical"
+	"tech-challenge-payment/internal/repository"
+)
+
+type auditRepository struct {
+	mu      sync.RWMutex
+	entries []canonical.AuditEntry
+}
+
+func NewAuditRepo() repository.AuditRepository {
+	return &auditRepository{}
+}
+
+func (r *auditRepository) Create(ctx context.Context, entry canonical.AuditEntry) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, stored := range r.entries {
+		if stored.ID == entry.ID {
+			return ErrDuplicateKey
+		}
+	}
+	r.entries = append(r.entries, entry)
+	return nil
+}
+
+func (r *auditRepository) GetByPaymentID(ctx context.Context, paymentID string) ([]canonical.AuditEntry, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	results := []canonical.AuditEntry{}
+	for _, entry := range r.entries {
+		if entry.PaymentID == paymentID {
+			results = append(results, entry)
+		}
+	}
+	sort.SliceStable(results, func(i, j int) bool { return results[i].At.Before(results[j].At) })
+	return results, nil
+}
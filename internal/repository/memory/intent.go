@@ -0,0 +1,105 @@
+package memory
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"tech-challenge-payment/internal/canonical"
+	"tech-challenge-payment/internal/repository"
+	"time"
+)
+
+type intentRepository struct {
+	mu      sync.RWMutex
+	intents map[string]canonical.PaymentIntent
+}
+
+func NewIntentRepo() repository.IntentRepository {
+	return &intentRepository{
+		intents: map[string]canonical.PaymentIntent{},
+	}
+}
+
+func (r *intentRepository) Create(ctx context.Context, intent canonical.PaymentIntent) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.intents[intent.OrderID]; ok {
+		return ErrDuplicateKey
+	}
+	r.intents[intent.OrderID] = intent
+	return nil
+}
+
+func (r *intentRepository) GetByOrderID(ctx context.Context, orderID string) (*canonical.PaymentIntent, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	intent, ok := r.intents[orderID]
+	if !ok {
+		return nil, canonical.ErrorNotFound
+	}
+	return &intent, nil
+}
+
+func (r *intentRepository) AddAttempt(ctx context.Context, orderID string, attempts int, at time.Time) error {
+	return r.update(orderID, func(intent *canonical.PaymentIntent) bool {
+		if intent.Attempts != attempts {
+			return false
+		}
+		intent.Attempts++
+		intent.UpdatedAt = at
+		return true
+	})
+}
+
+func (r *intentRepository) Settle(ctx context.Context, orderID string, status canonical.IntentStatus, reason canonical.StatusReason, at time.Time) error {
+	return r.update(orderID, func(intent *canonical.PaymentIntent) bool {
+		intent.Status = status
+		intent.Reason = reason
+		intent.UpdatedAt = at
+		return true
+	})
+}
+
+func (r *intentRepository) Resettle(ctx context.Context, orderID string, status canonical.IntentStatus, reason canonical.StatusReason, at time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	intent, ok := r.intents[orderID]
+	if !ok || intent.Status == canonical.INTENT_OPEN {
+		return canonical.ErrorInvalidTransition
+	}
+	intent.Status = status
+	intent.Reason = reason
+	intent.UpdatedAt = at
+	r.intents[orderID] = intent
+	return nil
+}
+
+// update applies change to the intent while it is open, change tells whether it applies.
+func (r *intentRepository) update(orderID string, change func(*canonical.PaymentIntent) bool) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	intent, ok := r.intents[orderID]
+	if !ok || intent.Status != canonical.INTENT_OPEN || !change(&intent) {
+		return canonical.ErrorInvalidTransition
+	}
+	r.intents[orderID] = intent
+	return nil
+}
+
+func (r *intentRepository) GetOpenUpdatedBefore(ctx context.Context, before time.Time) ([]canonical.PaymentIntent, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var results []canonical.PaymentIntent
+	for _, intent := range r.intents {
+		if intent.Status == canonical.INTENT_OPEN && intent.UpdatedAt.Before(before) {
+			results = append(results, intent)
+		}
+	}
+	sort.Slice(results, func(i, j int) bool { return results[i].UpdatedAt.Before(results[j].UpdatedAt) })
+	return results, nil
+}
@@ -0,0 +1,53 @@
+package memory
+
+import (
+	"context"
+	"tech-challenge-payment/internal/canonical"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIntent(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2020, 11, 01, 00, 00, 00, 0, time.UTC)
+	repo := NewIntentRepo()
+
+	assert.NoError(t, repo.Create(ctx, canonical.PaymentIntent{OrderID: "order", MaxAttempts: 2, CreatedAt: now, UpdatedAt: now}))
+	assert.ErrorIs(t, repo.Create(ctx, canonical.PaymentIntent{OrderID: "order"}), ErrDuplicateKey)
+
+	assert.NoError(t, repo.AddAttempt(ctx, "order", 0, now))
+	// a concurrent attempt saw the intent before the first one was counted
+	assert.ErrorIs(t, repo.AddAttempt(ctx, "order", 0, now), canonical.ErrorInvalidTransition)
+
+	open, err := repo.GetOpenUpdatedBefore(ctx, now.Add(time.Minute))
+	assert.NoError(t, err)
+	assert.Len(t, open, 1)
+
+	// the deadline moves with every attempt
+	assert.NoError(t, repo.AddAttempt(ctx, "order", 1, now.Add(time.Hour)))
+	open, err = repo.GetOpenUpdatedBefore(ctx, now.Add(time.Minute))
+	assert.NoError(t, err)
+	assert.Empty(t, open)
+
+	assert.NoError(t, repo.Settle(ctx, "order", canonical.INTENT_SUCCEEDED, "", now))
+	assert.ErrorIs(t, repo.Settle(ctx, "order", canonical.INTENT_CANCELLED, canonical.REASON_EXPIRED, now), canonical.ErrorInvalidTransition)
+	assert.ErrorIs(t, repo.AddAttempt(ctx, "order", 2, now), canonical.ErrorInvalidTransition)
+	assert.ErrorIs(t, repo.Resettle(ctx, "missing", canonical.INTENT_CANCELLED, canonical.REASON_FORCED, now), canonical.ErrorInvalidTransition)
+
+	intent, err := repo.GetByOrderID(ctx, "order")
+	assert.NoError(t, err)
+	assert.Equal(t, canonical.INTENT_SUCCEEDED, intent.Status)
+	assert.Equal(t, 2, intent.Attempts)
+
+	assert.NoError(t, repo.Resettle(ctx, "order", canonical.INTENT_CANCELLED, canonical.REASON_FORCED, now.Add(time.Hour)))
+	intent, err = repo.GetByOrderID(ctx, "order")
+	assert.NoError(t, err)
+	assert.Equal(t, canonical.INTENT_CANCELLED, intent.Status)
+	assert.Equal(t, canonical.REASON_FORCED, intent.Reason)
+
+	open, err = repo.GetOpenUpdatedBefore(ctx, now.Add(time.Minute))
+	assert.NoError(t, err)
+	assert.Empty(t, open)
+}
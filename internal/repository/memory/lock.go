@@ -0,0 +1,50 @@
+package memory
+
+import (
+	"context"
+	"sync"
+	"tech-challenge-payment/internal/canonical"
+	"tech-challenge-payment/internal/repository"
+	"time"
+)
+
+type lease struct {
+	owner     string
+	expiresAt time.Time
+}
+
+type lockRepository struct {
+	mu     sync.Mutex
+	clock  canonical.Clock
+	leases map[string]lease
+}
+
+func NewLockRepo(clock canonical.Clock) repository.LockRepository {
+	return &lockRepository{
+		clock:  clock,
+		leases: map[string]lease{},
+	}
+}
+
+func (r *lockRepository) Acquire(ctx context.Context, name, owner string, ttl time.Duration) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := r.clock.Now()
+	if current, ok := r.leases[name]; ok && current.owner != owner && now.Before(current.expiresAt) {
+		return false, nil
+	}
+	r.leases[name] = lease{owner: owner, expiresAt: now.Add(ttl)}
+
+	return true, nil
+}
+
+func (r *lockRepository) Release(ctx context.Context, name, owner string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if current, ok := r.leases[name]; ok && current.owner == owner {
+		delete(r.leases, name)
+	}
+	return nil
+}
@@ -0,0 +1,71 @@
+package memory
+
+import (
+	"context"
+	"tech-challenge-payment/internal/canonical/canonicaltest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAcquire(t *testing.T) {
+	type Given struct {
+		holder  string
+		elapsed time.Duration
+	}
+	type Expected struct {
+		acquired bool
+	}
+	tests := map[string]struct {
+		given    Given
+		expected Expected
+	}{
+		"given free lease, must acquire it": {
+			expected: Expected{acquired: true},
+		},
+		"given lease held by the owner, must renew it": {
+			given:    Given{holder: "owner"},
+			expected: Expected{acquired: true},
+		},
+		"given lease held by another owner, must not acquire it": {
+			given:    Given{holder: "other", elapsed: 59 * time.Second},
+			expected: Expected{acquired: false},
+		},
+		"given expired lease of another owner, must take it over": {
+			given:    Given{holder: "other", elapsed: time.Minute},
+			expected: Expected{acquired: true},
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			clock := canonicaltest.NewClock(time.Date(2020, 11, 1, 0, 0, 0, 0, time.UTC))
+			repo := NewLockRepo(clock)
+			if len(tc.given.holder) > 0 {
+				_, err := repo.Acquire(context.Background(), "job", tc.given.holder, time.Minute)
+				assert.NoError(t, err)
+			}
+			clock.Advance(tc.given.elapsed)
+
+			acquired, err := repo.Acquire(context.Background(), "job", "owner", time.Minute)
+
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expected.acquired, acquired)
+		})
+	}
+}
+
+func TestRelease(t *testing.T) {
+	repo := NewLockRepo(canonicaltest.NewClock(time.Date(2020, 11, 1, 0, 0, 0, 0, time.UTC)))
+	_, err := repo.Acquire(context.Background(), "job", "owner", time.Minute)
+	assert.NoError(t, err)
+
+	assert.NoError(t, repo.Release(context.Background(), "job", "other"))
+	acquired, _ := repo.Acquire(context.Background(), "job", "other", time.Minute)
+	assert.False(t, acquired)
+
+	assert.NoError(t, repo.Release(context.Background(), "job", "owner"))
+	acquired, _ = repo.Acquire(context.Background(), "job", "other", time.Minute)
+	assert.True(t, acquired)
+}
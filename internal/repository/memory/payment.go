@@ -0,0 +1,143 @@
+// Package memory keeps the repositories in process memory, with the semantics of their Mongo
+// counterparts. It backs the service when no database is at hand, as in the integration tests.
+package memory
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"sync"
+	"tech-challenge-payment/internal/canonical"
+	"tech-challenge-payment/internal/metrics"
+	"tech-challenge-payment/internal/repository"
+	"time"
+)
+
+// ErrDuplicateKey is returned when creating a document whose id is already taken.
+var ErrDuplicateKey = errors.New("duplicate key")
+
+// paymentRepository keeps the log of every payment next to the payments folded from it.
+type paymentRepository struct {
+	mu       sync.RWMutex
+	events   map[string][]canonical.PaymentEvent
+	payments map[string]canonical.Payment
+}
+
+func NewPaymentRepo() repository.PaymentRepository {
+	return &paymentRepository{
+		events:   map[string][]canonical.PaymentEvent{},
+		payments: map[string]canonical.Payment{},
+	}
+}
+
+func (r *paymentRepository) Create(ctx context.Context, payment canonical.Payment) (canonical.Payment, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.events[payment.ID]; ok {
+		return payment, ErrDuplicateKey
+	}
+	for _, event := range canonical.NewPaymentLog(payment) {
+		payment = r.append(event)
+	}
+	metrics.ObserveTransition("", payment.Status.String())
+
+	return payment, nil
+}
+
+func (r *paymentRepository) UpdateFromStatus(ctx context.Context, id string, current canonical.PaymentStatus, payment canonical.Payment) error {
+	if payment.Status == canonical.PAYMENT_CREATED {
+		return canonical.ErrorInvalidTransition
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	stored := canonical.Replay(r.events[id])
+	if stored == nil || stored.Status != current {
+		return canonical.ErrorInvalidTransition
+	}
+	payment.ID = id
+	r.append(canonical.NewPaymentEvent(payment, stored.Version+1))
+	metrics.ObserveTransition(current.String(), payment.Status.String())
+
+	return nil
+}
+
+// append must be called holding the lock.
+func (r *paymentRepository) append(event canonical.PaymentEvent) canonical.Payment {
+	r.events[event.PaymentID] = append(r.events[event.PaymentID], event)
+	payment := *canonical.Replay(r.events[event.PaymentID])
+	r.payments[event.PaymentID] = payment
+	return payment
+}
+
+func (r *paymentRepository) GetByID(ctx context.Context, id string) (*canonical.Payment, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	payment, ok := r.payments[id]
+	if !ok {
+		return nil, canonical.ErrorNotFound
+	}
+	return &payment, nil
+}
+
+// GetByOrderID returns the latest payment of the order.
+func (r *paymentRepository) GetByOrderID(ctx context.Context, orderID string) (*canonical.Payment, error) {
+	payments := r.filter(func(payment canonical.Payment) bool { return payment.OrderID == orderID })
+	if len(payments) == 0 {
+		return nil, canonical.ErrorNotFound
+	}
+
+	latest := payments[len(payments)-1]
+	return &latest, nil
+}
+
+func (r *paymentRepository) GetByStatusCreatedBefore(ctx context.Context, status canonical.PaymentStatus, before time.Time) ([]canonical.Payment, error) {
+	return r.filter(func(payment canonical.Payment) bool {
+		return payment.Status == status && payment.CreatedAt.Before(before)
+	}), nil
+}
+
+func (r *paymentRepository) GetByStatusUpdatedBefore(ctx context.Context, status canonical.PaymentStatus, before time.Time) ([]canonical.Payment, error) {
+	return r.filter(func(payment canonical.Payment) bool {
+		return payment.Status == status && payment.UpdatedAt.Before(before)
+	}), nil
+}
+
+func (r *paymentRepository) GetByCustomerID(ctx context.Context, customerID string) ([]canonical.Payment, error) {
+	return r.filter(func(payment canonical.Payment) bool { return payment.CustomerID == customerID }), nil
+}
+
+func (r *paymentRepository) Search(ctx context.Context, filter canonical.PaymentFilter) ([]canonical.Payment, error) {
+	results := r.filter(filter.Match)
+	if filter.Limit > 0 && len(results) > filter.Limit {
+		results = results[:filter.Limit]
+	}
+	return results, nil
+}
+
+func (r *paymentRepository) GetAll(ctx context.Context) ([]canonical.Payment, error) {
+	return r.filter(func(canonical.Payment) bool { return true }), nil
+}
+
+// filter lists the matching payments from the oldest to the newest.
+func (r *paymentRepository) filter(match func(canonical.Payment) bool) []canonical.Payment {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var results []canonical.Payment
+	for _, payment := range r.payments {
+		if match(payment) {
+			results = append(results, payment)
+		}
+	}
+	sort.SliceStable(results, func(i, j int) bool {
+		if results[i].CreatedAt.Equal(results[j].CreatedAt) {
+			return results[i].ID < results[j].ID
+		}
+		return results[i].CreatedAt.Before(results[j].CreatedAt)
+	})
+	return results
+}
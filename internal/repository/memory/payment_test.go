@@ -0,0 +1,150 @@
+package memory
+
+import (
+	"context"
+	"tech-challenge-payment/internal/canonical"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUpdateFromStatus(t *testing.T) {
+	type Given struct {
+		current canonical.PaymentStatus
+		id      string
+		status  canonical.PaymentStatus
+	}
+	type Expected struct {
+		err    error
+		status canonical.PaymentStatus
+	}
+	tests := map[string]struct {
+		given    Given
+		expected Expected
+	}{
+		"given payment with the current status, must update it": {
+			given:    Given{id: "1234", current: canonical.PAYMENT_CREATED, status: canonical.PAYMENT_PAYED},
+			expected: Expected{status: canonical.PAYMENT_PAYED},
+		},
+		"given payment changed meanwhile, must return invalid transition": {
+			given:    Given{id: "1234", current: canonical.PAYMENT_FAILED, status: canonical.PAYMENT_PAYED},
+			expected: Expected{err: canonical.ErrorInvalidTransition, status: canonical.PAYMENT_CREATED},
+		},
+		"given unknown payment, must return invalid transition": {
+			given:    Given{id: "4321", current: canonical.PAYMENT_CREATED, status: canonical.PAYMENT_PAYED},
+			expected: Expected{err: canonical.ErrorInvalidTransition, status: canonical.PAYMENT_CREATED},
+		},
+		"given change back to created, must return invalid transition": {
+			given:    Given{id: "1234", current: canonical.PAYMENT_CREATED, status: canonical.PAYMENT_CREATED},
+			expected: Expected{err: canonical.ErrorInvalidTransition, status: canonical.PAYMENT_CREATED},
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			repo := NewPaymentRepo()
+			_, err := repo.Create(context.Background(), canonical.Payment{ID: "1234", Status: canonical.PAYMENT_CREATED})
+			assert.NoError(t, err)
+
+			err = repo.UpdateFromStatus(context.Background(), tc.given.id, tc.given.current, canonical.Payment{Status: tc.given.status})
+
+			assert.Equal(t, tc.expected.err, err)
+			payment, err := repo.GetByID(context.Background(), "1234")
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expected.status, payment.Status)
+		})
+	}
+}
+
+func TestEventLog(t *testing.T) {
+	repo := NewPaymentRepo()
+	now := time.Date(2020, 11, 1, 12, 0, 0, 0, time.UTC)
+	details := &canonical.MethodDetails{Pix: &canonical.PixDetails{QRCode: "qr-code"}}
+
+	created, err := repo.Create(context.Background(), canonical.Payment{ID: "1234", OrderID: "order", Details: details, Status: canonical.PAYMENT_CREATED, CreatedAt: now})
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(2), created.Version)
+
+	err = repo.UpdateFromStatus(context.Background(), "1234", canonical.PAYMENT_CREATED, canonical.Payment{
+		Status:    canonical.PAYMENT_CANCELLED,
+		Reason:    canonical.REASON_REQUESTED,
+		UpdatedAt: now.Add(time.Minute),
+	})
+	assert.NoError(t, err)
+
+	events := repo.(*paymentRepository).events["1234"]
+	assert.Equal(t, []canonical.PaymentEvent{
+		{ID: "1234:1", PaymentID: "1234", Sequence: 1, Type: canonical.EVENT_PAYMENT_REQUESTED, At: now, OrderID: "order"},
+		{ID: "1234:2", PaymentID: "1234", Sequence: 2, Type: canonical.EVENT_CHARGE_CREATED, At: now, Details: details},
+		{ID: "1234:3", PaymentID: "1234", Sequence: 3, Type: canonical.EVENT_CANCELLED, Reason: canonical.REASON_REQUESTED, At: now.Add(time.Minute)},
+	}, events)
+
+	payment, err := repo.GetByID(context.Background(), "1234")
+	assert.NoError(t, err)
+	assert.Equal(t, canonical.Payment{
+		ID:        "1234",
+		OrderID:   "order",
+		Details:   details,
+		CreatedAt: now,
+		UpdatedAt: now.Add(time.Minute),
+		Status:    canonical.PAYMENT_CANCELLED,
+		Reason:    canonical.REASON_REQUESTED,
+		Version:   3,
+	}, *payment)
+}
+
+func TestQueries(t *testing.T) {
+	repo := NewPaymentRepo()
+	now := time.Now()
+	for _, payment := range []canonical.Payment{
+		{ID: "1", OrderID: "order", CustomerID: "alice", Status: canonical.PAYMENT_CREATED, CreatedAt: now.Add(-time.Hour)},
+		{ID: "2", OrderID: "order", CustomerID: "alice", Status: canonical.PAYMENT_CREATED, CreatedAt: now.Add(-time.Minute)},
+		{ID: "3", OrderID: "other", CustomerID: "bob", Status: canonical.PAYMENT_CREATED, CreatedAt: now},
+	} {
+		_, err := repo.Create(context.Background(), payment)
+		assert.NoError(t, err)
+	}
+	assert.NoError(t, repo.UpdateFromStatus(context.Background(), "1", canonical.PAYMENT_CREATED, canonical.Payment{Status: canonical.PAYMENT_FAILED, UpdatedAt: now}))
+
+	_, err := repo.Create(context.Background(), canonical.Payment{ID: "1"})
+	assert.ErrorIs(t, err, ErrDuplicateKey)
+
+	latest, err := repo.GetByOrderID(context.Background(), "order")
+	assert.NoError(t, err)
+	assert.Equal(t, "2", latest.ID)
+
+	_, err = repo.GetByOrderID(context.Background(), "missing")
+	assert.ErrorIs(t, err, canonical.ErrorNotFound)
+
+	_, err = repo.GetByID(context.Background(), "missing")
+	assert.ErrorIs(t, err, canonical.ErrorNotFound)
+
+	pending, err := repo.GetByStatusCreatedBefore(context.Background(), canonical.PAYMENT_CREATED, now)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"2"}, ids(pending))
+
+	failed, err := repo.GetByStatusUpdatedBefore(context.Background(), canonical.PAYMENT_FAILED, now.Add(time.Minute))
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"1"}, ids(failed))
+
+	owned, err := repo.GetByCustomerID(context.Background(), "alice")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"1", "2"}, ids(owned))
+
+	found, err := repo.Search(context.Background(), canonical.PaymentFilter{OrderID: "order", Limit: 1})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"1"}, ids(found))
+
+	all, err := repo.GetAll(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"1", "2", "3"}, ids(all))
+}
+
+func ids(payments []canonical.Payment) []string {
+	var result []string
+	for _, payment := range payments {
+		result = append(result, payment.ID)
+	}
+	return result
+}
@@ -0,0 +1,25 @@
+package memory
+
+import (
+	"context"
+	"sync"
+	"tech-challenge-payment/internal/canonical"
+	"tech-challenge-payment/internal/repository"
+)
+
+type reconciliationRepository struct {
+	mu      sync.Mutex
+	reports []canonical.ReconciliationReport
+}
+
+func NewReconciliationRepo() repository.ReconciliationRepository {
+	return &reconciliationRepository{}
+}
+
+func (r *reconciliationRepository) Create(ctx context.Context, report canonical.ReconciliationReport) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.reports = append(r.reports, report)
+	return nil
+}
@@ -0,0 +1,70 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"tech-challenge-payment/internal/metrics"
+	"tech-challenge-payment/internal/tracing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/event"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// commandMonitor times and traces every command sent to Mongo. Replies do not carry the
+// collection, so it is kept from the command until the reply arrives, along with its span.
+type commandMonitor struct {
+	commands sync.Map
+}
+
+type startedCommand struct {
+	collection string
+	span       trace.Span
+}
+
+func newCommandMonitor() *event.CommandMonitor {
+	m := &commandMonitor{}
+
+	return &event.CommandMonitor{
+		Started: m.started,
+		Succeeded: func(_ context.Context, e *event.CommandSucceededEvent) {
+			m.finished(e.RequestID, e.CommandName, e.Duration, nil)
+		},
+		Failed: func(_ context.Context, e *event.CommandFailedEvent) {
+			m.finished(e.RequestID, e.CommandName, e.Duration, errors.New(e.Failure))
+		},
+	}
+}
+
+func (m *commandMonitor) started(ctx context.Context, e *event.CommandStartedEvent) {
+	// the first element of a command names its collection, e.g. {"find": "payment", ...}
+	collection, ok := e.Command.Lookup(e.CommandName).StringValueOK()
+	if !ok {
+		// getMore names it apart, its first element is the cursor
+		collection, _ = e.Command.Lookup("collection").StringValueOK()
+	}
+
+	_, span := tracing.Start(ctx, e.CommandName+" "+collection,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			semconv.DBSystemMongoDB,
+			semconv.DBNamespace(e.DatabaseName),
+			semconv.DBCollectionName(collection),
+			semconv.DBOperationName(e.CommandName),
+		),
+	)
+	m.commands.Store(e.RequestID, startedCommand{collection: collection, span: span})
+}
+
+func (m *commandMonitor) finished(requestID int64, command string, duration time.Duration, err error) {
+	value, ok := m.commands.LoadAndDelete(requestID)
+	if !ok {
+		return
+	}
+	started := value.(startedCommand)
+
+	metrics.MongoDuration.WithLabelValues(started.collection, command, metrics.Result(err)).Observe(duration.Seconds())
+	tracing.End(started.span, err)
+}
@@ -0,0 +1,72 @@
+package repository
+
+import (
+	"context"
+	"tech-challenge-payment/internal/metrics"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/event"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestCommandMonitor(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	monitor := newCommandMonitor()
+
+	command := func(doc bson.D) bson.Raw {
+		raw, _ := bson.Marshal(doc)
+		return raw
+	}
+
+	monitor.Started(context.Background(), &event.CommandStartedEvent{
+		Command:      command(bson.D{{Key: "find", Value: "monitored"}}),
+		CommandName:  "find",
+		DatabaseName: "payment",
+		RequestID:    1,
+	})
+	monitor.Started(context.Background(), &event.CommandStartedEvent{
+		Command:     command(bson.D{{Key: "getMore", Value: int64(42)}, {Key: "collection", Value: "monitored"}}),
+		CommandName: "getMore",
+		RequestID:   2,
+	})
+	monitor.Succeeded(context.Background(), &event.CommandSucceededEvent{
+		CommandFinishedEvent: event.CommandFinishedEvent{CommandName: "find", RequestID: 1, Duration: time.Millisecond},
+	})
+	monitor.Failed(context.Background(), &event.CommandFailedEvent{
+		CommandFinishedEvent: event.CommandFinishedEvent{CommandName: "getMore", RequestID: 2, Duration: time.Millisecond},
+		Failure:              "cursor not found",
+	})
+
+	assert.Equal(t, uint64(1), sampleCount(t, "monitored", "find", metrics.RESULT_SUCCESS))
+	assert.Equal(t, uint64(1), sampleCount(t, "monitored", "getMore", metrics.RESULT_FAILURE))
+
+	spans := recorder.Ended()
+	assert.Len(t, spans, 2)
+	assert.Equal(t, "find monitored", spans[0].Name())
+	assert.Equal(t, trace.SpanKindClient, spans[0].SpanKind())
+	assert.Contains(t, spans[0].Attributes(), semconv.DBNamespace("payment"))
+	assert.Contains(t, spans[0].Attributes(), semconv.DBCollectionName("monitored"))
+	assert.Equal(t, codes.Unset, spans[0].Status().Code)
+	assert.Equal(t, "getMore monitored", spans[1].Name())
+	assert.Equal(t, codes.Error, spans[1].Status().Code)
+	assert.Equal(t, "cursor not found", spans[1].Status().Description)
+}
+
+func sampleCount(t *testing.T, labels ...string) uint64 {
+	var m dto.Metric
+	if err := metrics.MongoDuration.WithLabelValues(labels...).(prometheus.Histogram).Write(&m); err != nil {
+		t.Fatal(err)
+	}
+	return m.GetHistogram().GetSampleCount()
+}
@@ -4,9 +4,9 @@ import (
 	"context"
 	"errors"
 	"tech-challenge-payment/internal/canonical"
-	"tech-challenge-payment/internal/config"
+	"tech-challenge-payment/internal/metrics"
+	"time"
 
-	"github.com/rs/zerolog/log"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
@@ -18,69 +18,256 @@ const (
 )
 
 var (
-	cfg           = &config.Cfg
 	ErrorNotFound = errors.New("entity not found")
 )
 
-func NewMongo() *mongo.Database {
-	client, err := mongo.Connect(context.Background(), options.Client().ApplyURI(cfg.DB.ConnectionString))
+// NewMongo connects to the payment database, the client is meant to be shared by every repository
+// and disconnected when the service stops.
+func NewMongo(ctx context.Context, connectionString string) (*mongo.Database, error) {
+	client, err := mongo.Connect(ctx, options.Client().
+		ApplyURI(connectionString).
+		SetMonitor(newCommandMonitor()))
 	if err != nil {
-		log.Fatal().Err(err).Msg("an error occurred when try to connect to mongo")
+		return nil, err
 	}
 
-	return client.Database(database)
+	return client.Database(database), nil
 }
 
+// PaymentRepository derives the payments from their event log. Writes append to the log and
+// then save the payment into the payment collection, which reads are served from.
 type PaymentRepository interface {
 	GetByID(context.Context, string) (*canonical.Payment, error)
-	Update(ctx context.Context, id string, payment canonical.Payment) error
+	GetByOrderID(ctx context.Context, orderID string) (*canonical.Payment, error)
+	UpdateFromStatus(ctx context.Context, id string, current canonical.PaymentStatus, payment canonical.Payment) error
+	GetByStatusCreatedBefore(ctx context.Context, status canonical.PaymentStatus, before time.Time) ([]canonical.Payment, error)
+	// GetByStatusUpdatedBefore lists the payments that reached the status before the given time.
+	GetByStatusUpdatedBefore(ctx context.Context, status canonical.PaymentStatus, before time.Time) ([]canonical.Payment, error)
 	Create(ctx context.Context, payment canonical.Payment) (canonical.Payment, error)
 	GetAll(ctx context.Context) ([]canonical.Payment, error)
+	GetByCustomerID(ctx context.Context, customerID string) ([]canonical.Payment, error)
+	// Search lists the payments matching the filter from the oldest to the newest.
+	Search(ctx context.Context, filter canonical.PaymentFilter) ([]canonical.Payment, error)
 }
 
 type paymentRepository struct {
 	collection *mongo.Collection
+	events     EventStore
 }
 
-func NewPaymentRepo() PaymentRepository {
+func NewPaymentRepo(db *mongo.Database) PaymentRepository {
 	return &paymentRepository{
-		collection: NewMongo().Collection(collection),
+		collection: db.Collection(collection),
+		events:     NewEventStore(db),
 	}
 }
 
+// Create starts the log of the payment with its PaymentRequested event, followed by its
+// ChargeCreated event when it was charged.
 func (r *paymentRepository) Create(ctx context.Context, payment canonical.Payment) (canonical.Payment, error) {
+	events := canonical.NewPaymentLog(payment)
+	for _, event := range events {
+		if err := r.events.Append(ctx, event); err != nil {
+			return payment, err
+		}
+	}
 
-	_, err := r.collection.InsertOne(ctx, payment)
-	if err != nil {
+	payment = *canonical.Replay(events)
+	if err := r.project(ctx, payment); err != nil {
 		return payment, err
 	}
+	metrics.ObserveTransition("", payment.Status.String())
 	return payment, nil
-
 }
 
-func (r *paymentRepository) Update(ctx context.Context, id string, payment canonical.Payment) error {
-	filter := bson.M{"_id": id}
-	fields := bson.M{"$set": payment}
+// UpdateFromStatus appends the change to the log only while the payment, as derived from its
+// log, still has the current status, so concurrent transitions can not overwrite each other.
+// Payments can not change back to CREATED, PaymentRequested only ever starts a log.
+func (r *paymentRepository) UpdateFromStatus(ctx context.Context, id string, current canonical.PaymentStatus, payment canonical.Payment) error {
+	if payment.Status == canonical.PAYMENT_CREATED {
+		return canonical.ErrorInvalidTransition
+	}
 
-	_, err := r.collection.UpdateOne(ctx, filter, fields)
+	events, err := r.events.Load(ctx, id)
 	if err != nil {
 		return err
 	}
+	if len(events) == 0 {
+		if events, err = r.seed(ctx, id); err != nil {
+			return err
+		}
+	}
+
+	stored := canonical.Replay(events)
+	if stored == nil || stored.Status != current {
+		return canonical.ErrorInvalidTransition
+	}
+
+	payment.ID = id
+	event := canonical.NewPaymentEvent(payment, stored.Version+1)
+	if err := r.events.Append(ctx, event); err != nil {
+		if errors.Is(err, ErrorSequenceConflict) {
+			return canonical.ErrorInvalidTransition
+		}
+		return err
+	}
+
+	stored.Apply(event)
+	if err := r.project(ctx, *stored); err != nil {
+		return err
+	}
+	metrics.ObserveTransition(current.String(), payment.Status.String())
 	return nil
 }
 
+// seed starts the log of a payment saved before the log existed and loads it back, it loads
+// nothing when no such payment was saved.
+func (r *paymentRepository) seed(ctx context.Context, id string) ([]canonical.PaymentEvent, error) {
+	var payment canonical.Payment
+	err := r.collection.FindOne(ctx, bson.M{"_id": id, "version": bson.M{"$in": bson.A{nil, 0}}}).Decode(&payment)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := seedLog(ctx, r.events, payment); err != nil {
+		return nil, err
+	}
+	return r.events.Load(ctx, id)
+}
+
+// project saves the payment unless a later version of it was already saved.
+func (r *paymentRepository) project(ctx context.Context, payment canonical.Payment) error {
+	filter := bson.M{"_id": payment.ID, "version": bson.M{"$lt": payment.Version}}
+
+	_, err := r.collection.ReplaceOne(ctx, filter, payment, options.Replace().SetUpsert(true))
+	// the upsert collides with the later version
+	if mongo.IsDuplicateKeyError(err) {
+		return nil
+	}
+	return err
+}
+
 func (r *paymentRepository) GetByID(ctx context.Context, id string) (*canonical.Payment, error) {
 
 	var payment canonical.Payment
 
 	err := r.collection.FindOne(ctx, bson.D{{Key: "_id", Value: id}}).Decode(&payment)
 	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, canonical.ErrorNotFound
+		}
+		return nil, err
+	}
+
+	return &payment, nil
+}
+
+func (r *paymentRepository) GetByOrderID(ctx context.Context, orderID string) (*canonical.Payment, error) {
+	var payment canonical.Payment
+
+	opts := options.FindOne().SetSort(bson.D{{Key: "created_at", Value: -1}})
+	err := r.collection.FindOne(ctx, bson.D{{Key: "order_id", Value: orderID}}, opts).Decode(&payment)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, canonical.ErrorNotFound
+		}
 		return nil, err
 	}
 
 	return &payment, nil
 }
 
+func (r *paymentRepository) GetByStatusCreatedBefore(ctx context.Context, status canonical.PaymentStatus, before time.Time) ([]canonical.Payment, error) {
+	filter := bson.M{
+		"status":     status,
+		"created_at": bson.M{"$lt": before},
+	}
+
+	cursor, err := r.collection.Find(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+	var results []canonical.Payment
+	if err = cursor.All(ctx, &results); err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
+func (r *paymentRepository) GetByStatusUpdatedBefore(ctx context.Context, status canonical.PaymentStatus, before time.Time) ([]canonical.Payment, error) {
+	filter := bson.M{
+		"status":     status,
+		"updated_at": bson.M{"$lt": before},
+	}
+
+	cursor, err := r.collection.Find(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+	var results []canonical.Payment
+	if err = cursor.All(ctx, &results); err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
+func (r *paymentRepository) GetByCustomerID(ctx context.Context, customerID string) ([]canonical.Payment, error) {
+	cursor, err := r.collection.Find(ctx, bson.D{{Key: "customer_id", Value: customerID}})
+	if err != nil {
+		return nil, err
+	}
+
+	var results []canonical.Payment
+	if err = cursor.All(ctx, &results); err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
+func (r *paymentRepository) Search(ctx context.Context, filter canonical.PaymentFilter) ([]canonical.Payment, error) {
+	query := bson.M{}
+	if filter.Status != nil {
+		query["status"] = *filter.Status
+	}
+	if len(filter.OrderID) > 0 {
+		query["order_id"] = filter.OrderID
+	}
+	if len(filter.CustomerID) > 0 {
+		query["customer_id"] = filter.CustomerID
+	}
+	if filter.Method != canonical.METHOD_UNSPECIFIED {
+		query["method"] = filter.Method
+	}
+	createdAt := bson.M{}
+	if !filter.CreatedFrom.IsZero() {
+		createdAt["$gte"] = filter.CreatedFrom
+	}
+	if !filter.CreatedTo.IsZero() {
+		createdAt["$lt"] = filter.CreatedTo
+	}
+	if len(createdAt) > 0 {
+		query["created_at"] = createdAt
+	}
+
+	opts := options.Find().SetSort(bson.D{{Key: "created_at", Value: 1}})
+	if filter.Limit > 0 {
+		opts.SetLimit(int64(filter.Limit))
+	}
+
+	cursor, err := r.collection.Find(ctx, query, opts)
+	if err != nil {
+		return nil, err
+	}
+	var results []canonical.Payment
+	if err = cursor.All(ctx, &results); err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
 func (r *paymentRepository) GetAll(ctx context.Context) ([]canonical.Payment, error) {
 	cursor, err := r.collection.Find(context.TODO(), bson.D{{}})
 	if err != nil {
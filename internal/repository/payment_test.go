@@ -3,20 +3,19 @@ package repository
 import (
 	"context"
 	"tech-challenge-payment/internal/canonical"
+	"tech-challenge-payment/internal/metrics"
 	"testing"
 	"time"
 
+	"github.com/prometheus/client_golang/prometheus/testutil"
 	"github.com/stretchr/testify/assert"
-	"github.com/undefinedlabs/go-mpatch"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
 )
 
 func TestGetByID(t *testing.T) {
 
-	mpatch.PatchMethod(time.Now, func() time.Time {
-		return time.Date(2020, 11, 01, 00, 00, 00, 0, time.UTC)
-	})
+	now := time.Date(2020, 11, 01, 00, 00, 00, 0, time.UTC)
 
 	type Given struct {
 		mtestFunc func(mt *mtest.T)
@@ -32,36 +31,77 @@ func TestGetByID(t *testing.T) {
 				mtestFunc: func(mt *mtest.T) {
 					repo := paymentRepository{
 						collection: mt.DB.Collection("fake-collection"),
+						events:     &eventStore{collection: mt.DB.Collection("fake-events")},
 					}
 					mt.AddMockResponses(mtest.CreateCursorResponse(1, "payment.payment", mtest.FirstBatch, bson.D{
 						{Key: "_id", Value: "payment_valid"},
 						{Key: "order_id", Value: "order_valid"},
 						{Key: "payment_type", Value: 0},
-						{Key: "created_at", Value: time.Now()},
-						{Key: "updated_at", Value: time.Now()},
+						{Key: "created_at", Value: now},
+						{Key: "updated_at", Value: now},
 						{Key: "status", Value: 0},
 					}))
 					payment, err := repo.GetByID(context.Background(), "payment_valid")
 					assert.Nil(t, err)
 					assert.Equal(t, payment.ID, "payment_valid")
 					assert.Equal(t, payment.OrderID, "order_valid")
-					assert.Equal(t, payment.PaymentType, 0)
-					assert.Equal(t, payment.CreatedAt, time.Now())
-					assert.Equal(t, payment.UpdatedAt, time.Now())
+					assert.Equal(t, payment.Method, canonical.METHOD_UNSPECIFIED)
+					assert.Equal(t, payment.CreatedAt, now)
+					assert.Equal(t, payment.UpdatedAt, now)
 					assert.Equal(t, payment.Status, canonical.PAYMENT_CREATED)
 				},
 			},
 		},
+		"given payment saved before methods existed, must not read its payment_type as a method": {
+			given: Given{
+				mtestFunc: func(mt *mtest.T) {
+					repo := paymentRepository{
+						collection: mt.DB.Collection("fake-collection"),
+						events:     &eventStore{collection: mt.DB.Collection("fake-events")},
+					}
+					mt.AddMockResponses(mtest.CreateCursorResponse(1, "payment.payment", mtest.FirstBatch, bson.D{
+						{Key: "_id", Value: "payment_legacy"},
+						{Key: "order_id", Value: "order_legacy"},
+						{Key: "payment_type", Value: 3},
+						{Key: "status", Value: 0},
+					}))
+					payment, err := repo.GetByID(context.Background(), "payment_legacy")
+					assert.Nil(t, err)
+					assert.Equal(t, canonical.METHOD_UNSPECIFIED, payment.Method)
+				},
+			},
+		},
+		"given payment with a method, must return it": {
+			given: Given{
+				mtestFunc: func(mt *mtest.T) {
+					repo := paymentRepository{
+						collection: mt.DB.Collection("fake-collection"),
+						events:     &eventStore{collection: mt.DB.Collection("fake-events")},
+					}
+					mt.AddMockResponses(mtest.CreateCursorResponse(1, "payment.payment", mtest.FirstBatch, bson.D{
+						{Key: "_id", Value: "payment_boleto"},
+						{Key: "order_id", Value: "order_boleto"},
+						{Key: "payment_type", Value: 3},
+						{Key: "method", Value: canonical.METHOD_BOLETO},
+						{Key: "status", Value: 0},
+					}))
+					payment, err := repo.GetByID(context.Background(), "payment_boleto")
+					assert.Nil(t, err)
+					assert.Equal(t, canonical.METHOD_BOLETO, payment.Method)
+				},
+			},
+		},
 		"given entity not found must return error": {
 			given: Given{
 				mtestFunc: func(mt *mtest.T) {
 					repo := paymentRepository{
 						collection: mt.DB.Collection("fake-collection"),
+						events:     &eventStore{collection: mt.DB.Collection("fake-events")},
 					}
 					mt.AddMockResponses(mtest.CreateCursorResponse(0, "payment.payment", mtest.FirstBatch))
 					payment, err := repo.GetByID(context.Background(), "asd")
 					assert.NotNil(t, err)
-					assert.Equal(t, err.Error(), "mongo: no documents in result")
+					assert.ErrorIs(t, err, canonical.ErrorNotFound)
 					assert.Nil(t, payment)
 				},
 			},
@@ -76,9 +116,7 @@ func TestGetByID(t *testing.T) {
 
 func TestGetAll(t *testing.T) {
 
-	mpatch.PatchMethod(time.Now, func() time.Time {
-		return time.Date(2020, 11, 01, 00, 00, 00, 0, time.UTC)
-	})
+	now := time.Date(2020, 11, 01, 00, 00, 00, 0, time.UTC)
 
 	type Given struct {
 		mtestFunc func(mt *mtest.T)
@@ -94,21 +132,22 @@ func TestGetAll(t *testing.T) {
 				mtestFunc: func(mt *mtest.T) {
 					repo := paymentRepository{
 						collection: mt.DB.Collection("fake-collection"),
+						events:     &eventStore{collection: mt.DB.Collection("fake-events")},
 					}
 					first := mtest.CreateCursorResponse(1, "payment.payment", mtest.FirstBatch, bson.D{
 						{Key: "_id", Value: "payment_valid"},
 						{Key: "order_id", Value: "order_valid"},
 						{Key: "payment_type", Value: 0},
-						{Key: "created_at", Value: time.Now()},
-						{Key: "updated_at", Value: time.Now()},
+						{Key: "created_at", Value: now},
+						{Key: "updated_at", Value: now},
 						{Key: "status", Value: 0},
 					})
 					getMore := mtest.CreateCursorResponse(1, "payment.payment", mtest.NextBatch, bson.D{
 						{Key: "_id", Value: "payment_valid"},
 						{Key: "order_id", Value: "order_valid"},
 						{Key: "payment_type", Value: 0},
-						{Key: "created_at", Value: time.Now()},
-						{Key: "updated_at", Value: time.Now()},
+						{Key: "created_at", Value: now},
+						{Key: "updated_at", Value: now},
 						{Key: "status", Value: 0},
 					})
 
@@ -119,9 +158,9 @@ func TestGetAll(t *testing.T) {
 					for _, payment := range payments {
 						assert.Equal(t, payment.ID, "payment_valid")
 						assert.Equal(t, payment.OrderID, "order_valid")
-						assert.Equal(t, payment.PaymentType, 0)
-						assert.Equal(t, payment.CreatedAt, time.Now())
-						assert.Equal(t, payment.UpdatedAt, time.Now())
+						assert.Equal(t, payment.Method, canonical.METHOD_UNSPECIFIED)
+						assert.Equal(t, payment.CreatedAt, now)
+						assert.Equal(t, payment.UpdatedAt, now)
 						assert.Equal(t, payment.Status, canonical.PAYMENT_CREATED)
 					}
 				},
@@ -132,6 +171,7 @@ func TestGetAll(t *testing.T) {
 				mtestFunc: func(mt *mtest.T) {
 					repo := paymentRepository{
 						collection: mt.DB.Collection("fake-collection"),
+						events:     &eventStore{collection: mt.DB.Collection("fake-events")},
 					}
 					mt.AddMockResponses(mtest.CreateWriteErrorsResponse(mtest.WriteError{Message: "mongo: no documents in result"}))
 					payment, err := repo.GetAll(context.Background())
@@ -151,9 +191,7 @@ func TestGetAll(t *testing.T) {
 
 func TestCreate(t *testing.T) {
 
-	mpatch.PatchMethod(time.Now, func() time.Time {
-		return time.Date(2020, 11, 01, 00, 00, 00, 0, time.UTC)
-	})
+	now := time.Date(2020, 11, 01, 00, 00, 00, 0, time.UTC)
 
 	type Given struct {
 		mtestFunc func(mt *mtest.T)
@@ -169,21 +207,22 @@ func TestCreate(t *testing.T) {
 				mtestFunc: func(mt *mtest.T) {
 					repo := paymentRepository{
 						collection: mt.DB.Collection("fake-collection"),
+						events:     &eventStore{collection: mt.DB.Collection("fake-events")},
 					}
-					mt.AddMockResponses(mtest.CreateSuccessResponse())
+					mt.AddMockResponses(mtest.CreateSuccessResponse(), mtest.CreateSuccessResponse())
 
 					tPayment := canonical.Payment{
-						ID:          "payment_valid",
-						OrderID:     "order_valid",
-						PaymentType: 0,
-						CreatedAt:   time.Now(),
-						UpdatedAt:   time.Now(),
-						Status:      canonical.PAYMENT_CREATED,
+						ID:        "payment_valid",
+						OrderID:   "order_valid",
+						Method:    canonical.METHOD_UNSPECIFIED,
+						CreatedAt: now,
+						Status:    canonical.PAYMENT_CREATED,
 					}
 
 					payment, err := repo.Create(context.Background(), tPayment)
 
 					assert.Nil(t, err)
+					tPayment.Version = 1
 					assert.Equal(t, payment, tPayment)
 
 				},
@@ -194,6 +233,7 @@ func TestCreate(t *testing.T) {
 				mtestFunc: func(mt *mtest.T) {
 					repo := paymentRepository{
 						collection: mt.DB.Collection("fake-collection"),
+						events:     &eventStore{collection: mt.DB.Collection("fake-events")},
 					}
 					mt.AddMockResponses(
 						bson.D{
@@ -202,12 +242,12 @@ func TestCreate(t *testing.T) {
 					)
 
 					tPayment := canonical.Payment{
-						ID:          "payment_valid",
-						OrderID:     "order_valid",
-						PaymentType: 0,
-						CreatedAt:   time.Now(),
-						UpdatedAt:   time.Now(),
-						Status:      canonical.PAYMENT_CREATED,
+						ID:        "payment_valid",
+						OrderID:   "order_valid",
+						Method:    canonical.METHOD_UNSPECIFIED,
+						CreatedAt: now,
+						UpdatedAt: now,
+						Status:    canonical.PAYMENT_CREATED,
 					}
 
 					payment, err := repo.Create(context.Background(), tPayment)
@@ -226,79 +266,43 @@ func TestCreate(t *testing.T) {
 	}
 }
 
-func TestUpdate(t *testing.T) {
-
-	mpatch.PatchMethod(time.Now, func() time.Time {
-		return time.Date(2020, 11, 01, 00, 00, 00, 0, time.UTC)
-	})
-
+func TestGetByOrderID(t *testing.T) {
 	type Given struct {
 		mtestFunc func(mt *mtest.T)
 	}
-	type Expected struct {
-	}
 	tests := map[string]struct {
-		given    Given
-		expected Expected
+		given Given
 	}{
-		"given given no error updating must return no error": {
+		"given payment linked to the order, must return it": {
 			given: Given{
 				mtestFunc: func(mt *mtest.T) {
 					repo := paymentRepository{
 						collection: mt.DB.Collection("fake-collection"),
+						events:     &eventStore{collection: mt.DB.Collection("fake-events")},
 					}
-					mt.AddMockResponses(bson.D{
-						{Key: "ok", Value: 1},
-						{Key: "value", Value: bson.D{
-							{Key: "_id", Value: "payment_valid"},
-							{Key: "order_id", Value: "order_valid"},
-							{Key: "payment_type", Value: 0},
-							{Key: "created_at", Value: time.Now()},
-							{Key: "updated_at", Value: time.Now()},
-							{Key: "status", Value: 0},
-						}},
-					})
-
-					tPayment := canonical.Payment{
-						ID:          "payment_valid",
-						OrderID:     "order_valid",
-						PaymentType: 0,
-						CreatedAt:   time.Now(),
-						UpdatedAt:   time.Now(),
-						Status:      canonical.PAYMENT_CREATED,
-					}
-
-					err := repo.Update(context.Background(), "payment_valid", tPayment)
-
+					mt.AddMockResponses(mtest.CreateCursorResponse(1, "payment.payment", mtest.FirstBatch, bson.D{
+						{Key: "_id", Value: "payment_valid"},
+						{Key: "order_id", Value: "order_valid"},
+						{Key: "status", Value: 0},
+					}))
+					payment, err := repo.GetByOrderID(context.Background(), "order_valid")
 					assert.Nil(t, err)
-
+					assert.Equal(t, "payment_valid", payment.ID)
+					assert.Equal(t, "order_valid", payment.OrderID)
 				},
 			},
 		},
-		"given error saving must return error": {
+		"given no payment linked to the order, must return not found": {
 			given: Given{
 				mtestFunc: func(mt *mtest.T) {
 					repo := paymentRepository{
 						collection: mt.DB.Collection("fake-collection"),
+						events:     &eventStore{collection: mt.DB.Collection("fake-events")},
 					}
-					mt.AddMockResponses(
-						bson.D{
-							{Key: "ok", Value: -1},
-						},
-					)
-					tPayment := canonical.Payment{
-						ID:          "payment_valid",
-						OrderID:     "order_valid",
-						PaymentType: 0,
-						CreatedAt:   time.Now(),
-						UpdatedAt:   time.Now(),
-						Status:      canonical.PAYMENT_CREATED,
-					}
-
-					err := repo.Update(context.Background(), "payment_valid", tPayment)
-
-					assert.NotNil(t, err)
-
+					mt.AddMockResponses(mtest.CreateCursorResponse(0, "payment.payment", mtest.FirstBatch))
+					payment, err := repo.GetByOrderID(context.Background(), "order_valid")
+					assert.ErrorIs(t, err, canonical.ErrorNotFound)
+					assert.Nil(t, payment)
 				},
 			},
 		},
@@ -309,3 +313,207 @@ func TestUpdate(t *testing.T) {
 		db.Run("", tc.given.mtestFunc)
 	}
 }
+
+func TestUpdateFromStatus(t *testing.T) {
+	type Given struct {
+		responses []bson.D
+	}
+	type Expected struct {
+		err         error
+		transitions float64
+	}
+	tests := map[string]struct {
+		given    Given
+		expected Expected
+	}{
+		"given payment still in expected status, must append the event and project it": {
+			given: Given{
+				responses: []bson.D{
+					mtest.CreateCursorResponse(0, "payment.payment_event", mtest.FirstBatch, eventDocument(1, canonical.EVENT_PAYMENT_REQUESTED)),
+					mtest.CreateSuccessResponse(),
+					mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 1}, bson.E{Key: "nModified", Value: 1}),
+				},
+			},
+			expected: Expected{transitions: 1},
+		},
+		"given payment whose log moved on meanwhile, must return invalid transition": {
+			given: Given{
+				responses: []bson.D{
+					mtest.CreateCursorResponse(0, "payment.payment_event", mtest.FirstBatch,
+						eventDocument(1, canonical.EVENT_PAYMENT_REQUESTED),
+						eventDocument(2, canonical.EVENT_FAILED),
+					),
+				},
+			},
+			expected: Expected{err: canonical.ErrorInvalidTransition},
+		},
+		"given another writer taking the sequence first, must return invalid transition": {
+			given: Given{
+				responses: []bson.D{
+					mtest.CreateCursorResponse(0, "payment.payment_event", mtest.FirstBatch, eventDocument(1, canonical.EVENT_PAYMENT_REQUESTED)),
+					mtest.CreateWriteErrorsResponse(mtest.WriteError{Code: 11000, Message: "duplicate key"}),
+				},
+			},
+			expected: Expected{err: canonical.ErrorInvalidTransition},
+		},
+		"given payment saved before the log existed, must seed its log and append the event": {
+			given: Given{
+				responses: []bson.D{
+					mtest.CreateCursorResponse(0, "payment.payment_event", mtest.FirstBatch),
+					mtest.CreateCursorResponse(0, "payment.payment", mtest.FirstBatch, bson.D{
+						{Key: "_id", Value: "payment_valid"},
+						{Key: "status", Value: canonical.PAYMENT_CREATED},
+					}),
+					mtest.CreateSuccessResponse(),
+					mtest.CreateCursorResponse(0, "payment.payment_event", mtest.FirstBatch, eventDocument(1, canonical.EVENT_PAYMENT_REQUESTED)),
+					mtest.CreateSuccessResponse(),
+					mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 1}, bson.E{Key: "nModified", Value: 1}),
+				},
+			},
+			expected: Expected{transitions: 1},
+		},
+		"given payment without events nor saved document, must return invalid transition": {
+			given: Given{
+				responses: []bson.D{
+					mtest.CreateCursorResponse(0, "payment.payment_event", mtest.FirstBatch),
+					mtest.CreateCursorResponse(0, "payment.payment", mtest.FirstBatch),
+				},
+			},
+			expected: Expected{err: canonical.ErrorInvalidTransition},
+		},
+	}
+
+	for name, tc := range tests {
+		db := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+		db.Run(name, func(mt *mtest.T) {
+			repo := paymentRepository{
+				collection: mt.DB.Collection("fake-collection"),
+				events:     &eventStore{collection: mt.DB.Collection("fake-events")},
+			}
+			mt.AddMockResponses(tc.given.responses...)
+			transitions := metrics.PaymentTransitions.WithLabelValues("CREATED", "EXPIRED")
+			before := testutil.ToFloat64(transitions)
+
+			err := repo.UpdateFromStatus(context.Background(), "payment_valid", canonical.PAYMENT_CREATED, canonical.Payment{
+				ID:     "payment_valid",
+				Status: canonical.PAYMENT_EXPIRED,
+			})
+
+			assert.Equal(t, tc.expected.err, err)
+			assert.Equal(t, before+tc.expected.transitions, testutil.ToFloat64(transitions))
+		})
+	}
+}
+
+func eventDocument(sequence int, eventType canonical.PaymentEventType) bson.D {
+	return bson.D{
+		{Key: "_id", Value: canonical.EventID("payment_valid", uint64(sequence))},
+		{Key: "payment_id", Value: "payment_valid"},
+		{Key: "sequence", Value: sequence},
+		{Key: "type", Value: eventType},
+	}
+}
+
+func TestGetByStatusCreatedBefore(t *testing.T) {
+	db := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	db.Run("", func(mt *mtest.T) {
+		repo := paymentRepository{
+			collection: mt.DB.Collection("fake-collection"),
+		}
+		mt.AddMockResponses(
+			mtest.CreateCursorResponse(1, "payment.payment", mtest.FirstBatch, bson.D{
+				{Key: "_id", Value: "payment_valid"},
+				{Key: "order_id", Value: "order_valid"},
+				{Key: "status", Value: 0},
+			}),
+			mtest.CreateCursorResponse(0, "payment.payment", mtest.NextBatch),
+		)
+
+		payments, err := repo.GetByStatusCreatedBefore(context.Background(), canonical.PAYMENT_CREATED, time.Now())
+
+		assert.Nil(t, err)
+		assert.Len(t, payments, 1)
+		assert.Equal(t, "payment_valid", payments[0].ID)
+	})
+}
+
+func TestGetByStatusUpdatedBefore(t *testing.T) {
+	db := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	db.Run("", func(mt *mtest.T) {
+		repo := paymentRepository{
+			collection: mt.DB.Collection("fake-collection"),
+		}
+		mt.AddMockResponses(
+			mtest.CreateCursorResponse(0, "payment.payment", mtest.FirstBatch, bson.D{
+				{Key: "_id", Value: "payment_valid"},
+				{Key: "order_id", Value: "order_valid"},
+				{Key: "status", Value: canonical.PAYMENT_AUTHORIZED},
+			}),
+		)
+
+		payments, err := repo.GetByStatusUpdatedBefore(context.Background(), canonical.PAYMENT_AUTHORIZED, time.Now())
+
+		assert.Nil(t, err)
+		assert.Len(t, payments, 1)
+		assert.Equal(t, canonical.PAYMENT_AUTHORIZED, payments[0].Status)
+	})
+}
+
+func TestSearch(t *testing.T) {
+	db := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	db.Run("", func(mt *mtest.T) {
+		repo := paymentRepository{
+			collection: mt.DB.Collection("fake-collection"),
+		}
+		mt.AddMockResponses(
+			mtest.CreateCursorResponse(0, "payment.payment", mtest.FirstBatch, bson.D{
+				{Key: "_id", Value: "payment_valid"},
+				{Key: "order_id", Value: "order_valid"},
+				{Key: "method", Value: canonical.METHOD_CASH},
+				{Key: "status", Value: canonical.PAYMENT_PAYED},
+			}),
+		)
+		payed := canonical.PAYMENT_PAYED
+
+		payments, err := repo.Search(context.Background(), canonical.PaymentFilter{
+			Status:      &payed,
+			Method:      canonical.METHOD_CASH,
+			CreatedFrom: time.Now().Add(-time.Hour),
+			Limit:       10,
+		})
+
+		assert.Nil(t, err)
+		assert.Len(t, payments, 1)
+		assert.Equal(t, "payment_valid", payments[0].ID)
+		started := mt.GetStartedEvent()
+		assert.Equal(t, "find", started.CommandName)
+		filter := started.Command.Lookup("filter").Document()
+		assert.Equal(t, int32(canonical.PAYMENT_PAYED), filter.Lookup("status").Int32())
+		assert.Equal(t, int32(canonical.METHOD_CASH), filter.Lookup("method").Int32())
+		assert.Equal(t, int64(10), started.Command.Lookup("limit").Int64())
+	})
+}
+
+func TestGetByCustomerID(t *testing.T) {
+	db := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	db.Run("", func(mt *mtest.T) {
+		repo := paymentRepository{
+			collection: mt.DB.Collection("fake-collection"),
+		}
+		mt.AddMockResponses(
+			mtest.CreateCursorResponse(1, "payment.payment", mtest.FirstBatch, bson.D{
+				{Key: "_id", Value: "payment_valid"},
+				{Key: "order_id", Value: "order_valid"},
+				{Key: "customer_id", Value: "customer"},
+				{Key: "status", Value: 0},
+			}),
+			mtest.CreateCursorResponse(0, "payment.payment", mtest.NextBatch),
+		)
+
+		payments, err := repo.GetByCustomerID(context.Background(), "customer")
+
+		assert.Nil(t, err)
+		assert.Len(t, payments, 1)
+		assert.Equal(t, "customer", payments[0].CustomerID)
+	})
+}
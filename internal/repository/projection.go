@@ -0,0 +1,113 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"tech-challenge-payment/internal/canonical"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// PaymentProjector rebuilds the payment collection from the event log, after a bug in the
+// projection or to recover payments lost from the collection.
+type PaymentProjector interface {
+	// Rebuild saves every payment as folded from its events and returns how many it saved.
+	// Payments saved before the log existed get their log seeded from the saved document first,
+	// the payment repository seeds them too on their first change.
+	Rebuild(ctx context.Context) (int, error)
+}
+
+type paymentProjector struct {
+	collection *mongo.Collection
+	events     EventStore
+}
+
+func NewPaymentProjector(db *mongo.Database) PaymentProjector {
+	return &paymentProjector{
+		collection: db.Collection(collection),
+		events:     NewEventStore(db),
+	}
+}
+
+func (p *paymentProjector) Rebuild(ctx context.Context) (int, error) {
+	if err := p.seed(ctx); err != nil {
+		return 0, err
+	}
+
+	var (
+		saved   int
+		payment *canonical.Payment
+	)
+	save := func() error {
+		if payment == nil {
+			return nil
+		}
+		_, err := p.collection.ReplaceOne(ctx, bson.M{"_id": payment.ID}, *payment, options.Replace().SetUpsert(true))
+		if err != nil {
+			return err
+		}
+		saved++
+		return nil
+	}
+
+	err := p.events.Replay(ctx, func(event canonical.PaymentEvent) error {
+		if payment != nil && payment.ID != event.PaymentID {
+			if err := save(); err != nil {
+				return err
+			}
+			payment = nil
+		}
+		if payment == nil {
+			payment = &canonical.Payment{}
+		}
+		payment.Apply(event)
+		return nil
+	})
+	if err != nil {
+		return saved, err
+	}
+
+	return saved, save()
+}
+
+// seed appends the events leading to the saved status of every payment without a log.
+func (p *paymentProjector) seed(ctx context.Context) error {
+	cursor, err := p.collection.Find(ctx, bson.M{"version": bson.M{"$in": bson.A{nil, 0}}})
+	if err != nil {
+		return err
+	}
+
+	var payments []canonical.Payment
+	if err = cursor.All(ctx, &payments); err != nil {
+		return err
+	}
+
+	for _, payment := range payments {
+		if err := seedLog(ctx, p.events, payment); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// seedLog appends the events leading to the saved status of a payment saved before the log
+// existed. Events already appended by a previous seed, stopped halfway or racing this one, are
+// left as they are.
+func seedLog(ctx context.Context, events EventStore, payment canonical.Payment) error {
+	requested := payment
+	requested.Status = canonical.PAYMENT_CREATED
+	requested.Reason = ""
+	log := canonical.NewPaymentLog(requested)
+	if payment.Status != canonical.PAYMENT_CREATED {
+		log = append(log, canonical.NewPaymentEvent(payment, uint64(len(log)+1)))
+	}
+
+	for _, event := range log {
+		if err := events.Append(ctx, event); err != nil && !errors.Is(err, ErrorSequenceConflict) {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,62 @@
+package repository
+
+import (
+	"context"
+	"tech-challenge-payment/internal/canonical"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+func TestRebuild(t *testing.T) {
+	db := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	db.Run("", func(mt *mtest.T) {
+		projector := paymentProjector{
+			collection: mt.DB.Collection("fake-collection"),
+			events:     &eventStore{collection: mt.DB.Collection("fake-events")},
+		}
+		mt.AddMockResponses(
+			// a payment saved before the log existed
+			mtest.CreateCursorResponse(0, "payment.payment", mtest.FirstBatch, bson.D{
+				{Key: "_id", Value: "legacy"},
+				{Key: "order_id", Value: "order"},
+				{Key: "status", Value: canonical.PAYMENT_FAILED},
+				{Key: "reason", Value: canonical.REASON_PROVIDER_FAILURE},
+			}),
+			mtest.CreateSuccessResponse(),
+			mtest.CreateSuccessResponse(),
+			mtest.CreateCursorResponse(0, "payment.payment_event", mtest.FirstBatch,
+				bson.D{{Key: "_id", Value: "legacy:1"}, {Key: "payment_id", Value: "legacy"}, {Key: "sequence", Value: 1}, {Key: "type", Value: canonical.EVENT_PAYMENT_REQUESTED}},
+				bson.D{{Key: "_id", Value: "legacy:2"}, {Key: "payment_id", Value: "legacy"}, {Key: "sequence", Value: 2}, {Key: "type", Value: canonical.EVENT_FAILED}},
+				bson.D{{Key: "_id", Value: "other:1"}, {Key: "payment_id", Value: "other"}, {Key: "sequence", Value: 1}, {Key: "type", Value: canonical.EVENT_PAYMENT_REQUESTED}},
+			),
+			mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 1}),
+			mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 1}),
+		)
+
+		saved, err := projector.Rebuild(context.Background())
+
+		assert.Nil(t, err)
+		assert.Equal(t, 2, saved)
+
+		var commands []string
+		var seeded []canonical.PaymentEvent
+		for _, started := range mt.GetAllStartedEvents() {
+			commands = append(commands, started.CommandName)
+			if started.CommandName == "insert" {
+				var event canonical.PaymentEvent
+				assert.NoError(t, bson.Unmarshal(started.Command.Lookup("documents", "0").Document(), &event))
+				seeded = append(seeded, event)
+			}
+		}
+		assert.Equal(t, []string{"find", "insert", "insert", "find", "update", "update"}, commands)
+		if assert.Len(t, seeded, 2) {
+			assert.Equal(t, canonical.EVENT_PAYMENT_REQUESTED, seeded[0].Type)
+			assert.Equal(t, "order", seeded[0].OrderID)
+			assert.Equal(t, canonical.EVENT_FAILED, seeded[1].Type)
+			assert.Equal(t, canonical.REASON_PROVIDER_FAILURE, seeded[1].Reason)
+		}
+	})
+}
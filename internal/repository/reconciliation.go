@@ -0,0 +1,31 @@
+package repository
+
+import (
+	"context"
+	"tech-challenge-payment/internal/canonical"
+
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+const (
+	reconciliationCollection = "reconciliation_report"
+)
+
+type ReconciliationRepository interface {
+	Create(ctx context.Context, report canonical.ReconciliationReport) error
+}
+
+type reconciliationRepository struct {
+	collection *mongo.Collection
+}
+
+func NewReconciliationRepo(db *mongo.Database) ReconciliationRepository {
+	return &reconciliationRepository{
+		collection: db.Collection(reconciliationCollection),
+	}
+}
+
+func (r *reconciliationRepository) Create(ctx context.Context, report canonical.ReconciliationReport) error {
+	_, err := r.collection.InsertOne(ctx, report)
+	return err
+}
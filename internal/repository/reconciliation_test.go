@@ -0,0 +1,54 @@
+package repository
+
+import (
+	"context"
+	"tech-challenge-payment/internal/canonical"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+func TestCreateReport(t *testing.T) {
+	type Given struct {
+		mtestFunc func(mt *mtest.T)
+	}
+	tests := map[string]struct {
+		given Given
+	}{
+		"given no error saving must return no error": {
+			given: Given{
+				mtestFunc: func(mt *mtest.T) {
+					repo := reconciliationRepository{
+						collection: mt.DB.Collection("fake-collection"),
+					}
+					mt.AddMockResponses(mtest.CreateSuccessResponse())
+
+					err := repo.Create(context.Background(), canonical.ReconciliationReport{ID: "report"})
+
+					assert.Nil(t, err)
+				},
+			},
+		},
+		"given error saving must return error": {
+			given: Given{
+				mtestFunc: func(mt *mtest.T) {
+					repo := reconciliationRepository{
+						collection: mt.DB.Collection("fake-collection"),
+					}
+					mt.AddMockResponses(bson.D{{Key: "ok", Value: -1}})
+
+					err := repo.Create(context.Background(), canonical.ReconciliationReport{ID: "report"})
+
+					assert.NotNil(t, err)
+				},
+			},
+		},
+	}
+
+	for _, tc := range tests {
+		db := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+		db.Run("", tc.given.mtestFunc)
+	}
+}
@@ -0,0 +1,134 @@
+package service
+
+import (
+	"context"
+	"strings"
+	"tech-challenge-payment/internal/auth/principal"
+	"tech-challenge-payment/internal/canonical"
+)
+
+// Search is meant for operators, callers authenticated as a principal need the admin scope.
+func (s *paymentService) Search(ctx context.Context, filter canonical.PaymentFilter) ([]canonical.Payment, error) {
+	if p, ok := principal.FromContext(ctx); ok && !p.HasScopes(principal.SCOPE_ADMIN) {
+		return nil, canonical.ErrorForbidden
+	}
+
+	return s.repo.Search(ctx, filter)
+}
+
+// ForceStatus skips the provider and the transition rules, it is meant for operators fixing
+// payments whose status is known to be wrong. The order service hears about the new status as
+// if the provider had reported it, and when the intent of the order was already settled by the
+// payment, the intent is settled again with the new outcome.
+func (s *paymentService) ForceStatus(ctx context.Context, paymentId string, status canonical.PaymentStatus, note string) (*canonical.Payment, error) {
+	if len(strings.TrimSpace(note)) == 0 {
+		return nil, canonical.ErrorReasonRequired
+	}
+
+	payment, err := s.GetByID(ctx, paymentId)
+	if err != nil {
+		return nil, err
+	}
+
+	if payment == nil {
+		return nil, canonical.ErrorNotFound
+	}
+
+	// payments only start as pending, their log can not be started over
+	if payment.Status == status || status == canonical.PAYMENT_CREATED {
+		return nil, canonical.ErrorInvalidTransition
+	}
+	// only cards can hold an amount
+	if status == canonical.PAYMENT_AUTHORIZED && !payment.Method.IsCard() {
+		return nil, canonical.ErrorInvalidTransition
+	}
+
+	var settled *canonical.PaymentIntent
+	if payment.Attempt > 0 {
+		intent, err := s.intents.GetByOrderID(ctx, payment.OrderID)
+		if err != nil {
+			return nil, err
+		}
+		// earlier attempts did not settle the intent
+		if intent.Status != canonical.INTENT_OPEN && payment.Attempt == intent.Attempts {
+			settled = intent
+		}
+	}
+
+	err = s.change(ctx, payment, status, canonical.REASON_FORCED, actor(ctx), "", note)
+	if err != nil {
+		return nil, err
+	}
+
+	// notify only settles open intents
+	if settled != nil && status.IsFinal() && status != canonical.PAYMENT_REFUNDED {
+		if err := s.resettle(ctx, *settled, *payment); err != nil {
+			return nil, err
+		}
+	}
+
+	return payment, nil
+}
+
+// resettle settles the intent again with the outcome of the payment's forced status, and tells
+// the order service when the outcome changed.
+func (s *paymentService) resettle(ctx context.Context, intent canonical.PaymentIntent, payment canonical.Payment) error {
+	status, queue := canonical.INTENT_CANCELLED, s.statusToQueue[canonical.PAYMENT_CANCELLED]
+	if payment.Status == canonical.PAYMENT_PAYED {
+		status, queue = canonical.INTENT_SUCCEEDED, s.statusToQueue[canonical.PAYMENT_PAYED]
+	}
+	// the order service already heard about this outcome
+	if intent.Status == status {
+		return nil
+	}
+
+	err := s.intents.Resettle(ctx, payment.OrderID, status, payment.Reason, s.clock.Now())
+	if err != nil {
+		return err
+	}
+
+	return s.publish(ctx, payment.OrderID, queue, payment.Reason)
+}
+
+// Republish is for events lost on the way to the order service. Payments of an intent send the
+// event that settled the intent, as it is the only one the order service was ever sent.
+func (s *paymentService) Republish(ctx context.Context, paymentId string) (*canonical.Payment, error) {
+	payment, err := s.GetByID(ctx, paymentId)
+	if err != nil {
+		return nil, err
+	}
+
+	if payment == nil {
+		return nil, canonical.ErrorNotFound
+	}
+
+	// pending payments have no event yet, refunded ones never had one
+	if !payment.Status.IsFinal() || payment.Status == canonical.PAYMENT_REFUNDED {
+		return nil, canonical.ErrorInvalidTransition
+	}
+
+	queue, reason := s.statusToQueue[payment.Status], payment.Reason
+	if payment.Attempt > 0 {
+		intent, err := s.intents.GetByOrderID(ctx, payment.OrderID)
+		if err != nil {
+			return nil, err
+		}
+
+		switch intent.Status {
+		case canonical.INTENT_OPEN:
+			return nil, canonical.ErrorInvalidTransition
+		case canonical.INTENT_SUCCEEDED:
+			queue = s.statusToQueue[canonical.PAYMENT_PAYED]
+		default:
+			queue = s.statusToQueue[canonical.PAYMENT_CANCELLED]
+		}
+		reason = intent.Reason
+	}
+
+	err = s.publish(ctx, payment.OrderID, queue, reason)
+	if err != nil {
+		return nil, err
+	}
+
+	return payment, nil
+}
@@ -0,0 +1,307 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"tech-challenge-payment/internal/auth/principal"
+	"tech-challenge-payment/internal/canonical"
+	"tech-challenge-payment/internal/canonical/canonicaltest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func newAdminService(repoMock *PaymentRepositoryMock, intentMock *IntentRepositoryMock, auditMock *AuditRepositoryMock, pubMock *PublisherMock) paymentService {
+	return paymentService{
+		repo:      repoMock,
+		intents:   intentMock,
+		audits:    auditMock,
+		publisher: pubMock,
+		providers: &ProviderMock{},
+		hub:       newHubMock(),
+		clock:     canonicaltest.NewClock(now),
+		ids:       canonicaltest.NewIDs("audit"),
+		statusToQueue: map[canonical.PaymentStatus]string{
+			canonical.PAYMENT_PAYED:     "payed",
+			canonical.PAYMENT_FAILED:    "cancelled",
+			canonical.PAYMENT_CANCELLED: "cancelled",
+			canonical.PAYMENT_EXPIRED:   "cancelled",
+		},
+	}
+}
+
+func TestSearch(t *testing.T) {
+	payed := canonical.PAYMENT_PAYED
+	filter := canonical.PaymentFilter{Status: &payed, Limit: 10}
+
+	t.Run("given no principal, must search the repository", func(t *testing.T) {
+		repoMock := &PaymentRepositoryMock{}
+		repoMock.On("Search", mock.Anything, filter).Return([]canonical.Payment{{ID: "1234"}}, nil)
+		paymentSvc := newAdminService(repoMock, &IntentRepositoryMock{}, newAuditMock(), new(PublisherMock))
+
+		payments, err := paymentSvc.Search(context.Background(), filter)
+
+		assert.NoError(t, err)
+		assert.Len(t, payments, 1)
+	})
+
+	t.Run("given principal without the admin scope, must return forbidden", func(t *testing.T) {
+		ctx := principal.NewContext(context.Background(), principal.Principal{Subject: "order-service", Scopes: []string{principal.SCOPE_READ}})
+		repoMock := &PaymentRepositoryMock{}
+		paymentSvc := newAdminService(repoMock, &IntentRepositoryMock{}, newAuditMock(), new(PublisherMock))
+
+		_, err := paymentSvc.Search(ctx, filter)
+
+		assert.ErrorIs(t, err, canonical.ErrorForbidden)
+		repoMock.AssertNotCalled(t, "Search", mock.Anything, mock.Anything)
+	})
+}
+
+func TestForceStatus(t *testing.T) {
+	type Given struct {
+		payment *canonical.Payment
+		status  canonical.PaymentStatus
+		note    string
+	}
+	type Expected struct {
+		err error
+	}
+	tests := map[string]struct {
+		given    Given
+		expected Expected
+	}{
+		"given final payment and a note, must force the status and publish it": {
+			given: Given{
+				payment: &canonical.Payment{ID: "1234", OrderID: "order", Status: canonical.PAYMENT_FAILED},
+				status:  canonical.PAYMENT_PAYED,
+				note:    "provider confirmed the payment by phone",
+			},
+		},
+		"given no note, must return reason required": {
+			given: Given{
+				payment: &canonical.Payment{ID: "1234", OrderID: "order", Status: canonical.PAYMENT_FAILED},
+				status:  canonical.PAYMENT_PAYED,
+				note:    "  ",
+			},
+			expected: Expected{err: canonical.ErrorReasonRequired},
+		},
+		"given payment already in the status, must return invalid transition": {
+			given: Given{
+				payment: &canonical.Payment{ID: "1234", OrderID: "order", Status: canonical.PAYMENT_PAYED},
+				status:  canonical.PAYMENT_PAYED,
+				note:    "again",
+			},
+			expected: Expected{err: canonical.ErrorInvalidTransition},
+		},
+		"given authorized status for a pix payment, must return invalid transition": {
+			given: Given{
+				payment: &canonical.Payment{ID: "1234", OrderID: "order", Method: canonical.METHOD_PIX, Status: canonical.PAYMENT_FAILED},
+				status:  canonical.PAYMENT_AUTHORIZED,
+				note:    "provider says it holds the amount",
+			},
+			expected: Expected{err: canonical.ErrorInvalidTransition},
+		},
+		"given pending status, must return invalid transition": {
+			given: Given{
+				payment: &canonical.Payment{ID: "1234", OrderID: "order", Status: canonical.PAYMENT_FAILED},
+				status:  canonical.PAYMENT_CREATED,
+				note:    "customer wants to pay again",
+			},
+			expected: Expected{err: canonical.ErrorInvalidTransition},
+		},
+		"given unknown payment, must return not found": {
+			given:    Given{status: canonical.PAYMENT_PAYED, note: "missing"},
+			expected: Expected{err: canonical.ErrorNotFound},
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			repoMock := &PaymentRepositoryMock{}
+			if tc.given.payment != nil {
+				repoMock.On("GetByID", mock.Anything, "1234").Return(copyPayment(tc.given.payment), nil)
+				repoMock.On("UpdateFromStatus", mock.Anything, "1234", tc.given.payment.Status, mock.Anything).Return(nil)
+			} else {
+				repoMock.On("GetByID", mock.Anything, "1234").Return(nil, canonical.ErrorNotFound)
+			}
+			auditMock := newAuditMock()
+			pubMock := new(PublisherMock)
+			pubMock.On("SendMessageWithAttributes", mock.Anything).Return(nil)
+			paymentSvc := newAdminService(repoMock, &IntentRepositoryMock{}, auditMock, pubMock)
+
+			payment, err := paymentSvc.ForceStatus(WithActor(context.Background(), ACTOR_OPERATOR_PREFIX+"alice"), "1234", tc.given.status, tc.given.note)
+
+			if tc.expected.err != nil {
+				assert.ErrorIs(t, err, tc.expected.err)
+				repoMock.AssertNotCalled(t, "UpdateFromStatus", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+				assert.Empty(t, pubMock.Calls)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tc.given.status, payment.Status)
+			assert.Equal(t, canonical.REASON_FORCED, payment.Reason)
+			auditMock.AssertCalled(t, "Create", mock.Anything, mock.MatchedBy(func(entry canonical.AuditEntry) bool {
+				return entry.Actor == "operator:alice" && entry.Note == tc.given.note && entry.Reason == canonical.REASON_FORCED &&
+					*entry.PreviousStatus == tc.given.payment.Status && entry.NewStatus == tc.given.status
+			}))
+			pubMock.AssertCalled(t, "SendMessageWithAttributes", map[string]string{REASON_ATTRIBUTE: string(canonical.REASON_FORCED)})
+		})
+	}
+}
+
+func TestForceStatusSettledIntent(t *testing.T) {
+	type Given struct {
+		payment *canonical.Payment
+		intent  *canonical.PaymentIntent
+		status  canonical.PaymentStatus
+	}
+	type Expected struct {
+		// resettled is the new status of the intent, open when it is left alone
+		resettled canonical.IntentStatus
+	}
+	tests := map[string]struct {
+		given    Given
+		expected Expected
+	}{
+		"given the attempt that cancelled the intent forced to payed, must settle the intent as succeeded": {
+			given: Given{
+				payment: &canonical.Payment{ID: "1234", OrderID: "order", Status: canonical.PAYMENT_FAILED, Attempt: 3},
+				intent:  &canonical.PaymentIntent{OrderID: "order", Status: canonical.INTENT_CANCELLED, Reason: canonical.REASON_ATTEMPTS_EXHAUSTED, Attempts: 3, MaxAttempts: 3},
+				status:  canonical.PAYMENT_PAYED,
+			},
+			expected: Expected{resettled: canonical.INTENT_SUCCEEDED},
+		},
+		"given the attempt that paid the intent forced to failed, must settle the intent as cancelled": {
+			given: Given{
+				payment: &canonical.Payment{ID: "1234", OrderID: "order", Status: canonical.PAYMENT_PAYED, Attempt: 1},
+				intent:  &canonical.PaymentIntent{OrderID: "order", Status: canonical.INTENT_SUCCEEDED, Attempts: 1, MaxAttempts: 3},
+				status:  canonical.PAYMENT_FAILED,
+			},
+			expected: Expected{resettled: canonical.INTENT_CANCELLED},
+		},
+		"given an earlier attempt of a settled intent, must leave the intent alone": {
+			given: Given{
+				payment: &canonical.Payment{ID: "1234", OrderID: "order", Status: canonical.PAYMENT_FAILED, Attempt: 1},
+				intent:  &canonical.PaymentIntent{OrderID: "order", Status: canonical.INTENT_SUCCEEDED, Attempts: 2, MaxAttempts: 3},
+				status:  canonical.PAYMENT_CANCELLED,
+			},
+		},
+		"given the outcome the intent already has, must leave the intent alone": {
+			given: Given{
+				payment: &canonical.Payment{ID: "1234", OrderID: "order", Status: canonical.PAYMENT_EXPIRED, Attempt: 1},
+				intent:  &canonical.PaymentIntent{OrderID: "order", Status: canonical.INTENT_CANCELLED, Reason: canonical.REASON_EXPIRED, Attempts: 1, MaxAttempts: 3},
+				status:  canonical.PAYMENT_CANCELLED,
+			},
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			repoMock := &PaymentRepositoryMock{}
+			repoMock.On("GetByID", mock.Anything, "1234").Return(copyPayment(tc.given.payment), nil)
+			repoMock.On("UpdateFromStatus", mock.Anything, "1234", tc.given.payment.Status, mock.Anything).Return(nil)
+			intentMock := &IntentRepositoryMock{}
+			intentMock.On("GetByOrderID", mock.Anything, "order").Return(tc.given.intent, nil)
+			intentMock.On("Settle", mock.Anything, "order", mock.Anything, mock.Anything, now).Return(canonical.ErrorInvalidTransition)
+			intentMock.On("Resettle", mock.Anything, "order", mock.Anything, mock.Anything, now).Return(nil)
+			pubMock := new(PublisherMock)
+			pubMock.On("SendMessageWithAttributes", mock.Anything).Return(nil)
+			paymentSvc := newAdminService(repoMock, intentMock, newAuditMock(), pubMock)
+
+			_, err := paymentSvc.ForceStatus(context.Background(), "1234", tc.given.status, "checked with the provider")
+
+			assert.NoError(t, err)
+			if tc.expected.resettled == canonical.INTENT_OPEN {
+				intentMock.AssertNotCalled(t, "Resettle", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+				assert.Empty(t, pubMock.Calls)
+				return
+			}
+			intentMock.AssertCalled(t, "Resettle", mock.Anything, "order", tc.expected.resettled, canonical.REASON_FORCED, now)
+			pubMock.AssertCalled(t, "SendMessageWithAttributes", map[string]string{REASON_ATTRIBUTE: string(canonical.REASON_FORCED)})
+			pubMock.AssertNumberOfCalls(t, "SendMessageWithAttributes", 1)
+		})
+	}
+}
+
+func TestRepublish(t *testing.T) {
+	type Given struct {
+		payment   *canonical.Payment
+		intent    *canonical.PaymentIntent
+		intentErr error
+	}
+	type Expected struct {
+		err       error
+		sent      string
+		attribute map[string]string
+	}
+	tests := map[string]struct {
+		given    Given
+		expected Expected
+	}{
+		"given payment settling its order by itself, must publish its status": {
+			given:    Given{payment: &canonical.Payment{ID: "1234", OrderID: "order", Status: canonical.PAYMENT_PAYED}},
+			expected: Expected{sent: "SendMessage"},
+		},
+		"given payment of an exhausted intent, must publish the intent's reason": {
+			given: Given{
+				payment: &canonical.Payment{ID: "1234", OrderID: "order", Status: canonical.PAYMENT_FAILED, Reason: canonical.REASON_PROVIDER_FAILURE, Attempt: 3},
+				intent:  &canonical.PaymentIntent{OrderID: "order", Status: canonical.INTENT_CANCELLED, Reason: canonical.REASON_ATTEMPTS_EXHAUSTED},
+			},
+			expected: Expected{
+				sent:      "SendMessageWithAttributes",
+				attribute: map[string]string{REASON_ATTRIBUTE: string(canonical.REASON_ATTEMPTS_EXHAUSTED)},
+			},
+		},
+		"given payment of an intent still open, must return invalid transition": {
+			given: Given{
+				payment: &canonical.Payment{ID: "1234", OrderID: "order", Status: canonical.PAYMENT_FAILED, Attempt: 1},
+				intent:  &canonical.PaymentIntent{OrderID: "order", Status: canonical.INTENT_OPEN},
+			},
+			expected: Expected{err: canonical.ErrorInvalidTransition},
+		},
+		"given pending payment, must return invalid transition": {
+			given:    Given{payment: &canonical.Payment{ID: "1234", OrderID: "order", Status: canonical.PAYMENT_AUTHORIZED}},
+			expected: Expected{err: canonical.ErrorInvalidTransition},
+		},
+		"given refunded payment, must return invalid transition": {
+			given:    Given{payment: &canonical.Payment{ID: "1234", OrderID: "order", Status: canonical.PAYMENT_REFUNDED}},
+			expected: Expected{err: canonical.ErrorInvalidTransition},
+		},
+		"given error searching the intent, must return it": {
+			given: Given{
+				payment:   &canonical.Payment{ID: "1234", OrderID: "order", Status: canonical.PAYMENT_PAYED, Attempt: 1},
+				intentErr: errors.New("db error"),
+			},
+			expected: Expected{err: errors.New("db error")},
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			repoMock := &PaymentRepositoryMock{}
+			repoMock.On("GetByID", mock.Anything, "1234").Return(copyPayment(tc.given.payment), nil)
+			intentMock := &IntentRepositoryMock{}
+			intentMock.On("GetByOrderID", mock.Anything, "order").Return(tc.given.intent, tc.given.intentErr)
+			pubMock := new(PublisherMock)
+			pubMock.On("SendMessage").Return(nil)
+			pubMock.On("SendMessageWithAttributes", mock.Anything).Return(nil)
+			paymentSvc := newAdminService(repoMock, intentMock, newAuditMock(), pubMock)
+
+			_, err := paymentSvc.Republish(context.Background(), "1234")
+
+			if tc.expected.err != nil {
+				assert.EqualError(t, err, tc.expected.err.Error())
+				assert.Empty(t, pubMock.Calls)
+				return
+			}
+			assert.NoError(t, err)
+			if tc.expected.attribute == nil {
+				pubMock.AssertCalled(t, tc.expected.sent)
+			} else {
+				pubMock.AssertCalled(t, tc.expected.sent, tc.expected.attribute)
+			}
+			pubMock.AssertNumberOfCalls(t, tc.expected.sent, 1)
+		})
+	}
+}
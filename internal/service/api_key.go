@@ -0,0 +1,142 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"tech-challenge-payment/internal/auth/apikey"
+	"tech-challenge-payment/internal/auth/principal"
+	"tech-challenge-payment/internal/canonical"
+	"tech-challenge-payment/internal/logging"
+	"tech-challenge-payment/internal/repository"
+	"time"
+)
+
+type APIKeyService interface {
+	// Authenticate fails with apikey.ErrInvalidKey, apikey.ErrKeyExpired or apikey.ErrKeyRevoked when the key is not accepted.
+	Authenticate(ctx context.Context, key string) (principal.Principal, error)
+	// Create returns the stored key and the key to hand to its owner, which can not be recovered later.
+	Create(ctx context.Context, owner string, scopes []string, expiresAt time.Time) (canonical.APIKey, string, error)
+	GetAll(ctx context.Context) ([]canonical.APIKey, error)
+	Revoke(ctx context.Context, id string) error
+	// Rotate issues a new key with the same owner and scopes, the old one keeps working during the rotation grace.
+	Rotate(ctx context.Context, id string) (canonical.APIKey, string, error)
+}
+
+type apiKeyService struct {
+	repo             repository.APIKeyRepository
+	clock            canonical.Clock
+	ids              canonical.IDGenerator
+	rotationGrace    time.Duration
+	lastUsedInterval time.Duration
+}
+
+func NewAPIKeyService(repo repository.APIKeyRepository, clock canonical.Clock, ids canonical.IDGenerator, rotationGrace, lastUsedInterval time.Duration) APIKeyService {
+	return &apiKeyService{
+		repo:             repo,
+		clock:            clock,
+		ids:              ids,
+		rotationGrace:    rotationGrace,
+		lastUsedInterval: lastUsedInterval,
+	}
+}
+
+func (s *apiKeyService) Authenticate(ctx context.Context, key string) (principal.Principal, error) {
+	id, secret, err := apikey.Parse(key)
+	if err != nil {
+		return principal.Principal{}, err
+	}
+
+	stored, err := s.repo.GetByID(ctx, id)
+	if err != nil {
+		if errors.Is(err, canonical.ErrorNotFound) {
+			return principal.Principal{}, apikey.ErrInvalidKey
+		}
+		return principal.Principal{}, err
+	}
+
+	if !apikey.Verify(stored.Hash, secret) {
+		return principal.Principal{}, apikey.ErrInvalidKey
+	}
+
+	now := s.clock.Now()
+	if !stored.RevokedAt.IsZero() {
+		return principal.Principal{}, apikey.ErrKeyRevoked
+	}
+	if !stored.ExpiresAt.IsZero() && now.After(stored.ExpiresAt) {
+		return principal.Principal{}, apikey.ErrKeyExpired
+	}
+
+	// writing on every request would turn each read into a write, a coarse last use is enough
+	if now.Sub(stored.LastUsedAt) >= s.lastUsedInterval {
+		if err := s.repo.UpdateLastUsed(ctx, stored.ID, now); err != nil {
+			logging.Ctx(ctx).Err(err).Str("api_key_id", stored.ID).Msg("an error occurred when update api key last use")
+		}
+	}
+
+	return principal.Principal{
+		Subject: stored.Owner,
+		Scopes:  stored.Scopes,
+		KeyID:   stored.ID,
+	}, nil
+}
+
+func (s *apiKeyService) Create(ctx context.Context, owner string, scopes []string, expiresAt time.Time) (canonical.APIKey, string, error) {
+	id := s.ids.NewID()
+	key, hash, err := apikey.Generate(id)
+	if err != nil {
+		return canonical.APIKey{}, "", err
+	}
+
+	stored := canonical.APIKey{
+		ID:        id,
+		Hash:      hash,
+		Owner:     owner,
+		Scopes:    scopes,
+		CreatedAt: s.clock.Now(),
+		ExpiresAt: expiresAt,
+	}
+	if err := s.repo.Create(ctx, stored); err != nil {
+		return canonical.APIKey{}, "", err
+	}
+
+	return stored, key, nil
+}
+
+func (s *apiKeyService) GetAll(ctx context.Context) ([]canonical.APIKey, error) {
+	return s.repo.GetAll(ctx)
+}
+
+func (s *apiKeyService) Revoke(ctx context.Context, id string) error {
+	return s.repo.Revoke(ctx, id, s.clock.Now())
+}
+
+func (s *apiKeyService) Rotate(ctx context.Context, id string) (canonical.APIKey, string, error) {
+	old, err := s.repo.GetByID(ctx, id)
+	if err != nil {
+		return canonical.APIKey{}, "", err
+	}
+
+	if !old.RevokedAt.IsZero() || len(old.RotatedTo) > 0 {
+		return canonical.APIKey{}, "", canonical.ErrorNotFound
+	}
+
+	stored, key, err := s.Create(ctx, old.Owner, old.Scopes, old.ExpiresAt)
+	if err != nil {
+		return canonical.APIKey{}, "", err
+	}
+
+	expiresAt := s.clock.Now().Add(s.rotationGrace)
+	if !old.ExpiresAt.IsZero() && old.ExpiresAt.Before(expiresAt) {
+		expiresAt = old.ExpiresAt
+	}
+
+	if err := s.repo.Rotate(ctx, old.ID, stored.ID, expiresAt); err != nil {
+		// the new key is useless if the old one can not be linked to it, e.g. a concurrent rotation won
+		if revokeErr := s.repo.Revoke(ctx, stored.ID, s.clock.Now()); revokeErr != nil {
+			logging.Ctx(ctx).Err(revokeErr).Str("api_key_id", stored.ID).Msg("an error occurred when revoke orphan api key")
+		}
+		return canonical.APIKey{}, "", err
+	}
+
+	return stored, key, nil
+}
@@ -0,0 +1,193 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"tech-challenge-payment/internal/auth/apikey"
+	"tech-challenge-payment/internal/canonical"
+	"tech-challenge-payment/internal/canonical/canonicaltest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestAuthenticate(t *testing.T) {
+	key, hash, _ := apikey.Generate("key_valid")
+	stored := func(change func(key *canonical.APIKey)) *canonical.APIKey {
+		k := &canonical.APIKey{
+			ID:     "key_valid",
+			Hash:   hash,
+			Owner:  "batch",
+			Scopes: []string{"payments:read"},
+		}
+		change(k)
+		return k
+	}
+
+	type Given struct {
+		key     string
+		stored  *canonical.APIKey
+		repoErr error
+	}
+	type Expected struct {
+		err         error
+		updatesLast bool
+	}
+	tests := map[string]struct {
+		given    Given
+		expected Expected
+	}{
+		"given valid key, must return its owner and track the use": {
+			given:    Given{key: key, stored: stored(func(*canonical.APIKey) {})},
+			expected: Expected{updatesLast: true},
+		},
+		"given key used moments ago, must not track the use again": {
+			given: Given{key: key, stored: stored(func(k *canonical.APIKey) {
+				k.LastUsedAt = now.Add(-time.Second)
+			})},
+		},
+		"given key with another secret, must reject it": {
+			given:    Given{key: "key_valid.other", stored: stored(func(*canonical.APIKey) {})},
+			expected: Expected{err: apikey.ErrInvalidKey},
+		},
+		"given unknown key, must reject it": {
+			given:    Given{key: key, repoErr: canonical.ErrorNotFound},
+			expected: Expected{err: apikey.ErrInvalidKey},
+		},
+		"given malformed key, must reject it": {
+			given:    Given{key: "malformed"},
+			expected: Expected{err: apikey.ErrInvalidKey},
+		},
+		"given revoked key, must reject it": {
+			given: Given{key: key, stored: stored(func(k *canonical.APIKey) {
+				k.RevokedAt = now
+			})},
+			expected: Expected{err: apikey.ErrKeyRevoked},
+		},
+		"given expired key, must reject it": {
+			given: Given{key: key, stored: stored(func(k *canonical.APIKey) {
+				k.ExpiresAt = now.Add(-time.Minute)
+			})},
+			expected: Expected{err: apikey.ErrKeyExpired},
+		},
+		"given error reading the key, must return error": {
+			given:    Given{key: key, repoErr: errors.New("db error")},
+			expected: Expected{err: errors.New("db error")},
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			repoMock := &APIKeyRepositoryMock{}
+			repoMock.On("GetByID", mock.Anything, "key_valid").Return(tc.given.stored, tc.given.repoErr)
+			repoMock.On("UpdateLastUsed", mock.Anything, "key_valid", now).Return(nil)
+			s := apiKeyService{repo: repoMock, clock: canonicaltest.NewClock(now), lastUsedInterval: time.Minute}
+
+			p, err := s.Authenticate(context.Background(), tc.given.key)
+
+			if tc.expected.err != nil {
+				assert.EqualError(t, err, tc.expected.err.Error())
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, "batch", p.Subject)
+			assert.Equal(t, "key_valid", p.KeyID)
+			assert.Equal(t, []string{"payments:read"}, p.Scopes)
+			if tc.expected.updatesLast {
+				repoMock.AssertCalled(t, "UpdateLastUsed", mock.Anything, "key_valid", now)
+			} else {
+				repoMock.AssertNotCalled(t, "UpdateLastUsed", mock.Anything, mock.Anything, mock.Anything)
+			}
+		})
+	}
+}
+
+func TestCreateAPIKey(t *testing.T) {
+	repoMock := &APIKeyRepositoryMock{}
+	repoMock.On("Create", mock.Anything, mock.MatchedBy(func(key canonical.APIKey) bool {
+		return key.Owner == "batch" && len(key.Hash) > 0
+	})).Return(nil)
+	s := apiKeyService{repo: repoMock, clock: canonicaltest.NewClock(now), ids: canonicaltest.NewIDs("key")}
+
+	stored, key, err := s.Create(context.Background(), "batch", []string{"payments:read"}, time.Time{})
+
+	assert.NoError(t, err)
+	assert.Equal(t, "key-1", stored.ID)
+	assert.Equal(t, now, stored.CreatedAt)
+	id, secret, err := apikey.Parse(key)
+	assert.NoError(t, err)
+	assert.Equal(t, stored.ID, id)
+	assert.True(t, apikey.Verify(stored.Hash, secret))
+	assert.NotContains(t, stored.Hash, secret, "the secret must never be stored")
+}
+
+func TestRotate(t *testing.T) {
+	old := func(change func(key *canonical.APIKey)) *canonical.APIKey {
+		k := &canonical.APIKey{ID: "key_old", Owner: "batch", Scopes: []string{"payments:read"}}
+		change(k)
+		return k
+	}
+
+	type Given struct {
+		old       *canonical.APIKey
+		rotateErr error
+	}
+	type Expected struct {
+		err       error
+		revokes   bool
+		expiresAt time.Time
+	}
+	tests := map[string]struct {
+		given    Given
+		expected Expected
+	}{
+		"given active key, must issue a new one and keep the old one during the grace": {
+			given:    Given{old: old(func(*canonical.APIKey) {})},
+			expected: Expected{expiresAt: now.Add(time.Hour)},
+		},
+		"given key expiring before the grace, must keep its expiration": {
+			given: Given{old: old(func(k *canonical.APIKey) {
+				k.ExpiresAt = now.Add(time.Minute)
+			})},
+			expected: Expected{expiresAt: now.Add(time.Minute)},
+		},
+		"given revoked key, must return not found": {
+			given: Given{old: old(func(k *canonical.APIKey) {
+				k.RevokedAt = now
+			})},
+			expected: Expected{err: canonical.ErrorNotFound},
+		},
+		"given concurrent rotation, must revoke the new key": {
+			given:    Given{old: old(func(*canonical.APIKey) {}), rotateErr: canonical.ErrorNotFound},
+			expected: Expected{err: canonical.ErrorNotFound, revokes: true},
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			repoMock := &APIKeyRepositoryMock{}
+			repoMock.On("GetByID", mock.Anything, "key_old").Return(tc.given.old, nil)
+			repoMock.On("Create", mock.Anything, mock.Anything).Return(nil)
+			repoMock.On("Rotate", mock.Anything, "key_old", mock.Anything, mock.Anything).Return(tc.given.rotateErr)
+			repoMock.On("Revoke", mock.Anything, mock.Anything, mock.Anything).Return(nil)
+			s := apiKeyService{repo: repoMock, clock: canonicaltest.NewClock(now), ids: canonicaltest.NewIDs("key"), rotationGrace: time.Hour}
+
+			stored, key, err := s.Rotate(context.Background(), "key_old")
+
+			if tc.expected.err != nil {
+				assert.ErrorIs(t, err, tc.expected.err)
+				if tc.expected.revokes {
+					repoMock.AssertCalled(t, "Revoke", mock.Anything, mock.Anything, mock.Anything)
+				}
+				return
+			}
+			assert.NoError(t, err)
+			assert.NotEmpty(t, key)
+			assert.Equal(t, "batch", stored.Owner)
+			assert.Equal(t, "key-1", stored.ID)
+			repoMock.AssertCalled(t, "Rotate", mock.Anything, "key_old", "key-1", tc.expected.expiresAt)
+		})
+	}
+}
@@ -0,0 +1,70 @@
+package service
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"tech-challenge-payment/internal/auth/principal"
+	"tech-challenge-payment/internal/canonical"
+	"tech-challenge-payment/internal/logging"
+)
+
+const (
+	// ACTOR_SQS_CONSUMER changes payments on behalf of the messages of the order service.
+	ACTOR_SQS_CONSUMER = "sqs-consumer"
+	// ACTOR_SYSTEM is recorded when nobody can be told apart as the actor.
+	ACTOR_SYSTEM = "system"
+
+	ACTOR_PROVIDER_PREFIX = "provider:"
+	ACTOR_JOB_PREFIX      = "job:"
+	// ACTOR_OPERATOR_PREFIX names the operator changing payments from the admin CLI.
+	ACTOR_OPERATOR_PREFIX = "operator:"
+)
+
+type actorKey struct{}
+
+// WithActor names who changes payments within ctx in the audit trail, for callers that do not
+// authenticate as a principal.
+func WithActor(ctx context.Context, actor string) context.Context {
+	return context.WithValue(ctx, actorKey{}, actor)
+}
+
+// actor prefers the actor set with WithActor, then the subject of the authenticated principal.
+func actor(ctx context.Context) string {
+	if actor, ok := ctx.Value(actorKey{}).(string); ok && len(actor) > 0 {
+		return actor
+	}
+	if p, ok := principal.FromContext(ctx); ok && len(p.Subject) > 0 {
+		return p.Subject
+	}
+	return ACTOR_SYSTEM
+}
+
+func payloadHash(payload []byte) string {
+	if len(payload) == 0 {
+		return ""
+	}
+	sum := sha256.Sum256(payload)
+	return hex.EncodeToString(sum[:])
+}
+
+// audit records a change already applied to the payment. Failing to record it does not undo
+// the change, which the order service still has to hear about, so the failure is only logged.
+func (s *paymentService) audit(ctx context.Context, previous *canonical.PaymentStatus, payment canonical.Payment, actor, payloadHash, note string) {
+	entry := canonical.AuditEntry{
+		ID:             s.ids.NewID(),
+		PaymentID:      payment.ID,
+		PreviousStatus: previous,
+		NewStatus:      payment.Status,
+		Reason:         payment.Reason,
+		Actor:          actor,
+		PayloadHash:    payloadHash,
+		Note:           note,
+		RequestID:      logging.RequestID(ctx),
+		At:             s.clock.Now(),
+	}
+
+	if err := s.audits.Create(ctx, entry); err != nil {
+		logging.Ctx(ctx).Err(err).Str("payment_id", payment.ID).Str("actor", actor).Msg("an error occurred when record the payment audit entry")
+	}
+}
@@ -0,0 +1,151 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"tech-challenge-payment/internal/auth/principal"
+	"tech-challenge-payment/internal/canonical"
+	"tech-challenge-payment/internal/canonical/canonicaltest"
+	"tech-challenge-payment/internal/logging"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestAudit(t *testing.T) {
+	created := canonical.PAYMENT_CREATED
+
+	newService := func(repoMock *PaymentRepositoryMock, auditMock *AuditRepositoryMock) *paymentService {
+		pubMock := new(PublisherMock)
+		pubMock.On("SendMessage").Return(nil)
+		pubMock.On("SendMessageWithAttributes", mock.Anything).Return(nil)
+		providerMock := newProviderMock()
+		providerMock.On("Void", mock.Anything, mock.Anything).Return(nil)
+
+		return &paymentService{
+			repo:          repoMock,
+			intents:       newIntentMock(),
+			audits:        auditMock,
+			publisher:     pubMock,
+			providers:     providerMock,
+			hub:           newHubMock(),
+			clock:         canonicaltest.NewClock(now),
+			ids:           canonicaltest.NewIDs("audit"),
+			maxAttempts:   3,
+			defaultMethod: canonical.METHOD_PIX,
+		}
+	}
+
+	t.Run("given a customer creating a payment, must record the customer as the actor", func(t *testing.T) {
+		repoMock := &PaymentRepositoryMock{}
+		repoMock.On("GetByOrderID", mock.Anything, "order").Return(nil, canonical.ErrorNotFound)
+		repoMock.On("Create", mock.Anything, mock.Anything).Return(canonical.Payment{ID: "1234", Status: canonical.PAYMENT_CREATED}, nil)
+		auditMock := newAuditMock()
+		ctx := principal.NewContext(context.Background(), principal.Principal{Subject: "customer", Roles: []string{principal.ROLE_CUSTOMER}})
+
+		_, err := newService(repoMock, auditMock).Create(ctx, canonical.Payment{OrderID: "order"})
+
+		assert.NoError(t, err)
+		auditMock.AssertCalled(t, "Create", mock.Anything, canonical.AuditEntry{
+			ID:        "audit-2",
+			PaymentID: "1234",
+			NewStatus: canonical.PAYMENT_CREATED,
+			Actor:     "customer",
+			At:        now,
+		})
+	})
+
+	t.Run("given a provider callback, must record the provider, the payload hash and the request id", func(t *testing.T) {
+		repoMock := &PaymentRepositoryMock{}
+		repoMock.On("GetByID", mock.Anything, "1234").Return(&canonical.Payment{ID: "1234", Status: canonical.PAYMENT_CREATED}, nil)
+		repoMock.On("UpdateFromStatus", mock.Anything, "1234", canonical.PAYMENT_CREATED, mock.Anything).Return(nil)
+		auditMock := newAuditMock()
+		ctx := logging.WithRequestID(context.Background(), "request")
+
+		err := newService(repoMock, auditMock).Callback(ctx, "1234", canonical.PAYMENT_PAYED, []byte("payload"))
+
+		assert.NoError(t, err)
+		auditMock.AssertCalled(t, "Create", mock.Anything, canonical.AuditEntry{
+			ID:             "audit-1",
+			PaymentID:      "1234",
+			PreviousStatus: &created,
+			NewStatus:      canonical.PAYMENT_PAYED,
+			Actor:          "provider:mock",
+			PayloadHash:    "239f59ed55e737c77147cf55ad0c1b030b6d7ee748a7426952f9b852d5a935e5",
+			RequestID:      "request",
+			At:             now,
+		})
+	})
+
+	t.Run("given an actor set on the context, must record it with the reason", func(t *testing.T) {
+		repoMock := &PaymentRepositoryMock{}
+		repoMock.On("GetByOrderID", mock.Anything, "order").Return(&canonical.Payment{ID: "1234", Status: canonical.PAYMENT_CREATED}, nil)
+		repoMock.On("UpdateFromStatus", mock.Anything, "1234", canonical.PAYMENT_CREATED, mock.Anything).Return(nil)
+		auditMock := newAuditMock()
+		ctx := WithActor(context.Background(), ACTOR_SQS_CONSUMER)
+
+		_, err := newService(repoMock, auditMock).CancelByOrderID(ctx, "order", canonical.REASON_ORDER_CANCELLED)
+
+		assert.NoError(t, err)
+		auditMock.AssertCalled(t, "Create", mock.Anything, canonical.AuditEntry{
+			ID:             "audit-1",
+			PaymentID:      "1234",
+			PreviousStatus: &created,
+			NewStatus:      canonical.PAYMENT_CANCELLED,
+			Reason:         canonical.REASON_ORDER_CANCELLED,
+			Actor:          ACTOR_SQS_CONSUMER,
+			At:             now,
+		})
+	})
+
+	t.Run("given the audit entry fails to be recorded, must still notify the change", func(t *testing.T) {
+		repoMock := &PaymentRepositoryMock{}
+		repoMock.On("GetByID", mock.Anything, "1234").Return(&canonical.Payment{ID: "1234", Status: canonical.PAYMENT_CREATED}, nil)
+		repoMock.On("UpdateFromStatus", mock.Anything, "1234", canonical.PAYMENT_CREATED, mock.Anything).Return(nil)
+		auditMock := &AuditRepositoryMock{}
+		auditMock.On("Create", mock.Anything, mock.Anything).Return(errors.New("db error"))
+		paymentSvc := newService(repoMock, auditMock)
+
+		err := paymentSvc.Callback(context.Background(), "1234", canonical.PAYMENT_PAYED, nil)
+
+		assert.NoError(t, err)
+		paymentSvc.publisher.(*PublisherMock).AssertCalled(t, "SendMessage")
+	})
+
+	t.Run("given no actor on the context, must record the system", func(t *testing.T) {
+		assert.Equal(t, ACTOR_SYSTEM, actor(context.Background()))
+	})
+}
+
+func TestHistory(t *testing.T) {
+	customer := principal.NewContext(context.Background(), principal.Principal{
+		Subject: "customer",
+		Roles:   []string{principal.ROLE_CUSTOMER},
+	})
+
+	t.Run("given a payment, must list its entries", func(t *testing.T) {
+		repoMock := &PaymentRepositoryMock{}
+		repoMock.On("GetByID", mock.Anything, "1234").Return(&canonical.Payment{ID: "1234", CustomerID: "customer"}, nil)
+		auditMock := &AuditRepositoryMock{}
+		auditMock.On("GetByPaymentID", mock.Anything, "1234").Return([]canonical.AuditEntry{{ID: "1"}, {ID: "2"}}, nil)
+		paymentSvc := paymentService{repo: repoMock, audits: auditMock}
+
+		entries, err := paymentSvc.History(customer, "1234")
+
+		assert.NoError(t, err)
+		assert.Len(t, entries, 2)
+	})
+
+	t.Run("given another customer's payment, must return not found", func(t *testing.T) {
+		repoMock := &PaymentRepositoryMock{}
+		repoMock.On("GetByID", mock.Anything, "1234").Return(&canonical.Payment{ID: "1234", CustomerID: "other"}, nil)
+		auditMock := &AuditRepositoryMock{}
+		paymentSvc := paymentService{repo: repoMock, audits: auditMock}
+
+		_, err := paymentSvc.History(customer, "1234")
+
+		assert.ErrorIs(t, err, canonical.ErrorNotFound)
+		auditMock.AssertNotCalled(t, "GetByPaymentID", mock.Anything, mock.Anything)
+	})
+}
@@ -0,0 +1,108 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"tech-challenge-payment/internal/canonical"
+	"time"
+)
+
+// Authorize only takes card payments still waiting for the customer. Card payments are
+// authorized as they are created, this is for those whose authorization could not be saved then.
+func (s *paymentService) Authorize(ctx context.Context, paymentId string) (*canonical.Payment, error) {
+	payment, err := s.GetByID(ctx, paymentId)
+	if err != nil {
+		return nil, err
+	}
+
+	if payment == nil {
+		return nil, canonical.ErrorNotFound
+	}
+
+	if !payment.Method.IsCard() {
+		return nil, fmt.Errorf("%w: %s can not be authorized", canonical.ErrorInvalidPayment, payment.Method)
+	}
+
+	// the authorization was already held
+	if payment.Status == canonical.PAYMENT_AUTHORIZED {
+		return payment, nil
+	}
+
+	if payment.Status != canonical.PAYMENT_CREATED {
+		return nil, canonical.ErrorInvalidTransition
+	}
+
+	_, err = s.providers.Route(payment.Method).Authorize(ctx, *payment)
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.change(ctx, payment, canonical.PAYMENT_AUTHORIZED, "", actor(ctx), "", "")
+	if err != nil {
+		return nil, err
+	}
+
+	return payment, nil
+}
+
+// Capture pays the order with part or all of the authorized amount, the rest is released by
+// the provider.
+func (s *paymentService) Capture(ctx context.Context, paymentId string, amount int64) (*canonical.Payment, error) {
+	payment, err := s.GetByID(ctx, paymentId)
+	if err != nil {
+		return nil, err
+	}
+
+	if payment == nil {
+		return nil, canonical.ErrorNotFound
+	}
+
+	if payment.Status != canonical.PAYMENT_AUTHORIZED {
+		return nil, canonical.ErrorInvalidTransition
+	}
+
+	if amount == 0 {
+		amount = payment.Amount
+	}
+	// nothing to capture when neither the request nor the authorization has an amount
+	if amount <= 0 || amount > payment.Amount {
+		return nil, fmt.Errorf("%w: %d is not between 1 and the authorized %d", canonical.ErrorInvalidAmount, amount, payment.Amount)
+	}
+
+	err = s.providers.Route(payment.Method).Capture(ctx, *payment, amount)
+	if err != nil {
+		return nil, err
+	}
+
+	payment.CapturedAmount = amount
+	err = s.change(ctx, payment, canonical.PAYMENT_PAYED, "", actor(ctx), "", "")
+	if err != nil {
+		return nil, err
+	}
+
+	return payment, nil
+}
+
+// VoidAuthorizations expires the authorizations at the provider, authorizations captured or
+// cancelled meanwhile are skipped.
+func (s *paymentService) VoidAuthorizations(ctx context.Context, authorizedBefore time.Time) ([]canonical.Payment, error) {
+	payments, err := s.repo.GetByStatusUpdatedBefore(ctx, canonical.PAYMENT_AUTHORIZED, authorizedBefore)
+	if err != nil {
+		return nil, err
+	}
+
+	voided := make([]canonical.Payment, 0, len(payments))
+	for i := range payments {
+		payment, err := s.finish(ctx, &payments[i], canonical.PAYMENT_EXPIRED, canonical.REASON_NOT_CAPTURED)
+		if err != nil {
+			if errors.Is(err, canonical.ErrorInvalidTransition) {
+				continue
+			}
+			return voided, err
+		}
+		voided = append(voided, *payment)
+	}
+
+	return voided, nil
+}
@@ -0,0 +1,217 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"tech-challenge-payment/internal/canonical"
+	"tech-challenge-payment/internal/canonical/canonicaltest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func newAuthorizationService(repoMock *PaymentRepositoryMock, providerMock *ProviderMock, pubMock *PublisherMock) paymentService {
+	return paymentService{
+		repo:      repoMock,
+		intents:   newIntentMock(),
+		audits:    newAuditMock(),
+		publisher: pubMock,
+		providers: providerMock,
+		hub:       newHubMock(),
+		clock:     canonicaltest.NewClock(now),
+		ids:       canonicaltest.NewIDs("audit"),
+		statusToQueue: map[canonical.PaymentStatus]string{
+			canonical.PAYMENT_PAYED:   "payed",
+			canonical.PAYMENT_EXPIRED: "cancelled",
+		},
+	}
+}
+
+func TestAuthorize(t *testing.T) {
+	type Given struct {
+		payment      *canonical.Payment
+		authorizeErr error
+	}
+	type Expected struct {
+		err        error
+		authorized bool
+	}
+	tests := map[string]struct {
+		given    Given
+		expected Expected
+	}{
+		"given pending card payment, must authorize it": {
+			given:    Given{payment: &canonical.Payment{ID: "1234", Method: canonical.METHOD_CREDIT_CARD, Amount: 2500, Status: canonical.PAYMENT_CREATED}},
+			expected: Expected{authorized: true},
+		},
+		"given payment already authorized, must return it as is": {
+			given: Given{payment: &canonical.Payment{ID: "1234", Method: canonical.METHOD_CREDIT_CARD, Amount: 2500, Status: canonical.PAYMENT_AUTHORIZED}},
+		},
+		"given pix payment, must return invalid payment": {
+			given:    Given{payment: &canonical.Payment{ID: "1234", Method: canonical.METHOD_PIX, Status: canonical.PAYMENT_CREATED}},
+			expected: Expected{err: canonical.ErrorInvalidPayment},
+		},
+		"given cancelled payment, must return invalid transition": {
+			given:    Given{payment: &canonical.Payment{ID: "1234", Method: canonical.METHOD_DEBIT_CARD, Amount: 2500, Status: canonical.PAYMENT_CANCELLED}},
+			expected: Expected{err: canonical.ErrorInvalidTransition},
+		},
+		"given provider refusing the authorization, must return its error": {
+			given: Given{
+				payment:      &canonical.Payment{ID: "1234", Method: canonical.METHOD_CREDIT_CARD, Amount: 2500, Status: canonical.PAYMENT_CREATED},
+				authorizeErr: errors.New("insufficient funds"),
+			},
+			expected: Expected{err: errors.New("insufficient funds")},
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			repoMock := &PaymentRepositoryMock{}
+			repoMock.On("GetByID", mock.Anything, "1234").Return(copyPayment(tc.given.payment), nil)
+			repoMock.On("UpdateFromStatus", mock.Anything, "1234", canonical.PAYMENT_CREATED, mock.Anything).Return(nil)
+			providerMock := &ProviderMock{}
+			providerMock.On("Authorize", mock.Anything, mock.Anything).Return(canonical.MethodDetails{}, tc.given.authorizeErr)
+			pubMock := new(PublisherMock)
+			paymentSvc := newAuthorizationService(repoMock, providerMock, pubMock)
+
+			payment, err := paymentSvc.Authorize(context.Background(), "1234")
+
+			if tc.expected.err != nil {
+				assert.ErrorContains(t, err, tc.expected.err.Error())
+				repoMock.AssertNotCalled(t, "UpdateFromStatus", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, canonical.PAYMENT_AUTHORIZED, payment.Status)
+			// the order service only hears about the payment once it is captured
+			assert.Empty(t, pubMock.Calls)
+			if !tc.expected.authorized {
+				providerMock.AssertNotCalled(t, "Authorize", mock.Anything, mock.Anything)
+				return
+			}
+			repoMock.AssertCalled(t, "UpdateFromStatus", mock.Anything, "1234", canonical.PAYMENT_CREATED, mock.MatchedBy(func(payment canonical.Payment) bool {
+				return payment.Status == canonical.PAYMENT_AUTHORIZED && payment.UpdatedAt.Equal(now)
+			}))
+		})
+	}
+}
+
+func TestCapture(t *testing.T) {
+	authorized := &canonical.Payment{ID: "1234", OrderID: "order", Method: canonical.METHOD_CREDIT_CARD, Amount: 2500, Status: canonical.PAYMENT_AUTHORIZED}
+
+	type Given struct {
+		payment    *canonical.Payment
+		amount     int64
+		captureErr error
+	}
+	type Expected struct {
+		err      error
+		captured int64
+	}
+	tests := map[string]struct {
+		given    Given
+		expected Expected
+	}{
+		"given no amount, must capture all of the authorized one": {
+			given:    Given{payment: authorized},
+			expected: Expected{captured: 2500},
+		},
+		"given part of the amount, must capture only that part": {
+			given:    Given{payment: authorized, amount: 1800},
+			expected: Expected{captured: 1800},
+		},
+		"given more than the authorized amount, must return invalid amount": {
+			given:    Given{payment: authorized, amount: 2501},
+			expected: Expected{err: canonical.ErrorInvalidAmount},
+		},
+		"given negative amount, must return invalid amount": {
+			given:    Given{payment: authorized, amount: -1},
+			expected: Expected{err: canonical.ErrorInvalidAmount},
+		},
+		"given no amount on an authorization without one, must return invalid amount": {
+			given:    Given{payment: &canonical.Payment{ID: "1234", Method: canonical.METHOD_CREDIT_CARD, Status: canonical.PAYMENT_AUTHORIZED}},
+			expected: Expected{err: canonical.ErrorInvalidAmount},
+		},
+		"given payment not authorized, must return invalid transition": {
+			given:    Given{payment: &canonical.Payment{ID: "1234", Method: canonical.METHOD_CREDIT_CARD, Amount: 2500, Status: canonical.PAYMENT_CREATED}},
+			expected: Expected{err: canonical.ErrorInvalidTransition},
+		},
+		"given provider error capturing, must return it": {
+			given:    Given{payment: authorized, captureErr: errors.New("provider error")},
+			expected: Expected{err: errors.New("provider error")},
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			repoMock := &PaymentRepositoryMock{}
+			repoMock.On("GetByID", mock.Anything, "1234").Return(copyPayment(tc.given.payment), nil)
+			repoMock.On("UpdateFromStatus", mock.Anything, "1234", canonical.PAYMENT_AUTHORIZED, mock.Anything).Return(nil)
+			providerMock := &ProviderMock{}
+			providerMock.On("Capture", mock.Anything, mock.Anything, mock.Anything).Return(tc.given.captureErr)
+			pubMock := new(PublisherMock)
+			pubMock.On("SendMessage").Return(nil)
+			paymentSvc := newAuthorizationService(repoMock, providerMock, pubMock)
+
+			payment, err := paymentSvc.Capture(context.Background(), "1234", tc.given.amount)
+
+			if tc.expected.err != nil {
+				assert.ErrorContains(t, err, tc.expected.err.Error())
+				repoMock.AssertNotCalled(t, "UpdateFromStatus", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+				assert.Empty(t, pubMock.Calls)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, canonical.PAYMENT_PAYED, payment.Status)
+			assert.Equal(t, tc.expected.captured, payment.CapturedAmount)
+			assert.Equal(t, tc.given.payment.Version+1, payment.Version)
+			providerMock.AssertCalled(t, "Capture", mock.Anything, mock.Anything, tc.expected.captured)
+			repoMock.AssertCalled(t, "UpdateFromStatus", mock.Anything, "1234", canonical.PAYMENT_AUTHORIZED, mock.MatchedBy(func(payment canonical.Payment) bool {
+				return payment.Status == canonical.PAYMENT_PAYED && payment.CapturedAmount == tc.expected.captured
+			}))
+			pubMock.AssertCalled(t, "SendMessage")
+		})
+	}
+}
+
+func TestVoidAuthorizations(t *testing.T) {
+	before := now.Add(-24 * time.Hour)
+
+	t.Run("given authorizations not captured in time, must void them", func(t *testing.T) {
+		repoMock := &PaymentRepositoryMock{}
+		repoMock.On("GetByStatusUpdatedBefore", mock.Anything, canonical.PAYMENT_AUTHORIZED, before).Return([]canonical.Payment{
+			{ID: "1", OrderID: "order-1", Method: canonical.METHOD_CREDIT_CARD, Status: canonical.PAYMENT_AUTHORIZED},
+			{ID: "2", OrderID: "order-2", Method: canonical.METHOD_CREDIT_CARD, Status: canonical.PAYMENT_AUTHORIZED},
+		}, nil)
+		repoMock.On("UpdateFromStatus", mock.Anything, "1", canonical.PAYMENT_AUTHORIZED, mock.Anything).Return(nil)
+		// captured meanwhile
+		repoMock.On("UpdateFromStatus", mock.Anything, "2", canonical.PAYMENT_AUTHORIZED, mock.Anything).Return(canonical.ErrorInvalidTransition)
+		providerMock := &ProviderMock{}
+		providerMock.On("Void", mock.Anything, mock.Anything).Return(nil)
+		pubMock := new(PublisherMock)
+		pubMock.On("SendMessageWithAttributes", map[string]string{REASON_ATTRIBUTE: string(canonical.REASON_NOT_CAPTURED)}).Return(nil)
+		paymentSvc := newAuthorizationService(repoMock, providerMock, pubMock)
+
+		voided, err := paymentSvc.VoidAuthorizations(context.Background(), before)
+
+		assert.NoError(t, err)
+		assert.Len(t, voided, 1)
+		assert.Equal(t, "1", voided[0].ID)
+		assert.Equal(t, canonical.PAYMENT_EXPIRED, voided[0].Status)
+		assert.Equal(t, canonical.REASON_NOT_CAPTURED, voided[0].Reason)
+		providerMock.AssertNumberOfCalls(t, "Void", 2)
+		pubMock.AssertNumberOfCalls(t, "SendMessageWithAttributes", 1)
+	})
+
+	t.Run("given error searching, must return it", func(t *testing.T) {
+		repoMock := &PaymentRepositoryMock{}
+		repoMock.On("GetByStatusUpdatedBefore", mock.Anything, canonical.PAYMENT_AUTHORIZED, before).Return(nil, errors.New("db error"))
+		paymentSvc := newAuthorizationService(repoMock, &ProviderMock{}, new(PublisherMock))
+
+		_, err := paymentSvc.VoidAuthorizations(context.Background(), before)
+
+		assert.EqualError(t, err, "db error")
+	})
+}
@@ -0,0 +1,144 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"tech-challenge-payment/internal/auth/principal"
+	"tech-challenge-payment/internal/canonical"
+	"tech-challenge-payment/internal/logging"
+)
+
+// Intent is visible to whoever may read the payments of the order.
+func (s *paymentService) Intent(ctx context.Context, orderId string) (*canonical.PaymentIntent, error) {
+	intent, err := s.intents.GetByOrderID(ctx, orderId)
+	if err != nil {
+		return nil, err
+	}
+
+	if p, ok := principal.FromContext(ctx); ok && !p.Owns(intent.CustomerID) {
+		return nil, canonical.ErrorNotFound
+	}
+
+	return intent, nil
+}
+
+// intent returns the intent the payment would be the next attempt of, opening it on the first
+// one. The attempt is only counted once the payment is stored, see countAttempt.
+func (s *paymentService) intent(ctx context.Context, payment canonical.Payment) (*canonical.PaymentIntent, error) {
+	latest, err := s.repo.GetByOrderID(ctx, payment.OrderID)
+	if err != nil && !errors.Is(err, canonical.ErrorNotFound) {
+		return nil, err
+	}
+	if latest != nil && !latest.Status.IsFinal() {
+		return nil, canonical.ErrorAttemptPending
+	}
+
+	intent, err := s.intents.GetByOrderID(ctx, payment.OrderID)
+	if errors.Is(err, canonical.ErrorNotFound) {
+		intent = &canonical.PaymentIntent{
+			OrderID:     payment.OrderID,
+			CustomerID:  payment.CustomerID,
+			Status:      canonical.INTENT_OPEN,
+			MaxAttempts: s.maxAttempts,
+			CreatedAt:   payment.CreatedAt,
+			UpdatedAt:   payment.CreatedAt,
+		}
+		if err = s.intents.Create(ctx, *intent); err != nil {
+			// another attempt opened the intent meanwhile
+			intent, err = s.intents.GetByOrderID(ctx, payment.OrderID)
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if p, ok := principal.FromContext(ctx); ok && !p.Owns(intent.CustomerID) {
+		return nil, canonical.ErrorNotFound
+	}
+	if intent.Status != canonical.INTENT_OPEN || intent.Exhausted() {
+		return nil, canonical.ErrorIntentSettled
+	}
+
+	return intent, nil
+}
+
+// countAttempt counts the stored payment as the next attempt of the intent. When the attempt
+// can not be counted, e.g. because another one was counted meanwhile, the payment is voided
+// and cancelled as a duplicate; the order service never hears about it.
+func (s *paymentService) countAttempt(ctx context.Context, intent canonical.PaymentIntent, payment canonical.Payment) error {
+	err := s.intents.AddAttempt(ctx, intent.OrderID, intent.Attempts, payment.CreatedAt)
+	if err == nil {
+		return nil
+	}
+
+	if discardErr := s.discard(ctx, payment); discardErr != nil {
+		logging.Ctx(ctx).Err(discardErr).Str("payment_id", payment.ID).Msg("an error occurred when discard the uncounted payment attempt")
+	}
+	if errors.Is(err, canonical.ErrorInvalidTransition) {
+		return canonical.ErrorAttemptPending
+	}
+	return err
+}
+
+// discard voids the payment at the provider and cancels it without telling anyone else.
+func (s *paymentService) discard(ctx context.Context, payment canonical.Payment) error {
+	if err := s.providers.Route(payment.Method).Void(ctx, payment); err != nil {
+		return err
+	}
+
+	current := payment.Status
+	payment.UpdatedAt = s.clock.Now()
+	payment.Status = canonical.PAYMENT_CANCELLED
+	payment.Reason = canonical.REASON_DUPLICATE_ATTEMPT
+	if err := s.repo.UpdateFromStatus(ctx, payment.ID, current, payment); err != nil {
+		return err
+	}
+	payment.Version++
+	s.audit(ctx, &current, payment, actor(ctx), "", "")
+	return nil
+}
+
+// settle decides whether the new status of the payment settles the intent of its order, and
+// with which reason. A failed attempt only settles the intent when it was the last one allowed.
+func (s *paymentService) settle(ctx context.Context, payment canonical.Payment) (bool, canonical.StatusReason, error) {
+	// payments created before intents existed settle the order by themselves
+	if payment.Attempt == 0 {
+		return true, payment.Reason, nil
+	}
+
+	status, reason := canonical.INTENT_CANCELLED, payment.Reason
+	switch payment.Status {
+	case canonical.PAYMENT_PAYED:
+		status = canonical.INTENT_SUCCEEDED
+	case canonical.PAYMENT_FAILED:
+		intent, err := s.intents.GetByOrderID(ctx, payment.OrderID)
+		if err != nil {
+			return false, "", err
+		}
+		if payment.Attempt < intent.MaxAttempts {
+			return false, "", nil
+		}
+		reason = canonical.REASON_ATTEMPTS_EXHAUSTED
+	}
+
+	err := s.intents.Settle(ctx, payment.OrderID, status, reason, s.clock.Now())
+	if err != nil {
+		// the order service already heard about the intent
+		if errors.Is(err, canonical.ErrorInvalidTransition) {
+			return false, "", nil
+		}
+		return false, "", err
+	}
+
+	return true, reason, nil
+}
+
+// cancelIntent gives up on an open intent whose last attempt failed, as no attempt would settle it.
+func (s *paymentService) cancelIntent(ctx context.Context, orderId string, reason canonical.StatusReason) error {
+	err := s.intents.Settle(ctx, orderId, canonical.INTENT_CANCELLED, reason, s.clock.Now())
+	if err != nil {
+		return err
+	}
+
+	return s.publish(ctx, orderId, s.statusToQueue[canonical.PAYMENT_CANCELLED], reason)
+}
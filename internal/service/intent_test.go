@@ -0,0 +1,345 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"tech-challenge-payment/internal/auth/principal"
+	"tech-challenge-payment/internal/canonical"
+	"tech-challenge-payment/internal/canonical/canonicaltest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestCreateAttempt(t *testing.T) {
+	customer := principal.NewContext(context.Background(), principal.Principal{
+		Subject: "customer",
+		Roles:   []string{principal.ROLE_CUSTOMER},
+	})
+
+	type Given struct {
+		ctx        context.Context
+		latest     *canonical.Payment
+		intent     *canonical.PaymentIntent
+		chargeErr  error
+		attemptErr error
+	}
+	type Expected struct {
+		attempt int
+		err     error
+		// the payment was stored before its attempt could not be counted
+		discarded bool
+	}
+	tests := map[string]struct {
+		given    Given
+		expected Expected
+	}{
+		"given the last attempt failed, must create the next attempt": {
+			given: Given{
+				ctx:    context.Background(),
+				latest: &canonical.Payment{ID: "1", OrderID: "order", Status: canonical.PAYMENT_FAILED, Attempt: 1},
+				intent: &canonical.PaymentIntent{OrderID: "order", Attempts: 1, MaxAttempts: 3},
+			},
+			expected: Expected{attempt: 2},
+		},
+		"given the last attempt still pending, must return attempt pending": {
+			given: Given{
+				ctx:    context.Background(),
+				latest: &canonical.Payment{ID: "1", OrderID: "order", Status: canonical.PAYMENT_CREATED, Attempt: 1},
+				intent: &canonical.PaymentIntent{OrderID: "order", Attempts: 1, MaxAttempts: 3},
+			},
+			expected: Expected{err: canonical.ErrorAttemptPending},
+		},
+		"given intent already payed, must return intent settled": {
+			given: Given{
+				ctx:    context.Background(),
+				latest: &canonical.Payment{ID: "1", OrderID: "order", Status: canonical.PAYMENT_PAYED, Attempt: 1},
+				intent: &canonical.PaymentIntent{OrderID: "order", Status: canonical.INTENT_SUCCEEDED, Attempts: 1, MaxAttempts: 3},
+			},
+			expected: Expected{err: canonical.ErrorIntentSettled},
+		},
+		"given another attempt counted meanwhile, must return attempt pending": {
+			given: Given{
+				ctx:        context.Background(),
+				latest:     &canonical.Payment{ID: "1", OrderID: "order", Status: canonical.PAYMENT_FAILED, Attempt: 1},
+				intent:     &canonical.PaymentIntent{OrderID: "order", Attempts: 1, MaxAttempts: 3},
+				attemptErr: canonical.ErrorInvalidTransition,
+			},
+			expected: Expected{attempt: 2, err: canonical.ErrorAttemptPending, discarded: true},
+		},
+		"given error counting the attempt, must discard the payment and return the error": {
+			given: Given{
+				ctx:        context.Background(),
+				latest:     &canonical.Payment{ID: "1", OrderID: "order", Status: canonical.PAYMENT_FAILED, Attempt: 1},
+				intent:     &canonical.PaymentIntent{OrderID: "order", Attempts: 1, MaxAttempts: 3},
+				attemptErr: errors.New("db error"),
+			},
+			expected: Expected{attempt: 2, err: errors.New("db error"), discarded: true},
+		},
+		"given provider failing to charge, must not count the attempt": {
+			given: Given{
+				ctx:       context.Background(),
+				latest:    &canonical.Payment{ID: "1", OrderID: "order", Status: canonical.PAYMENT_FAILED, Attempt: 1},
+				intent:    &canonical.PaymentIntent{OrderID: "order", Attempts: 1, MaxAttempts: 3},
+				chargeErr: errors.New("provider error"),
+			},
+			expected: Expected{err: errors.New("provider error")},
+		},
+		"given customer retrying another customer's order, must return not found": {
+			given: Given{
+				ctx:    customer,
+				latest: &canonical.Payment{ID: "1", OrderID: "order", Status: canonical.PAYMENT_FAILED, Attempt: 1},
+				intent: &canonical.PaymentIntent{OrderID: "order", CustomerID: "other", Attempts: 1, MaxAttempts: 3},
+			},
+			expected: Expected{err: canonical.ErrorNotFound},
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			repoMock := &PaymentRepositoryMock{}
+			repoMock.On("GetByOrderID", mock.Anything, "order").Return(tc.given.latest, nil)
+			repoMock.On("Create", mock.Anything, mock.Anything).Return(canonical.Payment{ID: "2", OrderID: "order", Method: canonical.METHOD_PIX, Attempt: tc.expected.attempt, CreatedAt: now}, nil)
+			repoMock.On("UpdateFromStatus", mock.Anything, "2", canonical.PAYMENT_CREATED, mock.Anything).Return(nil)
+			providerMock := newProviderMock()
+			if tc.given.chargeErr != nil {
+				providerMock = new(ProviderMock)
+				providerMock.On("Charge", mock.Anything, mock.Anything).Return(canonical.MethodDetails{}, tc.given.chargeErr)
+			}
+			providerMock.On("Void", mock.Anything, mock.Anything).Return(nil)
+			intentMock := &IntentRepositoryMock{}
+			intentMock.On("GetByOrderID", mock.Anything, "order").Return(tc.given.intent, nil)
+			intentMock.On("AddAttempt", mock.Anything, "order", tc.given.intent.Attempts, now).Return(tc.given.attemptErr)
+			paymentSvc := paymentService{
+				repo:          repoMock,
+				intents:       intentMock,
+				audits:        newAuditMock(),
+				providers:     providerMock,
+				hub:           newHubMock(),
+				clock:         canonicaltest.NewClock(now),
+				ids:           canonicaltest.NewIDs("payment"),
+				maxAttempts:   3,
+				defaultMethod: canonical.METHOD_PIX,
+			}
+
+			payment, err := paymentSvc.Create(tc.given.ctx, canonical.Payment{OrderID: "order"})
+
+			assert.Equal(t, tc.expected.err, err)
+			if tc.expected.err == nil {
+				assert.Equal(t, tc.expected.attempt, payment.Attempt)
+			}
+			if tc.expected.err == nil || tc.expected.discarded {
+				repoMock.AssertCalled(t, "Create", mock.Anything, mock.MatchedBy(func(payment canonical.Payment) bool {
+					return payment.Attempt == tc.expected.attempt
+				}))
+			} else {
+				repoMock.AssertNotCalled(t, "Create", mock.Anything, mock.Anything)
+				intentMock.AssertNotCalled(t, "AddAttempt", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+			}
+			if tc.expected.discarded {
+				providerMock.AssertCalled(t, "Void", mock.Anything, mock.Anything)
+				repoMock.AssertCalled(t, "UpdateFromStatus", mock.Anything, "2", canonical.PAYMENT_CREATED, mock.MatchedBy(func(payment canonical.Payment) bool {
+					return payment.Status == canonical.PAYMENT_CANCELLED && payment.Reason == canonical.REASON_DUPLICATE_ATTEMPT
+				}))
+			} else {
+				repoMock.AssertNotCalled(t, "UpdateFromStatus", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+			}
+		})
+	}
+}
+
+func TestSettleIntent(t *testing.T) {
+	type Given struct {
+		status  canonical.PaymentStatus
+		attempt int
+	}
+	type Expected struct {
+		settled bool
+		status  canonical.IntentStatus
+		reason  canonical.StatusReason
+	}
+	tests := map[string]struct {
+		given    Given
+		expected Expected
+	}{
+		"given an attempt payed, must settle the intent as succeeded": {
+			given:    Given{status: canonical.PAYMENT_PAYED, attempt: 2},
+			expected: Expected{settled: true, status: canonical.INTENT_SUCCEEDED},
+		},
+		"given an attempt failed with attempts left, must keep the intent open": {
+			given:    Given{status: canonical.PAYMENT_FAILED, attempt: 2},
+			expected: Expected{settled: false},
+		},
+		"given the last attempt failed, must cancel the intent as exhausted": {
+			given:    Given{status: canonical.PAYMENT_FAILED, attempt: 3},
+			expected: Expected{settled: true, status: canonical.INTENT_CANCELLED, reason: canonical.REASON_ATTEMPTS_EXHAUSTED},
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			repoMock := &PaymentRepositoryMock{}
+			repoMock.On("GetByID", mock.Anything, "1234").Return(&canonical.Payment{
+				ID: "1234", OrderID: "order", Status: canonical.PAYMENT_CREATED, Attempt: tc.given.attempt,
+			}, nil)
+			repoMock.On("UpdateFromStatus", mock.Anything, "1234", canonical.PAYMENT_CREATED, mock.Anything).Return(nil)
+			intentMock := &IntentRepositoryMock{}
+			intentMock.On("GetByOrderID", mock.Anything, "order").Return(&canonical.PaymentIntent{OrderID: "order", Attempts: tc.given.attempt, MaxAttempts: 3}, nil)
+			intentMock.On("Settle", mock.Anything, "order", mock.Anything, mock.Anything, now).Return(nil)
+			pubMock := new(PublisherMock)
+			pubMock.On("SendMessage").Return(nil)
+			pubMock.On("SendMessageWithAttributes", mock.Anything).Return(nil)
+			paymentSvc := paymentService{
+				repo:      repoMock,
+				intents:   intentMock,
+				audits:    newAuditMock(),
+				publisher: pubMock,
+				providers: &ProviderMock{},
+				hub:       newHubMock(),
+				clock:     canonicaltest.NewClock(now),
+				ids:       canonicaltest.NewIDs("audit"),
+			}
+
+			err := paymentSvc.Callback(context.Background(), "1234", tc.given.status, nil)
+
+			assert.NoError(t, err)
+			if !tc.expected.settled {
+				intentMock.AssertNotCalled(t, "Settle", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+				assert.Empty(t, pubMock.Calls)
+				return
+			}
+			intentMock.AssertCalled(t, "Settle", mock.Anything, "order", tc.expected.status, tc.expected.reason, now)
+			assert.Len(t, pubMock.Calls, 1)
+			if len(tc.expected.reason) > 0 {
+				pubMock.AssertCalled(t, "SendMessageWithAttributes", map[string]string{REASON_ATTRIBUTE: string(tc.expected.reason)})
+			}
+		})
+	}
+}
+
+func TestCancelIntent(t *testing.T) {
+	failed := []canonical.Payment{{ID: "1234", OrderID: "order", Status: canonical.PAYMENT_FAILED, Attempt: 1}}
+
+	newService := func(repoMock *PaymentRepositoryMock, intentMock *IntentRepositoryMock, pubMock *PublisherMock) paymentService {
+		return paymentService{
+			repo:          repoMock,
+			intents:       intentMock,
+			publisher:     pubMock,
+			hub:           newHubMock(),
+			clock:         canonicaltest.NewClock(now),
+			statusToQueue: map[canonical.PaymentStatus]string{canonical.PAYMENT_CANCELLED: "cancelled"},
+		}
+	}
+
+	t.Run("given order cancelled after a failed attempt, must cancel the intent", func(t *testing.T) {
+		repoMock := &PaymentRepositoryMock{}
+		repoMock.On("GetByOrderID", mock.Anything, "order").Return(&failed[0], nil)
+		intentMock := &IntentRepositoryMock{}
+		intentMock.On("Settle", mock.Anything, "order", canonical.INTENT_CANCELLED, canonical.REASON_ORDER_CANCELLED, now).Return(nil)
+		pubMock := new(PublisherMock)
+		pubMock.On("SendMessageWithAttributes", map[string]string{REASON_ATTRIBUTE: string(canonical.REASON_ORDER_CANCELLED)}).Return(nil)
+		paymentSvc := newService(repoMock, intentMock, pubMock)
+
+		payment, err := paymentSvc.CancelByOrderID(context.Background(), "order", canonical.REASON_ORDER_CANCELLED)
+
+		assert.NoError(t, err)
+		assert.Equal(t, "1234", payment.ID)
+		pubMock.AssertExpectations(t)
+	})
+
+	t.Run("given order already payed, must return invalid transition", func(t *testing.T) {
+		repoMock := &PaymentRepositoryMock{}
+		repoMock.On("GetByOrderID", mock.Anything, "order").Return(&canonical.Payment{ID: "1234", OrderID: "order", Status: canonical.PAYMENT_PAYED, Attempt: 1}, nil)
+		pubMock := new(PublisherMock)
+		paymentSvc := newService(repoMock, &IntentRepositoryMock{}, pubMock)
+
+		_, err := paymentSvc.CancelByOrderID(context.Background(), "order", canonical.REASON_ORDER_CANCELLED)
+
+		assert.ErrorIs(t, err, canonical.ErrorInvalidTransition)
+		assert.Empty(t, pubMock.Calls)
+	})
+
+	t.Run("given intent waiting for an attempt for too long, must expire it", func(t *testing.T) {
+		before := now.Add(-30 * time.Minute)
+		repoMock := &PaymentRepositoryMock{}
+		repoMock.On("GetByStatusCreatedBefore", mock.Anything, canonical.PAYMENT_CREATED, before).Return(nil, nil)
+		repoMock.On("GetByOrderID", mock.Anything, "order").Return(&failed[0], nil)
+		intentMock := &IntentRepositoryMock{}
+		intentMock.On("GetOpenUpdatedBefore", mock.Anything, before).Return([]canonical.PaymentIntent{{OrderID: "order", Attempts: 1, MaxAttempts: 3}}, nil)
+		intentMock.On("Settle", mock.Anything, "order", canonical.INTENT_CANCELLED, canonical.REASON_EXPIRED, now).Return(nil)
+		pubMock := new(PublisherMock)
+		pubMock.On("SendMessageWithAttributes", map[string]string{REASON_ATTRIBUTE: string(canonical.REASON_EXPIRED)}).Return(nil)
+		paymentSvc := newService(repoMock, intentMock, pubMock)
+
+		expired, err := paymentSvc.Expire(context.Background(), before)
+
+		assert.NoError(t, err)
+		assert.Empty(t, expired)
+		pubMock.AssertExpectations(t)
+	})
+
+	t.Run("given intent cancelled meanwhile, must skip it", func(t *testing.T) {
+		before := now.Add(-30 * time.Minute)
+		repoMock := &PaymentRepositoryMock{}
+		repoMock.On("GetByStatusCreatedBefore", mock.Anything, canonical.PAYMENT_CREATED, before).Return(nil, nil)
+		repoMock.On("GetByOrderID", mock.Anything, "order").Return(&failed[0], nil)
+		intentMock := &IntentRepositoryMock{}
+		intentMock.On("GetOpenUpdatedBefore", mock.Anything, before).Return([]canonical.PaymentIntent{{OrderID: "order"}}, nil)
+		intentMock.On("Settle", mock.Anything, "order", mock.Anything, mock.Anything, now).Return(canonical.ErrorInvalidTransition)
+		pubMock := new(PublisherMock)
+		paymentSvc := newService(repoMock, intentMock, pubMock)
+
+		_, err := paymentSvc.Expire(context.Background(), before)
+
+		assert.NoError(t, err)
+		assert.Empty(t, pubMock.Calls)
+	})
+}
+
+func TestIntent(t *testing.T) {
+	customer := principal.NewContext(context.Background(), principal.Principal{
+		Subject: "customer",
+		Roles:   []string{principal.ROLE_CUSTOMER},
+	})
+
+	type Given struct {
+		intent *canonical.PaymentIntent
+		err    error
+	}
+	type Expected struct {
+		err error
+	}
+	tests := map[string]struct {
+		given    Given
+		expected Expected
+	}{
+		"given customer's own intent, must return it": {
+			given: Given{intent: &canonical.PaymentIntent{OrderID: "order", CustomerID: "customer"}},
+		},
+		"given another customer's intent, must return not found": {
+			given:    Given{intent: &canonical.PaymentIntent{OrderID: "order", CustomerID: "other"}},
+			expected: Expected{err: canonical.ErrorNotFound},
+		},
+		"given error searching, must return it": {
+			given:    Given{err: errors.New("db error")},
+			expected: Expected{err: errors.New("db error")},
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			intentMock := &IntentRepositoryMock{}
+			intentMock.On("GetByOrderID", mock.Anything, "order").Return(tc.given.intent, tc.given.err)
+			paymentSvc := paymentService{intents: intentMock}
+
+			intent, err := paymentSvc.Intent(customer, "order")
+
+			assert.Equal(t, tc.expected.err, err)
+			if tc.expected.err == nil {
+				assert.Equal(t, "order", intent.OrderID)
+			}
+		})
+	}
+}
@@ -3,6 +3,9 @@ package service
 import (
 	"context"
 	"tech-challenge-payment/internal/canonical"
+	"tech-challenge-payment/internal/events"
+	"tech-challenge-payment/internal/integration/payment_provider"
+	"time"
 
 	"github.com/stretchr/testify/mock"
 )
@@ -11,12 +14,165 @@ type PublisherMock struct {
 	mock.Mock
 }
 
-func (p *PublisherMock) SendMessage(inputMsg any, queueURL string) error {
+func (p *PublisherMock) SendMessage(ctx context.Context, inputMsg any, queueURL string) error {
 	args := p.Called()
 
 	return args.Error(0)
 }
 
+func (p *PublisherMock) SendMessageWithAttributes(ctx context.Context, inputMsg any, queueURL string, attributes map[string]string) error {
+	args := p.Called(attributes)
+
+	return args.Error(0)
+}
+
+type ProviderMock struct {
+	mock.Mock
+}
+
+func (p *ProviderMock) Name() string {
+	return "mock"
+}
+
+// Route sends every method to the mock itself.
+func (p *ProviderMock) Route(method canonical.PaymentMethod) payment_provider.Provider {
+	return p
+}
+
+func (p *ProviderMock) Charge(ctx context.Context, payment canonical.Payment) (canonical.MethodDetails, error) {
+	args := p.Called(ctx, payment)
+
+	return args.Get(0).(canonical.MethodDetails), args.Error(1)
+}
+
+func (p *ProviderMock) Authorize(ctx context.Context, payment canonical.Payment) (canonical.MethodDetails, error) {
+	args := p.Called(ctx, payment)
+
+	return args.Get(0).(canonical.MethodDetails), args.Error(1)
+}
+
+func (p *ProviderMock) Capture(ctx context.Context, payment canonical.Payment, amount int64) error {
+	args := p.Called(ctx, payment, amount)
+
+	return args.Error(0)
+}
+
+func (p *ProviderMock) GetStatus(ctx context.Context, payment canonical.Payment) (canonical.PaymentStatus, error) {
+	args := p.Called(ctx, payment)
+
+	return args.Get(0).(canonical.PaymentStatus), args.Error(1)
+}
+
+func (p *ProviderMock) Void(ctx context.Context, payment canonical.Payment) error {
+	args := p.Called(ctx, payment)
+
+	return args.Error(0)
+}
+
+// newProviderMock charges every payment as a PIX one.
+func newProviderMock() *ProviderMock {
+	providerMock := new(ProviderMock)
+	providerMock.On("Charge", mock.Anything, mock.Anything).Return(canonical.MethodDetails{Pix: &canonical.PixDetails{QRCode: "qr"}}, nil)
+	return providerMock
+}
+
+type HubMock struct {
+	mock.Mock
+}
+
+func (h *HubMock) Publish(payment canonical.Payment) {
+	h.Called(payment)
+}
+
+func (h *HubMock) Subscribe(paymentID string, lastEventID uint64) (<-chan events.Event, func()) {
+	args := h.Called(paymentID, lastEventID)
+	return args.Get(0).(<-chan events.Event), args.Get(1).(func())
+}
+
+func copyPayment(payment *canonical.Payment) *canonical.Payment {
+	copied := *payment
+	return &copied
+}
+
+func newHubMock() *HubMock {
+	hubMock := new(HubMock)
+	hubMock.On("Publish", mock.Anything).Return()
+	return hubMock
+}
+
+type AuditRepositoryMock struct {
+	mock.Mock
+}
+
+func (m *AuditRepositoryMock) Create(ctx context.Context, entry canonical.AuditEntry) error {
+	args := m.Called(ctx, entry)
+	return args.Error(0)
+}
+
+func (m *AuditRepositoryMock) GetByPaymentID(ctx context.Context, paymentId string) ([]canonical.AuditEntry, error) {
+	args := m.Called(ctx, paymentId)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]canonical.AuditEntry), args.Error(1)
+}
+
+func newAuditMock() *AuditRepositoryMock {
+	auditMock := new(AuditRepositoryMock)
+	auditMock.On("Create", mock.Anything, mock.Anything).Return(nil)
+	return auditMock
+}
+
+type IntentRepositoryMock struct {
+	mock.Mock
+}
+
+func (m *IntentRepositoryMock) Create(ctx context.Context, intent canonical.PaymentIntent) error {
+	args := m.Called(ctx, intent)
+	return args.Error(0)
+}
+
+func (m *IntentRepositoryMock) GetByOrderID(ctx context.Context, orderID string) (*canonical.PaymentIntent, error) {
+	args := m.Called(ctx, orderID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*canonical.PaymentIntent), args.Error(1)
+}
+
+func (m *IntentRepositoryMock) AddAttempt(ctx context.Context, orderID string, attempts int, at time.Time) error {
+	args := m.Called(ctx, orderID, attempts, at)
+	return args.Error(0)
+}
+
+func (m *IntentRepositoryMock) Settle(ctx context.Context, orderID string, status canonical.IntentStatus, reason canonical.StatusReason, at time.Time) error {
+	args := m.Called(ctx, orderID, status, reason, at)
+	return args.Error(0)
+}
+
+func (m *IntentRepositoryMock) Resettle(ctx context.Context, orderID string, status canonical.IntentStatus, reason canonical.StatusReason, at time.Time) error {
+	args := m.Called(ctx, orderID, status, reason, at)
+	return args.Error(0)
+}
+
+func (m *IntentRepositoryMock) GetOpenUpdatedBefore(ctx context.Context, before time.Time) ([]canonical.PaymentIntent, error) {
+	args := m.Called(ctx, before)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]canonical.PaymentIntent), args.Error(1)
+}
+
+// newIntentMock opens a new intent for every order, as when each order is paid at the first attempt.
+func newIntentMock() *IntentRepositoryMock {
+	intentMock := new(IntentRepositoryMock)
+	intentMock.On("GetByOrderID", mock.Anything, mock.Anything).Return(nil, canonical.ErrorNotFound)
+	intentMock.On("Create", mock.Anything, mock.Anything).Return(nil)
+	intentMock.On("AddAttempt", mock.Anything, mock.Anything, 0, mock.Anything).Return(nil)
+	intentMock.On("GetOpenUpdatedBefore", mock.Anything, mock.Anything).Return(nil, nil)
+	return intentMock
+}
+
 type PaymentRepositoryMock struct {
 	mock.Mock
 }
@@ -26,18 +182,50 @@ func (m *PaymentRepositoryMock) Create(ctx context.Context, payment canonical.Pa
 	return args.Get(0).(canonical.Payment), args.Error(1)
 }
 
-func (m *PaymentRepositoryMock) Update(ctx context.Context, paymentId string, payment canonical.Payment) error {
-	args := m.Called(ctx, paymentId, payment)
+func (m *PaymentRepositoryMock) GetByID(ctx context.Context, paymentId string) (*canonical.Payment, error) {
+	args := m.Called(ctx, paymentId)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*canonical.Payment), args.Error(1)
+}
+func (m *PaymentRepositoryMock) UpdateFromStatus(ctx context.Context, paymentId string, current canonical.PaymentStatus, payment canonical.Payment) error {
+	args := m.Called(ctx, paymentId, current, payment)
 	return args.Error(0)
 }
 
-func (m *PaymentRepositoryMock) GetByID(ctx context.Context, paymentId string) (*canonical.Payment, error) {
-	args := m.Called(ctx, paymentId)
+func (m *PaymentRepositoryMock) GetByStatusCreatedBefore(ctx context.Context, status canonical.PaymentStatus, before time.Time) ([]canonical.Payment, error) {
+	args := m.Called(ctx, status, before)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]canonical.Payment), args.Error(1)
+}
+
+func (m *PaymentRepositoryMock) GetByStatusUpdatedBefore(ctx context.Context, status canonical.PaymentStatus, before time.Time) ([]canonical.Payment, error) {
+	args := m.Called(ctx, status, before)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]canonical.Payment), args.Error(1)
+}
+
+func (m *PaymentRepositoryMock) Search(ctx context.Context, filter canonical.PaymentFilter) ([]canonical.Payment, error) {
+	args := m.Called(ctx, filter)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]canonical.Payment), args.Error(1)
+}
+
+func (m *PaymentRepositoryMock) GetByOrderID(ctx context.Context, orderId string) (*canonical.Payment, error) {
+	args := m.Called(ctx, orderId)
 	if args.Get(0) == nil {
 		return nil, args.Error(1)
 	}
 	return args.Get(0).(*canonical.Payment), args.Error(1)
 }
+
 func (m *PaymentRepositoryMock) GetAll(ctx context.Context) ([]canonical.Payment, error) {
 	args := m.Called(ctx)
 	if args.Get(0) == nil {
@@ -45,3 +233,51 @@ func (m *PaymentRepositoryMock) GetAll(ctx context.Context) ([]canonical.Payment
 	}
 	return args.Get(0).([]canonical.Payment), args.Error(1)
 }
+
+func (m *PaymentRepositoryMock) GetByCustomerID(ctx context.Context, customerID string) ([]canonical.Payment, error) {
+	args := m.Called(ctx, customerID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]canonical.Payment), args.Error(1)
+}
+
+type APIKeyRepositoryMock struct {
+	mock.Mock
+}
+
+func (m *APIKeyRepositoryMock) Create(ctx context.Context, key canonical.APIKey) error {
+	args := m.Called(ctx, key)
+	return args.Error(0)
+}
+
+func (m *APIKeyRepositoryMock) GetByID(ctx context.Context, id string) (*canonical.APIKey, error) {
+	args := m.Called(ctx, id)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*canonical.APIKey), args.Error(1)
+}
+
+func (m *APIKeyRepositoryMock) GetAll(ctx context.Context) ([]canonical.APIKey, error) {
+	args := m.Called(ctx)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]canonical.APIKey), args.Error(1)
+}
+
+func (m *APIKeyRepositoryMock) Revoke(ctx context.Context, id string, at time.Time) error {
+	args := m.Called(ctx, id, at)
+	return args.Error(0)
+}
+
+func (m *APIKeyRepositoryMock) Rotate(ctx context.Context, id, replacedBy string, expiresAt time.Time) error {
+	args := m.Called(ctx, id, replacedBy, expiresAt)
+	return args.Error(0)
+}
+
+func (m *APIKeyRepositoryMock) UpdateLastUsed(ctx context.Context, id string, at time.Time) error {
+	args := m.Called(ctx, id, at)
+	return args.Error(0)
+}
@@ -2,8 +2,12 @@ package service
 
 import (
 	"context"
+	"errors"
+	"tech-challenge-payment/internal/auth/principal"
 	"tech-challenge-payment/internal/canonical"
 	"tech-challenge-payment/internal/config"
+	"tech-challenge-payment/internal/events"
+	"tech-challenge-payment/internal/integration/payment_provider"
 	"tech-challenge-payment/internal/integration/sqs_publisher"
 	"tech-challenge-payment/internal/repository"
 	"time"
@@ -12,50 +16,148 @@ import (
 const (
 	ORDER_PAYED     = "PAYED"
 	ORDER_CANCELLED = "CANCELLED"
+
+	REASON_ATTRIBUTE = "reason"
 )
 
 type PaymentService interface {
 	GetByID(context.Context, string) (*canonical.Payment, error)
-	Callback(ctx context.Context, paymentId string, status canonical.PaymentStatus) error
+	// Callback applies the status reported by the provider, payload is the raw callback kept as a hash in the audit trail.
+	Callback(ctx context.Context, paymentId string, status canonical.PaymentStatus, payload []byte) error
 	Create(ctx context.Context, payment canonical.Payment) (*canonical.Payment, error)
 	GetAll(ctx context.Context) ([]canonical.Payment, error)
+	Cancel(ctx context.Context, paymentId string, reason canonical.StatusReason) (*canonical.Payment, error)
+	CancelByOrderID(ctx context.Context, orderId string, reason canonical.StatusReason) (*canonical.Payment, error)
+	Expire(ctx context.Context, createdBefore time.Time) ([]canonical.Payment, error)
+	Reconcile(ctx context.Context, createdBefore time.Time) (canonical.ReconciliationReport, error)
+	// History lists the audit trail of the payment from the oldest change to the newest.
+	History(ctx context.Context, paymentId string) ([]canonical.AuditEntry, error)
+	// Intent tells how the payment of the order stands across its attempts.
+	Intent(ctx context.Context, orderId string) (*canonical.PaymentIntent, error)
+	// Search lists the payments matching the filter, it requires the admin scope.
+	Search(ctx context.Context, filter canonical.PaymentFilter) ([]canonical.Payment, error)
+	// ForceStatus moves the payment to the status whatever its current one, note tells why in the audit trail.
+	ForceStatus(ctx context.Context, paymentId string, status canonical.PaymentStatus, note string) (*canonical.Payment, error)
+	// Republish sends the event that settled the order of the payment to its queue again.
+	Republish(ctx context.Context, paymentId string) (*canonical.Payment, error)
+	// Authorize holds the amount of a pending card payment on the card until it is captured.
+	Authorize(ctx context.Context, paymentId string) (*canonical.Payment, error)
+	// Capture collects amount of an authorized payment, zero collects all of it.
+	Capture(ctx context.Context, paymentId string, amount int64) (*canonical.Payment, error)
+	// VoidAuthorizations releases every authorization not captured since before authorizedBefore.
+	VoidAuthorizations(ctx context.Context, authorizedBefore time.Time) ([]canonical.Payment, error)
 }
 
 type paymentService struct {
 	repo          repository.PaymentRepository
+	intents       repository.IntentRepository
+	audits        repository.AuditRepository
 	publisher     sqs_publisher.Publisher
+	providers     payment_provider.Router
+	hub           events.Hub
+	clock         canonical.Clock
+	ids           canonical.IDGenerator
 	statusToQueue map[canonical.PaymentStatus]string
+	maxAttempts   int
+	defaultMethod canonical.PaymentMethod
+	ttl           time.Duration
 }
 
-func NewPaymentService() PaymentService {
-	return &paymentService{
-		repo:      repository.NewPaymentRepo(),
-		publisher: sqs_publisher.NewSQS(),
+// NewPaymentService reads the queues, the attempts, the default method and the time to live of
+// payments from cfg.
+func NewPaymentService(repo repository.PaymentRepository, intents repository.IntentRepository, audits repository.AuditRepository, publisher sqs_publisher.Publisher, providers payment_provider.Router, hub events.Hub, clock canonical.Clock, ids canonical.IDGenerator, cfg config.Config) PaymentService {
+	return &tracedPaymentService{next: &paymentService{
+		repo:      repo,
+		intents:   intents,
+		audits:    audits,
+		publisher: publisher,
+		providers: providers,
+		hub:       hub,
+		clock:     clock,
+		ids:       ids,
 		statusToQueue: map[canonical.PaymentStatus]string{
-			canonical.PAYMENT_FAILED: config.Get().SQS.PaymentCancelledQueue,
-			canonical.PAYMENT_PAYED:  config.Get().SQS.PaymentPayedQueue,
+			canonical.PAYMENT_FAILED:    cfg.SQS.PaymentCancelledQueue,
+			canonical.PAYMENT_PAYED:     cfg.SQS.PaymentPayedQueue,
+			canonical.PAYMENT_CANCELLED: cfg.SQS.PaymentCancelledQueue,
+			canonical.PAYMENT_EXPIRED:   cfg.SQS.PaymentCancelledQueue,
 		},
-	}
+		maxAttempts:   cfg.Intent.MaxAttempts,
+		defaultMethod: canonical.MapPaymentMethod[cfg.Provider.DefaultMethod],
+		ttl:           cfg.Expiration.TTL,
+	}}
 }
 
 func (s *paymentService) Create(ctx context.Context, payment canonical.Payment) (*canonical.Payment, error) {
 	payment.Status = canonical.PAYMENT_CREATED
-	payment.ID = canonical.NewUUID()
-	payment.CreatedAt = time.Now()
+	payment.ID = s.ids.NewID()
+	payment.CreatedAt = s.clock.Now()
+	if p, ok := principal.FromContext(ctx); ok && p.IsCustomer() {
+		payment.CustomerID = p.Subject
+	}
+	if payment.Method == canonical.METHOD_UNSPECIFIED {
+		payment.Method = s.defaultMethod
+	}
+	if err := payment.ValidateMethod(); err != nil {
+		return nil, err
+	}
+
+	intent, err := s.intent(ctx, payment)
+	if err != nil {
+		return nil, err
+	}
+	payment.Attempt = intent.Attempts + 1
+
+	// card payments are only held on the card at order time, they are captured later
+	var details canonical.MethodDetails
+	if payment.Method.IsCard() {
+		details, err = s.providers.Route(payment.Method).Authorize(ctx, payment)
+	} else {
+		details, err = s.providers.Route(payment.Method).Charge(ctx, payment)
+	}
+	if err != nil {
+		return nil, err
+	}
+	// the payment expires then unless the provider wants it paid sooner
+	details = details.WithDeadline(payment.CreatedAt.Add(s.ttl))
+	payment.Details = &details
 
-	payment, err := s.repo.Create(ctx, payment)
+	payment, err = s.repo.Create(ctx, payment)
 	if err != nil {
 		return nil, err
 	}
+	s.audit(ctx, nil, payment, actor(ctx), "", "")
+
+	// failing to charge or store the payment does not use up an attempt
+	if err := s.countAttempt(ctx, *intent, payment); err != nil {
+		return nil, err
+	}
+
+	s.hub.Publish(payment)
+
+	if payment.Method.IsCard() {
+		if err := s.change(ctx, &payment, canonical.PAYMENT_AUTHORIZED, "", actor(ctx), "", ""); err != nil {
+			return nil, err
+		}
+	}
 
 	return &payment, nil
 }
 
+// GetByID hides payments of other customers as if they did not exist.
 func (s *paymentService) GetByID(ctx context.Context, id string) (*canonical.Payment, error) {
-	return s.repo.GetByID(ctx, id)
+	payment, err := s.repo.GetByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	if p, ok := principal.FromContext(ctx); ok && payment != nil && !p.Owns(payment.CustomerID) {
+		return nil, canonical.ErrorNotFound
+	}
+
+	return payment, nil
 }
 
-func (s *paymentService) Callback(ctx context.Context, paymentId string, status canonical.PaymentStatus) error {
+func (s *paymentService) Callback(ctx context.Context, paymentId string, status canonical.PaymentStatus, payload []byte) error {
 	payment, err := s.repo.GetByID(ctx, paymentId)
 	if err != nil {
 		return err
@@ -65,22 +167,280 @@ func (s *paymentService) Callback(ctx context.Context, paymentId string, status
 		return canonical.ErrorNotFound
 	}
 
-	payment.UpdatedAt = time.Now()
+	return s.transition(ctx, payment, status, payloadHash(payload))
+}
+
+// Reconcile asks the provider for the status of every payment still pending or authorized since
+// before createdBefore and applies it whenever it disagrees with ours, as a lost callback would
+// have.
+func (s *paymentService) Reconcile(ctx context.Context, createdBefore time.Time) (canonical.ReconciliationReport, error) {
+	report := canonical.ReconciliationReport{
+		ID:            s.ids.NewID(),
+		StartedAt:     s.clock.Now(),
+		Discrepancies: []canonical.Discrepancy{},
+		Errors:        []canonical.ReconciliationFailure{},
+	}
+
+	var payments []canonical.Payment
+	for _, status := range []canonical.PaymentStatus{canonical.PAYMENT_CREATED, canonical.PAYMENT_AUTHORIZED} {
+		found, err := s.repo.GetByStatusCreatedBefore(ctx, status, createdBefore)
+		if err != nil {
+			report.FinishedAt = s.clock.Now()
+			return report, err
+		}
+		payments = append(payments, found...)
+	}
+
+	for i := range payments {
+		payment := &payments[i]
+
+		status, err := s.providers.Route(payment.Method).GetStatus(ctx, *payment)
+		if errors.Is(err, payment_provider.ErrorUnsupported) {
+			report.Skipped++
+			continue
+		}
+		report.Checked++
+		if err != nil {
+			report.Errors = append(report.Errors, canonical.ReconciliationFailure{
+				PaymentID: payment.ID,
+				Error:     err.Error(),
+			})
+			continue
+		}
+
+		if status == payment.Status {
+			continue
+		}
+
+		discrepancy := canonical.Discrepancy{
+			PaymentID:      payment.ID,
+			OrderID:        payment.OrderID,
+			LocalStatus:    payment.Status,
+			ProviderStatus: status,
+		}
+		if err := s.transition(ctx, payment, status, ""); err != nil {
+			discrepancy.Error = err.Error()
+		} else {
+			discrepancy.Fixed = true
+		}
+		report.Discrepancies = append(report.Discrepancies, discrepancy)
+	}
+
+	report.FinishedAt = s.clock.Now()
+	return report, nil
+}
+
+// transition applies a status reported by the provider. Repeated reports are ignored and a
+// payment that already reached a final status can not be moved anymore, nor back to pending,
+// except for payed payments being refunded.
+func (s *paymentService) transition(ctx context.Context, payment *canonical.Payment, status canonical.PaymentStatus, payloadHash string) error {
+	if payment.Status == status {
+		return nil
+	}
+
+	refund := payment.Status == canonical.PAYMENT_PAYED && status == canonical.PAYMENT_REFUNDED
+	if status == canonical.PAYMENT_REFUNDED && !refund {
+		return canonical.ErrorInvalidTransition
+	}
+	if (payment.Status.IsFinal() && !refund) || status == canonical.PAYMENT_CREATED {
+		return canonical.ErrorInvalidTransition
+	}
+	// only cards can hold an amount
+	if status == canonical.PAYMENT_AUTHORIZED && !payment.Method.IsCard() {
+		return canonical.ErrorInvalidTransition
+	}
+	// the provider captured the whole authorization
+	if status == canonical.PAYMENT_PAYED && payment.Status == canonical.PAYMENT_AUTHORIZED {
+		payment.CapturedAmount = payment.Amount
+	}
+
+	var reason canonical.StatusReason
+	if status == canonical.PAYMENT_FAILED {
+		reason = canonical.REASON_PROVIDER_FAILURE
+	}
+
+	return s.change(ctx, payment, status, reason, ACTOR_PROVIDER_PREFIX+s.providers.Route(payment.Method).Name(), payloadHash, "")
+}
+
+// change moves the payment from the status it was read with to the given one, records it in
+// the audit trail and tells about it.
+func (s *paymentService) change(ctx context.Context, payment *canonical.Payment, status canonical.PaymentStatus, reason canonical.StatusReason, actor, payloadHash, note string) error {
+	current := payment.Status
+	payment.UpdatedAt = s.clock.Now()
 	payment.Status = status
+	payment.Reason = reason
 
-	err = s.repo.Update(ctx, paymentId, *payment)
+	err := s.repo.UpdateFromStatus(ctx, payment.ID, current, *payment)
 	if err != nil {
 		return err
 	}
+	// the change was appended right after the version the payment was read with
+	payment.Version++
+	s.audit(ctx, &current, *payment, actor, payloadHash, note)
+
+	return s.notify(ctx, *payment)
+}
+
+func (s *paymentService) Cancel(ctx context.Context, paymentId string, reason canonical.StatusReason) (*canonical.Payment, error) {
+	payment, err := s.GetByID(ctx, paymentId)
+	if err != nil {
+		return nil, err
+	}
 
-	err = s.publisher.SendMessage(payment.OrderID, s.statusToQueue[status])
+	if payment == nil {
+		return nil, canonical.ErrorNotFound
+	}
+
+	return s.finish(ctx, payment, canonical.PAYMENT_CANCELLED, reason)
+}
+
+func (s *paymentService) CancelByOrderID(ctx context.Context, orderId string, reason canonical.StatusReason) (*canonical.Payment, error) {
+	payment, err := s.repo.GetByOrderID(ctx, orderId)
 	if err != nil {
+		return nil, err
+	}
+
+	if payment == nil {
+		return nil, canonical.ErrorNotFound
+	}
+
+	// the last attempt failed and the intent is waiting for another one
+	if payment.Status == canonical.PAYMENT_FAILED && payment.Attempt > 0 {
+		if err := s.cancelIntent(ctx, orderId, reason); err != nil {
+			return nil, err
+		}
+		return payment, nil
+	}
+
+	return s.finish(ctx, payment, canonical.PAYMENT_CANCELLED, reason)
+}
+
+// Expire gives up on every payment still waiting for the customer since before createdBefore,
+// and on every intent still waiting for an attempt to succeed whose last attempt was made
+// before it, so an intent expires with the deadline given to the customer for its last attempt.
+// Payments and intents that change status meanwhile are skipped.
+func (s *paymentService) Expire(ctx context.Context, createdBefore time.Time) ([]canonical.Payment, error) {
+	payments, err := s.repo.GetByStatusCreatedBefore(ctx, canonical.PAYMENT_CREATED, createdBefore)
+	if err != nil {
+		return nil, err
+	}
+
+	expired := make([]canonical.Payment, 0, len(payments))
+	for i := range payments {
+		payment, err := s.finish(ctx, &payments[i], canonical.PAYMENT_EXPIRED, canonical.REASON_EXPIRED)
+		if err != nil {
+			if errors.Is(err, canonical.ErrorInvalidTransition) {
+				continue
+			}
+			return expired, err
+		}
+		expired = append(expired, *payment)
+	}
+
+	intents, err := s.intents.GetOpenUpdatedBefore(ctx, createdBefore)
+	if err != nil {
+		return expired, err
+	}
+
+	for _, intent := range intents {
+		payment, err := s.repo.GetByOrderID(ctx, intent.OrderID)
+		if err != nil && !errors.Is(err, canonical.ErrorNotFound) {
+			return expired, err
+		}
+
+		// an authorization is held until it is captured or voided
+		if payment != nil && payment.Status == canonical.PAYMENT_AUTHORIZED {
+			continue
+		}
+
+		// a pending attempt settles the intent as it expires
+		if payment != nil && payment.Status == canonical.PAYMENT_CREATED {
+			payment, err = s.finish(ctx, payment, canonical.PAYMENT_EXPIRED, canonical.REASON_EXPIRED)
+			if err == nil {
+				expired = append(expired, *payment)
+			}
+		} else {
+			err = s.cancelIntent(ctx, intent.OrderID, canonical.REASON_EXPIRED)
+		}
+		if err != nil && !errors.Is(err, canonical.ErrorInvalidTransition) {
+			return expired, err
+		}
+	}
+
+	return expired, nil
+}
+
+// finish voids a pending or authorized payment at the provider and moves it to a final status
+// without going through the provider callback.
+func (s *paymentService) finish(ctx context.Context, payment *canonical.Payment, status canonical.PaymentStatus, reason canonical.StatusReason) (*canonical.Payment, error) {
+	if payment.Status.IsFinal() {
+		return nil, canonical.ErrorInvalidTransition
+	}
+
+	err := s.providers.Route(payment.Method).Void(ctx, *payment)
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.change(ctx, payment, status, reason, actor(ctx), "", "")
+	if err != nil {
+		return nil, err
+	}
+
+	return payment, nil
+}
+
+// notify tells the watchers about the payment's new status, and the order service when the
+// status settles the intent of the order.
+func (s *paymentService) notify(ctx context.Context, payment canonical.Payment) error {
+	s.hub.Publish(payment)
+
+	// an authorized payment still has to be captured
+	if !payment.Status.IsFinal() {
+		return nil
+	}
+	// the order service has no event for refunds, the payment settled the order already
+	if payment.Status == canonical.PAYMENT_REFUNDED {
+		return nil
+	}
+
+	settled, reason, err := s.settle(ctx, payment)
+	if err != nil || !settled {
 		return err
 	}
 
-	return nil
+	return s.publish(ctx, payment.OrderID, s.statusToQueue[payment.Status], reason)
+}
+
+func (s *paymentService) publish(ctx context.Context, orderId, queue string, reason canonical.StatusReason) error {
+	if len(reason) == 0 {
+		return s.publisher.SendMessage(ctx, orderId, queue)
+	}
+
+	return s.publisher.SendMessageWithAttributes(ctx, orderId, queue, map[string]string{
+		REASON_ATTRIBUTE: string(reason),
+	})
 }
 
+// GetAll lists only the caller's own payments for customers, listing every payment requires the admin scope.
 func (s *paymentService) GetAll(ctx context.Context) ([]canonical.Payment, error) {
+	if p, ok := principal.FromContext(ctx); ok {
+		if p.IsCustomer() {
+			return s.repo.GetByCustomerID(ctx, p.Subject)
+		}
+		if !p.HasScopes(principal.SCOPE_ADMIN) {
+			return nil, canonical.ErrorForbidden
+		}
+	}
+
 	return s.repo.GetAll(ctx)
 }
+
+// History is visible to whoever may read the payment.
+func (s *paymentService) History(ctx context.Context, paymentId string) ([]canonical.AuditEntry, error) {
+	if _, err := s.GetByID(ctx, paymentId); err != nil {
+		return nil, err
+	}
+
+	return s.audits.GetByPaymentID(ctx, paymentId)
+}
@@ -3,7 +3,10 @@ package service
 import (
 	"context"
 	"errors"
+	"tech-challenge-payment/internal/auth/principal"
 	"tech-challenge-payment/internal/canonical"
+	"tech-challenge-payment/internal/canonical/canonicaltest"
+	"tech-challenge-payment/internal/integration/payment_provider"
 	"tech-challenge-payment/internal/integration/sqs_publisher"
 	"tech-challenge-payment/internal/repository"
 	"testing"
@@ -13,8 +16,10 @@ import (
 	"github.com/stretchr/testify/mock"
 )
 
+// now is where the clock of the services under test stands.
+var now = time.Date(2020, 11, 1, 12, 0, 0, 0, time.UTC)
+
 func TestCreate(t *testing.T) {
-	time := time.Now()
 	type Given struct {
 		payment     canonical.Payment
 		paymentRepo func() repository.PaymentRepository
@@ -31,23 +36,24 @@ func TestCreate(t *testing.T) {
 				payment: canonical.Payment{
 					ID:          canonical.NewUUID(),
 					OrderID:     "1234",
-					PaymentType: 3,
-					CreatedAt:   time,
-					UpdatedAt:   time,
+					Method:      canonical.METHOD_BOLETO,
+					CreatedAt:   now,
+					UpdatedAt:   now,
 					Status:      canonical.PAYMENT_CREATED,
 				},
 				paymentRepo: func() repository.PaymentRepository {
 					payment := canonical.Payment{
 						ID:          canonical.NewUUID(),
 						OrderID:     "1234",
-						PaymentType: 3,
-						CreatedAt:   time,
-						UpdatedAt:   time,
+						Method:      canonical.METHOD_BOLETO,
+						CreatedAt:   now,
+						UpdatedAt:   now,
 						Status:      canonical.PAYMENT_CREATED,
 					}
 					repoMock := &PaymentRepositoryMock{}
+					repoMock.On("GetByOrderID", mock.Anything, "1234").Return(nil, canonical.ErrorNotFound)
 					repoMock.On("Create", mock.Anything, mock.MatchedBy(func(payment canonical.Payment) bool {
-						return payment.OrderID == "1234"
+						return payment.OrderID == "1234" && payment.ID == "payment-1" && payment.CreatedAt.Equal(now) && payment.Attempt == 1
 					})).Return(payment, nil)
 					return repoMock
 				},
@@ -61,19 +67,20 @@ func TestCreate(t *testing.T) {
 				payment: canonical.Payment{
 					ID:          canonical.NewUUID(),
 					OrderID:     "1234",
-					PaymentType: 3,
-					CreatedAt:   time,
-					UpdatedAt:   time,
+					Method:      canonical.METHOD_BOLETO,
+					CreatedAt:   now,
+					UpdatedAt:   now,
 					Status:      canonical.PAYMENT_CREATED,
 				},
 				paymentRepo: func() repository.PaymentRepository {
 					repoMock := &PaymentRepositoryMock{}
+					repoMock.On("GetByOrderID", mock.Anything, "1234").Return(nil, canonical.ErrorNotFound)
 					repoMock.On("Create", mock.Anything, mock.Anything).Return(canonical.Payment{
 						ID:          canonical.NewUUID(),
 						OrderID:     "1234",
-						PaymentType: 3,
-						CreatedAt:   time,
-						UpdatedAt:   time,
+						Method:      canonical.METHOD_BOLETO,
+						CreatedAt:   now,
+						UpdatedAt:   now,
 						Status:      canonical.PAYMENT_CREATED,
 					}, errors.New("error creating payment"))
 					return repoMock
@@ -87,13 +94,141 @@ func TestCreate(t *testing.T) {
 
 	for _, tc := range tests {
 		paymentSvc := paymentService{
-			repo: tc.given.paymentRepo(),
+			repo:          tc.given.paymentRepo(),
+			intents:       newIntentMock(),
+			audits:        newAuditMock(),
+			providers:     newProviderMock(),
+			hub:           newHubMock(),
+			clock:         canonicaltest.NewClock(now),
+			ids:           canonicaltest.NewIDs("payment"),
+			maxAttempts:   3,
+			defaultMethod: canonical.METHOD_PIX,
 		}
 		_, err := paymentSvc.Create(context.Background(), tc.given.payment)
 
 		tc.expected.err(t, err)
 	}
 }
+func TestCreateMethod(t *testing.T) {
+	card := &canonical.MethodDetails{Card: &canonical.CardDetails{Token: "tok_4242"}}
+
+	type Given struct {
+		payment   canonical.Payment
+		details   canonical.MethodDetails
+		chargeErr error
+	}
+	type Expected struct {
+		method  canonical.PaymentMethod
+		details *canonical.MethodDetails
+		err     error
+	}
+	tests := map[string]struct {
+		given    Given
+		expected Expected
+	}{
+		"given no method, must charge the default one until the payment expires": {
+			given: Given{
+				payment: canonical.Payment{OrderID: "1234"},
+				details: canonical.MethodDetails{Pix: &canonical.PixDetails{QRCode: "qr"}},
+			},
+			expected: Expected{
+				method:  canonical.METHOD_PIX,
+				details: &canonical.MethodDetails{Pix: &canonical.PixDetails{QRCode: "qr", ExpiresAt: now.Add(30 * time.Minute)}},
+			},
+		},
+		"given boleto with a due date from the provider, must keep it": {
+			given: Given{
+				payment: canonical.Payment{OrderID: "1234", Method: canonical.METHOD_BOLETO},
+				details: canonical.MethodDetails{Boleto: &canonical.BoletoDetails{Barcode: "123", DueDate: now.Add(72 * time.Hour)}},
+			},
+			expected: Expected{
+				method:  canonical.METHOD_BOLETO,
+				details: &canonical.MethodDetails{Boleto: &canonical.BoletoDetails{Barcode: "123", DueDate: now.Add(72 * time.Hour)}},
+			},
+		},
+		"given card with token, must authorize it and save what the provider tells about the card": {
+			given: Given{
+				payment: canonical.Payment{OrderID: "1234", Method: canonical.METHOD_CREDIT_CARD, Amount: 2500, Details: card},
+				details: canonical.MethodDetails{Card: &canonical.CardDetails{Last4: "4242", Brand: "VISA"}},
+			},
+			expected: Expected{
+				method:  canonical.METHOD_CREDIT_CARD,
+				details: &canonical.MethodDetails{Card: &canonical.CardDetails{Last4: "4242", Brand: "VISA"}},
+			},
+		},
+		"given card without token, must return invalid payment": {
+			given: Given{
+				payment: canonical.Payment{OrderID: "1234", Method: canonical.METHOD_DEBIT_CARD},
+			},
+			expected: Expected{err: canonical.ErrorInvalidPayment},
+		},
+		"given unknown method, must return invalid payment": {
+			given: Given{
+				payment: canonical.Payment{OrderID: "1234", Method: canonical.PaymentMethod(42)},
+			},
+			expected: Expected{err: canonical.ErrorInvalidPayment},
+		},
+		"given provider error charging, must return it": {
+			given: Given{
+				payment:   canonical.Payment{OrderID: "1234", Method: canonical.METHOD_CASH},
+				chargeErr: errors.New("provider error"),
+			},
+			expected: Expected{err: errors.New("provider error")},
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			repoMock := &PaymentRepositoryMock{}
+			repoMock.On("GetByOrderID", mock.Anything, "1234").Return(nil, canonical.ErrorNotFound)
+			repoMock.On("Create", mock.Anything, mock.Anything).Return(canonical.Payment{ID: "payment-1", Method: tc.expected.method}, nil)
+			repoMock.On("UpdateFromStatus", mock.Anything, "payment-1", canonical.PAYMENT_CREATED, mock.Anything).Return(nil)
+			providerMock := &ProviderMock{}
+			providerMock.On("Charge", mock.Anything, mock.Anything).Return(tc.given.details, tc.given.chargeErr)
+			providerMock.On("Authorize", mock.Anything, mock.Anything).Return(tc.given.details, tc.given.chargeErr)
+			paymentSvc := paymentService{
+				repo:          repoMock,
+				intents:       newIntentMock(),
+				audits:        newAuditMock(),
+				providers:     providerMock,
+				hub:           newHubMock(),
+				clock:         canonicaltest.NewClock(now),
+				ids:           canonicaltest.NewIDs("payment"),
+				maxAttempts:   3,
+				defaultMethod: canonical.METHOD_PIX,
+				ttl:           30 * time.Minute,
+			}
+
+			payment, err := paymentSvc.Create(context.Background(), tc.given.payment)
+
+			if tc.expected.err != nil {
+				if errors.Is(tc.expected.err, canonical.ErrorInvalidPayment) {
+					assert.ErrorIs(t, err, tc.expected.err)
+					providerMock.AssertNotCalled(t, "Charge", mock.Anything, mock.Anything)
+				} else {
+					assert.Equal(t, tc.expected.err, err)
+				}
+				repoMock.AssertNotCalled(t, "Create", mock.Anything, mock.Anything)
+				return
+			}
+			assert.NoError(t, err)
+			called, skipped, status := "Charge", "Authorize", canonical.PAYMENT_CREATED
+			if tc.expected.method.IsCard() {
+				called, skipped, status = "Authorize", "Charge", canonical.PAYMENT_AUTHORIZED
+			}
+			providerMock.AssertCalled(t, called, mock.Anything, mock.MatchedBy(func(payment canonical.Payment) bool {
+				// the card token reaches the provider
+				return payment.Method == tc.expected.method && payment.Details == tc.given.payment.Details
+			}))
+			providerMock.AssertNotCalled(t, skipped, mock.Anything, mock.Anything)
+			assert.Equal(t, status, payment.Status)
+			repoMock.AssertCalled(t, "Create", mock.Anything, mock.MatchedBy(func(payment canonical.Payment) bool {
+				return payment.Method == tc.expected.method && assert.ObjectsAreEqual(tc.expected.details, payment.Details)
+			}))
+		})
+	}
+}
+
 func TestGetByID(t *testing.T) {
 
 	type Given struct {
@@ -116,9 +251,9 @@ func TestGetByID(t *testing.T) {
 					repoMock.On("GetByID", mock.Anything, "1234").Return(&canonical.Payment{
 						ID:          canonical.NewUUID(),
 						OrderID:     "1234",
-						PaymentType: 3,
-						CreatedAt:   time.Now(),
-						UpdatedAt:   time.Now(),
+						Method:      canonical.METHOD_BOLETO,
+						CreatedAt:   now,
+						UpdatedAt:   now,
 						Status:      canonical.PAYMENT_CREATED,
 					}, nil)
 					return repoMock
@@ -144,9 +279,9 @@ func TestCallback(t *testing.T) {
 	payment := &canonical.Payment{
 		ID:          canonical.NewUUID(),
 		OrderID:     "1234",
-		PaymentType: 3,
-		CreatedAt:   time.Now(),
-		UpdatedAt:   time.Now(),
+		Method:      canonical.METHOD_BOLETO,
+		CreatedAt:   now,
+		UpdatedAt:   now,
 		Status:      canonical.PAYMENT_CREATED,
 	}
 	type Given struct {
@@ -168,8 +303,8 @@ func TestCallback(t *testing.T) {
 				status: canonical.PAYMENT_FAILED,
 				paymentRepo: func() repository.PaymentRepository {
 					repoMock := &PaymentRepositoryMock{}
-					repoMock.On("GetByID", mock.Anything, payment.OrderID).Return(payment, nil)
-					repoMock.On("Update", mock.Anything, payment.OrderID, mock.MatchedBy(func(input canonical.Payment) bool {
+					repoMock.On("GetByID", mock.Anything, payment.OrderID).Return(copyPayment(payment), nil)
+					repoMock.On("UpdateFromStatus", mock.Anything, payment.ID, canonical.PAYMENT_CREATED, mock.MatchedBy(func(input canonical.Payment) bool {
 						return input.OrderID == payment.OrderID
 					})).Return(nil)
 					return repoMock
@@ -177,7 +312,9 @@ func TestCallback(t *testing.T) {
 				publisher: func() sqs_publisher.Publisher {
 					pubMock := new(PublisherMock)
 
-					pubMock.On("SendMessage").Return(nil)
+					pubMock.On("SendMessageWithAttributes", map[string]string{
+						REASON_ATTRIBUTE: string(canonical.REASON_PROVIDER_FAILURE),
+					}).Return(nil)
 
 					return pubMock
 				},
@@ -220,6 +357,125 @@ func TestCallback(t *testing.T) {
 				err: assert.Error,
 			},
 		},
+		"given payment already in the status, must do nothing": {
+			given: Given{
+				id:     payment.OrderID,
+				status: canonical.PAYMENT_CREATED,
+				paymentRepo: func() repository.PaymentRepository {
+					repoMock := &PaymentRepositoryMock{}
+					repoMock.On("GetByID", mock.Anything, payment.OrderID).Return(copyPayment(payment), nil)
+					return repoMock
+				},
+				publisher: func() sqs_publisher.Publisher {
+					return new(PublisherMock)
+				},
+			},
+			expected: Expected{
+				err: assert.NoError,
+			},
+		},
+		"given payment already finished, must return invalid transition": {
+			given: Given{
+				id:     payment.OrderID,
+				status: canonical.PAYMENT_PAYED,
+				paymentRepo: func() repository.PaymentRepository {
+					finished := copyPayment(payment)
+					finished.Status = canonical.PAYMENT_CANCELLED
+					repoMock := &PaymentRepositoryMock{}
+					repoMock.On("GetByID", mock.Anything, payment.OrderID).Return(finished, nil)
+					return repoMock
+				},
+				publisher: func() sqs_publisher.Publisher {
+					return new(PublisherMock)
+				},
+			},
+			expected: Expected{
+				err: func(tt assert.TestingT, err error, i ...interface{}) bool {
+					return assert.ErrorIs(tt, err, canonical.ErrorInvalidTransition, i...)
+				},
+			},
+		},
+		"given authorized payment reported pending, must return invalid transition": {
+			given: Given{
+				id:     payment.OrderID,
+				status: canonical.PAYMENT_CREATED,
+				paymentRepo: func() repository.PaymentRepository {
+					authorized := copyPayment(payment)
+					authorized.Status = canonical.PAYMENT_AUTHORIZED
+					repoMock := &PaymentRepositoryMock{}
+					repoMock.On("GetByID", mock.Anything, payment.OrderID).Return(authorized, nil)
+					return repoMock
+				},
+				publisher: func() sqs_publisher.Publisher {
+					return new(PublisherMock)
+				},
+			},
+			expected: Expected{
+				err: func(tt assert.TestingT, err error, i ...interface{}) bool {
+					return assert.ErrorIs(tt, err, canonical.ErrorInvalidTransition, i...)
+				},
+			},
+		},
+		"given boleto payment reported authorized, must return invalid transition": {
+			given: Given{
+				id:     payment.OrderID,
+				status: canonical.PAYMENT_AUTHORIZED,
+				paymentRepo: func() repository.PaymentRepository {
+					repoMock := &PaymentRepositoryMock{}
+					repoMock.On("GetByID", mock.Anything, payment.OrderID).Return(copyPayment(payment), nil)
+					return repoMock
+				},
+				publisher: func() sqs_publisher.Publisher {
+					return new(PublisherMock)
+				},
+			},
+			expected: Expected{
+				err: func(tt assert.TestingT, err error, i ...interface{}) bool {
+					return assert.ErrorIs(tt, err, canonical.ErrorInvalidTransition, i...)
+				},
+			},
+		},
+		"given payed payment refunded, must record the refund without telling the order service": {
+			given: Given{
+				id:     payment.OrderID,
+				status: canonical.PAYMENT_REFUNDED,
+				paymentRepo: func() repository.PaymentRepository {
+					payed := copyPayment(payment)
+					payed.Status = canonical.PAYMENT_PAYED
+					repoMock := &PaymentRepositoryMock{}
+					repoMock.On("GetByID", mock.Anything, payment.OrderID).Return(payed, nil)
+					repoMock.On("UpdateFromStatus", mock.Anything, payment.ID, canonical.PAYMENT_PAYED, mock.MatchedBy(func(input canonical.Payment) bool {
+						return input.Status == canonical.PAYMENT_REFUNDED
+					})).Return(nil)
+					return repoMock
+				},
+				publisher: func() sqs_publisher.Publisher {
+					return new(PublisherMock)
+				},
+			},
+			expected: Expected{
+				err: assert.NoError,
+			},
+		},
+		"given pending payment refunded, must return invalid transition": {
+			given: Given{
+				id:     payment.OrderID,
+				status: canonical.PAYMENT_REFUNDED,
+				paymentRepo: func() repository.PaymentRepository {
+					repoMock := &PaymentRepositoryMock{}
+					repoMock.On("GetByID", mock.Anything, payment.OrderID).Return(copyPayment(payment), nil)
+					return repoMock
+				},
+				publisher: func() sqs_publisher.Publisher {
+					return new(PublisherMock)
+				},
+			},
+			expected: Expected{
+				err: func(tt assert.TestingT, err error, i ...interface{}) bool {
+					return assert.ErrorIs(tt, err, canonical.ErrorInvalidTransition, i...)
+				},
+			},
+		},
 		"given update error return error": {
 			given: Given{
 				id:     payment.OrderID,
@@ -227,8 +483,8 @@ func TestCallback(t *testing.T) {
 				paymentRepo: func() repository.PaymentRepository {
 					repoMock := &PaymentRepositoryMock{}
 
-					repoMock.On("GetByID", mock.Anything, payment.OrderID).Return(payment, nil)
-					repoMock.On("Update", mock.Anything, payment.OrderID, mock.MatchedBy(func(input canonical.Payment) bool {
+					repoMock.On("GetByID", mock.Anything, payment.OrderID).Return(copyPayment(payment), nil)
+					repoMock.On("UpdateFromStatus", mock.Anything, payment.ID, canonical.PAYMENT_CREATED, mock.MatchedBy(func(input canonical.Payment) bool {
 						return input.OrderID == payment.OrderID
 					})).Return(errors.New("db error"))
 					return repoMock
@@ -247,12 +503,417 @@ func TestCallback(t *testing.T) {
 		t.Run(name, func(t *testing.T) {
 			paymentSvc := paymentService{
 				repo:      tc.given.paymentRepo(),
+				audits:    newAuditMock(),
 				publisher: tc.given.publisher(),
+				providers:  &ProviderMock{},
+				hub:       newHubMock(),
+				clock:     canonicaltest.NewClock(now),
+				ids:       canonicaltest.NewIDs("audit"),
 			}
 
-			err := paymentSvc.Callback(context.Background(), tc.given.id, tc.given.status)
+			err := paymentSvc.Callback(context.Background(), tc.given.id, tc.given.status, []byte(`{"status":"OK"}`))
 
 			tc.expected.err(t, err)
 		})
 	}
 }
+
+func TestCancel(t *testing.T) {
+	type Given struct {
+		payment   *canonical.Payment
+		repoErr   error
+		voidErr   error
+		publisher func() sqs_publisher.Publisher
+	}
+	type Expected struct {
+		err assert.ErrorAssertionFunc
+	}
+	tests := map[string]struct {
+		given    Given
+		expected Expected
+	}{
+		"given created payment, must void, cancel and publish with reason": {
+			given: Given{
+				payment: &canonical.Payment{ID: "1234", OrderID: "order", Status: canonical.PAYMENT_CREATED},
+				publisher: func() sqs_publisher.Publisher {
+					pubMock := new(PublisherMock)
+					pubMock.On("SendMessageWithAttributes", map[string]string{
+						REASON_ATTRIBUTE: string(canonical.REASON_REQUESTED),
+					}).Return(nil)
+					return pubMock
+				},
+			},
+			expected: Expected{
+				err: assert.NoError,
+			},
+		},
+		"given payed payment, must return invalid transition": {
+			given: Given{
+				payment: &canonical.Payment{ID: "1234", OrderID: "order", Status: canonical.PAYMENT_PAYED},
+				publisher: func() sqs_publisher.Publisher {
+					return new(PublisherMock)
+				},
+			},
+			expected: Expected{
+				err: func(tt assert.TestingT, err error, i ...interface{}) bool {
+					return assert.ErrorIs(tt, err, canonical.ErrorInvalidTransition, i...)
+				},
+			},
+		},
+		"given provider error, must not cancel": {
+			given: Given{
+				payment: &canonical.Payment{ID: "1234", OrderID: "order", Status: canonical.PAYMENT_CREATED},
+				voidErr: errors.New("provider error"),
+				publisher: func() sqs_publisher.Publisher {
+					return new(PublisherMock)
+				},
+			},
+			expected: Expected{
+				err: assert.Error,
+			},
+		},
+		"given error on db search, must return error": {
+			given: Given{
+				repoErr: errors.New("db error"),
+				publisher: func() sqs_publisher.Publisher {
+					return new(PublisherMock)
+				},
+			},
+			expected: Expected{
+				err: assert.Error,
+			},
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			repoMock := &PaymentRepositoryMock{}
+			repoMock.On("GetByID", mock.Anything, "1234").Return(tc.given.payment, tc.given.repoErr)
+			repoMock.On("UpdateFromStatus", mock.Anything, "1234", canonical.PAYMENT_CREATED, mock.MatchedBy(func(input canonical.Payment) bool {
+				return input.Status == canonical.PAYMENT_CANCELLED && input.Reason == canonical.REASON_REQUESTED
+			})).Return(nil)
+
+			providerMock := &ProviderMock{}
+			providerMock.On("Void", mock.Anything, mock.Anything).Return(tc.given.voidErr)
+
+			paymentSvc := paymentService{
+				repo:      repoMock,
+				audits:    newAuditMock(),
+				publisher: tc.given.publisher(),
+				providers:  providerMock,
+				hub:       newHubMock(),
+				clock:     canonicaltest.NewClock(now),
+				ids:       canonicaltest.NewIDs("audit"),
+			}
+
+			_, err := paymentSvc.Cancel(context.Background(), "1234", canonical.REASON_REQUESTED)
+
+			tc.expected.err(t, err)
+		})
+	}
+}
+
+func TestCancelByOrderID(t *testing.T) {
+	type Given struct {
+		payment *canonical.Payment
+		repoErr error
+	}
+	type Expected struct {
+		err assert.ErrorAssertionFunc
+	}
+	tests := map[string]struct {
+		given    Given
+		expected Expected
+	}{
+		"given payment linked to the order, must cancel it with order reason": {
+			given: Given{
+				payment: &canonical.Payment{ID: "1234", OrderID: "order", Status: canonical.PAYMENT_CREATED},
+			},
+			expected: Expected{
+				err: assert.NoError,
+			},
+		},
+		"given no payment linked to the order, must return not found": {
+			given: Given{
+				repoErr: canonical.ErrorNotFound,
+			},
+			expected: Expected{
+				err: func(tt assert.TestingT, err error, i ...interface{}) bool {
+					return assert.ErrorIs(tt, err, canonical.ErrorNotFound, i...)
+				},
+			},
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			repoMock := &PaymentRepositoryMock{}
+			repoMock.On("GetByOrderID", mock.Anything, "order").Return(tc.given.payment, tc.given.repoErr)
+			repoMock.On("UpdateFromStatus", mock.Anything, "1234", canonical.PAYMENT_CREATED, mock.MatchedBy(func(input canonical.Payment) bool {
+				return input.Status == canonical.PAYMENT_CANCELLED && input.Reason == canonical.REASON_ORDER_CANCELLED
+			})).Return(nil)
+
+			providerMock := &ProviderMock{}
+			providerMock.On("Void", mock.Anything, mock.Anything).Return(nil)
+
+			pubMock := new(PublisherMock)
+			pubMock.On("SendMessageWithAttributes", map[string]string{
+				REASON_ATTRIBUTE: string(canonical.REASON_ORDER_CANCELLED),
+			}).Return(nil)
+
+			paymentSvc := paymentService{
+				repo:      repoMock,
+				audits:    newAuditMock(),
+				publisher: pubMock,
+				providers:  providerMock,
+				hub:       newHubMock(),
+				clock:     canonicaltest.NewClock(now),
+				ids:       canonicaltest.NewIDs("audit"),
+			}
+
+			_, err := paymentSvc.CancelByOrderID(context.Background(), "order", canonical.REASON_ORDER_CANCELLED)
+
+			tc.expected.err(t, err)
+		})
+	}
+}
+
+func TestExpire(t *testing.T) {
+	before := now.Add(-30 * time.Minute)
+
+	type Given struct {
+		payments  []canonical.Payment
+		searchErr error
+		updateErr error
+	}
+	type Expected struct {
+		expired int
+		err     assert.ErrorAssertionFunc
+	}
+	tests := map[string]struct {
+		given    Given
+		expected Expected
+	}{
+		"given stale payments, must expire all of them": {
+			given: Given{
+				payments: []canonical.Payment{
+					{ID: "1234", OrderID: "order", Status: canonical.PAYMENT_CREATED},
+					{ID: "1235", OrderID: "order2", Status: canonical.PAYMENT_CREATED},
+				},
+			},
+			expected: Expected{
+				expired: 2,
+				err:     assert.NoError,
+			},
+		},
+		"given payment payed meanwhile, must skip it": {
+			given: Given{
+				payments: []canonical.Payment{
+					{ID: "1234", OrderID: "order", Status: canonical.PAYMENT_CREATED},
+				},
+				updateErr: canonical.ErrorInvalidTransition,
+			},
+			expected: Expected{
+				expired: 0,
+				err:     assert.NoError,
+			},
+		},
+		"given error on db search, must return error": {
+			given: Given{
+				searchErr: errors.New("db error"),
+			},
+			expected: Expected{
+				expired: 0,
+				err:     assert.Error,
+			},
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			repoMock := &PaymentRepositoryMock{}
+			repoMock.On("GetByStatusCreatedBefore", mock.Anything, canonical.PAYMENT_CREATED, before).Return(tc.given.payments, tc.given.searchErr)
+			repoMock.On("UpdateFromStatus", mock.Anything, mock.Anything, canonical.PAYMENT_CREATED, mock.MatchedBy(func(input canonical.Payment) bool {
+				return input.Status == canonical.PAYMENT_EXPIRED && input.Reason == canonical.REASON_EXPIRED
+			})).Return(tc.given.updateErr)
+
+			providerMock := &ProviderMock{}
+			providerMock.On("Void", mock.Anything, mock.Anything).Return(nil)
+
+			pubMock := new(PublisherMock)
+			pubMock.On("SendMessageWithAttributes", map[string]string{
+				REASON_ATTRIBUTE: string(canonical.REASON_EXPIRED),
+			}).Return(nil)
+
+			paymentSvc := paymentService{
+				repo:      repoMock,
+				intents:   newIntentMock(),
+				audits:    newAuditMock(),
+				publisher: pubMock,
+				providers:  providerMock,
+				hub:       newHubMock(),
+				clock:     canonicaltest.NewClock(now),
+				ids:       canonicaltest.NewIDs("audit"),
+			}
+
+			expired, err := paymentSvc.Expire(context.Background(), before)
+
+			tc.expected.err(t, err)
+			assert.Len(t, expired, tc.expected.expired)
+		})
+	}
+}
+
+func TestReconcile(t *testing.T) {
+	before := now.Add(-10 * time.Minute)
+	payments := []canonical.Payment{
+		{ID: "in_sync", OrderID: "order1", Status: canonical.PAYMENT_CREATED},
+		{ID: "payed", OrderID: "order2", Status: canonical.PAYMENT_CREATED},
+		{ID: "unreachable", OrderID: "order3", Status: canonical.PAYMENT_CREATED},
+		{ID: "conflict", OrderID: "order4", Status: canonical.PAYMENT_CREATED},
+		{ID: "unsupported", OrderID: "order6", Status: canonical.PAYMENT_CREATED},
+	}
+	authorized := []canonical.Payment{
+		{ID: "captured", OrderID: "order5", Method: canonical.METHOD_CREDIT_CARD, Amount: 2500, Status: canonical.PAYMENT_AUTHORIZED},
+	}
+
+	repoMock := &PaymentRepositoryMock{}
+	repoMock.On("GetByStatusCreatedBefore", mock.Anything, canonical.PAYMENT_CREATED, before).Return(payments, nil)
+	repoMock.On("GetByStatusCreatedBefore", mock.Anything, canonical.PAYMENT_AUTHORIZED, before).Return(authorized, nil)
+	repoMock.On("UpdateFromStatus", mock.Anything, "captured", canonical.PAYMENT_AUTHORIZED, mock.MatchedBy(func(input canonical.Payment) bool {
+		return input.Status == canonical.PAYMENT_PAYED && input.CapturedAmount == 2500
+	})).Return(nil)
+	repoMock.On("UpdateFromStatus", mock.Anything, "payed", canonical.PAYMENT_CREATED, mock.MatchedBy(func(input canonical.Payment) bool {
+		return input.Status == canonical.PAYMENT_PAYED && input.UpdatedAt.Equal(now)
+	})).Return(nil)
+	repoMock.On("UpdateFromStatus", mock.Anything, "conflict", canonical.PAYMENT_CREATED, mock.Anything).Return(canonical.ErrorInvalidTransition)
+
+	providerMock := &ProviderMock{}
+	providerMock.On("GetStatus", mock.Anything, payments[0]).Return(canonical.PAYMENT_CREATED, nil)
+	providerMock.On("GetStatus", mock.Anything, payments[1]).Return(canonical.PAYMENT_PAYED, nil)
+	providerMock.On("GetStatus", mock.Anything, payments[2]).Return(canonical.PAYMENT_CREATED, errors.New("provider error"))
+	providerMock.On("GetStatus", mock.Anything, payments[3]).Return(canonical.PAYMENT_FAILED, nil)
+	providerMock.On("GetStatus", mock.Anything, payments[4]).Return(canonical.PAYMENT_CREATED, payment_provider.ErrorUnsupported)
+	providerMock.On("GetStatus", mock.Anything, authorized[0]).Return(canonical.PAYMENT_PAYED, nil)
+
+	pubMock := new(PublisherMock)
+	pubMock.On("SendMessage").Return(nil)
+
+	paymentSvc := paymentService{
+		repo:      repoMock,
+		audits:    newAuditMock(),
+		publisher: pubMock,
+		providers:  providerMock,
+		hub:       newHubMock(),
+		clock:     canonicaltest.NewClock(now),
+		ids:       canonicaltest.NewIDs("report"),
+	}
+
+	report, err := paymentSvc.Reconcile(context.Background(), before)
+
+	assert.NoError(t, err)
+	assert.Equal(t, "report-1", report.ID)
+	assert.Equal(t, now, report.StartedAt)
+	assert.Equal(t, now, report.FinishedAt)
+	assert.Equal(t, 5, report.Checked)
+	assert.Equal(t, 1, report.Skipped)
+	assert.Equal(t, []canonical.ReconciliationFailure{{PaymentID: "unreachable", Error: "provider error"}}, report.Errors)
+	assert.Equal(t, []canonical.Discrepancy{
+		{PaymentID: "payed", OrderID: "order2", LocalStatus: canonical.PAYMENT_CREATED, ProviderStatus: canonical.PAYMENT_PAYED, Fixed: true},
+		{PaymentID: "conflict", OrderID: "order4", LocalStatus: canonical.PAYMENT_CREATED, ProviderStatus: canonical.PAYMENT_FAILED, Error: canonical.ErrorInvalidTransition.Error()},
+		{PaymentID: "captured", OrderID: "order5", LocalStatus: canonical.PAYMENT_AUTHORIZED, ProviderStatus: canonical.PAYMENT_PAYED, Fixed: true},
+	}, report.Discrepancies)
+	pubMock.AssertNumberOfCalls(t, "SendMessage", 2)
+}
+
+func TestPrincipalRestrictions(t *testing.T) {
+	customer := principal.NewContext(context.Background(), principal.Principal{
+		Subject: "customer",
+		Scopes:  []string{principal.SCOPE_READ, principal.SCOPE_WRITE},
+		Roles:   []string{principal.ROLE_CUSTOMER},
+	})
+	service := principal.NewContext(context.Background(), principal.Principal{
+		Subject: "order-service",
+		Scopes:  []string{principal.SCOPE_READ, principal.SCOPE_WRITE},
+	})
+	admin := principal.NewContext(context.Background(), principal.Principal{
+		Subject: "ops",
+		Scopes:  []string{principal.SCOPE_ADMIN},
+	})
+
+	t.Run("given customer reading another customer's payment, must return not found", func(t *testing.T) {
+		repoMock := &PaymentRepositoryMock{}
+		repoMock.On("GetByID", mock.Anything, "1234").Return(&canonical.Payment{ID: "1234", CustomerID: "other"}, nil)
+		paymentSvc := paymentService{repo: repoMock}
+
+		_, err := paymentSvc.GetByID(customer, "1234")
+
+		assert.ErrorIs(t, err, canonical.ErrorNotFound)
+	})
+
+	t.Run("given customer reading its own payment, must return it", func(t *testing.T) {
+		repoMock := &PaymentRepositoryMock{}
+		repoMock.On("GetByID", mock.Anything, "1234").Return(&canonical.Payment{ID: "1234", CustomerID: "customer"}, nil)
+		paymentSvc := paymentService{repo: repoMock}
+
+		payment, err := paymentSvc.GetByID(customer, "1234")
+
+		assert.NoError(t, err)
+		assert.Equal(t, "1234", payment.ID)
+	})
+
+	t.Run("given customer cancelling another customer's payment, must return not found", func(t *testing.T) {
+		repoMock := &PaymentRepositoryMock{}
+		repoMock.On("GetByID", mock.Anything, "1234").Return(&canonical.Payment{ID: "1234", CustomerID: "other"}, nil)
+		paymentSvc := paymentService{repo: repoMock}
+
+		_, err := paymentSvc.Cancel(customer, "1234", canonical.REASON_REQUESTED)
+
+		assert.ErrorIs(t, err, canonical.ErrorNotFound)
+		repoMock.AssertNotCalled(t, "UpdateFromStatus", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+	})
+
+	t.Run("given customer creating a payment, must record the customer", func(t *testing.T) {
+		repoMock := &PaymentRepositoryMock{}
+		repoMock.On("Create", mock.Anything, mock.MatchedBy(func(payment canonical.Payment) bool {
+			return payment.CustomerID == "customer"
+		})).Return(canonical.Payment{ID: "1234", CustomerID: "customer"}, nil)
+		repoMock.On("GetByOrderID", mock.Anything, "1234").Return(nil, canonical.ErrorNotFound)
+		paymentSvc := paymentService{repo: repoMock, intents: newIntentMock(), audits: newAuditMock(), providers: newProviderMock(), hub: newHubMock(), clock: canonicaltest.NewClock(now), ids: canonicaltest.NewIDs("payment"), maxAttempts: 3, defaultMethod: canonical.METHOD_PIX}
+
+		_, err := paymentSvc.Create(customer, canonical.Payment{OrderID: "1234"})
+
+		assert.NoError(t, err)
+	})
+
+	t.Run("given customer listing payments, must list only its own", func(t *testing.T) {
+		repoMock := &PaymentRepositoryMock{}
+		repoMock.On("GetByCustomerID", mock.Anything, "customer").Return([]canonical.Payment{{ID: "1234"}}, nil)
+		paymentSvc := paymentService{repo: repoMock}
+
+		payments, err := paymentSvc.GetAll(customer)
+
+		assert.NoError(t, err)
+		assert.Len(t, payments, 1)
+		repoMock.AssertNotCalled(t, "GetAll", mock.Anything)
+	})
+
+	t.Run("given service without admin scope listing payments, must be forbidden", func(t *testing.T) {
+		paymentSvc := paymentService{repo: &PaymentRepositoryMock{}}
+
+		_, err := paymentSvc.GetAll(service)
+
+		assert.ErrorIs(t, err, canonical.ErrorForbidden)
+	})
+
+	t.Run("given admin listing payments, must list every payment", func(t *testing.T) {
+		repoMock := &PaymentRepositoryMock{}
+		repoMock.On("GetAll", mock.Anything).Return([]canonical.Payment{{ID: "1234"}, {ID: "1235"}}, nil)
+		paymentSvc := paymentService{repo: repoMock}
+
+		payments, err := paymentSvc.GetAll(admin)
+
+		assert.NoError(t, err)
+		assert.Len(t, payments, 2)
+	})
+}
@@ -0,0 +1,150 @@
+package service
+
+import (
+	"context"
+	"tech-challenge-payment/internal/canonical"
+	"tech-challenge-payment/internal/tracing"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	PAYMENT_ID_ATTRIBUTE = attribute.Key("payment.id")
+	ORDER_ID_ATTRIBUTE   = attribute.Key("payment.order_id")
+	STATUS_ATTRIBUTE     = attribute.Key("payment.status")
+	AMOUNT_ATTRIBUTE     = attribute.Key("payment.amount")
+)
+
+// tracedPaymentService opens a span around every call to the payment service, the spans of
+// the repository, provider and publisher calls hang from it.
+type tracedPaymentService struct {
+	next PaymentService
+}
+
+func (s *tracedPaymentService) GetByID(ctx context.Context, id string) (_ *canonical.Payment, err error) {
+	ctx, span := tracing.Start(ctx, "PaymentService.GetByID", trace.WithAttributes(PAYMENT_ID_ATTRIBUTE.String(id)))
+	defer func() { tracing.End(span, err) }()
+
+	return s.next.GetByID(ctx, id)
+}
+
+func (s *tracedPaymentService) Callback(ctx context.Context, paymentId string, status canonical.PaymentStatus, payload []byte) (err error) {
+	ctx, span := tracing.Start(ctx, "PaymentService.Callback", trace.WithAttributes(
+		PAYMENT_ID_ATTRIBUTE.String(paymentId),
+		STATUS_ATTRIBUTE.String(status.String()),
+	))
+	defer func() { tracing.End(span, err) }()
+
+	return s.next.Callback(ctx, paymentId, status, payload)
+}
+
+func (s *tracedPaymentService) Create(ctx context.Context, payment canonical.Payment) (created *canonical.Payment, err error) {
+	ctx, span := tracing.Start(ctx, "PaymentService.Create", trace.WithAttributes(ORDER_ID_ATTRIBUTE.String(payment.OrderID)))
+	defer func() {
+		if created != nil {
+			span.SetAttributes(PAYMENT_ID_ATTRIBUTE.String(created.ID))
+		}
+		tracing.End(span, err)
+	}()
+
+	return s.next.Create(ctx, payment)
+}
+
+func (s *tracedPaymentService) GetAll(ctx context.Context) (_ []canonical.Payment, err error) {
+	ctx, span := tracing.Start(ctx, "PaymentService.GetAll")
+	defer func() { tracing.End(span, err) }()
+
+	return s.next.GetAll(ctx)
+}
+
+func (s *tracedPaymentService) Cancel(ctx context.Context, paymentId string, reason canonical.StatusReason) (_ *canonical.Payment, err error) {
+	ctx, span := tracing.Start(ctx, "PaymentService.Cancel", trace.WithAttributes(PAYMENT_ID_ATTRIBUTE.String(paymentId)))
+	defer func() { tracing.End(span, err) }()
+
+	return s.next.Cancel(ctx, paymentId, reason)
+}
+
+func (s *tracedPaymentService) CancelByOrderID(ctx context.Context, orderId string, reason canonical.StatusReason) (_ *canonical.Payment, err error) {
+	ctx, span := tracing.Start(ctx, "PaymentService.CancelByOrderID", trace.WithAttributes(ORDER_ID_ATTRIBUTE.String(orderId)))
+	defer func() { tracing.End(span, err) }()
+
+	return s.next.CancelByOrderID(ctx, orderId, reason)
+}
+
+func (s *tracedPaymentService) Expire(ctx context.Context, createdBefore time.Time) (_ []canonical.Payment, err error) {
+	ctx, span := tracing.Start(ctx, "PaymentService.Expire")
+	defer func() { tracing.End(span, err) }()
+
+	return s.next.Expire(ctx, createdBefore)
+}
+
+func (s *tracedPaymentService) Reconcile(ctx context.Context, createdBefore time.Time) (_ canonical.ReconciliationReport, err error) {
+	ctx, span := tracing.Start(ctx, "PaymentService.Reconcile")
+	defer func() { tracing.End(span, err) }()
+
+	return s.next.Reconcile(ctx, createdBefore)
+}
+
+func (s *tracedPaymentService) History(ctx context.Context, paymentId string) (_ []canonical.AuditEntry, err error) {
+	ctx, span := tracing.Start(ctx, "PaymentService.History", trace.WithAttributes(PAYMENT_ID_ATTRIBUTE.String(paymentId)))
+	defer func() { tracing.End(span, err) }()
+
+	return s.next.History(ctx, paymentId)
+}
+
+func (s *tracedPaymentService) Intent(ctx context.Context, orderId string) (_ *canonical.PaymentIntent, err error) {
+	ctx, span := tracing.Start(ctx, "PaymentService.Intent", trace.WithAttributes(ORDER_ID_ATTRIBUTE.String(orderId)))
+	defer func() { tracing.End(span, err) }()
+
+	return s.next.Intent(ctx, orderId)
+}
+
+func (s *tracedPaymentService) Authorize(ctx context.Context, paymentId string) (_ *canonical.Payment, err error) {
+	ctx, span := tracing.Start(ctx, "PaymentService.Authorize", trace.WithAttributes(PAYMENT_ID_ATTRIBUTE.String(paymentId)))
+	defer func() { tracing.End(span, err) }()
+
+	return s.next.Authorize(ctx, paymentId)
+}
+
+func (s *tracedPaymentService) Capture(ctx context.Context, paymentId string, amount int64) (_ *canonical.Payment, err error) {
+	ctx, span := tracing.Start(ctx, "PaymentService.Capture", trace.WithAttributes(
+		PAYMENT_ID_ATTRIBUTE.String(paymentId),
+		AMOUNT_ATTRIBUTE.Int64(amount),
+	))
+	defer func() { tracing.End(span, err) }()
+
+	return s.next.Capture(ctx, paymentId, amount)
+}
+
+func (s *tracedPaymentService) VoidAuthorizations(ctx context.Context, authorizedBefore time.Time) (_ []canonical.Payment, err error) {
+	ctx, span := tracing.Start(ctx, "PaymentService.VoidAuthorizations")
+	defer func() { tracing.End(span, err) }()
+
+	return s.next.VoidAuthorizations(ctx, authorizedBefore)
+}
+
+func (s *tracedPaymentService) Search(ctx context.Context, filter canonical.PaymentFilter) (_ []canonical.Payment, err error) {
+	ctx, span := tracing.Start(ctx, "PaymentService.Search")
+	defer func() { tracing.End(span, err) }()
+
+	return s.next.Search(ctx, filter)
+}
+
+func (s *tracedPaymentService) ForceStatus(ctx context.Context, paymentId string, status canonical.PaymentStatus, note string) (_ *canonical.Payment, err error) {
+	ctx, span := tracing.Start(ctx, "PaymentService.ForceStatus", trace.WithAttributes(
+		PAYMENT_ID_ATTRIBUTE.String(paymentId),
+		STATUS_ATTRIBUTE.String(status.String()),
+	))
+	defer func() { tracing.End(span, err) }()
+
+	return s.next.ForceStatus(ctx, paymentId, status, note)
+}
+
+func (s *tracedPaymentService) Republish(ctx context.Context, paymentId string) (_ *canonical.Payment, err error) {
+	ctx, span := tracing.Start(ctx, "PaymentService.Republish", trace.WithAttributes(PAYMENT_ID_ATTRIBUTE.String(paymentId)))
+	defer func() { tracing.End(span, err) }()
+
+	return s.next.Republish(ctx, paymentId)
+}
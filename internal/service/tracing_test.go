@@ -0,0 +1,48 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"tech-challenge-payment/internal/canonical"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestTracedPaymentService(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+
+	var traced trace.SpanContext
+	repoMock := new(PaymentRepositoryMock)
+	repoMock.On("GetByID", mock.Anything, "found").Run(func(args mock.Arguments) {
+		traced = trace.SpanContextFromContext(args.Get(0).(context.Context))
+	}).Return(&canonical.Payment{ID: "found"}, nil)
+	repoMock.On("GetByID", mock.Anything, "broken").Return(nil, errors.New("db error"))
+
+	svc := &tracedPaymentService{next: &paymentService{repo: repoMock}}
+
+	_, err := svc.GetByID(context.Background(), "found")
+	assert.NoError(t, err)
+	err = svc.Callback(context.Background(), "broken", canonical.PAYMENT_PAYED, nil)
+	assert.Error(t, err)
+
+	spans := recorder.Ended()
+	assert.Len(t, spans, 2)
+
+	assert.Equal(t, "PaymentService.GetByID", spans[0].Name())
+	assert.Contains(t, spans[0].Attributes(), PAYMENT_ID_ATTRIBUTE.String("found"))
+	assert.Equal(t, codes.Unset, spans[0].Status().Code)
+	// the repository runs within the span of the service
+	assert.Equal(t, spans[0].SpanContext().SpanID(), traced.SpanID())
+
+	assert.Equal(t, "PaymentService.Callback", spans[1].Name())
+	assert.Contains(t, spans[1].Attributes(), STATUS_ATTRIBUTE.String("PAYED"))
+	assert.Equal(t, codes.Error, spans[1].Status().Code)
+}
@@ -0,0 +1,213 @@
+// Package sqstest serves an in-memory stand-in of the SQS JSON API, enough for the calls the
+// service makes: sending, receiving and deleting messages and reading queue attributes.
+package sqstest
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"tech-challenge-payment/internal/canonical"
+	"time"
+)
+
+const (
+	account = "000000000000"
+	region  = "sa-east-1"
+
+	// DefaultVisibilityTimeout hides received messages from other receivers until they are deleted or it elapses.
+	DefaultVisibilityTimeout = 30 * time.Second
+)
+
+type Attribute struct {
+	DataType    string
+	StringValue string
+}
+
+type Message struct {
+	ID         string
+	Body       string
+	Attributes map[string]Attribute
+
+	receiptHandle  string
+	invisibleUntil time.Time
+}
+
+type Request struct {
+	Action        string
+	Authorization string
+}
+
+type Server struct {
+	*httptest.Server
+
+	VisibilityTimeout time.Duration
+
+	mu       sync.Mutex
+	queues   map[string][]*Message
+	requests []Request
+}
+
+// NewServer starts a fake SQS with the named queues, requests to any other queue fail as SQS does.
+func NewServer(queues ...string) *Server {
+	s := &Server{
+		VisibilityTimeout: DefaultVisibilityTimeout,
+		queues:            map[string][]*Message{},
+	}
+	for _, queue := range queues {
+		s.queues[queue] = nil
+	}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.handle))
+
+	return s
+}
+
+func (s *Server) QueueURL(queue string) string {
+	return s.URL + "/" + account + "/" + queue
+}
+
+// Send puts a message in the queue as if another service had published it.
+func (s *Server) Send(queue, body string, attributes map[string]string) string {
+	message := &Message{
+		ID:         canonical.NewUUID(),
+		Body:       body,
+		Attributes: map[string]Attribute{},
+	}
+	for key, value := range attributes {
+		message.Attributes[key] = Attribute{DataType: "String", StringValue: value}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.queues[queue] = append(s.queues[queue], message)
+
+	return message.ID
+}
+
+// Messages lists the messages not deleted from the queue yet, received or not.
+func (s *Server) Messages(queue string) []Message {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	messages := make([]Message, 0, len(s.queues[queue]))
+	for _, message := range s.queues[queue] {
+		messages = append(messages, *message)
+	}
+	return messages
+}
+
+// Requests lists the calls received so far, in order.
+func (s *Server) Requests() []Request {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return append([]Request(nil), s.requests...)
+}
+
+func (s *Server) handle(w http.ResponseWriter, r *http.Request) {
+	action := strings.TrimPrefix(r.Header.Get("X-Amz-Target"), "AmazonSQS.")
+
+	var input struct {
+		QueueUrl            string
+		MessageBody         string
+		MessageAttributes   map[string]Attribute
+		MaxNumberOfMessages int
+		ReceiptHandle       string
+	}
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		fail(w, "InvalidParameterValue", err.Error())
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.requests = append(s.requests, Request{Action: action, Authorization: r.Header.Get("Authorization")})
+
+	queue := input.QueueUrl[strings.LastIndex(input.QueueUrl, "/")+1:]
+	if _, ok := s.queues[queue]; !ok {
+		fail(w, "QueueDoesNotExist", "The specified queue does not exist.")
+		return
+	}
+
+	switch action {
+	case "SendMessage":
+		message := &Message{ID: canonical.NewUUID(), Body: input.MessageBody, Attributes: input.MessageAttributes}
+		s.queues[queue] = append(s.queues[queue], message)
+		reply(w, map[string]string{
+			"MessageId":        message.ID,
+			"MD5OfMessageBody": checksum(message.Body),
+		})
+	case "ReceiveMessage":
+		reply(w, map[string]any{"Messages": s.receive(queue, input.MaxNumberOfMessages)})
+	case "DeleteMessage":
+		s.delete(queue, input.ReceiptHandle)
+		reply(w, map[string]any{})
+	case "GetQueueAttributes":
+		reply(w, map[string]any{"Attributes": map[string]string{
+			"QueueArn": "arn:aws:sqs:" + region + ":" + account + ":" + queue,
+		}})
+	default:
+		fail(w, "UnsupportedOperation", action+" is not supported by the fake")
+	}
+}
+
+func (s *Server) receive(queue string, max int) []map[string]any {
+	if max <= 0 {
+		max = 1
+	}
+
+	now := time.Now()
+	received := []map[string]any{}
+	for _, message := range s.queues[queue] {
+		if len(received) == max {
+			break
+		}
+		if now.Before(message.invisibleUntil) {
+			continue
+		}
+
+		message.receiptHandle = canonical.NewUUID()
+		message.invisibleUntil = now.Add(s.VisibilityTimeout)
+		received = append(received, map[string]any{
+			"MessageId":         message.ID,
+			"ReceiptHandle":     message.receiptHandle,
+			"Body":              message.Body,
+			"MD5OfBody":         checksum(message.Body),
+			"MessageAttributes": message.Attributes,
+		})
+	}
+	return received
+}
+
+func (s *Server) delete(queue, receiptHandle string) {
+	messages := s.queues[queue]
+	for i, message := range messages {
+		if message.receiptHandle == receiptHandle {
+			s.queues[queue] = append(messages[:i], messages[i+1:]...)
+			return
+		}
+	}
+}
+
+func checksum(body string) string {
+	sum := md5.Sum([]byte(body))
+	return hex.EncodeToString(sum[:])
+}
+
+func reply(w http.ResponseWriter, body any) {
+	w.Header().Set("Content-Type", "application/x-amz-json-1.0")
+	_ = json.NewEncoder(w).Encode(body)
+}
+
+func fail(w http.ResponseWriter, code, message string) {
+	w.Header().Set("Content-Type", "application/x-amz-json-1.0")
+	w.WriteHeader(http.StatusBadRequest)
+	_ = json.NewEncoder(w).Encode(map[string]string{
+		"__type":  "com.amazonaws.sqs#" + code,
+		"message": message,
+	})
+}
@@ -0,0 +1,49 @@
+package tracing
+
+import (
+	"context"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/sqs"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+)
+
+// messageAttributes carries the trace context in the attributes of an SQS message, so the
+// consumer continues the trace of whoever published it.
+type messageAttributes map[string]*sqs.MessageAttributeValue
+
+func (m messageAttributes) Get(key string) string {
+	value, ok := m[key]
+	if !ok || value == nil || value.StringValue == nil {
+		return ""
+	}
+	return *value.StringValue
+}
+
+func (m messageAttributes) Set(key, value string) {
+	m[key] = &sqs.MessageAttributeValue{
+		DataType:    aws.String("String"),
+		StringValue: aws.String(value),
+	}
+}
+
+func (m messageAttributes) Keys() []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	return keys
+}
+
+var _ propagation.TextMapCarrier = messageAttributes{}
+
+// Inject writes the trace context of ctx into attributes, which must not be nil.
+func Inject(ctx context.Context, attributes map[string]*sqs.MessageAttributeValue) {
+	otel.GetTextMapPropagator().Inject(ctx, messageAttributes(attributes))
+}
+
+// Extract returns ctx carrying the trace context found in attributes, if any.
+func Extract(ctx context.Context, attributes map[string]*sqs.MessageAttributeValue) context.Context {
+	return otel.GetTextMapPropagator().Extract(ctx, messageAttributes(attributes))
+}
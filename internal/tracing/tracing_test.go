@@ -0,0 +1,99 @@
+package tracing
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/service/sqs"
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestNewExporter(t *testing.T) {
+	type Given struct {
+		kind     string
+		endpoint string
+	}
+	type Expected struct {
+		exporter bool
+		err      error
+	}
+	tests := map[string]struct {
+		given    Given
+		expected Expected
+	}{
+		"given no exporter, must disable tracing": {
+			given:    Given{kind: ""},
+			expected: Expected{exporter: false},
+		},
+		"given none exporter, must disable tracing": {
+			given:    Given{kind: EXPORTER_NONE},
+			expected: Expected{exporter: false},
+		},
+		"given stdout exporter, must create it": {
+			given:    Given{kind: EXPORTER_STDOUT},
+			expected: Expected{exporter: true},
+		},
+		"given otlp exporter, must create it": {
+			given:    Given{kind: EXPORTER_OTLP, endpoint: "http://localhost:4318"},
+			expected: Expected{exporter: true},
+		},
+		"given unknown exporter, must return error": {
+			given:    Given{kind: "zipkin"},
+			expected: Expected{err: ErrInvalidExporter},
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			exporter, err := newExporter(context.Background(), tc.given.kind, tc.given.endpoint)
+
+			assert.ErrorIs(t, err, tc.expected.err)
+			assert.Equal(t, tc.expected.exporter, exporter != nil)
+		})
+	}
+}
+
+func TestPropagation(t *testing.T) {
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	provider := sdktrace.NewTracerProvider()
+
+	ctx, span := provider.Tracer("test").Start(context.Background(), "publish")
+	defer span.End()
+
+	attributes := map[string]*sqs.MessageAttributeValue{}
+	Inject(ctx, attributes)
+
+	assert.Contains(t, attributes, "traceparent")
+	assert.Equal(t, "String", *attributes["traceparent"].DataType)
+
+	extracted := trace.SpanContextFromContext(Extract(context.Background(), attributes))
+	assert.Equal(t, span.SpanContext().TraceID(), extracted.TraceID())
+	assert.Equal(t, span.SpanContext().SpanID(), extracted.SpanID())
+	assert.True(t, extracted.IsRemote())
+
+	assert.False(t, trace.SpanContextFromContext(Extract(context.Background(), nil)).IsValid())
+}
+
+func TestEnd(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	tracer := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)).Tracer("test")
+
+	_, succeeded := tracer.Start(context.Background(), "succeeded")
+	End(succeeded, nil)
+	_, failed := tracer.Start(context.Background(), "failed")
+	End(failed, errors.New("db error"))
+
+	spans := recorder.Ended()
+	assert.Len(t, spans, 2)
+	assert.Equal(t, codes.Unset, spans[0].Status().Code)
+	assert.Equal(t, codes.Error, spans[1].Status().Code)
+	assert.Equal(t, "db error", spans[1].Status().Description)
+	assert.Len(t, spans[1].Events(), 1)
+}